@@ -0,0 +1,78 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// ErrPrivateAddress is returned when a user configured url points to an internal address
+var ErrPrivateAddress = errors.New("private, loopback and link-local addresses are not allowed")
+
+// cgnatPrefix is the shared address space of the carrier-grade NAT, RFC 6598
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// WebhookHTTPClient sends the requests to the urls configured by the users, such as the webhooks.
+//
+// The addresses are checked after the DNS resolution on each connection, so neither the redirects
+// nor the DNS rebinding could reach the internal services. The relay proxy is not used,
+// since the connection to the proxy would be checked instead of the target.
+var WebhookHTTPClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: guardDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// IsPrivateAddress returns true if the address is not reachable from the public internet
+func IsPrivateAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || cgnatPrefix.Contains(addr)
+}
+
+// ValidatePublicURL checks that the url is http or https, and its host is not a private address.
+// The host names are checked by WebhookHTTPClient when it connects.
+func ValidatePublicURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.Errorf("invalid url %q", rawURL)
+	}
+	if config.WebhookAllowPrivateNetwork {
+		return nil
+	}
+	if u.Hostname() == "localhost" {
+		return errors.WithStack(ErrPrivateAddress)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && IsPrivateAddress(addr) {
+		return errors.WithStack(ErrPrivateAddress)
+	}
+	return nil
+}
+
+// guardDialControl rejects the connection to the private addresses, the address is already resolved
+func guardDialControl(network, address string, _ syscall.RawConn) error {
+	if config.WebhookAllowPrivateNetwork {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "parse address %q", address)
+	}
+	if IsPrivateAddress(addrPort.Addr()) {
+		return errors.Wrapf(ErrPrivateAddress, "dial %s", address)
+	}
+	return nil
+}
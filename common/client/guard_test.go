@@ -0,0 +1,44 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestIsPrivateAddress(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fc00::1", "::ffff:127.0.0.1"} {
+		assert.True(t, IsPrivateAddress(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+		assert.False(t, IsPrivateAddress(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestWebhookHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// the redirects are followed through the same guarded dialer
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+
+	_, err := WebhookHTTPClient.Get(server.URL)
+	require.ErrorIs(t, err, ErrPrivateAddress)
+	assert.ErrorIs(t, ValidatePublicURL(server.URL), ErrPrivateAddress)
+
+	original := config.WebhookAllowPrivateNetwork
+	config.WebhookAllowPrivateNetwork = true
+	defer func() { config.WebhookAllowPrivateNetwork = original }()
+	resp, err := WebhookHTTPClient.Get(redirect.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, ValidatePublicURL(server.URL))
+}
@@ -205,3 +205,144 @@ var OpenrouterProviderSort = env.String("OPENROUTER_PROVIDER_SORT", "")
 
 // DefaultMaxToken is the default maximum number of tokens for requests
 var DefaultMaxToken = env.Int("DEFAULT_MAX_TOKEN", 2048)
+
+// FileStorageType is the backend of the files api, `local` or `s3`
+var FileStorageType = env.String("FILE_STORAGE_TYPE", "local")
+
+// FileStorageLocalDir is the directory to save uploaded files when FileStorageType is `local`
+var FileStorageLocalDir = env.String("FILE_STORAGE_LOCAL_DIR", "./data/files")
+
+// FileStorageS3Endpoint is the endpoint of the S3 compatible storage, like `https://s3.us-east-1.amazonaws.com`
+// or `http://localhost:9000` for minio
+var FileStorageS3Endpoint = env.String("FILE_STORAGE_S3_ENDPOINT", "")
+var FileStorageS3Region = env.String("FILE_STORAGE_S3_REGION", "us-east-1")
+var FileStorageS3Bucket = env.String("FILE_STORAGE_S3_BUCKET", "")
+var FileStorageS3AccessKey = env.String("FILE_STORAGE_S3_ACCESS_KEY", "")
+var FileStorageS3SecretKey = env.String("FILE_STORAGE_S3_SECRET_KEY", "")
+
+// MaxUploadFileSize is the maximum size of a file uploaded to the files api, unit is MB
+var MaxUploadFileSize = env.Int("MAX_UPLOAD_FILE_SIZE", 512)
+
+// BatchConcurrency is the maximum number of batch requests running at the same time
+var BatchConcurrency = env.Int("BATCH_CONCURRENCY", 8)
+
+// BatchDiscountRatio is multiplied to the quota of the requests in batches
+var BatchDiscountRatio = env.Float64("BATCH_DISCOUNT_RATIO", 0.5)
+
+// BatchPollInterval is the interval to pick up pending batches and sync native batches, unit is second
+var BatchPollInterval = env.Int("BATCH_POLL_INTERVAL", 10)
+
+// BatchNativeForwardEnabled forwards batches to OpenAI/Azure channels that support batches natively,
+// instead of running the requests by one-api itself
+var BatchNativeForwardEnabled = env.Bool("BATCH_NATIVE_FORWARD_ENABLED", false)
+
+// TaskPollInterval is the interval to poll the running asynchronous tasks from the upstream, unit is second
+var TaskPollInterval = env.Int("TASK_POLL_INTERVAL", 15)
+
+// TaskPollConcurrency is the maximum number of tasks polled at the same time
+var TaskPollConcurrency = env.Int("TASK_POLL_CONCURRENCY", 8)
+
+// TaskTimeout fails the tasks still running after the timeout and refunds their quota, unit is second
+var TaskTimeout = env.Int("TASK_TIMEOUT", 86400)
+
+// VideoMaxSeconds is the maximum duration of the videos requested by the clients, unit is second
+var VideoMaxSeconds = env.Int("VIDEO_MAX_SECONDS", 60)
+
+// RealtimeAllowedOrigins are the origins of the web pages allowed to open realtime sessions separated by comma,
+// besides the same origin and ServerAddress, "*" allows all
+var RealtimeAllowedOrigins = env.String("REALTIME_ALLOWED_ORIGINS", "")
+
+// ResponseCacheEnabled caches the responses of embeddings and deterministic (temperature 0) chat completions
+var ResponseCacheEnabled = env.Bool("RESPONSE_CACHE_ENABLED", false)
+
+// ResponseCacheTTL is the default time to live of the cached responses, unit is second
+var ResponseCacheTTL = env.Int("RESPONSE_CACHE_TTL", 3600)
+
+// ResponseCacheRatio is multiplied to the quota of the requests served by the response cache
+var ResponseCacheRatio = env.Float64("RESPONSE_CACHE_RATIO", 0.1)
+
+// ResponseCacheMemoryMaxEntries is the maximum number of cached responses kept in memory when redis is disabled
+var ResponseCacheMemoryMaxEntries = env.Int("RESPONSE_CACHE_MEMORY_MAX_ENTRIES", 10000)
+
+// LoadBalancingStrategy is the default strategy to pick a channel among the channels of the same priority,
+// could be overridden by group or model, see relay/balancer
+var LoadBalancingStrategy = env.String("LOAD_BALANCING_STRATEGY", "random")
+
+// CircuitBreakerEnabled enables the circuit breaker of each channel and model
+var CircuitBreakerEnabled = env.Bool("CIRCUIT_BREAKER_ENABLED", false)
+
+// CircuitBreakerErrorRate opens the breaker if the error rate in the window reaches it, 0 means disabled
+var CircuitBreakerErrorRate = env.Float64("CIRCUIT_BREAKER_ERROR_RATE", 0.5)
+
+// CircuitBreakerMinRequests is the minimum number of requests in the window to evaluate the error rate
+var CircuitBreakerMinRequests = env.Int("CIRCUIT_BREAKER_MIN_REQUESTS", 20)
+
+// CircuitBreakerWindow is the window to calculate the error rate, unit is second
+var CircuitBreakerWindow = env.Int("CIRCUIT_BREAKER_WINDOW", 60)
+
+// CircuitBreakerConsecutiveFailures opens the breaker after these consecutive failures, 0 means disabled
+var CircuitBreakerConsecutiveFailures = env.Int("CIRCUIT_BREAKER_CONSECUTIVE_FAILURES", 5)
+
+// CircuitBreakerOpenSeconds is how long the breaker stays open before probing the channel
+var CircuitBreakerOpenSeconds = env.Int("CIRCUIT_BREAKER_OPEN_SECONDS", 30)
+
+// CircuitBreakerHalfOpenRequests is the number of requests let through while half-open,
+// the breaker is closed once all of them succeed
+var CircuitBreakerHalfOpenRequests = env.Int("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", 3)
+
+// BudgetTimezone is the timezone in which the daily, weekly and monthly budgets are reset,
+// e.g. Asia/Shanghai, empty means the local timezone of the server
+var BudgetTimezone = env.String("BUDGET_TIMEZONE", "")
+
+// StatisticsTimezone is the timezone of the days, weeks and months the logs are bucketed into
+// by the analytics, the statistics and the daily rollups, e.g. Asia/Shanghai, empty means the local timezone of the server
+var StatisticsTimezone = env.String("STATISTICS_TIMEZONE", "")
+
+// AuditLogWebhookURL receives each audit log as JSON by POST, empty means the audit logs are not exported
+var AuditLogWebhookURL = env.String("AUDIT_LOG_WEBHOOK_URL", "")
+
+// SecretMasterKey is the master key to encrypt the channel keys and the secret options saved in the database,
+// it should be a long random string, empty means the secrets are saved in plaintext
+var SecretMasterKey = env.String("SECRET_MASTER_KEY", "")
+
+// SecretMasterKeyFile is the file of the master key, it's used if SecretMasterKey is empty
+var SecretMasterKeyFile = env.String("SECRET_MASTER_KEY_FILE", "")
+
+// SecretOldMasterKeys are the previous master keys separated by comma, which are only used to decrypt
+// the secrets during the key rotation
+var SecretOldMasterKeys = env.String("SECRET_OLD_MASTER_KEYS", "")
+
+// WebhookMaxRetries is the times to retry a failed webhook delivery, with an exponential backoff
+var WebhookMaxRetries = env.Int("WEBHOOK_MAX_RETRIES", 3)
+
+// WebhookAllowPrivateNetwork allows the webhooks configured by the users to reach the private,
+// loopback and link-local addresses, it should only be enabled if all the users are trusted.
+var WebhookAllowPrivateNetwork = env.Bool("WEBHOOK_ALLOW_PRIVATE_NETWORK", false)
+
+// NotificationCheckInterval is the interval in seconds to check the expiring tokens and the budgets to notify the users
+var NotificationCheckInterval = env.Int("NOTIFICATION_CHECK_INTERVAL", 600)
+
+// LogSinkType ships each consume log to an external sink, one of file, http and kafka, empty means disabled
+var LogSinkType = env.String("LOG_SINK_TYPE", "")
+
+// LogSinkURL is the file path of the file sink, the collector url of the http sink,
+// or the url of the Kafka REST proxy of the kafka sink
+var LogSinkURL = env.String("LOG_SINK_URL", "")
+
+// LogSinkKafkaTopic is the topic the kafka sink produces to
+var LogSinkKafkaTopic = env.String("LOG_SINK_KAFKA_TOPIC", "one-api-logs")
+
+// LogSinkAuthorization is sent as the Authorization header by the http and kafka sinks, empty means no header
+var LogSinkAuthorization = env.String("LOG_SINK_AUTHORIZATION", "")
+
+// LogSinkBufferDir buffers the logs on disk until they are shipped, so they are delivered at least once
+var LogSinkBufferDir = env.String("LOG_SINK_BUFFER_DIR", "log-sink")
+
+// LogSinkBatchSize is the maximum number of logs shipped at a time
+var LogSinkBatchSize = env.Int("LOG_SINK_BATCH_SIZE", 500)
+
+// LogSinkFlushInterval is the interval in seconds to ship the buffered logs, and to retry after a failure
+var LogSinkFlushInterval = env.Int("LOG_SINK_FLUSH_INTERVAL", 5)
+
+// LogRollupInterval is the interval in seconds to aggregate the new logs into the hourly and daily rollups
+var LogRollupInterval = env.Int("LOG_ROLLUP_INTERVAL", 60)
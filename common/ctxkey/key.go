@@ -32,4 +32,23 @@ const (
 	SystemPrompt        = "system_prompt"
 	Meta                = "meta"
 	RateLimit           = "rate_limit"
+	// QuotaDiscount is multiplied to the channel ratio, such as the discount of batches
+	QuotaDiscount = "quota_discount"
+	// ResponseId is the id of the response returned by the upstream Response API
+	ResponseId = "response_id"
+	// ResponseCacheDisabled and ResponseCacheTTL are the response cache settings of the token
+	ResponseCacheDisabled = "response_cache_disabled"
+	ResponseCacheTTL      = "response_cache_ttl"
+	// HedgeDelay is the hedge delay of the token in milliseconds
+	HedgeDelay = "hedge_delay"
+	// TokenRateLimitRPM, TokenRateLimitTPM and TokenMaxConcurrency are the rate limits of the token
+	TokenRateLimitRPM   = "token_rate_limit_rpm"
+	TokenRateLimitTPM   = "token_rate_limit_tpm"
+	TokenMaxConcurrency = "token_max_concurrency"
+	// OrganizationId is the organization owns the token, 0 if the token is owned by the user
+	OrganizationId = "organization_id"
+	// ChannelKeyId is the id of the key state of the multi-key channel, 0 if the channel has a single key
+	ChannelKeyId = "channel_key_id"
+	// ChannelError is the error of setting up the selected channel, e.g. the key can't be decrypted
+	ChannelError = "channel_error"
 )
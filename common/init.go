@@ -22,7 +22,7 @@ func printHelp() {
 	fmt.Println("One API " + Version + " - All in one API service for OpenAI API.")
 	fmt.Println("Copyright (C) 2025 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/Laisky/one-api")
-	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help] [reencrypt-secrets] [backfill-rollups]")
 }
 
 func Init() {
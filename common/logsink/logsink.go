@@ -0,0 +1,65 @@
+// Package logsink ships the consume logs to an external sink, which is a file, an HTTP collector, or a Kafka-compatible broker.
+// The logs are buffered on disk first, so they are delivered at least once.
+package logsink
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var defaultSpool *Spool
+
+// Init opens the spool and starts shipping the logs in background if LogSinkType is set
+func Init() error {
+	if config.LogSinkType == "" {
+		return nil
+	}
+	sink, err := NewSink(config.LogSinkType, config.LogSinkURL, config.LogSinkKafkaTopic, config.LogSinkAuthorization)
+	if err != nil {
+		return err
+	}
+	spool, err := OpenSpool(config.LogSinkBufferDir)
+	if err != nil {
+		return err
+	}
+	defaultSpool = spool
+	go run(spool, sink)
+	logger.SysLogf("log sink enabled, shipping the logs to the %s sink", config.LogSinkType)
+	return nil
+}
+
+// Enabled returns true if the logs are shipped to a sink
+func Enabled() bool {
+	return defaultSpool != nil
+}
+
+// Append buffers the log to be shipped, it does nothing if the sink is disabled
+func Append(record any) {
+	if defaultSpool == nil {
+		return
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		logger.SysError("failed to marshal log for sink: " + err.Error())
+		return
+	}
+	if err = defaultSpool.Append(body); err != nil {
+		logger.SysError("failed to buffer log for sink: " + err.Error())
+	}
+}
+
+func run(spool *Spool, sink Sink) {
+	ctx := context.Background()
+	interval := time.Duration(max(config.LogSinkFlushInterval, 1)) * time.Second
+	batchSize := max(config.LogSinkBatchSize, 1)
+	for {
+		time.Sleep(interval)
+		if err := spool.Flush(ctx, sink, batchSize); err != nil {
+			logger.SysError("failed to ship logs to sink, will retry later: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+// The types of the sinks
+const (
+	TypeFile  = "file"
+	TypeHTTP  = "http"
+	TypeKafka = "kafka"
+)
+
+// Sink receives the records, each of which is a JSON object.
+// A batch is retried as a whole on error, so the sink may receive a record more than once.
+type Sink interface {
+	Send(ctx context.Context, records []json.RawMessage) error
+}
+
+// NewSink returns the sink of the type, target is the file path of the file sink,
+// the collector url of the http sink, or the url of the Kafka REST proxy of the kafka sink.
+func NewSink(sinkType string, target string, topic string, authorization string) (Sink, error) {
+	if target == "" {
+		return nil, errors.Errorf("the target of the %s sink is not set", sinkType)
+	}
+	switch sinkType {
+	case TypeFile:
+		return &FileSink{Path: target}, nil
+	case TypeHTTP:
+		return &HTTPSink{URL: target, Authorization: authorization}, nil
+	case TypeKafka:
+		if topic == "" {
+			return nil, errors.New("the topic of the kafka sink is not set")
+		}
+		return &KafkaSink{URL: target, Topic: topic, Authorization: authorization}, nil
+	default:
+		return nil, errors.Errorf("unknown sink type %q, should be one of file, http and kafka", sinkType)
+	}
+}
+
+// FileSink appends the records to a file as JSON lines
+type FileSink struct {
+	Path string
+}
+
+func (s *FileSink) Send(_ context.Context, records []json.RawMessage) error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "open sink file")
+	}
+	if _, err = f.Write(jsonLines(records)); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "write sink file")
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "sync sink file")
+	}
+	return f.Close()
+}
+
+// HTTPSink posts the records to a collector as JSON lines, with the content type application/x-ndjson
+type HTTPSink struct {
+	URL           string
+	Authorization string
+}
+
+func (s *HTTPSink) Send(ctx context.Context, records []json.RawMessage) error {
+	return post(ctx, s.URL, "application/x-ndjson", s.Authorization, jsonLines(records))
+}
+
+// KafkaSink produces the records to a topic by the REST proxy of Kafka, which is also served by Redpanda,
+// so the sink works with any Kafka-compatible broker without a native client.
+type KafkaSink struct {
+	URL           string
+	Topic         string
+	Authorization string
+}
+
+type kafkaRecord struct {
+	Value json.RawMessage `json:"value"`
+}
+
+func (s *KafkaSink) Send(ctx context.Context, records []json.RawMessage) error {
+	kafkaRecords := make([]kafkaRecord, 0, len(records))
+	for _, record := range records {
+		kafkaRecords = append(kafkaRecords, kafkaRecord{Value: record})
+	}
+	body, err := json.Marshal(map[string]any{"records": kafkaRecords})
+	if err != nil {
+		return errors.Wrap(err, "marshal kafka records")
+	}
+	endpoint := strings.TrimSuffix(s.URL, "/") + "/topics/" + url.PathEscape(s.Topic)
+	return post(ctx, endpoint, "application/vnd.kafka.json.v2+json", s.Authorization, body)
+}
+
+func jsonLines(records []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func post(ctx context.Context, url string, contentType string, authorization string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new sink request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	httpClient := client.ImpatientHTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "send sink request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return errors.Errorf("sink returns status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
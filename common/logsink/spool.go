@@ -0,0 +1,233 @@
+package logsink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+const (
+	segmentSuffix = ".jsonl"
+	offsetSuffix  = ".offset"
+	// maxSegmentBytes seals the active segment once it's larger, so a segment is shipped in bounded time
+	maxSegmentBytes = 16 << 20
+)
+
+// Spool buffers the records on disk as segments of JSON lines.
+// The records are appended to the active segment, which is sealed before shipping.
+// A sealed segment is removed after all its records are sent, and the sent offset is saved after each batch,
+// so the records are delivered at least once even if the process restarts.
+type Spool struct {
+	dir string
+
+	mu     sync.Mutex
+	active *os.File
+	size   int64
+	seq    uint64
+}
+
+// OpenSpool opens the spool in the dir, the segments left by the last run are shipped first
+func OpenSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "create spool dir")
+	}
+	spool := &Spool{dir: dir}
+	seqs, err := spool.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) > 0 {
+		spool.seq = seqs[len(seqs)-1]
+	}
+	return spool, nil
+}
+
+// Append writes a record to the active segment, the record should be a JSON object without new lines
+func (s *Spool) Append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		f, err := os.OpenFile(s.segmentPath(s.seq+1), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "create spool segment")
+		}
+		s.active, s.size = f, 0
+		s.seq++
+	}
+	n, err := s.active.Write(append(record, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "write spool segment")
+	}
+	if s.size >= maxSegmentBytes {
+		return s.sealLocked()
+	}
+	return nil
+}
+
+// seal closes the active segment, so it could be shipped
+func (s *Spool) seal() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sealLocked()
+}
+
+func (s *Spool) sealLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Sync()
+	if closeErr := s.active.Close(); err == nil {
+		err = closeErr
+	}
+	s.active = nil
+	return errors.Wrap(err, "seal spool segment")
+}
+
+// Flush seals the active segment and ships all the sealed segments in order,
+// it stops at the first failure and the rest are shipped next time.
+func (s *Spool) Flush(ctx context.Context, sink Sink, batchSize int) error {
+	if err := s.seal(); err != nil {
+		return err
+	}
+	seqs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		s.mu.Lock()
+		isActive := s.active != nil && seq == s.seq
+		s.mu.Unlock()
+		if isActive {
+			// appended after sealed
+			break
+		}
+		if err := s.ship(ctx, sink, seq, batchSize); err != nil {
+			return errors.Wrapf(err, "ship spool segment %d", seq)
+		}
+	}
+	return nil
+}
+
+// ship sends the records of a sealed segment from the saved offset, and removes it when all are sent
+func (s *Spool) ship(ctx context.Context, sink Sink, seq uint64, batchSize int) error {
+	path := s.segmentPath(seq)
+	offset, err := s.readOffset(seq)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open spool segment")
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "seek spool segment")
+	}
+
+	reader := bufio.NewReader(f)
+	var batch []json.RawMessage
+	var batchBytes int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return errors.Wrap(readErr, "read spool segment")
+		}
+		// a line without the new line is left by a crash during writing, which is dropped
+		if readErr == nil {
+			batchBytes += int64(len(line))
+			if record := bytes.TrimSpace(line); len(record) > 0 {
+				batch = append(batch, json.RawMessage(record))
+			}
+		}
+		if len(batch) > 0 && (len(batch) >= batchSize || readErr == io.EOF) {
+			if err = sink.Send(ctx, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		if batchBytes > 0 && (len(batch) == 0 || readErr == io.EOF) {
+			offset += batchBytes
+			batchBytes = 0
+			if err = s.writeOffset(seq, offset); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if err = os.Remove(path); err != nil {
+		return errors.Wrap(err, "remove spool segment")
+	}
+	if err = os.Remove(s.offsetPath(seq)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove spool offset")
+	}
+	return nil
+}
+
+// segments returns the sequences of the segments in the spool, in ascending order
+func (s *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read spool dir")
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (s *Spool) offsetPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, offsetSuffix))
+}
+
+func (s *Spool) readOffset(seq uint64) (int64, error) {
+	content, err := os.ReadFile(s.offsetPath(seq))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "read spool offset")
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse spool offset")
+	}
+	return offset, nil
+}
+
+// writeOffset saves the offset by renaming, so the offset is never partially written
+func (s *Spool) writeOffset(seq uint64, offset int64) error {
+	tmp := s.offsetPath(seq) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o644); err != nil {
+		return errors.Wrap(err, "write spool offset")
+	}
+	return errors.Wrap(os.Rename(tmp, s.offsetPath(seq)), "save spool offset")
+}
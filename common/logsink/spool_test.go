@@ -0,0 +1,97 @@
+package logsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps the records, and fails after failAfter batches if it's positive
+type memorySink struct {
+	records   []string
+	batches   int
+	failAfter int
+}
+
+func (s *memorySink) Send(_ context.Context, records []json.RawMessage) error {
+	if s.failAfter > 0 && s.batches >= s.failAfter {
+		return errors.New("sink is down")
+	}
+	s.batches++
+	for _, record := range records {
+		s.records = append(s.records, string(record))
+	}
+	return nil
+}
+
+func TestSpoolFlush(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir)
+	require.NoError(t, err)
+	for i := range 5 {
+		require.NoError(t, spool.Append([]byte(fmt.Sprintf(`{"id":%d}`, i))))
+	}
+
+	// the sink fails after the first batch, the sent records are not sent again
+	sink := &memorySink{failAfter: 1}
+	require.Error(t, spool.Flush(ctx, sink, 2))
+	assert.Equal(t, []string{`{"id":0}`, `{"id":1}`}, sink.records)
+
+	// the records appended meanwhile are kept in a new segment
+	require.NoError(t, spool.Append([]byte(`{"id":5}`)))
+
+	// the spool is reopened as the process restarts
+	spool, err = OpenSpool(dir)
+	require.NoError(t, err)
+	sink.failAfter = 0
+	require.NoError(t, spool.Flush(ctx, sink, 2))
+	assert.Equal(t, []string{`{"id":0}`, `{"id":1}`, `{"id":2}`, `{"id":3}`, `{"id":4}`, `{"id":5}`}, sink.records)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSpoolDropsPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	// the last line is left by a crash during writing
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001.jsonl"),
+		[]byte("{\"id\":1}\n{\"id\""), 0o644))
+	spool, err := OpenSpool(dir)
+	require.NoError(t, err)
+	sink := new(memorySink)
+	require.NoError(t, spool.Flush(context.Background(), sink, 10))
+	assert.Equal(t, []string{`{"id":1}`}, sink.records)
+}
+
+func TestKafkaSink(t *testing.T) {
+	var body map[string][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/one-api-logs", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		content, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(content, &body))
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(TypeKafka, server.URL+"/", "one-api-logs", "Bearer secret")
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), []json.RawMessage{json.RawMessage(`{"id":1}`)}))
+	require.Len(t, body["records"], 1)
+	assert.EqualValues(t, map[string]any{"id": float64(1)}, body["records"][0]["value"])
+
+	_, err = NewSink("syslog", server.URL, "", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+// The chat apps supported by SendIncomingWebhook
+const (
+	IncomingWebhookSlack    = "slack"
+	IncomingWebhookLark     = "lark"
+	IncomingWebhookDingTalk = "dingtalk"
+)
+
+// IsValidIncomingWebhookType returns true if the incoming webhook type is supported
+func IsValidIncomingWebhookType(webhookType string) bool {
+	switch webhookType {
+	case IncomingWebhookSlack, IncomingWebhookLark, IncomingWebhookDingTalk:
+		return true
+	default:
+		return false
+	}
+}
+
+// incomingWebhookResponse covers the error fields of lark and dingtalk, which return errors with status 200
+type incomingWebhookResponse struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// SendIncomingWebhook sends a text message to the incoming webhook of slack, lark or dingtalk,
+// the slack-compatible apps like mattermost and discord (with the /slack suffix) are also supported.
+func SendIncomingWebhook(ctx context.Context, webhookType string, url string, title string, content string) error {
+	text := title + "\n" + content
+	var payload any
+	switch webhookType {
+	case IncomingWebhookSlack:
+		payload = map[string]any{"text": "*" + title + "*\n" + content}
+	case IncomingWebhookLark:
+		payload = map[string]any{"msg_type": "text", "content": map[string]any{"text": text}}
+	case IncomingWebhookDingTalk:
+		payload = map[string]any{"msgtype": "text", "text": map[string]any{"content": text}}
+	default:
+		return errors.Errorf("unknown incoming webhook type %q", webhookType)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshal incoming webhook message")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new incoming webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the incoming webhooks are configured by the users, so the internal addresses are rejected
+	resp, err := client.WebhookHTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "send incoming webhook request")
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("incoming webhook returns status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var result incomingWebhookResponse
+	if json.Unmarshal(respBody, &result) == nil {
+		if result.Code != 0 {
+			return errors.Errorf("incoming webhook returns error %d: %s", result.Code, result.Msg)
+		}
+		if result.ErrCode != 0 {
+			return errors.Errorf("incoming webhook returns error %d: %s", result.ErrCode, result.ErrMsg)
+		}
+	}
+	return nil
+}
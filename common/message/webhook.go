@@ -0,0 +1,63 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+)
+
+// The headers of the webhook requests
+const (
+	WebhookHeaderEvent     = "X-One-API-Event"
+	WebhookHeaderDelivery  = "X-One-API-Delivery"
+	WebhookHeaderTimestamp = "X-One-API-Timestamp"
+	WebhookHeaderSignature = "X-One-API-Signature"
+)
+
+// SignWebhook signs the webhook body with HMAC-SHA256 of "<timestamp>.<body>",
+// the receivers should compare it with the signature header in constant time and reject the stale timestamps.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SendWebhook posts the signed JSON body to the webhook, it returns the status code of the response,
+// and an error if the request fails or the status code isn't 2xx.
+func SendWebhook(ctx context.Context, url string, secret string, event string, deliveryId string,
+	timestamp int64, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "new webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEvent, event)
+	req.Header.Set(WebhookHeaderDelivery, deliveryId)
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if secret != "" {
+		req.Header.Set(WebhookHeaderSignature, SignWebhook(secret, timestamp, body))
+	}
+
+	// the webhooks are configured by the users, so the internal addresses are rejected
+	resp, err := client.WebhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "send webhook request")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, errors.Errorf("webhook returns status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
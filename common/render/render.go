@@ -29,3 +29,9 @@ func ObjectData(c *gin.Context, object interface{}) error {
 func Done(c *gin.Context) {
 	StringData(c, "[DONE]")
 }
+
+// EventData writes a named server-sent event, such as the events of the Anthropic Messages API
+func EventData(c *gin.Context, event string, data string) {
+	_, _ = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data)
+	c.Writer.Flush()
+}
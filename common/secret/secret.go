@@ -0,0 +1,218 @@
+// Package secret encrypts the secrets saved in the database, e.g. the channel keys, by envelope encryption.
+//
+// Each secret is encrypted by its own random data key with AES-256-GCM, and the data key is wrapped
+// by the master key, which is loaded from SECRET_MASTER_KEY or SECRET_MASTER_KEY_FILE and never saved.
+// The encrypted secret is saved as
+//
+//	enc:v1:<master key id>:<wrapped data key>:<ciphertext>
+//
+// To rotate the master key, set the new one as the master key, move the old one to SECRET_OLD_MASTER_KEYS,
+// and run `one-api reencrypt-secrets` to re-encrypt the existing secrets with the new master key.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	prefix      = "enc:v1:"
+	dataKeySize = 32
+)
+
+var encoding = base64.RawStdEncoding
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var (
+	currentKey *masterKey
+	masterKeys = map[string]*masterKey{}
+)
+
+// Init loads the master keys from the config, the secrets are saved in plaintext if no master key is set
+func Init() error {
+	current := config.SecretMasterKey
+	if current == "" && config.SecretMasterKeyFile != "" {
+		data, err := os.ReadFile(config.SecretMasterKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "read master key file")
+		}
+		current = strings.TrimSpace(string(data))
+	}
+	var old []string
+	for _, key := range strings.Split(config.SecretOldMasterKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			old = append(old, key)
+		}
+	}
+	return SetMasterKeys(current, old...)
+}
+
+// SetMasterKeys sets the master key to encrypt the secrets, and the old master keys only to decrypt them
+func SetMasterKeys(current string, old ...string) error {
+	currentKey = nil
+	masterKeys = map[string]*masterKey{}
+	for _, material := range old {
+		key, err := newMasterKey(material)
+		if err != nil {
+			return err
+		}
+		masterKeys[key.id] = key
+	}
+	if current == "" {
+		if len(old) > 0 {
+			return errors.New("old master keys are set without the master key")
+		}
+		return nil
+	}
+	key, err := newMasterKey(current)
+	if err != nil {
+		return err
+	}
+	currentKey = key
+	masterKeys[key.id] = key
+	return nil
+}
+
+// newMasterKey derives an AES-256 key from the key material, which should be a long random string
+func newMasterKey(material string) (*masterKey, error) {
+	sum := sha256.Sum256([]byte(material))
+	aead, err := newAEAD(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(sum[:])
+	return &masterKey{id: hex.EncodeToString(id[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "new gcm")
+	}
+	return aead, nil
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
+
+// Enabled returns true if the master key is set
+func Enabled() bool {
+	return currentKey != nil
+}
+
+// IsEncrypted returns true if the value is an encrypted secret
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts the secret with the master key, the empty and the encrypted values are kept,
+// and the secret is returned as is if the master key is not set.
+func Encrypt(plaintext string) (string, error) {
+	if !Enabled() || plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", errors.Wrap(err, "generate data key")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(currentKey.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return prefix + currentKey.id + ":" + encoding.EncodeToString(wrappedKey) + ":" +
+		encoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts the secret, the values not encrypted are returned as is
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted secret")
+	}
+	key, ok := masterKeys[parts[0]]
+	if !ok {
+		return "", errors.Errorf("master key %s of the secret is not set", parts[0])
+	}
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.Wrap(err, "decode data key")
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.Wrap(err, "decode ciphertext")
+	}
+	dataKey, err := open(key.aead, wrappedKey)
+	if err != nil {
+		return "", errors.Wrap(err, "unwrap data key")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypt secret")
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReencrypt returns true if the value is in plaintext or encrypted by an old master key
+func NeedsReencrypt(value string) bool {
+	if !Enabled() || value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+currentKey.id+":")
+}
+
+// Reencrypt encrypts the value with the current master key, whether it's in plaintext or encrypted by an old one
+func Reencrypt(value string) (string, error) {
+	if !NeedsReencrypt(value) {
+		return value, nil
+	}
+	plaintext, err := Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(plaintext)
+}
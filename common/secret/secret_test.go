@@ -0,0 +1,76 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	t.Cleanup(func() { _ = SetMasterKeys("") })
+
+	// the secrets are kept in plaintext without the master key
+	value, err := Encrypt("sk-plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", value)
+
+	require.NoError(t, SetMasterKeys("master-key-1"))
+	encrypted, err := Encrypt("sk-secret")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "sk-secret")
+
+	another, err := Encrypt("sk-secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, another, "each secret should have its own data key")
+
+	again, err := Encrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, again, "encrypted secrets should not be encrypted twice")
+
+	plaintext, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", plaintext)
+
+	plaintext, err = Decrypt("sk-plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", plaintext)
+
+	tampered := encrypted[:len(encrypted)-2] + strings.Repeat("A", 2)
+	_, err = Decrypt(tampered)
+	assert.Error(t, err)
+
+	require.NoError(t, SetMasterKeys("another-master-key"))
+	_, err = Decrypt(encrypted)
+	assert.Error(t, err)
+}
+
+func TestRotateMasterKey(t *testing.T) {
+	t.Cleanup(func() { _ = SetMasterKeys("") })
+
+	require.NoError(t, SetMasterKeys("master-key-1"))
+	encrypted, err := Encrypt("sk-secret")
+	require.NoError(t, err)
+	assert.False(t, NeedsReencrypt(encrypted))
+	assert.True(t, NeedsReencrypt("sk-plain"))
+
+	require.NoError(t, SetMasterKeys("master-key-2", "master-key-1"))
+	assert.True(t, NeedsReencrypt(encrypted))
+	plaintext, err := Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", plaintext)
+
+	reencrypted, err := Reencrypt(encrypted)
+	require.NoError(t, err)
+	assert.False(t, NeedsReencrypt(reencrypted))
+
+	// the old master key could be dropped after the secrets are re-encrypted
+	require.NoError(t, SetMasterKeys("master-key-2"))
+	plaintext, err = Decrypt(reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", plaintext)
+
+	assert.Error(t, SetMasterKeys("", "master-key-1"))
+}
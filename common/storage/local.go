@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Local saves objects in the local filesystem
+type Local struct {
+	dir string
+}
+
+// NewLocal creates a local storage rooted at dir
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("local storage dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "create storage dir %s", dir)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (s *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the body to a temporary file first,
+// so readers never see a partially written object
+func (s *Local) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	fpath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fpath), 0o750); err != nil {
+		return errors.Wrap(err, "create object dir")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "create temp file")
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "write object")
+	}
+	if size >= 0 && written != size {
+		return errors.Errorf("object size mismatch, expect %d, got %d", size, written)
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), fpath), "rename object")
+}
+
+func (s *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	fpath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "open object")
+	}
+	return f, nil
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	fpath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove object")
+	}
+	return nil
+}
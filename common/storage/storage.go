@@ -0,0 +1,74 @@
+// Package storage saves the blobs uploaded by users, such as the files of the files api.
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// ErrNotFound is returned when the object does not exist in the storage
+var ErrNotFound = errors.New("object not found")
+
+// Storage is a blob storage
+type Storage interface {
+	// Put saves the body with the key, size is the length of the body
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+	// Get returns the content of the key, the caller should close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the key, it is not an error if the key does not exist
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultStorage Storage
+	defaultErr     error
+)
+
+// Default returns the storage configured by FILE_STORAGE_TYPE
+func Default() (Storage, error) {
+	defaultOnce.Do(func() {
+		defaultStorage, defaultErr = New(config.FileStorageType)
+	})
+	return defaultStorage, defaultErr
+}
+
+// New creates a storage by type, `local` or `s3`
+func New(storageType string) (Storage, error) {
+	switch strings.ToLower(storageType) {
+	case "", "local":
+		return NewLocal(config.FileStorageLocalDir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  config.FileStorageS3Endpoint,
+			Region:    config.FileStorageS3Region,
+			Bucket:    config.FileStorageS3Bucket,
+			AccessKey: config.FileStorageS3AccessKey,
+			SecretKey: config.FileStorageS3SecretKey,
+		})
+	default:
+		return nil, errors.Errorf("unknown storage type %q", storageType)
+	}
+}
+
+// validateKey rejects keys that could escape from the storage root
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+	if strings.HasPrefix(key, "/") {
+		return errors.Errorf("key %q should not be absolute", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return errors.Errorf("invalid key %q", key)
+		}
+	}
+	return nil
+}
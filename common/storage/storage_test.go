@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocal(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(ctx, "files/1/file-abc", strings.NewReader("hello"), 5))
+
+	r, err := s.Get(ctx, "files/1/file-abc")
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "hello", string(content))
+
+	// size mismatch should not leave a partial object
+	err = s.Put(ctx, "files/1/file-bad", strings.NewReader("hello"), 10)
+	require.Error(t, err)
+	_, err = s.Get(ctx, "files/1/file-bad")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	require.NoError(t, s.Delete(ctx, "files/1/file-abc"))
+	require.NoError(t, s.Delete(ctx, "files/1/file-abc"))
+	_, err = s.Get(ctx, "files/1/file-abc")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b"} {
+		assert.Error(t, validateKey(key), key)
+	}
+	assert.NoError(t, validateKey("files/1/file-abc"))
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ak/"))
+		assert.Equal(t, unsignedPayload, r.Header.Get("X-Amz-Content-Sha256"))
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s, err := NewS3(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "bucket",
+		AccessKey: "ak",
+		SecretKey: "sk",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(ctx, "files/1/file-abc", strings.NewReader("hello"), 5))
+	assert.Equal(t, "hello", objects["/bucket/files/1/file-abc"])
+
+	r, err := s.Get(ctx, "files/1/file-abc")
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "hello", string(content))
+
+	require.NoError(t, s.Delete(ctx, "files/1/file-abc"))
+	_, err = s.Get(ctx, "files/1/file-abc")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// recordAudit records an administrative action of the current user to the audit logs,
+// before and after are the target before and after the action, nil means the target doesn't exist.
+func recordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	ctx := c.Request.Context()
+	diff, err := model.AuditDiff(before, after)
+	if err != nil {
+		logger.Errorf(ctx, "failed to diff audit log of %s: %+v", action, err)
+		diff = "{}"
+	}
+	model.RecordAuditLog(ctx, &model.AuditLog{
+		ActorId:    c.GetInt(ctxkey.Id),
+		ActorName:  c.GetString(ctxkey.Username),
+		Ip:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Diff:       diff,
+	})
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	itemsPerPage, err := strconv.Atoi(c.Query("items_per_page"))
+	if err != nil {
+		itemsPerPage = config.DefaultItemsPerPage
+	}
+	if itemsPerPage > config.MaxItemsPerPage {
+		itemsPerPage = config.MaxItemsPerPage
+	}
+	filter := model.AuditLogFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetId:   c.Query("target_id"),
+	}
+	filter.ActorId, _ = strconv.Atoi(c.Query("actor_id"))
+	filter.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	filter.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+
+	logs, err := model.GetAuditLogs(filter, p*itemsPerPage, itemsPerPage)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+	})
+}
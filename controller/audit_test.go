@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestGetChannelKeyAudited(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	channel := &model.Channel{Name: "audited", Key: "sk-secret-key", Status: model.ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.Insert())
+
+	router := setupTestRouter()
+	router.GET("/channel/:id/key", func(c *gin.Context) {
+		c.Set("id", 1)
+		GetChannelKey(c)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/channel/"+strconv.Itoa(channel.Id)+"/key", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "sk-secret-key")
+
+	var logs []model.AuditLog
+	require.NoError(t, testDB.Where("action = ?", "channel.reveal_key").Find(&logs).Error)
+	require.Len(t, logs, 1)
+	assert.Equal(t, 1, logs[0].ActorId)
+	assert.Equal(t, strconv.Itoa(channel.Id), logs[0].TargetId)
+	assert.NotContains(t, logs[0].Diff, "sk-secret-key")
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+var batchEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+}
+
+const (
+	batchCompletionWindow = "24h"
+	defaultBatchListLimit = 20
+	maxBatchListLimit     = 100
+)
+
+type CreateBatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// CreateBatch creates a batch from an uploaded jsonl file,
+// the requests are executed asynchronously by the batch runner.
+func CreateBatch(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+
+	req := new(CreateBatchRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, errors.Wrap(err, "parse request"))
+		return
+	}
+	if !slices.Contains(batchEndpoints, req.Endpoint) {
+		middleware.AbortWithError(c, http.StatusBadRequest, errors.Errorf("unsupported endpoint %q", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		middleware.AbortWithError(c, http.StatusBadRequest,
+			errors.Errorf("completion_window should be %q", batchCompletionWindow))
+		return
+	}
+
+	file, err := model.GetUserFileById(userId, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusBadRequest, errors.Errorf("no such file: %s", req.InputFileId))
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if file.Purpose != "batch" {
+		middleware.AbortWithError(c, http.StatusBadRequest,
+			errors.Errorf("the purpose of file %s should be batch", file.Id))
+		return
+	}
+
+	batch := model.NewBatch(userId, c.GetInt(ctxkey.TokenId), req.Endpoint, req.InputFileId, req.CompletionWindow, req.Metadata)
+	batch.ExpiresAt = batch.CreatedAt + int64((24 * time.Hour).Seconds())
+	if err = batch.Insert(); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	batchWorker.wake()
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// getUserBatch loads the batch in the path, it aborts the request if the batch is not found
+func getUserBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetUserBatchById(c.GetInt(ctxkey.Id), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("no such batch: %s", c.Param("id")))
+			return nil, false
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return batch, true
+}
+
+// RetrieveBatch returns a batch
+func RetrieveBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// ListBatches lists the batches of the current user
+func ListBatches(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+
+	limit := defaultBatchListLimit
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxBatchListLimit {
+			middleware.AbortWithError(c, http.StatusBadRequest,
+				errors.Errorf("limit should be between 1 and %d", maxBatchListLimit))
+			return
+		}
+	}
+
+	// fetch one more batch to know whether there are more batches
+	batches, err := model.GetUserBatches(userId, c.Query("after"), limit+1)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusBadRequest, errors.Errorf("invalid after cursor %q", c.Query("after")))
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	resp := gin.H{
+		"object":   "list",
+		"data":     batches,
+		"has_more": hasMore,
+	}
+	if len(batches) > 0 {
+		resp["first_id"] = batches[0].Id
+		resp["last_id"] = batches[len(batches)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CancelBatch cancels a batch, the requests that are already running will still be finished.
+//
+// The batch is in cancelling status until the runner picks up the cancellation.
+func CancelBatch(c *gin.Context) {
+	batch, ok := getUserBatch(c)
+	if !ok {
+		return
+	}
+
+	cancelled, err := batch.TransitStatus(model.BatchStatusCancelling,
+		model.BatchStatusValidating, model.BatchStatusInProgress)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !cancelled && batch.Status != model.BatchStatusCancelling {
+		middleware.AbortWithError(c, http.StatusConflict,
+			errors.Errorf("cannot cancel batch %s with status %s", batch.Id, batch.Status))
+		return
+	}
+	batchWorker.wake()
+
+	c.JSON(http.StatusOK, batch)
+}
@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+// upstreamBatch is the batch object returned by OpenAI or Azure
+type upstreamBatch struct {
+	Id            string                   `json:"id"`
+	Status        string                   `json:"status"`
+	OutputFileId  string                   `json:"output_file_id"`
+	ErrorFileId   string                   `json:"error_file_id"`
+	Errors        *model.BatchErrors       `json:"errors"`
+	RequestCounts model.BatchRequestCounts `json:"request_counts"`
+}
+
+// forwardNativeBatch forwards the batch to an OpenAI or Azure channel that supports batches natively,
+// it returns false if the batch is not eligible for forwarding.
+//
+// A batch is forwarded only if all requests use the same model, and the selected channel
+// does not remap the model, since the input file is uploaded to the upstream as is.
+// The estimated quota of the batch is reserved before forwarding, and settled once the batch is finished.
+func (r *batchRunner) forwardNativeBatch(ctx context.Context, batch *model.Batch, requests []*batchRequest) (forwarded bool, err error) {
+	// the quota reserved by an interrupted attempt
+	if err = releaseNativeBatchQuota(ctx, batch); err != nil {
+		return false, err
+	}
+
+	modelName := requests[0].model
+	for _, request := range requests {
+		if request.model != modelName {
+			return false, nil
+		}
+	}
+
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return false, err
+	}
+	if token.Models != nil && *token.Models != "" &&
+		!slices.Contains(strings.Split(*token.Models, ","), modelName) {
+		return false, nil
+	}
+	group, err := model.CacheGetUserGroup(batch.UserId)
+	if err != nil {
+		return false, err
+	}
+	channel, err := model.CacheGetRandomSatisfiedChannel(group, modelName, false)
+	if err != nil {
+		return false, nil
+	}
+	if channel.Type != channeltype.OpenAI && channel.Type != channeltype.Azure {
+		return false, nil
+	}
+	if mapped, ok := channel.GetModelMapping()[modelName]; ok && mapped != modelName {
+		return false, nil
+	}
+
+	modelRatio, _, groupRatio := getNativeBatchRatios(modelName, channel)
+	reserved, err := reserveNativeBatchQuota(ctx, batch, estimateNativeBatchQuota(requests, modelRatio*groupRatio))
+	if err != nil || !reserved {
+		return false, err
+	}
+	defer func() {
+		if forwarded {
+			return
+		}
+		if releaseErr := releaseNativeBatchQuota(ctx, batch); releaseErr != nil {
+			logger.Errorf(ctx, "failed to release the quota of batch %s: %+v", batch.Id, releaseErr)
+		}
+	}()
+
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return false, err
+	}
+	upstreamFileId, err := MirrorFileToChannel(ctx, file, channel)
+	if err != nil {
+		return false, errors.Wrap(err, "mirror input file")
+	}
+
+	endpoint := batch.Endpoint
+	if channel.Type == channeltype.Azure {
+		endpoint = strings.TrimPrefix(endpoint, "/v1")
+	}
+	reqBody, err := json.Marshal(map[string]any{
+		"input_file_id":     upstreamFileId,
+		"endpoint":          endpoint,
+		"completion_window": batch.CompletionWindow,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "marshal upstream batch request")
+	}
+	req, err := newChannelRequest(ctx, channel, http.MethodPost, "/batches", bytes.NewReader(reqBody))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	respBody, err := doChannelRequest(req)
+	if err != nil {
+		return false, errors.Wrap(err, "create upstream batch")
+	}
+	upstream := new(upstreamBatch)
+	if err = json.Unmarshal(respBody, upstream); err != nil || upstream.Id == "" {
+		return false, errors.Errorf("invalid upstream response: %s", string(respBody))
+	}
+	forwarded = true
+
+	batch.Model = modelName
+	batch.ChannelId = channel.Id
+	batch.UpstreamBatchId = upstream.Id
+	if err = batch.UpdateFields("model", "channel_id", "upstream_batch_id"); err != nil {
+		return true, err
+	}
+	if _, err = batch.TransitStatus(model.BatchStatusInProgress, model.BatchStatusValidating); err != nil {
+		return true, err
+	}
+	logger.Infof(ctx, "batch %s is forwarded to channel #%d as %s", batch.Id, channel.Id, upstream.Id)
+	return true, nil
+}
+
+// estimateNativeBatchQuota estimates the quota of all the requests in the batch,
+// in the same way the quota of a single request is pre-consumed by the relay.
+func estimateNativeBatchQuota(requests []*batchRequest, ratio float64) int64 {
+	var tokens int64
+	for _, request := range requests {
+		var body struct {
+			MaxTokens           int `json:"max_tokens"`
+			MaxCompletionTokens int `json:"max_completion_tokens"`
+		}
+		_ = json.Unmarshal(request.Body, &body)
+		tokens += config.PreConsumedQuota + int64(openai.CountTokenText(string(request.Body), request.model))
+		tokens += int64(max(body.MaxTokens, body.MaxCompletionTokens))
+	}
+	return int64(math.Ceil(float64(tokens) * ratio))
+}
+
+// reserveNativeBatchQuota pre-consumes the estimated quota of the batch, it returns false if the budget,
+// the token, the user or the organization can't afford the batch, which is then run locally request by request.
+func reserveNativeBatchQuota(ctx context.Context, batch *model.Batch, quota int64) (bool, error) {
+	if err := model.CheckBudget(batch.TokenId, batch.UserId, quota); err != nil {
+		if errors.Is(err, model.ErrBudgetExhausted) {
+			logger.Infof(ctx, "batch %s is not forwarded: %s", batch.Id, err.Error())
+			return false, nil
+		}
+		return false, err
+	}
+	if err := model.PreConsumeTokenQuota(batch.TokenId, quota); err != nil {
+		logger.Infof(ctx, "batch %s is not forwarded, failed to reserve %d quota: %s", batch.Id, quota, err.Error())
+		return false, nil
+	}
+
+	batch.PreConsumedQuota = quota
+	if err := batch.UpdateFields("pre_consumed_quota"); err != nil {
+		if refundErr := model.PostConsumeTokenQuota(batch.TokenId, -quota); refundErr != nil {
+			logger.Errorf(ctx, "failed to refund %d quota of batch %s: %+v", quota, batch.Id, refundErr)
+		}
+		batch.PreConsumedQuota = 0
+		return false, err
+	}
+	if err := model.CacheUpdateUserQuota(ctx, batch.UserId); err != nil {
+		logger.Warnf(ctx, "failed to update the cached quota of user %d: %+v", batch.UserId, err)
+	}
+	return true, nil
+}
+
+// releaseNativeBatchQuota refunds the quota reserved for the batch
+func releaseNativeBatchQuota(ctx context.Context, batch *model.Batch) error {
+	if batch.PreConsumedQuota == 0 {
+		return nil
+	}
+	if err := model.PostConsumeTokenQuota(batch.TokenId, -batch.PreConsumedQuota); err != nil {
+		return errors.Wrapf(err, "refund %d quota of batch %s", batch.PreConsumedQuota, batch.Id)
+	}
+	if err := model.CacheUpdateUserQuota(ctx, batch.UserId); err != nil {
+		logger.Warnf(ctx, "failed to update the cached quota of user %d: %+v", batch.UserId, err)
+	}
+	batch.PreConsumedQuota = 0
+	return batch.UpdateFields("pre_consumed_quota")
+}
+
+// syncNativeBatch syncs the status of the batch from the upstream,
+// the results are downloaded and billed once the upstream batch is finished.
+func (r *batchRunner) syncNativeBatch(ctx context.Context, batch *model.Batch) error {
+	channel, err := model.GetChannelById(batch.ChannelId, true)
+	if err != nil {
+		return r.fail(batch, "channel_not_found", fmt.Sprintf("channel #%d of the batch is not found", batch.ChannelId))
+	}
+
+	if batch.Status == model.BatchStatusCancelling {
+		req, err := newChannelRequest(ctx, channel, http.MethodPost, "/batches/"+batch.UpstreamBatchId+"/cancel", nil)
+		if err != nil {
+			return err
+		}
+		if _, err = doChannelRequest(req); err != nil {
+			// the upstream batch may be finished already
+			logger.Warnf(ctx, "failed to cancel upstream batch %s: %+v", batch.UpstreamBatchId, err)
+		}
+	}
+
+	req, err := newChannelRequest(ctx, channel, http.MethodGet, "/batches/"+batch.UpstreamBatchId, nil)
+	if err != nil {
+		return err
+	}
+	respBody, err := doChannelRequest(req)
+	if err != nil {
+		return errors.Wrap(err, "get upstream batch")
+	}
+	upstream := new(upstreamBatch)
+	if err = json.Unmarshal(respBody, upstream); err != nil {
+		return errors.Wrapf(err, "invalid upstream response: %s", string(respBody))
+	}
+
+	batch.RequestCounts = upstream.RequestCounts
+	if err = batch.UpdateFields("request_counts_total", "request_counts_completed", "request_counts_failed"); err != nil {
+		return err
+	}
+
+	switch upstream.Status {
+	case model.BatchStatusFailed:
+		batch.Errors = upstream.Errors
+		if err = batch.UpdateFields("errors"); err != nil {
+			return err
+		}
+		ok, err := batch.TransitStatus(model.BatchStatusFailed, model.BatchActiveStatuses...)
+		if err != nil || !ok {
+			return err
+		}
+		return releaseNativeBatchQuota(ctx, batch)
+	case model.BatchStatusCompleted, model.BatchStatusExpired, model.BatchStatusCancelled:
+	default:
+		return nil
+	}
+
+	if _, err = batch.TransitStatus(model.BatchStatusFinalizing,
+		model.BatchStatusInProgress, model.BatchStatusCancelling); err != nil {
+		return err
+	}
+
+	if upstream.OutputFileId != "" && batch.OutputFileId == "" {
+		output, err := downloadUpstreamFile(ctx, channel, upstream.OutputFileId)
+		if err != nil {
+			return err
+		}
+		file, err := saveFileContent(ctx, batch.UserId, batch.TokenId, batch.Id+"_output.jsonl", "batch_output", output)
+		if err != nil {
+			return errors.Wrap(err, "save output file")
+		}
+		batch.OutputFileId = file.Id
+	}
+	if upstream.ErrorFileId != "" && batch.ErrorFileId == "" {
+		errOutput, err := downloadUpstreamFile(ctx, channel, upstream.ErrorFileId)
+		if err != nil {
+			return err
+		}
+		file, err := saveFileContent(ctx, batch.UserId, batch.TokenId, batch.Id+"_error.jsonl", "batch_output", errOutput)
+		if err != nil {
+			return errors.Wrap(err, "save error file")
+		}
+		batch.ErrorFileId = file.Id
+	}
+	if err = batch.UpdateFields("output_file_id", "error_file_id"); err != nil {
+		return err
+	}
+
+	// the usage is read from the saved output file, which may be downloaded by an interrupted attempt
+	output, err := readBatchOutput(ctx, batch)
+	if err != nil {
+		return err
+	}
+	ok, err := batch.TransitStatus(upstream.Status, model.BatchStatusFinalizing)
+	if err != nil {
+		return err
+	}
+	// the batch is billed only by the one that transits it to the terminal status
+	if ok {
+		billNativeBatch(ctx, batch, channel, output)
+	}
+	return nil
+}
+
+// readBatchOutput reads the content of the output file of the batch
+func readBatchOutput(ctx context.Context, batch *model.Batch) ([]byte, error) {
+	if batch.OutputFileId == "" {
+		return nil, nil
+	}
+	file, err := model.GetUserFileById(batch.UserId, batch.OutputFileId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get output file %s", batch.OutputFileId)
+	}
+	store, err := fileStorage()
+	if err != nil {
+		return nil, errors.Wrap(err, "get file storage")
+	}
+	content, err := store.Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get content of file %s", file.Id)
+	}
+	defer content.Close()
+	output, err := io.ReadAll(content)
+	return output, errors.Wrapf(err, "read content of file %s", file.Id)
+}
+
+func downloadUpstreamFile(ctx context.Context, channel *model.Channel, fileId string) ([]byte, error) {
+	req, err := newChannelRequest(ctx, channel, http.MethodGet, "/files/"+fileId+"/content", nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := doChannelRequest(req)
+	return body, errors.Wrapf(err, "download upstream file %s", fileId)
+}
+
+// sumBatchUsage sums up the usage of all the responses in the output file
+func sumBatchUsage(output []byte) (promptTokens, completionTokens int) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var result struct {
+			Response struct {
+				Body struct {
+					Usage struct {
+						PromptTokens     int `json:"prompt_tokens"`
+						CompletionTokens int `json:"completion_tokens"`
+						InputTokens      int `json:"input_tokens"`
+						OutputTokens     int `json:"output_tokens"`
+					} `json:"usage"`
+				} `json:"body"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		usage := result.Response.Body.Usage
+		promptTokens += usage.PromptTokens + usage.InputTokens
+		completionTokens += usage.CompletionTokens + usage.OutputTokens
+	}
+	return promptTokens, completionTokens
+}
+
+// getNativeBatchRatios returns the ratios of the model on the channel,
+// with the batch discount ratio applied to the group ratio.
+func getNativeBatchRatios(modelName string, channel *model.Channel) (modelRatio, completionRatio, groupRatio float64) {
+	pricingAdaptor := relay.GetAdaptor(channeltype.ToAPIType(channel.Type))
+	modelRatio = pricing.GetModelRatioWithThreeLayers(modelName, channel.GetModelRatioFromConfigs(), pricingAdaptor)
+	completionRatio = pricing.GetCompletionRatioWithThreeLayers(modelName, channel.GetCompletionRatioFromConfigs(), pricingAdaptor)
+	groupRatio = middleware.GetChannelRatio(channel) * config.BatchDiscountRatio
+	return modelRatio, completionRatio, groupRatio
+}
+
+// billNativeBatch bills the whole batch forwarded to the upstream at once,
+// the difference from the reserved quota is consumed or refunded.
+func billNativeBatch(ctx context.Context, batch *model.Batch, channel *model.Channel, output []byte) {
+	promptTokens, completionTokens := sumBatchUsage(output)
+	if promptTokens == 0 && completionTokens == 0 {
+		if err := releaseNativeBatchQuota(ctx, batch); err != nil {
+			logger.Errorf(ctx, "failed to release the quota of batch %s: %+v", batch.Id, err)
+		}
+		return
+	}
+
+	modelRatio, completionRatio, groupRatio := getNativeBatchRatios(batch.Model, channel)
+	ratio := modelRatio * groupRatio
+
+	quota := int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+
+	tokenName := ""
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		tokenName = token.Name
+	}
+	billing.PostConsumeQuotaDetailed(ctx, batch.TokenId, quota-batch.PreConsumedQuota, quota, batch.UserId, channel.Id,
+		promptTokens, completionTokens, modelRatio, groupRatio, batch.Model, tokenName,
+		false, time.Unix(batch.CreatedAt, 0), false, completionRatio, 0)
+}
@@ -0,0 +1,581 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	maxBatchRequests = 50000
+	// maxBatchErrors is the maximum number of validation errors reported in a batch
+	maxBatchErrors     = 100
+	batchWatchInterval = 3 * time.Second
+)
+
+// batchRequest is one line of the input file of a batch
+type batchRequest struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+
+	model string
+}
+
+type batchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// batchResult is one line of the output or error file of a batch
+type batchResult struct {
+	Id       string            `json:"id"`
+	CustomId string            `json:"custom_id"`
+	Response *batchResponse    `json:"response"`
+	Error    *model.BatchError `json:"error"`
+}
+
+// batchRunner executes the batches in the background.
+//
+// All the state of batches is saved in the database, so the runner can pick up
+// the unfinished batches after restarts.
+type batchRunner struct {
+	mu      sync.Mutex
+	running map[string]bool
+	wakeup  chan struct{}
+	// workers limits the number of requests running at the same time across all batches
+	workers chan struct{}
+}
+
+var batchWorker = &batchRunner{
+	running: make(map[string]bool),
+	wakeup:  make(chan struct{}, 1),
+	workers: make(chan struct{}, max(config.BatchConcurrency, 1)),
+}
+
+// AutomaticallyRunBatches picks up the active batches periodically,
+// it should only run on the master node to avoid running a batch twice.
+func AutomaticallyRunBatches() {
+	interval := time.Duration(config.BatchPollInterval) * time.Second
+	for {
+		batchWorker.schedule()
+		select {
+		case <-time.After(interval):
+		case <-batchWorker.wakeup:
+		}
+	}
+}
+
+// wake triggers the scheduling without waiting for the next poll
+func (r *batchRunner) wake() {
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (r *batchRunner) schedule() {
+	batches, err := model.GetActiveBatches()
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to get active batches: %+v", err))
+		return
+	}
+
+	for _, batch := range batches {
+		r.mu.Lock()
+		if r.running[batch.Id] {
+			r.mu.Unlock()
+			continue
+		}
+		r.running[batch.Id] = true
+		r.mu.Unlock()
+
+		go func(batch *model.Batch) {
+			defer func() {
+				r.mu.Lock()
+				delete(r.running, batch.Id)
+				r.mu.Unlock()
+			}()
+
+			ctx := helper.SetRequestID(context.Background(), batch.Id)
+			if err := r.run(ctx, batch); err != nil {
+				logger.Errorf(ctx, "failed to run batch %s: %+v", batch.Id, err)
+			}
+		}(batch)
+	}
+}
+
+// run drives the batch to the end, or to the next sync if it is forwarded to the upstream
+func (r *batchRunner) run(ctx context.Context, batch *model.Batch) error {
+	if batch.UpstreamBatchId != "" {
+		return r.syncNativeBatch(ctx, batch)
+	}
+
+	requests, batchErrs, err := loadBatchRequests(ctx, batch)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, storage.ErrNotFound) {
+			return r.fail(batch, "invalid_file", err.Error())
+		}
+		// maybe the storage is temporarily unavailable, retry in the next poll
+		return err
+	}
+	if batchErrs != nil {
+		batch.Errors = batchErrs
+		if err = batch.UpdateFields("errors"); err != nil {
+			return err
+		}
+		_, err = batch.TransitStatus(model.BatchStatusFailed, model.BatchStatusValidating, model.BatchStatusInProgress)
+		return err
+	}
+
+	if batch.Status == model.BatchStatusValidating {
+		batch.RequestCounts.Total = len(requests)
+		if err = batch.UpdateFields("request_counts_total"); err != nil {
+			return err
+		}
+
+		if config.BatchNativeForwardEnabled {
+			forwarded, err := r.forwardNativeBatch(ctx, batch, requests)
+			if err != nil {
+				logger.Warnf(ctx, "failed to forward batch %s to upstream, run it locally: %+v", batch.Id, err)
+			} else if forwarded {
+				return nil
+			}
+		}
+
+		if _, err = batch.TransitStatus(model.BatchStatusInProgress, model.BatchStatusValidating); err != nil {
+			return err
+		}
+	}
+
+	if err = r.process(ctx, batch, requests); err != nil {
+		return err
+	}
+	return r.finalize(ctx, batch, requests)
+}
+
+// fail marks the batch as failed with an error
+func (r *batchRunner) fail(batch *model.Batch, code, message string) error {
+	batch.Errors = &model.BatchErrors{
+		Object: "list",
+		Data:   []model.BatchError{{Code: code, Message: message}},
+	}
+	if err := batch.UpdateFields("errors"); err != nil {
+		return err
+	}
+	ok, err := batch.TransitStatus(model.BatchStatusFailed, model.BatchActiveStatuses...)
+	if err != nil || !ok {
+		return err
+	}
+	// the quota reserved for the batch forwarded to the upstream
+	return releaseNativeBatchQuota(context.Background(), batch)
+}
+
+// loadBatchRequests reads and validates the input file of the batch,
+// it returns the validation errors if any line is invalid.
+func loadBatchRequests(ctx context.Context, batch *model.Batch) ([]*batchRequest, *model.BatchErrors, error) {
+	file, err := model.GetUserFileById(batch.UserId, batch.InputFileId)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := fileStorage()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get file storage")
+	}
+	content, err := store.Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "get content of file %s", file.Id)
+	}
+	defer content.Close()
+
+	var (
+		requests   []*batchRequest
+		errs       []model.BatchError
+		errCount   int
+		customIds  = make(map[string]bool)
+		reader     = bufio.NewReader(content)
+		readErr    error
+		lineNumber int
+	)
+	for readErr == nil {
+		var line []byte
+		line, readErr = reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, nil, errors.Wrap(readErr, "read input file")
+		}
+		lineNumber++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		request, batchErr := parseBatchRequest(line, batch.Endpoint)
+		if batchErr == nil && customIds[request.CustomId] {
+			batchErr = &model.BatchError{
+				Code:    "duplicate_custom_id",
+				Message: fmt.Sprintf("custom_id %q is duplicated", request.CustomId),
+				Param:   "custom_id",
+			}
+		}
+		if batchErr != nil {
+			errCount++
+			if len(errs) < maxBatchErrors {
+				errLine := lineNumber
+				batchErr.Line = &errLine
+				errs = append(errs, *batchErr)
+			}
+			continue
+		}
+
+		customIds[request.CustomId] = true
+		requests = append(requests, request)
+	}
+
+	switch {
+	case errCount > 0:
+	case len(requests) == 0:
+		errs = append(errs, model.BatchError{Code: "empty_file", Message: "the input file is empty"})
+	case len(requests) > maxBatchRequests:
+		errs = append(errs, model.BatchError{
+			Code:    "too_many_requests",
+			Message: fmt.Sprintf("a batch can contain at most %d requests", maxBatchRequests),
+		})
+	}
+	if len(errs) > 0 {
+		return nil, &model.BatchErrors{Object: "list", Data: errs}, nil
+	}
+	return requests, nil, nil
+}
+
+func parseBatchRequest(line []byte, endpoint string) (*batchRequest, *model.BatchError) {
+	request := new(batchRequest)
+	if err := json.Unmarshal(line, request); err != nil {
+		return nil, &model.BatchError{Code: "invalid_json_line", Message: err.Error()}
+	}
+	if request.CustomId == "" {
+		return nil, &model.BatchError{Code: "missing_required_parameter", Message: "custom_id is required", Param: "custom_id"}
+	}
+	if request.Method != http.MethodPost {
+		return nil, &model.BatchError{Code: "invalid_method", Message: "method should be POST", Param: "method"}
+	}
+	if request.Url != endpoint {
+		return nil, &model.BatchError{
+			Code:    "invalid_url",
+			Message: fmt.Sprintf("url should be the endpoint of the batch %q", endpoint),
+			Param:   "url",
+		}
+	}
+
+	var body struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(request.Body, &body); err != nil {
+		return nil, &model.BatchError{Code: "invalid_request", Message: "body should be a json object", Param: "body"}
+	}
+	if body.Model == "" {
+		return nil, &model.BatchError{Code: "missing_required_parameter", Message: "body.model is required", Param: "body.model"}
+	}
+	if body.Stream {
+		return nil, &model.BatchError{Code: "invalid_request", Message: "stream is not supported in batches", Param: "body.stream"}
+	}
+	request.model = body.Model
+	return request, nil
+}
+
+// process executes the unfinished requests of the batch, until all the requests
+// are finished, or the batch is cancelled or expired.
+func (r *batchRunner) process(ctx context.Context, batch *model.Batch, requests []*batchRequest) error {
+	status, err := model.GetBatchStatus(batch.Id)
+	if err != nil {
+		return err
+	}
+	if status != model.BatchStatusInProgress || helper.GetTimestamp() >= batch.ExpiresAt {
+		return nil
+	}
+
+	tokenKey := ""
+	if token, err := model.GetTokenById(batch.TokenId); err == nil {
+		tokenKey = token.Key
+	} else {
+		// every request will fail with the invalid token
+		logger.Warnf(ctx, "failed to get token of batch %s: %+v", batch.Id, err)
+	}
+
+	finished, err := model.GetBatchFinishedLines(batch.Id)
+	if err != nil {
+		return err
+	}
+	completed, failed, err := model.CountBatchItems(batch.Id)
+	if err != nil {
+		return err
+	}
+	var completedCount, failedCount atomic.Int64
+	completedCount.Store(int64(completed))
+	failedCount.Store(int64(failed))
+	saveCounts := func() {
+		counts := &model.Batch{Id: batch.Id, RequestCounts: model.BatchRequestCounts{
+			Total:     batch.RequestCounts.Total,
+			Completed: int(completedCount.Load()),
+			Failed:    int(failedCount.Load()),
+		}}
+		if err := counts.UpdateFields("request_counts_completed", "request_counts_failed"); err != nil {
+			logger.Errorf(ctx, "failed to save counts of batch %s: %+v", batch.Id, err)
+		}
+	}
+
+	// stop dispatching new requests once the batch is cancelled or expired,
+	// the running requests are not interrupted
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	go func() {
+		ticker := time.NewTicker(batchWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-dispatchCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			saveCounts()
+			if helper.GetTimestamp() >= batch.ExpiresAt {
+				stopDispatch()
+				return
+			}
+			if status, err := model.GetBatchStatus(batch.Id); err == nil && status != model.BatchStatusInProgress {
+				stopDispatch()
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+dispatch:
+	for line, request := range requests {
+		if finished[line] {
+			continue
+		}
+		select {
+		case r.workers <- struct{}{}:
+		case <-dispatchCtx.Done():
+			break dispatch
+		}
+		if dispatchCtx.Err() != nil {
+			<-r.workers
+			break
+		}
+
+		wg.Add(1)
+		go func(line int, request *batchRequest) {
+			defer wg.Done()
+			defer func() { <-r.workers }()
+
+			item := executeBatchRequest(ctx, batch, tokenKey, line, request)
+			if err := model.SaveBatchItem(item); err != nil {
+				logger.Errorf(ctx, "failed to save result of line %d in batch %s: %+v", line, batch.Id, err)
+				return
+			}
+			if item.Success {
+				completedCount.Add(1)
+			} else {
+				failedCount.Add(1)
+			}
+		}(line, request)
+	}
+	wg.Wait()
+	stopDispatch()
+	saveCounts()
+
+	return nil
+}
+
+// executeBatchRequest runs one request of the batch and returns its result
+func executeBatchRequest(ctx context.Context, batch *model.Batch, tokenKey string, line int, request *batchRequest) *model.BatchItem {
+	requestId := helper.GenRequestID()
+	result := &batchResult{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: request.CustomId,
+	}
+
+	statusCode, body, err := relayBatchRequest(ctx, tokenKey, requestId, request)
+	if err != nil {
+		result.Error = &model.BatchError{Code: "request_failed", Message: err.Error()}
+	} else {
+		if !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		result.Response = &batchResponse{
+			StatusCode: statusCode,
+			RequestId:  requestId,
+			Body:       body,
+		}
+	}
+
+	resultBytes, _ := json.Marshal(result)
+	return &model.BatchItem{
+		BatchId: batch.Id,
+		Line:    line,
+		Success: err == nil && statusCode/100 == 2,
+		Result:  string(resultBytes),
+	}
+}
+
+// relayBatchRequest runs one request of the batch through the normal relay pipeline,
+// as if it is sent by the token of the batch.
+func relayBatchRequest(ctx context.Context, tokenKey, requestId string, request *batchRequest) (int, []byte, error) {
+	// the token and the user are checked for every request,
+	// since they could be disabled or exhausted during the batch
+	token, err := model.ValidateUserToken(tokenKey)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "invalid token")
+	}
+	userEnabled, err := model.CacheIsUserEnabled(token.UserId)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "check user status")
+	}
+	if !userEnabled || blacklist.IsUserBanned(token.UserId) {
+		return 0, nil, errors.New("User has been banned")
+	}
+	if token.Models != nil && *token.Models != "" &&
+		!slices.Contains(strings.Split(*token.Models, ","), request.model) {
+		return 0, nil, errors.Errorf("This API key does not have permission to use the model: %s", request.model)
+	}
+
+	group, err := model.CacheGetUserGroup(token.UserId)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "get user group")
+	}
+	channel, err := model.CacheGetRandomSatisfiedChannel(group, request.model, false)
+	if err != nil {
+		channel, err = model.CacheGetRandomSatisfiedChannel(group, request.model, true)
+		if err != nil {
+			return 0, nil, errors.Errorf("No available channels for Model %s under Group %s", request.model, group)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(ctx, http.MethodPost, request.Url, bytes.NewReader(request.Body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(helper.RequestIdKey, requestId)
+	if err := middleware.SetupContextForToken(c, token); err != nil {
+		return 0, nil, errors.Wrap(err, "invalid token")
+	}
+	c.Set(ctxkey.Group, group)
+	c.Set(ctxkey.RequestModel, request.model)
+	c.Set(ctxkey.QuotaDiscount, config.BatchDiscountRatio)
+	if err := middleware.SetupContextForSelectedChannel(c, channel, request.model); err != nil {
+		logger.Errorf(ctx, "failed to set up channel #%d: %+v", channel.Id, err)
+	}
+
+	Relay(c)
+	return w.Code, w.Body.Bytes(), nil
+}
+
+// finalize writes the output and error files of the batch,
+// the requests that are not executed are reported in the error file.
+func (r *batchRunner) finalize(ctx context.Context, batch *model.Batch, requests []*batchRequest) error {
+	if _, err := batch.TransitStatus(model.BatchStatusFinalizing,
+		model.BatchStatusInProgress, model.BatchStatusCancelling); err != nil {
+		return err
+	}
+	// reload the batch, it may be cancelled by other nodes
+	batch, err := model.GetBatchById(batch.Id)
+	if err != nil {
+		return err
+	}
+	if batch.Status != model.BatchStatusFinalizing {
+		return nil
+	}
+
+	finalStatus, unfinishedCode := model.BatchStatusCompleted, "internal_error"
+	switch {
+	case batch.CancellingAt != 0:
+		finalStatus, unfinishedCode = model.BatchStatusCancelled, "batch_cancelled"
+	case helper.GetTimestamp() >= batch.ExpiresAt:
+		finalStatus, unfinishedCode = model.BatchStatusExpired, "batch_expired"
+	}
+
+	items, err := model.GetBatchItems(batch.Id)
+	if err != nil {
+		return err
+	}
+	var output, errOutput bytes.Buffer
+	finished := make(map[int]bool, len(items))
+	batch.RequestCounts = model.BatchRequestCounts{Total: len(requests)}
+	for _, item := range items {
+		finished[item.Line] = true
+		if item.Success {
+			batch.RequestCounts.Completed++
+			output.WriteString(item.Result + "\n")
+		} else {
+			batch.RequestCounts.Failed++
+			errOutput.WriteString(item.Result + "\n")
+		}
+	}
+	for line, request := range requests {
+		if finished[line] {
+			continue
+		}
+		result, _ := json.Marshal(&batchResult{
+			Id:       "batch_req_" + random.GetUUID(),
+			CustomId: request.CustomId,
+			Error: &model.BatchError{
+				Code:    unfinishedCode,
+				Message: fmt.Sprintf("the request is not executed since the batch is %s", finalStatus),
+			},
+		})
+		errOutput.Write(result)
+		errOutput.WriteString("\n")
+	}
+
+	if output.Len() > 0 && batch.OutputFileId == "" {
+		file, err := saveFileContent(ctx, batch.UserId, batch.TokenId, batch.Id+"_output.jsonl", "batch_output", output.Bytes())
+		if err != nil {
+			return errors.Wrap(err, "save output file")
+		}
+		batch.OutputFileId = file.Id
+	}
+	if errOutput.Len() > 0 && batch.ErrorFileId == "" {
+		file, err := saveFileContent(ctx, batch.UserId, batch.TokenId, batch.Id+"_error.jsonl", "batch_output", errOutput.Bytes())
+		if err != nil {
+			return errors.Wrap(err, "save error file")
+		}
+		batch.ErrorFileId = file.Id
+	}
+	if err = batch.UpdateFields("output_file_id", "error_file_id", "request_counts_total",
+		"request_counts_completed", "request_counts_failed"); err != nil {
+		return err
+	}
+
+	if _, err = batch.TransitStatus(finalStatus, model.BatchStatusFinalizing); err != nil {
+		return err
+	}
+	return model.DeleteBatchItems(batch.Id)
+}
@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupBatchTestRouter(t *testing.T, userId int) *gin.Engine {
+	router := setupFileTestRouter(t, userId)
+	router.POST("/v1/batches", CreateBatch)
+	router.GET("/v1/batches", ListBatches)
+	router.GET("/v1/batches/:id", RetrieveBatch)
+	router.POST("/v1/batches/:id/cancel", CancelBatch)
+	return router
+}
+
+func createTestBatch(t *testing.T, router *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/batches", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func uploadBatchInput(t *testing.T, router *gin.Engine, content string) *model.File {
+	w := uploadTestFile(t, router, "batch", "input.jsonl", content)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	file := new(model.File)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), file))
+	return file
+}
+
+func TestBatchesAPI(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupBatchTestRouter(t, 1)
+
+	file := uploadBatchInput(t, router, `{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`)
+
+	w := createTestBatch(t, router, `{"input_file_id":"`+file.Id+`","endpoint":"/v1/images/generations","completion_window":"24h"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = createTestBatch(t, router, `{"input_file_id":"`+file.Id+`","endpoint":"/v1/chat/completions","completion_window":"1h"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = createTestBatch(t, router, `{"input_file_id":"file-unknown","endpoint":"/v1/chat/completions","completion_window":"24h"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = createTestBatch(t, router, `{"input_file_id":"`+file.Id+`","endpoint":"/v1/chat/completions","completion_window":"24h","metadata":{"k":"v"}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var batch model.Batch
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, "batch", batch.Object)
+	assert.Equal(t, model.BatchStatusValidating, batch.Status)
+	assert.Equal(t, map[string]string{"k": "v"}, batch.Metadata)
+	assert.Equal(t, batch.CreatedAt+24*3600, batch.ExpiresAt)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/batches/"+batch.Id, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/batches?limit=1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data    []model.Batch `json:"data"`
+		HasMore bool          `json:"has_more"`
+		LastId  string        `json:"last_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	assert.False(t, list.HasMore)
+	assert.Equal(t, batch.Id, list.LastId)
+
+	// other users can not see the batch
+	w = httptest.NewRecorder()
+	setupBatchTestRouter(t, 2).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/batches/"+batch.Id, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/batches/"+batch.Id+"/cancel", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, model.BatchStatusCancelling, batch.Status)
+	assert.NotZero(t, batch.CancellingAt)
+
+	// cancelling twice is fine, but finished batches can not be cancelled
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/batches/"+batch.Id+"/cancel", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := batch.TransitStatus(model.BatchStatusCancelled, model.BatchStatusCancelling)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/batches/"+batch.Id+"/cancel", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestLoadBatchRequests(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupBatchTestRouter(t, 1)
+
+	valid := uploadBatchInput(t, router, strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+		``,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o-mini"}}`,
+	}, "\n"))
+	batch := model.NewBatch(1, 1, "/v1/chat/completions", valid.Id, "24h", nil)
+	requests, batchErrs, err := loadBatchRequests(context.Background(), batch)
+	require.NoError(t, err)
+	require.Nil(t, batchErrs)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "b", requests[1].CustomId)
+	assert.Equal(t, "gpt-4o-mini", requests[1].model)
+
+	invalid := uploadBatchInput(t, router, strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+		`{"custom_id":"b","method":"GET","url":"/v1/chat/completions","body":{"model":"gpt-4o"}}`,
+		`{"custom_id":"c","method":"POST","url":"/v1/embeddings","body":{"model":"gpt-4o"}}`,
+		`{"custom_id":"d","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"e","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","stream":true}}`,
+		`not json`,
+	}, "\n"))
+	batch = model.NewBatch(1, 1, "/v1/chat/completions", invalid.Id, "24h", nil)
+	_, batchErrs, err = loadBatchRequests(context.Background(), batch)
+	require.NoError(t, err)
+	require.NotNil(t, batchErrs)
+
+	var codes []string
+	var lines []int
+	for _, batchErr := range batchErrs.Data {
+		codes = append(codes, batchErr.Code)
+		lines = append(lines, *batchErr.Line)
+	}
+	assert.Equal(t, []string{
+		"duplicate_custom_id", "invalid_method", "invalid_url",
+		"missing_required_parameter", "invalid_request", "invalid_json_line",
+	}, codes)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7}, lines)
+}
+
+func TestBatchFinalize(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupBatchTestRouter(t, 1)
+
+	batch := model.NewBatch(1, 1, "/v1/chat/completions", "file-input", "24h", nil)
+	batch.Status = model.BatchStatusInProgress
+	batch.ExpiresAt = helper.GetTimestamp() + 3600
+	batch.RequestCounts.Total = 3
+	require.NoError(t, batch.Insert())
+
+	requests := []*batchRequest{{CustomId: "a"}, {CustomId: "b"}, {CustomId: "c"}}
+	require.NoError(t, model.SaveBatchItem(&model.BatchItem{BatchId: batch.Id, Line: 0, Success: true, Result: `{"custom_id":"a"}`}))
+	require.NoError(t, model.SaveBatchItem(&model.BatchItem{BatchId: batch.Id, Line: 1, Success: false, Result: `{"custom_id":"b"}`}))
+	// saving the same line again is ignored
+	require.NoError(t, model.SaveBatchItem(&model.BatchItem{BatchId: batch.Id, Line: 1, Success: true, Result: `{"custom_id":"b"}`}))
+
+	_, err := batch.TransitStatus(model.BatchStatusCancelling, model.BatchStatusInProgress)
+	require.NoError(t, err)
+	require.NoError(t, batchWorker.finalize(context.Background(), batch, requests))
+
+	batch, err = model.GetBatchById(batch.Id)
+	require.NoError(t, err)
+	assert.Equal(t, model.BatchStatusCancelled, batch.Status)
+	assert.Equal(t, model.BatchRequestCounts{Total: 3, Completed: 1, Failed: 1}, batch.RequestCounts)
+	require.NotEmpty(t, batch.OutputFileId)
+	require.NotEmpty(t, batch.ErrorFileId)
+
+	readFile := func(id string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files/"+id+"/content", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		body, err := io.ReadAll(w.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "{\"custom_id\":\"a\"}\n", readFile(batch.OutputFileId))
+
+	errLines := bytes.Split(bytes.TrimSpace([]byte(readFile(batch.ErrorFileId))), []byte("\n"))
+	require.Len(t, errLines, 2)
+	var unfinished batchResult
+	require.NoError(t, json.Unmarshal(errLines[1], &unfinished))
+	assert.Equal(t, "c", unfinished.CustomId)
+	assert.Equal(t, "batch_cancelled", unfinished.Error.Code)
+
+	items, err := model.GetBatchItems(batch.Id)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestSumBatchUsage(t *testing.T) {
+	output := strings.Join([]string{
+		`{"custom_id":"a","response":{"status_code":200,"body":{"usage":{"prompt_tokens":10,"completion_tokens":5}}}}`,
+		`{"custom_id":"b","response":{"status_code":200,"body":{"usage":{"input_tokens":3,"output_tokens":2}}}}`,
+		`invalid`,
+	}, "\n")
+	promptTokens, completionTokens := sumBatchUsage([]byte(output))
+	assert.Equal(t, 13, promptTokens)
+	assert.Equal(t, 7, completionTokens)
+}
+
+func TestNativeBatchQuota(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	require.NoError(t, testDB.Model(&model.User{}).Where("id = ?", 1).Update("quota", 10000).Error)
+	token := &model.Token{Id: 1, UserId: 1, Key: "batch-test-key", Status: model.TokenStatusEnabled, Name: "test", RemainQuota: 9000}
+	require.NoError(t, testDB.Create(token).Error)
+
+	batch := model.NewBatch(1, token.Id, "/v1/chat/completions", "file-input", "24h", nil)
+	batch.Status = model.BatchStatusValidating
+	require.NoError(t, batch.Insert())
+	ctx := context.Background()
+
+	// the batch that can't be afforded is not forwarded
+	reserved, err := reserveNativeBatchQuota(ctx, batch, 20000)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+
+	reserved, err = reserveNativeBatchQuota(ctx, batch, 100)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	saved, err := model.GetBatchById(batch.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), saved.PreConsumedQuota)
+	user, err := model.GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9900), user.Quota)
+
+	// the reserved quota is refunded once the batch is failed, and only once
+	require.NoError(t, batchWorker.fail(batch, "channel_not_found", "test"))
+	require.NoError(t, batchWorker.fail(batch, "channel_not_found", "test"))
+	user, err = model.GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10000), user.Quota)
+	refreshed, err := model.GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9000), refreshed.RemainQuota)
+}
+
+func TestRelayBatchRequestOrganizationToken(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	client.Init()
+	// count the prompt tokens without loading the tiktoken encoders
+	originalApproximateToken := config.ApproximateTokenEnabled
+	config.ApproximateTokenEnabled = true
+	defer func() { config.ApproximateTokenEnabled = originalApproximateToken }()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",` +
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	defer upstream.Close()
+	baseURL := upstream.URL
+	modelConfigs := `{"gpt-4o":{"ratio":1,"completion_ratio":1}}`
+	channel := &model.Channel{Type: 1, Name: "batch", Key: "sk-upstream", Status: model.ChannelStatusEnabled,
+		BaseURL: &baseURL, Models: "gpt-4o", Group: "default", ModelConfigs: &modelConfigs}
+	require.NoError(t, channel.Insert())
+
+	// the member has no personal quota, the requests are charged to the pool
+	org, err := model.CreateOrganization("batch-org", 1)
+	require.NoError(t, err)
+	require.NoError(t, model.SetOrganizationQuota(org.Id, 1000000))
+	token := &model.Token{Id: 1, UserId: 1, Key: "batch-org-key", Status: model.TokenStatusEnabled, Name: "org",
+		UnlimitedQuota: true, OrganizationId: org.Id}
+	require.NoError(t, testDB.Create(token).Error)
+
+	request := &batchRequest{
+		Url:   "/v1/chat/completions",
+		Body:  []byte(`{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`),
+		model: "gpt-4o",
+	}
+	statusCode, body, err := relayBatchRequest(context.Background(), token.Key, "batch-req-1", request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, statusCode, string(body))
+	user, err := model.GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Zero(t, user.Quota)
+	// the usage is settled asynchronously
+	var member *model.OrganizationMember
+	require.Eventually(t, func() bool {
+		member, err = model.GetOrganizationMember(org.Id, 1)
+		return err == nil && member.UsedQuota > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the spending cap of the member is applied
+	member.QuotaLimit = 1
+	require.NoError(t, member.Update())
+	statusCode, body, err = relayBatchRequest(context.Background(), token.Key, "batch-req-2", request)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, statusCode)
+	assert.Contains(t, string(body), "insufficient_organization_quota")
+	require.Eventually(t, func() bool {
+		var count int64
+		return testDB.Model(&model.Log{}).Where("type = ?", model.LogTypeError).Count(&count).Error == nil && count > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the member removed from the organization could no longer spend the pool
+	require.NoError(t, member.Delete())
+	_, _, err = relayBatchRequest(context.Background(), token.Key, "batch-req-3", request)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed to use the tokens")
+}
@@ -96,3 +96,51 @@ func GetUsage(c *gin.Context) {
 	c.JSON(200, usage)
 	return
 }
+
+// BudgetResponse is the budget of the current period
+type BudgetResponse struct {
+	Period string `json:"period"`
+	// Granted is the budget of the current period, including the budget carried over from the last period
+	Granted   int64 `json:"granted"`
+	Used      int64 `json:"used"`
+	Available int64 `json:"available"`
+	// ResetAt is the unix time when the current period ends
+	ResetAt int64 `json:"reset_at"`
+}
+
+func newBudgetResponse(budget *model.Budget) *BudgetResponse {
+	if !budget.BudgetEnabled() {
+		return nil
+	}
+	return &BudgetResponse{
+		Period:    budget.BudgetPeriod,
+		Granted:   budget.BudgetQuota + budget.BudgetCarriedQuota,
+		Used:      budget.BudgetUsedQuota,
+		Available: max(budget.BudgetRemainQuota(), 0),
+		ResetAt:   budget.BudgetResetAt(),
+	}
+}
+
+// GetBudget returns the budgets of the token and its user in the current period, null if no budget is set
+func GetBudget(c *gin.Context) {
+	tokenBudget, err := model.GetTokenBudget(c.GetInt(ctxkey.TokenId))
+	var userBudget *model.Budget
+	if err == nil {
+		userBudget, err = model.GetUserBudget(c.GetInt(ctxkey.Id))
+	}
+	if err != nil {
+		Error := relaymodel.Error{
+			Message: err.Error(),
+			Type:    "one_api_error",
+		}
+		c.JSON(200, gin.H{
+			"error": Error,
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"object": "budget",
+		"token":  newBudgetResponse(tokenBudget),
+		"user":   newBudgetResponse(userBudget),
+	})
+}
@@ -309,6 +309,15 @@ func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	// the balance of the multi-key channel is queried by its first key
+	keys, err := channel.Keys()
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, errors.Errorf("channel %d has no keys", channel.Id)
+	}
+	channel.Key = keys[0]
 	baseURL := channeltype.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetChannelKeys returns the status and the usage of each key of the multi-key channel
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid channel id"))
+		return
+	}
+	keys, err := model.GetChannelKeys(id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+type channelKeyStatusRequest struct {
+	Status int `json:"status"`
+}
+
+// UpdateChannelKeyStatus enables or disables a key of the multi-key channel
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid channel id"))
+		return
+	}
+	keyId, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid key id"))
+		return
+	}
+	var req channelKeyStatusRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	if err := model.UpdateChannelKeyStatus(id, keyId, req.Status); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	recordAudit(c, "channel.update_key_status", "channel", id, nil, gin.H{"key_id": keyId, "status": req.Status})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/breaker"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/pricing"
 )
@@ -83,6 +84,42 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelKey reveals the key of the channel, which is omitted by the other channel APIs
+func GetChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	key, err := channel.DecryptedKey()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// only the channel is recorded, the key itself never reaches the audit log
+	recordAudit(c, "channel.reveal_key", "channel", channel.Id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    key,
+	})
+	return
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -106,7 +143,30 @@ func AddChannel(c *gin.Context) {
 		}
 	}
 
+	if !model.IsValidChannelKeyStrategy(channel.KeyStrategy) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid key strategy: " + channel.KeyStrategy,
+		})
+		return
+	}
+
 	channel.CreatedTime = helper.GetTimestamp()
+	if channel.IsMultiKey() {
+		// the keys of the multi-key channel are kept in one channel
+		if err = channel.Insert(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+		})
+		return
+	}
 	keys := strings.Split(channel.Key, "\n")
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
@@ -190,6 +250,22 @@ func UpdateChannel(c *gin.Context) {
 		}
 	}
 
+	if !model.IsValidChannelKeyStrategy(channel.KeyStrategy) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid key strategy: " + channel.KeyStrategy,
+		})
+		return
+	}
+
+	origin, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -198,6 +274,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil {
+		recordAudit(c, "channel.update", "channel", channel.Id, origin, updated)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -453,3 +532,73 @@ func GetChannelDefaultPricing(c *gin.Context) {
 		},
 	})
 }
+
+// GetChannelCircuitBreakers returns the circuit breakers of each model of the channel
+func GetChannelCircuitBreakers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	breakers := make([]breaker.Status, 0)
+	for _, modelName := range strings.Split(channel.Models, ",") {
+		if modelName == "" {
+			continue
+		}
+		breakers = append(breakers, breaker.Get(channel.Id, modelName))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    breakers,
+	})
+	return
+}
+
+// ResetChannelCircuitBreakers closes the circuit breaker of the model in the query,
+// or all models of the channel if the model is not specified
+func ResetChannelCircuitBreakers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	models := strings.Split(channel.Models, ",")
+	if modelName := c.Query("model"); modelName != "" {
+		models = []string{modelName}
+	}
+	for _, modelName := range models {
+		if modelName != "" {
+			breaker.Reset(channel.Id, modelName)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
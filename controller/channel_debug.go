@@ -65,6 +65,7 @@ func FixChannelModelConfigs(c *gin.Context) {
 		return
 	}
 
+	origin, _ := model.GetChannelById(channelId, true)
 	err = model.FixChannelModelConfigs(channelId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -73,6 +74,9 @@ func FixChannelModelConfigs(c *gin.Context) {
 		})
 		return
 	}
+	if fixed, err := model.GetChannelById(channelId, true); err == nil {
+		recordAudit(c, "channel.fix_model_configs", "channel", channelId, origin, fixed)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -107,6 +111,7 @@ func RemigratAllChannels(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.remigrate_model_configs", "channel", "", nil, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -202,6 +207,7 @@ func CleanAllMixedModelData(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.clean_mixed_model_data", "channel", "", nil, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
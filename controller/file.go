@@ -0,0 +1,393 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+var filePurposes = []string{"assistants", "batch", "fine-tune", "vision", "user_data", "evals"}
+
+const (
+	defaultFileListLimit = 100
+	maxFileListLimit     = 10000
+)
+
+// fileStorage returns the configured storage, it is a variable for testing
+var fileStorage = storage.Default
+
+// UploadFile saves a file uploaded by multipart form, the fields are `file` and `purpose`
+func UploadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	userId := c.GetInt(ctxkey.Id)
+
+	// reserve some space for the other fields of the form
+	maxBodySize := int64(config.MaxUploadFileSize)<<20 + 1<<20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+
+	purpose := c.PostForm("purpose")
+	if !slices.Contains(filePurposes, purpose) {
+		middleware.AbortWithError(c, http.StatusBadRequest,
+			errors.Errorf("invalid purpose %q, should be one of %s", purpose, strings.Join(filePurposes, ", ")))
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, errors.Wrap(err, "get file from form"))
+		return
+	}
+	if header.Size > int64(config.MaxUploadFileSize)<<20 {
+		middleware.AbortWithError(c, http.StatusRequestEntityTooLarge,
+			errors.Errorf("file size exceeds the limit of %d MB", config.MaxUploadFileSize))
+		return
+	}
+
+	store, err := fileStorage()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "get file storage"))
+		return
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, errors.Wrap(err, "open uploaded file"))
+		return
+	}
+	defer src.Close()
+
+	file := model.NewFile(userId, c.GetInt(ctxkey.TokenId), header.Filename, purpose, header.Size)
+	if err = store.Put(ctx, file.StorageKey, src, header.Size); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "save file"))
+		return
+	}
+	if err = file.Insert(); err != nil {
+		if delErr := store.Delete(ctx, file.StorageKey); delErr != nil {
+			logger.Errorf(ctx, "failed to delete orphan file %s: %+v", file.StorageKey, delErr)
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// saveFileContent saves the content generated by one-api itself as a file of the user,
+// such as the output of batches
+func saveFileContent(ctx context.Context, userId, tokenId int, filename, purpose string, content []byte) (*model.File, error) {
+	store, err := fileStorage()
+	if err != nil {
+		return nil, errors.Wrap(err, "get file storage")
+	}
+
+	file := model.NewFile(userId, tokenId, filename, purpose, int64(len(content)))
+	if err = store.Put(ctx, file.StorageKey, bytes.NewReader(content), file.Bytes); err != nil {
+		return nil, errors.Wrap(err, "save file")
+	}
+	if err = file.Insert(); err != nil {
+		if delErr := store.Delete(ctx, file.StorageKey); delErr != nil {
+			logger.Errorf(ctx, "failed to delete orphan file %s: %+v", file.StorageKey, delErr)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// ListFiles lists the files of the current user
+func ListFiles(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+
+	limit := defaultFileListLimit
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxFileListLimit {
+			middleware.AbortWithError(c, http.StatusBadRequest,
+				errors.Errorf("limit should be between 1 and %d", maxFileListLimit))
+			return
+		}
+	}
+
+	// fetch one more file to know whether there are more files
+	files, err := model.GetUserFiles(userId, c.Query("purpose"), c.Query("after"), limit+1, c.Query("order") == "asc")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusBadRequest, errors.Errorf("invalid after cursor %q", c.Query("after")))
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	resp := gin.H{
+		"object":   "list",
+		"data":     files,
+		"has_more": hasMore,
+	}
+	if len(files) > 0 {
+		resp["first_id"] = files[0].Id
+		resp["last_id"] = files[len(files)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// getUserFile loads the file in the path, it aborts the request if the file is not found
+func getUserFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetUserFileById(c.GetInt(ctxkey.Id), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("no such file: %s", c.Param("id")))
+			return nil, false
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return file, true
+}
+
+// RetrieveFile returns the metadata of a file
+func RetrieveFile(c *gin.Context) {
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// DeleteFile deletes a file and its copies on the upstream channels
+func DeleteFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+
+	store, err := fileStorage()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "get file storage"))
+		return
+	}
+
+	mirrors, err := model.GetFileMirrors(file.Id)
+	if err != nil {
+		logger.Errorf(ctx, "failed to get mirrors of file %s: %+v", file.Id, err)
+	}
+	if err = file.Delete(); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if err = store.Delete(ctx, file.StorageKey); err != nil {
+		logger.Errorf(ctx, "failed to delete file %s from storage: %+v", file.StorageKey, err)
+	}
+	for _, mirror := range mirrors {
+		if err = deleteUpstreamFile(ctx, mirror); err != nil {
+			logger.Warnf(ctx, "failed to delete upstream file %s on channel %d: %+v",
+				mirror.UpstreamFileId, mirror.ChannelId, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.Id,
+		"object":  "file",
+		"deleted": true,
+	})
+}
+
+// RetrieveFileContent returns the content of a file
+func RetrieveFileContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	file, ok := getUserFile(c)
+	if !ok {
+		return
+	}
+
+	store, err := fileStorage()
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "get file storage"))
+		return
+	}
+	content, err := store.Get(ctx, file.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("content of file %s is missing", file.Id))
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", content, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
+
+// defaultAzureFilesAPIVersion is the earliest azure api version that supports files and batches
+const defaultAzureFilesAPIVersion = "2024-10-21"
+
+// newChannelRequest creates a request to the OpenAI compatible api of the channel,
+// path is relative to `/v1`, such as `/files`.
+func newChannelRequest(ctx context.Context, channel *model.Channel, method, path string, body io.Reader) (*http.Request, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" && channel.Type < len(channeltype.ChannelBaseURLs) {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var requestURL string
+	if channel.Type == channeltype.Azure {
+		apiVersion := defaultAzureFilesAPIVersion
+		if cfg, err := channel.LoadConfig(); err == nil && cfg.APIVersion != "" {
+			apiVersion = cfg.APIVersion
+		}
+		requestURL = fmt.Sprintf("%s/openai%s?api-version=%s", baseURL, path, apiVersion)
+	} else {
+		requestURL = baseURL + "/v1" + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "new upstream request")
+	}
+	// the files are kept by the upstream account, so the first key of the multi-key channel is always used
+	keys, err := channel.Keys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("channel %d has no keys", channel.Id)
+	}
+	key := keys[0]
+	if channel.Type == channeltype.Azure {
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return req, nil
+}
+
+// doChannelRequest sends the request and returns the response body,
+// it returns an error if the upstream does not respond with 2xx.
+func doChannelRequest(req *http.Request) ([]byte, error) {
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", req.Method, req.URL.Path)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read upstream response")
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.Errorf("upstream returns status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// MirrorFileToChannel uploads the file to an OpenAI compatible channel and returns the upstream file id.
+//
+// The upstream file id is recorded, so each file is uploaded to each channel at most once.
+// It is used by the requests that refer to files by id, such as batches.
+func MirrorFileToChannel(ctx context.Context, file *model.File, channel *model.Channel) (string, error) {
+	mirror, err := model.GetFileMirror(file.Id, channel.Id)
+	if err == nil {
+		return mirror.UpstreamFileId, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	store, err := fileStorage()
+	if err != nil {
+		return "", errors.Wrap(err, "get file storage")
+	}
+	content, err := store.Get(ctx, file.StorageKey)
+	if err != nil {
+		return "", errors.Wrapf(err, "get content of file %s", file.Id)
+	}
+	defer content.Close()
+
+	// stream the multipart body to avoid loading the whole file into memory
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		err := writer.WriteField("purpose", file.Purpose)
+		if err == nil {
+			var part io.Writer
+			if part, err = writer.CreateFormFile("file", file.Filename); err == nil {
+				if _, err = io.Copy(part, content); err == nil {
+					err = writer.Close()
+				}
+			}
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	req, err := newChannelRequest(ctx, channel, http.MethodPost, "/files", pr)
+	if err != nil {
+		_ = pr.Close()
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	body, err := doChannelRequest(req)
+	if err != nil {
+		return "", errors.Wrap(err, "upload file to upstream")
+	}
+	var upstreamFile struct {
+		Id string `json:"id"`
+	}
+	if err = json.Unmarshal(body, &upstreamFile); err != nil || upstreamFile.Id == "" {
+		return "", errors.Errorf("invalid upstream response: %s", string(body))
+	}
+
+	mirror = &model.FileMirror{
+		FileId:         file.Id,
+		ChannelId:      channel.Id,
+		UpstreamFileId: upstreamFile.Id,
+	}
+	if err = mirror.Insert(); err != nil {
+		return "", err
+	}
+	return upstreamFile.Id, nil
+}
+
+func deleteUpstreamFile(ctx context.Context, mirror *model.FileMirror) error {
+	channel, err := model.GetChannelById(mirror.ChannelId, true)
+	if err != nil {
+		return errors.Wrapf(err, "get channel %d", mirror.ChannelId)
+	}
+
+	req, err := newChannelRequest(ctx, channel, http.MethodDelete, "/files/"+mirror.UpstreamFileId, nil)
+	if err != nil {
+		return err
+	}
+	_, err = doChannelRequest(req)
+	return err
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupFileTestRouter(t *testing.T, userId int) *gin.Engine {
+	store, err := storage.NewLocal(t.TempDir())
+	require.NoError(t, err)
+	originalStorage := fileStorage
+	fileStorage = func() (storage.Storage, error) { return store, nil }
+	t.Cleanup(func() { fileStorage = originalStorage })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.Id, userId)
+		c.Next()
+	})
+	router.GET("/v1/files", ListFiles)
+	router.POST("/v1/files", UploadFile)
+	router.GET("/v1/files/:id", RetrieveFile)
+	router.DELETE("/v1/files/:id", DeleteFile)
+	router.GET("/v1/files/:id/content", RetrieveFileContent)
+	return router
+}
+
+func uploadTestFile(t *testing.T, router *gin.Engine, purpose, filename, content string) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("purpose", purpose))
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestFilesAPI(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupFileTestRouter(t, 1)
+
+	w := uploadTestFile(t, router, "batch", "input.jsonl", `{"custom_id":"1"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var file model.File
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &file))
+	assert.Equal(t, "file", file.Object)
+	assert.Equal(t, "batch", file.Purpose)
+	assert.Equal(t, "input.jsonl", file.Filename)
+	assert.Equal(t, int64(17), file.Bytes)
+
+	w = uploadTestFile(t, router, "unknown", "input.jsonl", "x")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files?purpose=batch", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data    []model.File `json:"data"`
+		HasMore bool         `json:"has_more"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	assert.Equal(t, file.Id, list.Data[0].Id)
+	assert.False(t, list.HasMore)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files/"+file.Id+"/content", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"custom_id":"1"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/files/"+file.Id, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files/"+file.Id, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFilesAPI_Pagination(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupFileTestRouter(t, 1)
+
+	for i := 0; i < 3; i++ {
+		w := uploadTestFile(t, router, "batch", fmt.Sprintf("%d.jsonl", i), "x")
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	var ids []string
+	after := ""
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files?limit=2&after="+after, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Data    []model.File `json:"data"`
+			HasMore bool         `json:"has_more"`
+			LastId  string       `json:"last_id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		for _, f := range list.Data {
+			ids = append(ids, f.Id)
+		}
+		if !list.HasMore {
+			break
+		}
+		after = list.LastId
+	}
+	assert.Len(t, ids, 3)
+}
+
+func TestFilesAPI_OwnedByUser(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	w := uploadTestFile(t, setupFileTestRouter(t, 1), "batch", "input.jsonl", "x")
+	require.Equal(t, http.StatusOK, w.Code)
+	var file model.File
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &file))
+
+	w = httptest.NewRecorder()
+	setupFileTestRouter(t, 2).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/files/"+file.Id, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMirrorFileToChannel(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	router := setupFileTestRouter(t, 1)
+	client.Init()
+
+	uploads := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/files", r.URL.Path)
+		assert.Equal(t, "Bearer sk-upstream", r.Header.Get("Authorization"))
+		assert.Equal(t, "batch", r.FormValue("purpose"))
+		uploads++
+		_, _ = w.Write([]byte(`{"id":"file-upstream","object":"file"}`))
+	}))
+	defer upstream.Close()
+
+	w := uploadTestFile(t, router, "batch", "input.jsonl", "x")
+	require.Equal(t, http.StatusOK, w.Code)
+	var uploaded model.File
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	file, err := model.GetUserFileById(1, uploaded.Id)
+	require.NoError(t, err)
+
+	baseURL := upstream.URL
+	channel := &model.Channel{Id: 1, Key: "sk-upstream", BaseURL: &baseURL}
+	for i := 0; i < 2; i++ {
+		upstreamId, err := MirrorFileToChannel(t.Context(), file, channel)
+		require.NoError(t, err)
+		assert.Equal(t, "file-upstream", upstreamId)
+	}
+	assert.Equal(t, 1, uploads)
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// logExportColumns are the columns of the exported csv
+var logExportColumns = []string{"id", "created_at", "type", "user_id", "username", "token_id", "token_name",
+	"model_name", "group", "channel_id", "quota", "prompt_tokens", "completion_tokens", "elapsed_time",
+	"is_stream", "cache_hit", "request_id", "content"}
+
+func logExportRow(log *model.Log) []string {
+	return []string{
+		strconv.Itoa(log.Id),
+		strconv.FormatInt(log.CreatedAt, 10),
+		strconv.Itoa(log.Type),
+		strconv.Itoa(log.UserId),
+		csvSafe(log.Username),
+		strconv.Itoa(log.TokenId),
+		csvSafe(log.TokenName),
+		csvSafe(log.ModelName),
+		csvSafe(log.Group),
+		strconv.Itoa(log.ChannelId),
+		strconv.Itoa(log.Quota),
+		strconv.Itoa(log.PromptTokens),
+		strconv.Itoa(log.CompletionTokens),
+		strconv.FormatInt(log.ElapsedTime, 10),
+		strconv.FormatBool(log.IsStream),
+		strconv.FormatBool(log.CacheHit),
+		csvSafe(log.RequestId),
+		csvSafe(log.Content),
+	}
+}
+
+// csvSafe prefixes the text cell starting with a formula character by a quote,
+// so the spreadsheets don't evaluate the user-controlled text as a formula.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// logExportRecord is the row of the exported parquet, the columns are the same as the csv
+type logExportRecord struct {
+	Id               int    `parquet:"id"`
+	CreatedAt        int64  `parquet:"created_at"`
+	Type             int    `parquet:"type"`
+	UserId           int    `parquet:"user_id"`
+	Username         string `parquet:"username"`
+	TokenId          int    `parquet:"token_id"`
+	TokenName        string `parquet:"token_name"`
+	ModelName        string `parquet:"model_name"`
+	Group            string `parquet:"group"`
+	ChannelId        int    `parquet:"channel_id"`
+	Quota            int    `parquet:"quota"`
+	PromptTokens     int    `parquet:"prompt_tokens"`
+	CompletionTokens int    `parquet:"completion_tokens"`
+	ElapsedTime      int64  `parquet:"elapsed_time"`
+	IsStream         bool   `parquet:"is_stream"`
+	CacheHit         bool   `parquet:"cache_hit"`
+	RequestId        string `parquet:"request_id"`
+	Content          string `parquet:"content"`
+}
+
+func newLogExportRecord(log *model.Log) logExportRecord {
+	return logExportRecord{
+		Id:               log.Id,
+		CreatedAt:        log.CreatedAt,
+		Type:             log.Type,
+		UserId:           log.UserId,
+		Username:         log.Username,
+		TokenId:          log.TokenId,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		Group:            log.Group,
+		ChannelId:        log.ChannelId,
+		Quota:            log.Quota,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		ElapsedTime:      log.ElapsedTime,
+		IsStream:         log.IsStream,
+		CacheHit:         log.CacheHit,
+		RequestId:        log.RequestId,
+		Content:          log.Content,
+	}
+}
+
+// logExportWriter writes the exported logs in a format
+type logExportWriter interface {
+	Write(log *model.Log) error
+	// Flush sends the buffered logs to the client
+	Flush() error
+	// Close writes the rest of the logs and the footer if any
+	Close() error
+}
+
+type csvLogExportWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvLogExportWriter) Write(log *model.Log) error {
+	return errors.WithStack(w.w.Write(logExportRow(log)))
+}
+
+func (w *csvLogExportWriter) Flush() error {
+	w.w.Flush()
+	return errors.WithStack(w.w.Error())
+}
+
+func (w *csvLogExportWriter) Close() error {
+	return w.Flush()
+}
+
+type jsonlLogExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlLogExportWriter) Write(log *model.Log) error {
+	return errors.WithStack(w.encoder.Encode(log))
+}
+
+func (w *jsonlLogExportWriter) Flush() error { return nil }
+
+func (w *jsonlLogExportWriter) Close() error { return nil }
+
+// parquetLogExportRowGroupSize is the number of logs in a row group of the parquet exports,
+// the buffered rows are written to the response once a row group is full.
+const parquetLogExportRowGroupSize = 10000
+
+// parquetLogExportWriter writes a row group every parquetLogExportRowGroupSize logs, and the footer on close
+type parquetLogExportWriter struct {
+	w *parquet.GenericWriter[logExportRecord]
+}
+
+func (w *parquetLogExportWriter) Write(log *model.Log) error {
+	_, err := w.w.Write([]logExportRecord{newLogExportRecord(log)})
+	return errors.WithStack(err)
+}
+
+// Flush doesn't cut the row group, the row groups are cut by their size rather than the batches of the logs,
+// since the small row groups compress poorly
+func (w *parquetLogExportWriter) Flush() error { return nil }
+
+func (w *parquetLogExportWriter) Close() error {
+	return errors.Wrap(w.w.Close(), "write parquet footer")
+}
+
+// newLogExportWriter returns the writer of format to out, and the content type of the format
+func newLogExportWriter(format string, out io.Writer) (logExportWriter, string, error) {
+	switch format {
+	case "csv":
+		csvWriter := csv.NewWriter(out)
+		if err := csvWriter.Write(logExportColumns); err != nil {
+			return nil, "", errors.Wrap(err, "write csv header")
+		}
+		return &csvLogExportWriter{w: csvWriter}, "text/csv; charset=utf-8", nil
+	case "jsonl":
+		return &jsonlLogExportWriter{encoder: json.NewEncoder(out)}, "application/x-ndjson", nil
+	case "parquet":
+		parquetWriter := parquet.NewGenericWriter[logExportRecord](out,
+			parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(parquetLogExportRowGroupSize))
+		return &parquetLogExportWriter{w: parquetWriter}, "application/vnd.apache.parquet", nil
+	default:
+		return nil, "", errors.Errorf("unknown export format %q, should be csv, jsonl or parquet", format)
+	}
+}
+
+// ExportLogs streams the logs matching the same filters as GetAllLogs, the earliest first,
+// format is csv (by default), jsonl or parquet.
+func ExportLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	exportWriter, contentType, err := newLogExportWriter(format, c.Writer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	username := c.Query("username")
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	channel, _ := strconv.Atoi(c.Query("channel"))
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("logs-%s.%s", time.Now().Format("20060102150405"), format)))
+	c.Status(http.StatusOK)
+
+	// the status is already sent, so the error could only be logged and the export is truncated
+	err = model.ExportLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel,
+		func(logs []*model.Log) error {
+			for _, log := range logs {
+				if err := exportWriter.Write(log); err != nil {
+					return errors.Wrap(err, "write log")
+				}
+			}
+			if err := exportWriter.Flush(); err != nil {
+				return errors.WithStack(err)
+			}
+			c.Writer.Flush()
+			return nil
+		})
+	if closeErr := exportWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to export logs: %+v", err)
+	}
+}
@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 )
 
@@ -177,3 +182,58 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetLogAnalytics aggregates the usage of all users,
+// e.g. /api/log/analytics?granularity=day&group_by=user,model
+func GetLogAnalytics(c *gin.Context) {
+	query := parseAnalyticsQuery(c)
+	query.Username = c.Query("username")
+	query.ChannelId, _ = strconv.Atoi(c.Query("channel"))
+	respondLogAnalytics(c, query)
+}
+
+// GetSelfLogAnalytics aggregates the usage of the current user
+func GetSelfLogAnalytics(c *gin.Context) {
+	query := parseAnalyticsQuery(c)
+	query.UserId = c.GetInt(ctxkey.Id)
+	respondLogAnalytics(c, query)
+}
+
+func parseAnalyticsQuery(c *gin.Context) model.AnalyticsQuery {
+	query := model.AnalyticsQuery{
+		ModelName:   c.Query("model_name"),
+		TokenName:   c.Query("token_name"),
+		Granularity: c.Query("granularity"),
+	}
+	query.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		query.GroupBy = strings.Split(groupBy, ",")
+	}
+	return query
+}
+
+func respondLogAnalytics(c *gin.Context, query model.AnalyticsQuery) {
+	rows, err := model.GetLogAnalytics(query)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rows,
+	})
+}
+
+// AutomaticallyRollupLogs aggregates the new logs into the hourly and daily rollups periodically
+func AutomaticallyRollupLogs() {
+	ctx := context.Background()
+	interval := time.Duration(config.LogRollupInterval) * time.Second
+	for {
+		if err := model.RollupLogs(ctx, time.Now()); err != nil {
+			logger.SysError("failed to rollup logs: " + err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
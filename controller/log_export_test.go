@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestCsvSafe(t *testing.T) {
+	for cell, expected := range map[string]string{
+		"":                  "",
+		"gpt-4o":            "gpt-4o",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1+1":              "'-1+1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\t=1":              "'\t=1",
+	} {
+		assert.Equal(t, expected, csvSafe(cell), cell)
+	}
+}
+
+func TestLogExportWriter(t *testing.T) {
+	logs := []*model.Log{
+		{Id: 1, CreatedAt: 1700000000, Type: model.LogTypeConsume, Username: "=cmd", ModelName: "gpt-4o", Quota: -5, Content: "hello"},
+		{Id: 2, CreatedAt: 1700000001, Type: model.LogTypeConsume, Username: "alice", ModelName: "gpt-4o-mini", IsStream: true},
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		w, contentType, err := newLogExportWriter("csv", out)
+		require.NoError(t, err)
+		assert.Equal(t, "text/csv; charset=utf-8", contentType)
+		for _, log := range logs {
+			require.NoError(t, w.Write(log))
+		}
+		require.NoError(t, w.Close())
+
+		rows, err := csv.NewReader(out).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 3)
+		assert.Equal(t, logExportColumns, rows[0])
+		// the text cells are neutralised, and the numbers are kept
+		assert.Equal(t, "'=cmd", rows[1][4])
+		assert.Equal(t, "-5", rows[1][10])
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		w, contentType, err := newLogExportWriter("parquet", out)
+		require.NoError(t, err)
+		assert.Equal(t, "application/vnd.apache.parquet", contentType)
+		for _, log := range logs {
+			require.NoError(t, w.Write(log))
+		}
+		require.NoError(t, w.Close())
+
+		records, err := parquet.Read[logExportRecord](bytes.NewReader(out.Bytes()), int64(out.Len()))
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "=cmd", records[0].Username)
+		assert.Equal(t, -5, records[0].Quota)
+		assert.Equal(t, "gpt-4o-mini", records[1].ModelName)
+		assert.True(t, records[1].IsStream)
+	})
+
+	t.Run("parquet row groups", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		w, _, err := newLogExportWriter("parquet", out)
+		require.NoError(t, err)
+		for i := 0; i <= parquetLogExportRowGroupSize; i++ {
+			require.NoError(t, w.Write(logs[i%len(logs)]))
+		}
+		// the full row group is written before the export is closed
+		assert.Positive(t, out.Len())
+		require.NoError(t, w.Close())
+
+		file, err := parquet.OpenFile(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		require.NoError(t, err)
+		require.Len(t, file.RowGroups(), 2)
+		assert.EqualValues(t, parquetLogExportRowGroupSize, file.RowGroups()[0].NumRows())
+	})
+
+	_, _, err := newLogExportWriter("xlsx", new(bytes.Buffer))
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetNotificationPreference returns the notification preference of the current user
+func GetNotificationPreference(c *gin.Context) {
+	pref, err := model.GetNotificationPreference(c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    pref,
+	})
+}
+
+// UpdateNotificationPreference updates the notification preference of the current user
+func UpdateNotificationPreference(c *gin.Context) {
+	pref := new(model.NotificationPreference)
+	if err := json.NewDecoder(c.Request.Body).Decode(pref); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	pref.UserId = c.GetInt(ctxkey.Id)
+	if err := pref.ValidateNotificationPreference(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.SaveNotificationPreference(*pref); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    pref,
+	})
+}
+
+// GetNotifications returns the notification history of the current user
+func GetNotifications(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	notifications, err := model.GetNotifications(c.GetInt(ctxkey.Id), p*config.DefaultItemsPerPage, config.DefaultItemsPerPage)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    notifications,
+	})
+}
+
+// TestNotification sends a test notification by all the channels of the current user
+func TestNotification(c *gin.Context) {
+	err := model.NotifyUser(c.Request.Context(), c.GetInt(ctxkey.Id), model.NotificationEventTest,
+		"Test Notification", "This is a test notification from "+config.SystemName+".", "")
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// AutomaticallyCheckNotifications warns the users about the expiring tokens and the budgets periodically
+func AutomaticallyCheckNotifications() {
+	ctx := context.Background()
+	interval := time.Duration(config.NotificationCheckInterval) * time.Second
+	for {
+		time.Sleep(interval)
+		if err := model.CheckNotifications(ctx, time.Now()); err != nil {
+			logger.SysError("failed to check notifications: " + err.Error())
+		}
+	}
+}
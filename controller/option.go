@@ -3,7 +3,6 @@ package controller
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -11,13 +10,14 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/balancer"
 )
 
 func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	config.OptionMapRWMutex.Lock()
 	for k, v := range config.OptionMap {
-		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") {
+		if model.IsSecretOption(k) {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -53,6 +53,22 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "LoadBalancingStrategy":
+		if !balancer.IsValidStrategy(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid load balancing strategy",
+			})
+			return
+		}
+	case "GroupLoadBalancingStrategy", "ModelLoadBalancingStrategy":
+		if _, err = balancer.ParseStrategies(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "GitHubOAuthEnabled":
 		if option.Value == "true" && config.GitHubClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -86,6 +102,9 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	config.OptionMapRWMutex.RLock()
+	originValue, exists := config.OptionMap[option.Key]
+	config.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -94,6 +113,12 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	// the option key is used as the field, so the tokens and the secrets are redacted
+	var before map[string]string
+	if exists {
+		before = map[string]string{option.Key: originValue}
+	}
+	recordAudit(c, "option.update", "option", option.Key, before, map[string]string{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
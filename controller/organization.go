@@ -0,0 +1,449 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getOrganizationMember returns the membership of the current user in the organization of the url,
+// root users are treated as the owner of every organization.
+func getOrganizationMember(c *gin.Context) (*model.OrganizationMember, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid organization id")
+	}
+	userId := c.GetInt(ctxkey.Id)
+	member, err := model.GetOrganizationMember(id, userId)
+	if err == nil {
+		return member, nil
+	}
+	if c.GetInt(ctxkey.Role) == model.RoleRootUser {
+		return &model.OrganizationMember{OrganizationId: id, UserId: userId, Role: model.OrganizationRoleOwner}, nil
+	}
+	return nil, errors.New("you are not a member of this organization")
+}
+
+func GetUserOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+}
+
+// GetAllOrganizations lists all the organizations, only for admins
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orgs, err := model.GetAllOrganizations(p*config.MaxItemsPerPage, config.MaxItemsPerPage)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+}
+
+func GetOrganization(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": model.UserOrganization{
+			Organization: *org,
+			Role:         member.Role,
+		},
+	})
+}
+
+type organizationRequest struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	if req.Name == "" || len(req.Name) > 64 {
+		helper.RespondError(c, errors.New("organization name should be 1 to 64 characters"))
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanManageMembers() {
+		helper.RespondError(c, errors.New("only the owners could update the organization"))
+		return
+	}
+	var req organizationRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrganizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if req.Name != "" {
+		if len(req.Name) > 64 {
+			helper.RespondError(c, errors.New("organization name should be 1 to 64 characters"))
+			return
+		}
+		org.Name = req.Name
+	}
+	if req.Status == model.OrganizationStatusEnabled || req.Status == model.OrganizationStatusDisabled {
+		org.Status = req.Status
+	}
+	if err := org.Update(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org,
+	})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanManageMembers() {
+		helper.RespondError(c, errors.New("only the owners could delete the organization"))
+		return
+	}
+	if err := model.DeleteOrganization(c.Request.Context(), member.OrganizationId, c.GetInt(ctxkey.Id)); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type organizationQuotaRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+// TopUpOrganization transfers the quota of the current user to the pool of the organization
+func TopUpOrganization(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanManageBilling() {
+		helper.RespondError(c, errors.New("only the owners and the billing members could top up the organization"))
+		return
+	}
+	var req organizationQuotaRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	err = model.TransferQuotaToOrganization(c.Request.Context(), member.OrganizationId, c.GetInt(ctxkey.Id), req.Quota)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// SetOrganizationQuota sets the quota of the pool, only for admins
+func SetOrganizationQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid organization id"))
+		return
+	}
+	var req organizationQuotaRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.SetOrganizationQuota(id, req.Quota); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	model.RecordLog(c.Request.Context(), c.GetInt(ctxkey.Id), model.LogTypeManage,
+		fmt.Sprintf("Admin changed quota of organization %s from %s to %s",
+			org.Name, common.LogQuota(org.Quota), common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	members, err := model.GetOrganizationMembers(member.OrganizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+type organizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit *int64 `json:"quota_limit"`
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanManageMembers() {
+		helper.RespondError(c, errors.New("only the owners could add members"))
+		return
+	}
+	var req organizationMemberRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	if !model.IsValidOrganizationRole(req.Role) {
+		helper.RespondError(c, errors.Errorf("invalid role %q", req.Role))
+		return
+	}
+	quotaLimit := int64(0)
+	if req.QuotaLimit != nil {
+		quotaLimit = *req.QuotaLimit
+	}
+	if quotaLimit < 0 {
+		helper.RespondError(c, errors.New("quota limit should not be negative"))
+		return
+	}
+	user := model.User{Username: req.Username}
+	if err := user.FillUserByUsername(); err != nil || user.Id == 0 {
+		helper.RespondError(c, errors.Errorf("user %s not found", req.Username))
+		return
+	}
+	newMember := &model.OrganizationMember{
+		OrganizationId: member.OrganizationId,
+		UserId:         user.Id,
+		Role:           req.Role,
+		QuotaLimit:     quotaLimit,
+	}
+	if err := newMember.Insert(); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "add member, the user may be a member already"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    newMember,
+	})
+}
+
+// UpdateOrganizationMember updates the role and the spending cap of a member,
+// the owners could update both, while the billing members could only update the spending cap.
+func UpdateOrganizationMember(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationMemberRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	target, err := model.GetOrganizationMember(member.OrganizationId, req.UserId)
+	if err != nil {
+		helper.RespondError(c, errors.New("member not found"))
+		return
+	}
+	if req.Role != "" && req.Role != target.Role {
+		if !member.CanManageMembers() {
+			helper.RespondError(c, errors.New("only the owners could change the roles"))
+			return
+		}
+		if !model.IsValidOrganizationRole(req.Role) {
+			helper.RespondError(c, errors.Errorf("invalid role %q", req.Role))
+			return
+		}
+		if target.Role == model.OrganizationRoleOwner {
+			if err := checkNotLastOwner(member.OrganizationId); err != nil {
+				helper.RespondError(c, err)
+				return
+			}
+		}
+		target.Role = req.Role
+	}
+	if req.QuotaLimit != nil && *req.QuotaLimit != target.QuotaLimit {
+		if !member.CanManageBilling() {
+			helper.RespondError(c, errors.New("only the owners and the billing members could change the spending caps"))
+			return
+		}
+		if *req.QuotaLimit < 0 {
+			helper.RespondError(c, errors.New("quota limit should not be negative"))
+			return
+		}
+		target.QuotaLimit = *req.QuotaLimit
+	}
+	if err := target.Update(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    target,
+	})
+}
+
+// RemoveOrganizationMember removes a member, the members could also leave by themselves
+func RemoveOrganizationMember(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid user id"))
+		return
+	}
+	if userId != member.UserId && !member.CanManageMembers() {
+		helper.RespondError(c, errors.New("only the owners could remove members"))
+		return
+	}
+	target, err := model.GetOrganizationMember(member.OrganizationId, userId)
+	if err != nil {
+		helper.RespondError(c, errors.New("member not found"))
+		return
+	}
+	if target.Role == model.OrganizationRoleOwner {
+		if err := checkNotLastOwner(member.OrganizationId); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+	}
+	if err := target.Delete(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func checkNotLastOwner(organizationId int) error {
+	owners, err := model.CountOrganizationOwners(organizationId)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return errors.New("an organization should have at least one owner")
+	}
+	return nil
+}
+
+// GetOrganizationTokens lists the tokens of the organization, the owners see all of them,
+// while the developers only see their own ones.
+func GetOrganizationTokens(c *gin.Context) {
+	member, err := getOrganizationMember(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanUseTokens() {
+		helper.RespondError(c, errors.New("only the owners and the developers could view the tokens"))
+		return
+	}
+	tokens, err := model.GetOrganizationTokens(member.OrganizationId, member.UserId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !member.CanManageMembers() {
+		ownTokens := make([]*model.Token, 0, len(tokens))
+		for _, token := range tokens {
+			if token.UserId == member.UserId {
+				ownTokens = append(ownTokens, token)
+			}
+		}
+		tokens = ownTokens
+	}
+	rollTokenBudgets(tokens)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tokens,
+	})
+}
@@ -109,6 +109,7 @@ func AddRedemption(c *gin.Context) {
 		return
 	}
 	var keys []string
+	var ids []int
 	for i := 0; i < redemption.Count; i++ {
 		key := random.GetUUID()
 		cleanRedemption := model.Redemption{
@@ -128,7 +129,11 @@ func AddRedemption(c *gin.Context) {
 			return
 		}
 		keys = append(keys, key)
+		ids = append(ids, cleanRedemption.Id)
 	}
+	// the keys are secrets, only the ids of the redemption codes are recorded
+	recordAudit(c, "redemption.create", "redemption", "", nil,
+		gin.H{"name": redemption.Name, "quota": redemption.Quota, "count": len(ids), "ids": ids})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -19,6 +19,9 @@ import (
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/balancer"
+	"github.com/songquanpeng/one-api/relay/breaker"
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -27,8 +30,18 @@ import (
 
 // https://platform.openai.com/docs/api-reference/chat
 
-func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
-	var err *model.ErrorWithStatusCode
+func relayHelper(c *gin.Context, relayMode int) (err *model.ErrorWithStatusCode) {
+	// track the requests in flight and the latency for the load balancing
+	channelId := c.GetInt(ctxkey.ChannelId)
+	done := balancer.Start(channelId)
+	defer func() {
+		done(err == nil)
+		breaker.Record(channelId, c.GetString(ctxkey.OriginalModel), err == nil || !breaker.IsFailure(err.StatusCode))
+	}()
+	if setupErr, ok := c.Value(ctxkey.ChannelError).(error); ok {
+		return openai.ErrorWrapper(setupErr, "channel_setup_failed", http.StatusInternalServerError)
+	}
+
 	switch relayMode {
 	case relaymode.ImagesGenerations,
 		relaymode.ImagesEdits:
@@ -43,6 +56,14 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayProxyHelper(c, relayMode)
 	case relaymode.ResponseAPI:
 		err = controller.RelayResponseAPIHelper(c)
+	case relaymode.ClaudeMessages:
+		err = controller.RelayClaudeMessagesHelper(c)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c)
+	case relaymode.VideoGenerations:
+		err = controller.RelayVideoHelper(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -64,7 +85,15 @@ func Relay(c *gin.Context) {
 	// Track channel request in flight
 	PrometheusMonitor.RecordChannelRequest(relayMeta, startTime)
 
-	bizErr := relayHelper(c, relayMode)
+	var bizErr *model.ErrorWithStatusCode
+	var hedgeFailedChannelIds []int
+	if delay := getHedgeDelay(c, relayMode); delay > 0 {
+		bizErr, hedgeFailedChannelIds = relayHedged(c, relayMode, delay)
+		// the context of the winner is copied back
+		channelId = c.GetInt(ctxkey.ChannelId)
+	} else {
+		bizErr = relayHelper(c, relayMode)
+	}
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
 
@@ -76,7 +105,7 @@ func Relay(c *gin.Context) {
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+	go processChannelRelayError(ctx, userId, channelId, c.GetInt(ctxkey.ChannelKeyId), channelName, group, originalModel, *bizErr)
 
 	// Record failed relay request metrics
 	PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, false, 0, 0, 0)
@@ -116,6 +145,9 @@ func Relay(c *gin.Context) {
 	// Track failed channels to avoid retrying them, especially for 429 errors
 	failedChannels := make(map[int]bool)
 	failedChannels[lastFailedChannelId] = true
+	for _, id := range hedgeFailedChannelIds {
+		failedChannels[id] = true
+	}
 
 	// Debug logging to track channel exclusions (only when debug is enabled)
 	if config.DebugEnabled {
@@ -171,7 +203,9 @@ func Relay(c *gin.Context) {
 		}
 
 		logger.Infof(ctx, "using channel #%d to retry (remain times %d)", channel.Id, i)
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		if err = middleware.SetupContextForSelectedChannel(c, channel, originalModel); err != nil {
+			logger.Errorf(ctx, "failed to set up channel #%d: %+v", channel.Id, err)
+		}
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
@@ -181,6 +215,8 @@ func Relay(c *gin.Context) {
 
 		bizErr = relayHelper(c, relayMode)
 		if bizErr == nil {
+			monitor.Emit(channel.Id, true)
+
 			// Record successful retry
 			PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, true, 0, 0, 0)
 			return
@@ -202,7 +238,7 @@ func Relay(c *gin.Context) {
 		// Update group and originalModel potentially if changed by middleware, though unlikely for these.
 		group = c.GetString(ctxkey.Group)
 		originalModel = c.GetString(ctxkey.OriginalModel)
-		go processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+		go processChannelRelayError(ctx, userId, channelId, c.GetInt(ctxkey.ChannelKeyId), channelName, group, originalModel, *bizErr)
 	}
 
 	if bizErr != nil {
@@ -215,8 +251,33 @@ func Relay(c *gin.Context) {
 			}
 		}
 
+		// record the failed request, so the errors are counted by the analytics
+		errorLog := &dbmodel.Log{
+			UserId:      userId,
+			ChannelId:   lastFailedChannelId,
+			ModelName:   originalModel,
+			TokenName:   c.GetString(ctxkey.TokenName),
+			TokenId:     c.GetInt(ctxkey.TokenId),
+			Group:       group,
+			Content:     fmt.Sprintf("request failed with status %d: %s", bizErr.StatusCode, bizErr.Error.Message),
+			IsStream:    meta.GetByContext(c).IsStream,
+			ElapsedTime: helper.CalcElapsedTime(startTime),
+		}
+		go dbmodel.RecordErrorLog(context.WithoutCancel(ctx), errorLog)
+
 		// BUG: bizErr is in race condition
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		if relayMode == relaymode.ClaudeMessages {
+			// anthropic sdk expects the native error format
+			c.JSON(bizErr.StatusCode, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    bizErr.Error.Type,
+					"message": bizErr.Error.Message,
+				},
+			})
+			return
+		}
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
@@ -290,8 +351,14 @@ func logChannelSuspensionStatus(ctx context.Context, group, model string, failed
 	}
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, group string, originalModel string, err model.ErrorWithStatusCode) {
+// processChannelRelayError suspends or disables the channel by the error,
+// keyId is the key used by the multi-key channel, which is handled by processChannelKeyError.
+func processChannelRelayError(ctx context.Context, userId int, channelId int, keyId int, channelName string, group string, originalModel string, err model.ErrorWithStatusCode) {
 	logger.Errorf(ctx, "relay error (channel id %d, name %s, user_id %d, group: %s, model: %s): %s", channelId, channelName, userId, group, originalModel, err.Message)
+	if keyId != 0 && err.StatusCode != http.StatusBadRequest && processChannelKeyError(ctx, channelId, keyId, err) {
+		monitor.Emit(channelId, false)
+		return
+	}
 
 	// Handle 400 errors differently - they are client request issues, not channel problems
 	if err.StatusCode == http.StatusBadRequest {
@@ -322,6 +389,26 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 	}
 }
 
+// processChannelKeyError cools down the key of the multi-key channel on 429, and disables the key
+// on the errors that would disable the channel. It returns false if no key of the channel is still available,
+// then the channel itself should be suspended or disabled.
+func processChannelKeyError(ctx context.Context, channelId int, keyId int, err model.ErrorWithStatusCode) bool {
+	var cooldown time.Duration
+	if err.StatusCode == http.StatusTooManyRequests {
+		cooldown = config.ChannelSuspendSecondsFor429
+	}
+	disable := monitor.ShouldDisableChannel(&err.Error, err.StatusCode)
+	available, keyErr := dbmodel.RecordChannelKeyError(keyId, err.Message, cooldown, disable)
+	if keyErr != nil {
+		logger.Errorf(ctx, "failed to record error of key %d of channel %d: %+v", keyId, channelId, keyErr)
+		return false
+	}
+	if disable {
+		logger.Infof(ctx, "key %d of channel %d has been disabled, %d keys are still available", keyId, channelId, available)
+	}
+	return available > 0
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := model.Error{
 		Message: "API not implemented",
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// hedgeRelayModes are the relay modes that could be hedged,
+// their helpers don't bill the attempts that lost the race.
+var hedgeRelayModes = map[int]bool{
+	relaymode.ChatCompletions: true,
+	relaymode.Completions:     true,
+	relaymode.Embeddings:      true,
+	relaymode.ResponseAPI:     true,
+	relaymode.ClaudeMessages:  true,
+}
+
+// getHedgeDelay returns the hedge delay of the request, 0 means the request should not be hedged
+func getHedgeDelay(c *gin.Context, relayMode int) time.Duration {
+	if !hedgeRelayModes[relayMode] || c.GetInt(ctxkey.SpecificChannelId) != 0 {
+		return 0
+	}
+	return hedge.GetDelay(c.GetInt(ctxkey.HedgeDelay), c.GetString(ctxkey.Group))
+}
+
+// hedgeAttempt is an attempt of a hedged request, it runs on a copy of the gin context
+type hedgeAttempt struct {
+	c           *gin.Context
+	writer      *hedge.Writer
+	channelId   int
+	channelName string
+	startTime   time.Time
+	err         *model.ErrorWithStatusCode
+	done        chan struct{}
+}
+
+// startHedgeAttempt relays the request in background, to the channel if it's not nil,
+// otherwise to the channel already selected in c.
+func startHedgeAttempt(c *gin.Context, race *hedge.Race, relayMode int, channel *dbmodel.Channel) (*hedgeAttempt, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "get request body")
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	cp := c.Copy()
+	// each attempt has its own meta
+	delete(cp.Keys, ctxkey.Meta)
+	cp.Request = c.Request.Clone(ctx)
+	cp.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	writer := race.NewWriter(cancel)
+	cp.Writer = writer
+	if channel != nil {
+		if err = middleware.SetupContextForSelectedChannel(cp, channel, c.GetString(ctxkey.OriginalModel)); err != nil {
+			logger.Errorf(ctx, "failed to set up channel #%d: %+v", channel.Id, err)
+		}
+	}
+
+	attempt := &hedgeAttempt{
+		c:           cp,
+		writer:      writer,
+		channelId:   cp.GetInt(ctxkey.ChannelId),
+		channelName: cp.GetString(ctxkey.ChannelName),
+		startTime:   time.Now(),
+		done:        make(chan struct{}),
+	}
+	go func() {
+		defer close(attempt.done)
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorf(ctx, "panic in hedged request to channel #%d: %v", attempt.channelId, r)
+				attempt.err = openai.ErrorWrapper(errors.Errorf("panic: %v", r), "hedge_panic", http.StatusInternalServerError)
+			}
+		}()
+		attempt.err = relayHelper(cp, relayMode)
+	}()
+	return attempt, nil
+}
+
+// relayHedged relays the request to the selected channel, and races another channel against it
+// if the selected one hasn't written the first byte in delay.
+//
+// The context of the winner is copied back to c. It returns the error of the request,
+// and the channels failed besides the one in c, which should be excluded by retries.
+func relayHedged(c *gin.Context, relayMode int, delay time.Duration) (*model.ErrorWithStatusCode, []int) {
+	ctx := c.Request.Context()
+	race := hedge.NewRace(c.Writer)
+	primary, err := startHedgeAttempt(c, race, relayMode, nil)
+	if err != nil {
+		logger.Errorf(ctx, "failed to start hedged request: %+v", err)
+		return relayHelper(c, relayMode), nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-race.Won():
+	case <-primary.done:
+	case <-timer.C:
+	}
+	if race.Winner() != nil || isHedgeAttemptDone(primary) {
+		return finishHedge(c, []*hedgeAttempt{primary})
+	}
+
+	group, originalModel := c.GetString(ctxkey.Group), c.GetString(ctxkey.OriginalModel)
+	exclude := map[int]bool{primary.channelId: true}
+	channel, err := dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, false, exclude, false)
+	if err != nil {
+		channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, true, exclude, false)
+	}
+	if err != nil {
+		logger.Infof(ctx, "no channel to hedge the request to channel #%d: %v", primary.channelId, err)
+		return finishHedge(c, []*hedgeAttempt{primary})
+	}
+
+	logger.Infof(ctx, "channel #%d hasn't responded in %s, hedging the request to channel #%d", primary.channelId, delay, channel.Id)
+	secondary, err := startHedgeAttempt(c, race, relayMode, channel)
+	if err != nil {
+		logger.Errorf(ctx, "failed to start hedged request: %+v", err)
+		return finishHedge(c, []*hedgeAttempt{primary})
+	}
+	return finishHedge(c, []*hedgeAttempt{primary, secondary})
+}
+
+func isHedgeAttemptDone(attempt *hedgeAttempt) bool {
+	select {
+	case <-attempt.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// finishHedge waits for all attempts, the losers are cancelled once the winner writes the first byte
+func finishHedge(c *gin.Context, attempts []*hedgeAttempt) (*model.ErrorWithStatusCode, []int) {
+	for _, attempt := range attempts {
+		<-attempt.done
+	}
+
+	// the primary attempt is the result if no attempt has written anything
+	result := attempts[0]
+	for _, attempt := range attempts {
+		if !attempt.writer.Lost() {
+			result = attempt
+		}
+	}
+	for k, v := range result.c.Keys {
+		if k != ctxkey.Meta {
+			c.Set(k, v)
+		}
+	}
+	if len(attempts) == 1 {
+		return result.err, nil
+	}
+
+	var failedChannelIds []int
+	userId := c.GetInt(ctxkey.Id)
+	for _, attempt := range attempts {
+		if attempt == result {
+			continue
+		}
+
+		content := fmt.Sprintf("hedged request lost to channel #%d", result.channelId)
+		if attempt.err != nil && attempt.err.StatusCode != hedge.StatusLost {
+			content = fmt.Sprintf("hedged request failed: %s", attempt.err.Message)
+			failedChannelIds = append(failedChannelIds, attempt.channelId)
+			go processChannelRelayError(c.Request.Context(), userId, attempt.channelId, attempt.c.GetInt(ctxkey.ChannelKeyId), attempt.channelName,
+				c.GetString(ctxkey.Group), c.GetString(ctxkey.OriginalModel), *attempt.err)
+		}
+		logger.Infof(c.Request.Context(), "hedged request to channel #%d: %s", attempt.channelId, content)
+
+		// record the attempt without quota, so both attempts show up in the logs
+		ctx := context.WithoutCancel(c.Request.Context())
+		log := &dbmodel.Log{
+			UserId:      userId,
+			ChannelId:   attempt.channelId,
+			ModelName:   c.GetString(ctxkey.OriginalModel),
+			TokenName:   c.GetString(ctxkey.TokenName),
+			TokenId:     c.GetInt(ctxkey.TokenId),
+			Group:       c.GetString(ctxkey.Group),
+			Content:     content,
+			ElapsedTime: helper.CalcElapsedTime(attempt.startTime),
+		}
+		go dbmodel.RecordConsumeLog(ctx, log)
+	}
+	return result.err, failedChannelIds
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+
+// RetrieveResponse retrieves a stored response from the channel that created it
+func RetrieveResponse(c *gin.Context) {
+	relayStoredResponse(c, http.MethodGet, "")
+}
+
+// DeleteResponse deletes a stored response from the channel that created it
+func DeleteResponse(c *gin.Context) {
+	record, ok := relayStoredResponse(c, http.MethodDelete, "")
+	if !ok {
+		return
+	}
+	if err := model.DeleteResponseRecord(record.ResponseId); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to delete record of response %s: %+v", record.ResponseId, err)
+	}
+}
+
+// CancelResponse cancels a background response on the channel that created it
+func CancelResponse(c *gin.Context) {
+	relayStoredResponse(c, http.MethodPost, "/cancel")
+}
+
+// relayStoredResponse forwards the request of a stored response to the channel recorded for it,
+// it returns true if the upstream returns success.
+func relayStoredResponse(c *gin.Context, method, suffix string) (*model.ResponseRecord, bool) {
+	ctx := c.Request.Context()
+	responseId := c.Param("response_id")
+	record, err := model.GetUserResponseRecord(c.GetInt(ctxkey.Id), responseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("no such response: %s", responseId))
+			return nil, false
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	channel, err := model.GetChannelById(record.ChannelId, true)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusNotFound,
+			errors.Errorf("the channel of response %s is no longer available", responseId))
+		return nil, false
+	}
+	if channel.Status != model.ChannelStatusEnabled {
+		middleware.AbortWithError(c, http.StatusServiceUnavailable, errors.New("The channel has been disabled"))
+		return nil, false
+	}
+
+	req, err := newChannelRequest(ctx, channel, method, "/responses/"+record.ResponseId+suffix, nil)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	// keep the query such as include[] and stream
+	query := req.URL.Query()
+	for k, values := range c.Request.URL.Query() {
+		query[k] = values
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadGateway, errors.Wrap(err, "request upstream"))
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	// the response could be a stream if stream=true, copy it as is
+	c.Status(resp.StatusCode)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	if _, err = io.Copy(&flushWriter{c.Writer}, resp.Body); err != nil {
+		logger.Errorf(ctx, "failed to copy upstream response of %s: %+v", responseId, err)
+	}
+	return record, resp.StatusCode/100 == 2
+}
+
+// flushWriter flushes every write, so the streamed events are sent to the client immediately
+type flushWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.ResponseWriter.Flush()
+	return n, err
+}
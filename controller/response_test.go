@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupResponseTestRouter(userId int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.Id, userId)
+		c.Next()
+	})
+	router.GET("/v1/responses/:response_id", RetrieveResponse)
+	router.DELETE("/v1/responses/:response_id", DeleteResponse)
+	router.POST("/v1/responses/:response_id/cancel", CancelResponse)
+	return router
+}
+
+func TestStoredResponses(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	client.Init()
+
+	var requests []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sk-upstream", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"resp_1","object":"response"}`))
+	}))
+	defer upstream.Close()
+
+	baseURL := upstream.URL
+	require.NoError(t, testDB.Create(&model.Channel{
+		Id:      7,
+		Type:    1,
+		Key:     "sk-upstream",
+		Status:  model.ChannelStatusEnabled,
+		BaseURL: &baseURL,
+	}).Error)
+	require.NoError(t, (&model.ResponseRecord{ResponseId: "resp_1", UserId: 1, ChannelId: 7, Model: "gpt-4o"}).Insert())
+
+	router := setupResponseTestRouter(1)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/responses/resp_1?include[]=file_search_call.results", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"id":"resp_1","object":"response"}`, w.Body.String())
+
+	// other users can not access the response
+	w = httptest.NewRecorder()
+	setupResponseTestRouter(2).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/responses/resp_1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/responses/resp_1/cancel", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/v1/responses/resp_1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err := model.GetUserResponseRecord(1, "resp_1")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{
+		"GET /v1/responses/resp_1?include%5B%5D=file_search_call.results",
+		"POST /v1/responses/resp_1/cancel",
+		"DELETE /v1/responses/resp_1",
+	}, requests)
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetAllRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roles,
+	})
+}
+
+// GetPermissions lists all the permissions could be granted to a role
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.AllPermissions,
+	})
+}
+
+func CreateRole(c *gin.Context) {
+	role := new(model.Role)
+	if err := json.NewDecoder(c.Request.Body).Decode(role); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	if err := role.ValidateRole(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.CheckGrantable(c.GetInt(ctxkey.Id), role.PermissionList()); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	cleanRole := model.Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+	}
+	if err := cleanRole.Insert(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+}
+
+// UpdateRole updates the description and the permissions of a custom role
+func UpdateRole(c *gin.Context) {
+	role := new(model.Role)
+	if err := json.NewDecoder(c.Request.Body).Decode(role); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	cleanRole, err := model.GetRoleById(role.Id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	role.Name = cleanRole.Name
+	if err := role.ValidateRole(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	// both the revoked and the granted permissions should be held by the caller
+	permissions := append(cleanRole.PermissionList(), role.PermissionList()...)
+	if err := model.CheckGrantable(c.GetInt(ctxkey.Id), permissions); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	cleanRole.Description = role.Description
+	cleanRole.Permissions = role.Permissions
+	if err := cleanRole.Update(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+}
+
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid role id"))
+		return
+	}
+	role, err := model.GetRoleById(id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.CheckGrantable(c.GetInt(ctxkey.Id), role.PermissionList()); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := role.Delete(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type userRoleRequest struct {
+	UserId int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// SetUserRole assigns a built-in role preset or a custom role to a user, root users are never changed.
+// The caller should hold all the permissions of both the current and the new role of the user,
+// and could not change the role of itself.
+func SetUserRole(c *gin.Context) {
+	var req userRoleRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	callerId := c.GetInt(ctxkey.Id)
+	if req.UserId == callerId {
+		helper.RespondError(c, errors.New("you could not change your own role"))
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if user.Role == model.RoleRootUser {
+		helper.RespondError(c, errors.New("the role of root users could not be changed"))
+		return
+	}
+	role, err := model.GetRoleByName(req.Role)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	currentPermissions, err := model.GetUserPermissions(user.Id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.CheckGrantable(callerId, slices.Concat(currentPermissions, role.PermissionList())); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.SetUserRole(user.Id, req.Role); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if updated, err := model.GetUserById(user.Id, false); err == nil {
+		recordAudit(c, "user.set_role", "user", user.Id,
+			gin.H{"role": user.Role, "role_name": user.RoleName},
+			gin.H{"role": updated.Role, "role_name": updated.RoleName})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestRoleEscalation(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	require.NoError(t, testDB.Create(&model.User{Id: 2, Username: "member", Role: model.RoleCommonUser,
+		Status: model.UserStatusEnabled, AccessToken: "test-access-token-2", AffCode: "TEST2"}).Error)
+	manager := &model.Role{Name: "role-manager", Permissions: "role:manage,user:manage"}
+	require.NoError(t, manager.Insert())
+	require.NoError(t, model.SetUserRole(1, manager.Name))
+	defer func() { _ = model.SetUserRole(1, model.RolePresetCommon) }()
+
+	router := setupTestRouter()
+	handle := func(handler gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("id", 1)
+			handler(c)
+		}
+	}
+	router.POST("/role", handle(CreateRole))
+	router.PUT("/role", handle(UpdateRole))
+	router.POST("/role/user", handle(SetUserRole))
+	request := func(method string, path string, body any) bool {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Success bool `json:"success"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Success
+	}
+
+	// the permissions not held by the caller could not be granted
+	assert.False(t, request(http.MethodPost, "/role", gin.H{"name": "escalated", "permissions": "role:manage,option:write"}))
+	assert.True(t, request(http.MethodPost, "/role", gin.H{"name": "user-manager", "permissions": "user:manage"}))
+	userManager, err := model.GetRoleByName("user-manager")
+	require.NoError(t, err)
+	assert.False(t, request(http.MethodPut, "/role", gin.H{"id": userManager.Id, "permissions": "user:manage,option:write"}))
+
+	// the role held by the caller could not be modified to escalate itself, nor assigned to itself
+	assert.False(t, request(http.MethodPut, "/role", gin.H{"id": manager.Id, "permissions": "role:manage,option:write"}))
+	assert.False(t, request(http.MethodPost, "/role/user", gin.H{"user_id": 1, "role": "user-manager"}))
+
+	optionWriter := &model.Role{Name: "option-writer", Permissions: "option:write"}
+	require.NoError(t, optionWriter.Insert())
+	assert.False(t, request(http.MethodPost, "/role/user", gin.H{"user_id": 2, "role": optionWriter.Name}))
+	assert.True(t, request(http.MethodPost, "/role/user", gin.H{"user_id": 2, "role": userManager.Name}))
+
+	ok, err := model.UserHasPermission(1, model.PermissionOptionWrite)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
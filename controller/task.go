@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	relayadaptor "github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/billing"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// pollTasksBatchSize is the max number of the active tasks synced by one round of polling
+const pollTasksBatchSize = 500
+
+// RetrieveTask returns the task of any type (/v1/tasks/:task_id),
+// the running task is synced from the upstream first.
+func RetrieveTask(c *gin.Context) {
+	ctx := c.Request.Context()
+	taskId := c.Param("task_id")
+	task, err := model.GetUserTaskById(c.GetInt(ctxkey.Id), "", taskId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("no such task: %s", taskId))
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if err = syncTask(ctx, task); err != nil {
+		// the stale status is returned, and the task would be synced by the poller later
+		logger.Warnf(ctx, "sync task %s failed: %+v", task.Id, err)
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// AutomaticallyPollTasks syncs the active tasks from the upstream periodically,
+// the tasks are loaded from the database, so the polling and the refunds are resumed after restarts.
+func AutomaticallyPollTasks() {
+	interval := time.Duration(config.TaskPollInterval) * time.Second
+	for {
+		pollTasks()
+		retryTaskRefunds()
+		time.Sleep(interval)
+	}
+}
+
+func pollTasks() {
+	tasks, err := model.GetActiveTasks(pollTasksBatchSize)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to get active tasks: %+v", err))
+		return
+	}
+
+	pool := new(errgroup.Group)
+	pool.SetLimit(config.TaskPollConcurrency)
+	for _, task := range tasks {
+		pool.Go(func() error {
+			ctx, cancel := context.WithTimeout(helper.SetRequestID(context.Background(), task.Id), time.Minute)
+			defer cancel()
+			err := syncTask(ctx, task)
+			if err != nil {
+				logger.Warnf(ctx, "poll task %s failed: %+v", task.Id, err)
+			}
+			if task.IsActive() {
+				if err = task.ScheduleNextPoll(err != nil); err != nil {
+					logger.Warnf(ctx, "failed to schedule the next poll of task %s: %+v", task.Id, err)
+				}
+			}
+			return nil
+		})
+	}
+	_ = pool.Wait()
+}
+
+// retryTaskRefunds refunds the failed tasks whose refunds were interrupted
+func retryTaskRefunds() {
+	tasks, err := model.GetRefundPendingTasks(pollTasksBatchSize)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to get refund pending tasks: %+v", err))
+		return
+	}
+	for _, task := range tasks {
+		ctx := helper.SetRequestID(context.Background(), task.Id)
+		if err = refundTask(ctx, task); err != nil {
+			logger.Errorf(ctx, "%+v", err)
+		}
+	}
+}
+
+// getTaskRelayMode returns the relay mode that created the task of taskType
+func getTaskRelayMode(taskType string) (int, error) {
+	switch taskType {
+	case model.TaskTypeVideo:
+		return relaymode.VideoGenerations, nil
+	default:
+		return relaymode.Unknown, errors.Errorf("unknown task type %q", taskType)
+	}
+}
+
+// getTaskAdaptor returns the adaptor and the meta of the channel that created the task
+func getTaskAdaptor(task *model.Task) (relayadaptor.TaskAdaptor, *metalib.Meta, error) {
+	relayMode, err := getTaskRelayMode(task.Type)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	channel, err := model.GetChannelById(task.ChannelId, true)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "the channel of task %s is no longer available", task.Id)
+	}
+	// the tasks created before the channel is disabled automatically are still fetched
+	if channel.Status != model.ChannelStatusEnabled && channel.Status != model.ChannelStatusAutoDisabled {
+		return nil, nil, errors.Errorf("the channel of task %s has been disabled", task.Id)
+	}
+
+	meta, err := metalib.GetByChannel(channel, task.ChannelKeyId, relayMode, task.Model)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	meta.ActualModelName = task.UpstreamModel
+	meta.UserId = task.UserId
+	meta.TokenId = task.TokenId
+	meta.TokenName = task.TokenName
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return nil, nil, errors.Errorf("invalid api type: %d", meta.APIType)
+	}
+	adaptor.Init(meta)
+	taskAdaptor, ok := adaptor.(relayadaptor.TaskAdaptor)
+	if !ok {
+		return nil, nil, errors.Errorf("channel %s does not support asynchronous tasks", adaptor.GetChannelName())
+	}
+	return taskAdaptor, meta, nil
+}
+
+// syncTask fetches the status of the running task from the upstream,
+// the task is settled once it is completed, and refunded if it is failed or timed out.
+func syncTask(ctx context.Context, task *model.Task) error {
+	if !task.IsActive() {
+		return nil
+	}
+	if helper.GetTimestamp()-task.CreatedAt > int64(config.TaskTimeout) {
+		return failTask(ctx, task, &model.TaskError{
+			Code:    "task_timeout",
+			Message: fmt.Sprintf("the task is not finished in %d seconds", config.TaskTimeout),
+		})
+	}
+
+	taskAdaptor, meta, err := getTaskAdaptor(task)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := taskAdaptor.FetchTask(ctx, meta, task.UpstreamTaskId)
+	if err != nil {
+		return errors.Wrap(err, "fetch upstream task")
+	}
+
+	switch result.Status {
+	case relaymodel.TaskStatusCompleted:
+		transited, err := task.TransitStatus(model.TaskStatusCompleted, model.TaskActiveStatuses...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if transited {
+			settleTask(ctx, task)
+		}
+	case relaymodel.TaskStatusFailed:
+		taskErr := &model.TaskError{Code: task.Type + "_task_failed", Message: "the task is failed on the upstream"}
+		if result.Error != nil {
+			taskErr.Message = result.Error.Message
+			if code, ok := result.Error.Code.(string); ok && code != "" {
+				taskErr.Code = code
+			}
+		}
+		return failTask(ctx, task, taskErr)
+	case relaymodel.TaskStatusInProgress:
+		if task.Status == model.TaskStatusQueued {
+			if _, err = task.TransitStatus(model.TaskStatusInProgress, model.TaskStatusQueued); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if result.Progress > task.Progress {
+			task.Progress = result.Progress
+			if err = task.UpdateFields("progress"); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// settleTask consumes the rest of the quota decided when the task was created
+func settleTask(ctx context.Context, task *model.Task) {
+	billing.PostConsumeQuotaDetailed(ctx, task.TokenId, task.Quota-task.PreConsumedQuota, task.Quota, task.UserId, task.ChannelId,
+		task.PromptTokens, task.CompletionTokens, task.ModelRatio, task.GroupRatio, task.Model, task.TokenName,
+		false, time.Unix(task.CreatedAt, 0), false, task.CompletionRatio, 0)
+}
+
+// failTask marks the task as failed and refunds the pre-consumed quota, the task is marked refund pending
+// by the transition, so the refund interrupted here is retried by the poller.
+func failTask(ctx context.Context, task *model.Task, taskErr *model.TaskError) error {
+	transited, err := task.TransitStatus(model.TaskStatusFailed, model.TaskActiveStatuses...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !transited {
+		return nil
+	}
+
+	task.Error = taskErr
+	if err = task.UpdateFields("error"); err != nil {
+		logger.Errorf(ctx, "failed to save the error of task %s: %+v", task.Id, err)
+	}
+	return refundTask(ctx, task)
+}
+
+// refundTask refunds the pre-consumed quota of the failed task if it's not refunded yet
+func refundTask(ctx context.Context, task *model.Task) error {
+	if !task.RefundPending {
+		return nil
+	}
+	if err := model.RefundTask(task); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := model.CacheUpdateUserQuota(ctx, task.UserId); err != nil {
+		logger.Warnf(ctx, "failed to update the cached quota of user %d: %+v", task.UserId, err)
+	}
+	logger.Infof(ctx, "task %s is failed, refunded %d quota to token %d", task.Id, task.PreConsumedQuota, task.TokenId)
+	return nil
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestSyncTaskTimeoutRefund(t *testing.T) {
+	testDB, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	require.NoError(t, testDB.Model(&model.User{}).Where("id = ?", 1).Update("quota", 1000).Error)
+	token := &model.Token{Id: 1, UserId: 1, Key: "task-test-key", Status: model.TokenStatusEnabled, Name: "test", RemainQuota: 900}
+	require.NoError(t, testDB.Create(token).Error)
+
+	task := model.NewTask(model.TaskTypeVideo, 1)
+	task.TokenId = token.Id
+	task.Quota = 100
+	task.PreConsumedQuota = 100
+	task.CreatedAt = helper.GetTimestamp() - int64(config.TaskTimeout) - 1
+	require.NoError(t, task.Insert())
+
+	require.NoError(t, syncTask(context.Background(), task))
+	assert.Equal(t, model.TaskStatusFailed, task.Status)
+	require.NotNil(t, task.Error)
+	assert.Equal(t, "task_timeout", task.Error.Code)
+
+	// the task is only refunded once
+	require.NoError(t, failTask(context.Background(), task, &model.TaskError{Code: "again"}))
+
+	user, err := model.GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1100), user.Quota)
+	refreshed, err := model.GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), refreshed.RemainQuota)
+
+	saved, err := model.GetUserTaskById(1, "", task.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "task_timeout", saved.Error.Code)
+}
+
+func TestRetrieveTask(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	task := model.NewTask(model.TaskTypeVideo, 1)
+	require.NoError(t, task.Insert())
+	_, err := task.TransitStatus(model.TaskStatusCompleted, model.TaskActiveStatuses...)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.Id, 1)
+		c.Next()
+	})
+	router.GET("/v1/tasks/:task_id", RetrieveTask)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/tasks/"+task.Id, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	got := new(model.Task)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+	assert.Equal(t, "task", got.Object)
+	assert.Equal(t, model.TaskStatusCompleted, got.Status)
+	assert.Equal(t, 100, got.Progress)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/tasks/video_unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
@@ -51,6 +52,7 @@ func GetAllTokens(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
+	rollTokenBudgets(tokens)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -67,6 +69,7 @@ func SearchTokens(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
+	rollTokenBudgets(tokens)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -87,6 +90,7 @@ func GetToken(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
+	token.RollBudget(time.Now())
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -116,6 +120,14 @@ func GetTokenStatus(c *gin.Context) {
 	})
 }
 
+// rollTokenBudgets shows the budgets of the tokens in the current period
+func rollTokenBudgets(tokens []*model.Token) {
+	now := time.Now()
+	for _, token := range tokens {
+		token.RollBudget(now)
+	}
+}
+
 func validateToken(_ *gin.Context, token *model.Token) error {
 	if len(token.Name) > 30 {
 		return fmt.Errorf("Token name is too long")
@@ -128,6 +140,19 @@ func validateToken(_ *gin.Context, token *model.Token) error {
 		}
 	}
 
+	if token.ResponseCacheTTL < 0 {
+		return fmt.Errorf("response cache ttl should not be negative")
+	}
+	if token.HedgeDelay < 0 {
+		return fmt.Errorf("hedge delay should not be negative")
+	}
+	if token.RateLimitRPM < 0 || token.RateLimitTPM < 0 || token.MaxConcurrency < 0 {
+		return fmt.Errorf("rate limits should not be negative")
+	}
+	if err := token.ValidateBudget(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -147,6 +172,13 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.OrganizationId != 0 {
+		member, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt(ctxkey.Id))
+		if err != nil || !member.CanUseTokens() {
+			helper.RespondError(c, errors.New("you are not allowed to create tokens for this organization"))
+			return
+		}
+	}
 
 	cleanToken := model.Token{
 		UserId:         c.GetInt(ctxkey.Id),
@@ -159,6 +191,19 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+
+		ResponseCacheDisabled: token.ResponseCacheDisabled,
+		ResponseCacheTTL:      token.ResponseCacheTTL,
+		HedgeDelay:            token.HedgeDelay,
+		RateLimitRPM:          token.RateLimitRPM,
+		RateLimitTPM:          token.RateLimitTPM,
+		MaxConcurrency:        token.MaxConcurrency,
+		OrganizationId:        token.OrganizationId,
+		Budget: model.Budget{
+			BudgetQuota:    token.BudgetQuota,
+			BudgetPeriod:   token.BudgetPeriod,
+			BudgetRollover: token.BudgetRollover,
+		},
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -249,6 +294,7 @@ func ConsumeToken(c *gin.Context) {
 		UserId:    userID,
 		ModelName: tokenPatch.AddReason,
 		TokenName: cleanToken.Name,
+		TokenId:   cleanToken.Id,
 		Quota:     int(tokenPatch.AddUsedQuota),
 		Content: fmt.Sprintf("External (%s) consumed %s",
 			tokenPatch.AddReason, common.LogQuota(int64(tokenPatch.AddUsedQuota))),
@@ -358,6 +404,15 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
 		cleanToken.RemainQuota = token.RemainQuota
+		cleanToken.ResponseCacheDisabled = token.ResponseCacheDisabled
+		cleanToken.ResponseCacheTTL = token.ResponseCacheTTL
+		cleanToken.HedgeDelay = token.HedgeDelay
+		cleanToken.RateLimitRPM = token.RateLimitRPM
+		cleanToken.RateLimitTPM = token.RateLimitTPM
+		cleanToken.MaxConcurrency = token.MaxConcurrency
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetRollover = token.BudgetRollover
 		cleanToken.Status = token.Status
 	}
 
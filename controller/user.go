@@ -323,6 +323,7 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
+	user.RollBudget(time.Now())
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -588,6 +589,7 @@ func GetSelf(c *gin.Context) {
 		})
 		return
 	}
+	user.RollBudget(time.Now())
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -617,6 +619,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := updatedUser.ValidateBudget(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	originUser, err := model.GetUserById(updatedUser.Id, false)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -651,6 +660,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := model.UpdateUserBudget(updatedUser.Id, updatedUser.Budget); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(ctx, originUser.Id, model.LogTypeManage, fmt.Sprintf("Admin changed user quota from %s to %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
@@ -857,6 +873,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	origin := gin.H{"role": user.Role, "role_name": user.RoleName, "status": user.Status}
 	switch req.Action {
 	case "disable":
 		user.Status = model.UserStatusDisabled
@@ -925,6 +942,21 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	if req.Action == "promote" || req.Action == "demote" {
+		// the promoted and demoted users get the built-in role presets
+		if err := model.SetUserRole(user.Id, model.RolePresetName(user.Role)); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	var updated gin.H
+	if updatedUser, err := model.GetUserById(user.Id, false); err == nil {
+		updated = gin.H{"role": updatedUser.Role, "role_name": updatedUser.RoleName, "status": updatedUser.Status}
+	}
+	recordAudit(c, "user."+req.Action, "user", user.Id, origin, updated)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1028,6 +1060,14 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
+	originQuota, err := model.GetUserQuota(req.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -1040,6 +1080,8 @@ func AdminTopUp(c *gin.Context) {
 		req.Remark = fmt.Sprintf("Recharged via API %s", common.LogQuota(int64(req.Quota)))
 	}
 	model.RecordTopupLog(ctx, req.UserId, req.Remark, req.Quota)
+	recordAudit(c, "user.topup", "user", req.UserId,
+		gin.H{"quota": originQuota}, gin.H{"quota": originQuota + int64(req.Quota), "remark": req.Remark})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -26,7 +26,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	require.NoError(t, err)
 
 	// Auto-migrate the tables
-	err = db.AutoMigrate(&model.User{}, &model.Channel{}, &model.Token{}, &model.Option{}, &model.Redemption{}, &model.Ability{}, &model.Log{}, &model.UserRequestCost{})
+	err = db.AutoMigrate(&model.User{}, &model.Channel{}, &model.Token{}, &model.Option{}, &model.Redemption{}, &model.Ability{}, &model.Log{}, &model.UserRequestCost{}, &model.File{}, &model.FileMirror{}, &model.Batch{}, &model.BatchItem{}, &model.Task{}, &model.ResponseRecord{}, &model.Organization{}, &model.OrganizationMember{}, &model.Role{}, &model.AuditLog{})
 	require.NoError(t, err)
 
 	return db
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	relayadaptor "github.com/songquanpeng/one-api/relay/adaptor"
+	relaycontroller "github.com/songquanpeng/one-api/relay/controller"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+)
+
+// RetrieveVideo returns the video task, the running task is synced from the upstream first
+func RetrieveVideo(c *gin.Context) {
+	ctx := c.Request.Context()
+	task, ok := getUserVideoTask(c)
+	if !ok {
+		return
+	}
+	if err := syncTask(ctx, task); err != nil {
+		// the stale status is returned, and the task would be synced by the next retrieval
+		logger.Warnf(ctx, "sync video task %s failed: %+v", task.Id, err)
+	}
+	c.JSON(http.StatusOK, relaycontroller.GetVideoObject(task))
+}
+
+// RetrieveVideoContent downloads the video of the completed task from the upstream
+func RetrieveVideoContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	task, ok := getUserVideoTask(c)
+	if !ok {
+		return
+	}
+	if err := syncTask(ctx, task); err != nil {
+		logger.Warnf(ctx, "sync video task %s failed: %+v", task.Id, err)
+	}
+	if task.Status != model.TaskStatusCompleted {
+		middleware.AbortWithError(c, http.StatusBadRequest,
+			errors.Errorf("video %s is %s, the content is only available once it is completed", task.Id, task.Status))
+		return
+	}
+
+	videoAdaptor, meta, err := getVideoTaskAdaptor(task)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusServiceUnavailable, err)
+		return
+	}
+	content, contentType, err := videoAdaptor.GetVideoContent(ctx, meta, task.UpstreamTaskId)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadGateway, errors.Wrap(err, "get video content"))
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, content); err != nil {
+		logger.Errorf(ctx, "failed to copy the content of video %s: %+v", task.Id, err)
+	}
+}
+
+func getUserVideoTask(c *gin.Context) (*model.Task, bool) {
+	videoId := c.Param("video_id")
+	task, err := model.GetUserTaskById(c.GetInt(ctxkey.Id), model.TaskTypeVideo, videoId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, errors.Errorf("no such video: %s", videoId))
+			return nil, false
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return task, true
+}
+
+// getVideoTaskAdaptor returns the video adaptor and the meta of the channel that created the task
+func getVideoTaskAdaptor(task *model.Task) (relayadaptor.VideoAdaptor, *metalib.Meta, error) {
+	taskAdaptor, meta, err := getTaskAdaptor(task)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	videoAdaptor, ok := taskAdaptor.(relayadaptor.VideoAdaptor)
+	if !ok {
+		return nil, nil, errors.Errorf("the channel of video %s does not support video generation", task.Id)
+	}
+	return videoAdaptor, meta, nil
+}
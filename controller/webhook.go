@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// The webhooks of the current user only receive the events of the user,
+// the global webhooks, whose owner is 0, receive the events of all users and the system events.
+
+func GetWebhooks(c *gin.Context) {
+	getWebhooks(c, c.GetInt(ctxkey.Id))
+}
+
+func GetGlobalWebhooks(c *gin.Context) {
+	getWebhooks(c, 0)
+}
+
+func AddWebhook(c *gin.Context) {
+	addWebhook(c, c.GetInt(ctxkey.Id))
+}
+
+func AddGlobalWebhook(c *gin.Context) {
+	addWebhook(c, 0)
+}
+
+func UpdateWebhook(c *gin.Context) {
+	updateWebhook(c, c.GetInt(ctxkey.Id))
+}
+
+func UpdateGlobalWebhook(c *gin.Context) {
+	updateWebhook(c, 0)
+}
+
+func DeleteWebhook(c *gin.Context) {
+	deleteWebhook(c, c.GetInt(ctxkey.Id))
+}
+
+func DeleteGlobalWebhook(c *gin.Context) {
+	deleteWebhook(c, 0)
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	getWebhookDeliveries(c, c.GetInt(ctxkey.Id))
+}
+
+func GetGlobalWebhookDeliveries(c *gin.Context) {
+	getWebhookDeliveries(c, 0)
+}
+
+func TestWebhook(c *gin.Context) {
+	testWebhook(c, c.GetInt(ctxkey.Id))
+}
+
+func TestGlobalWebhook(c *gin.Context) {
+	testWebhook(c, 0)
+}
+
+// GetWebhookEvents lists the events could be subscribed by the webhooks of the current user and the global webhooks
+func GetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"user":   model.UserWebhookEvents,
+			"global": model.AllWebhookEvents,
+		},
+	})
+}
+
+func getWebhooks(c *gin.Context, ownerId int) {
+	webhooks, err := model.GetWebhooks(ownerId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    webhooks,
+	})
+}
+
+// addWebhook creates a webhook, the secret is only returned here
+func addWebhook(c *gin.Context, ownerId int) {
+	webhook := new(model.Webhook)
+	if err := json.NewDecoder(c.Request.Body).Decode(webhook); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	cleanWebhook := model.Webhook{
+		UserId: ownerId,
+		Name:   webhook.Name,
+		URL:    webhook.URL,
+		Secret: webhook.Secret,
+		Events: webhook.Events,
+		Status: model.WebhookStatusEnabled,
+	}
+	if err := cleanWebhook.ValidateWebhook(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := cleanWebhook.Insert(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanWebhook,
+	})
+}
+
+// updateWebhook updates the name, the url, the events and the status of the webhook
+func updateWebhook(c *gin.Context, ownerId int) {
+	webhook := new(model.Webhook)
+	if err := json.NewDecoder(c.Request.Body).Decode(webhook); err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid request"))
+		return
+	}
+	cleanWebhook, err := model.GetWebhookById(webhook.Id, ownerId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	cleanWebhook.Name = webhook.Name
+	cleanWebhook.URL = webhook.URL
+	cleanWebhook.Events = webhook.Events
+	if webhook.Status != 0 {
+		cleanWebhook.Status = webhook.Status
+	}
+	if err := cleanWebhook.ValidateWebhook(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := cleanWebhook.Update(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanWebhook,
+	})
+}
+
+func deleteWebhook(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid webhook id"))
+		return
+	}
+	if err := model.DeleteWebhook(id, ownerId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func getWebhookDeliveries(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid webhook id"))
+		return
+	}
+	if _, err := model.GetWebhookById(id, ownerId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	deliveries, err := model.GetWebhookDeliveries(id, p*config.DefaultItemsPerPage, config.DefaultItemsPerPage)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    deliveries,
+	})
+}
+
+// testWebhook sends a test event to the webhook, and only returns whether it is delivered
+func testWebhook(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, errors.Wrap(err, "invalid webhook id"))
+		return
+	}
+	if _, err := model.GetWebhookById(id, ownerId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	delivery, err := model.SendTestWebhookEvent(c.Request.Context(), id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	// the response of the receiver is not echoed, so the test could not be used to probe other hosts
+	if !delivery.Success {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "failed to deliver the test event",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
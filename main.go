@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -23,6 +25,8 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/logsink"
+	"github.com/songquanpeng/one-api/common/secret"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -48,6 +52,18 @@ func main() {
 		logger.SysLog("running in debug mode")
 	}
 
+	if err := secret.Init(); err != nil {
+		logger.FatalLog("failed to load secret master key: " + err.Error())
+	}
+	if flag.Arg(0) == "reencrypt-secrets" {
+		reencryptSecrets()
+		return
+	}
+	if flag.Arg(0) == "backfill-rollups" {
+		backfillRollups()
+		return
+	}
+
 	// Initialize SQL Database
 	model.InitDB()
 	model.InitLogDB()
@@ -86,6 +102,8 @@ func main() {
 		go model.SyncOptions(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
+	// the usage of the keys of the multi-key channels is counted in memory, and saved in batches
+	go model.SyncChannelKeyUsage(config.BatchUpdateInterval)
 	if os.Getenv("CHANNEL_TEST_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_TEST_FREQUENCY"))
 		if err != nil {
@@ -93,6 +111,16 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if config.IsMasterNode {
+		// batches are only executed on the master node to avoid running a batch twice
+		go controller.AutomaticallyRunBatches()
+		// the notifications are also checked on the master node only to avoid sending them twice
+		go controller.AutomaticallyCheckNotifications()
+		// the rollups are also maintained by the master node only
+		go controller.AutomaticallyRollupLogs()
+		// the asynchronous tasks are polled by the master node, so that each task is settled once
+		go controller.AutomaticallyPollTasks()
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -124,6 +152,10 @@ func main() {
 	openai.InitTokenEncoders()
 	client.Init()
 
+	if err := logsink.Init(); err != nil {
+		logger.FatalLog("failed to initialize log sink: " + err.Error())
+	}
+
 	// Initialize global pricing manager
 	relay.InitializeGlobalPricing()
 
@@ -198,3 +230,32 @@ func main() {
 		logger.FatalLog("failed to start HTTP server: " + err.Error())
 	}
 }
+
+// reencryptSecrets encrypts the secrets saved in the database with the current master key, then exits
+func reencryptSecrets() {
+	model.InitDB()
+	model.InitLogDB()
+	defer func() {
+		if err := model.CloseDB(); err != nil {
+			logger.FatalLog("failed to close database: " + err.Error())
+		}
+	}()
+	if _, err := model.ReencryptSecrets(); err != nil {
+		logger.FatalLog("failed to re-encrypt secrets: " + err.Error())
+	}
+}
+
+// backfillRollups rebuilds the log rollups from all the existing logs, then exits
+func backfillRollups() {
+	model.InitDB()
+	model.InitLogDB()
+	defer func() {
+		if err := model.CloseDB(); err != nil {
+			logger.FatalLog("failed to close database: " + err.Error())
+		}
+	}()
+	if err := model.RebuildLogRollups(context.Background()); err != nil {
+		logger.FatalLog("failed to backfill log rollups: " + err.Error())
+	}
+	logger.SysLog("log rollups are backfilled")
+}
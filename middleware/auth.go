@@ -6,6 +6,7 @@
 //   - Used for web dashboard access via browser sessions/cookies
 //   - Falls back to Authorization header tokens if no session exists
 //   - Different permission levels: User < Admin < Root
+//   - PermissionAuth checks the named permissions granted by the role of the user instead
 //
 // 2. Token-based Authentication (TokenAuth):
 //   - Used for programmatic API access with API keys
@@ -20,6 +21,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -42,6 +44,15 @@ import (
 //   - c: Gin context for the HTTP request
 //   - minRole: Minimum role level required (e.g., common user, admin, root)
 func authHelper(c *gin.Context, minRole int) {
+	if !authenticate(c, minRole) {
+		return
+	}
+	c.Next()
+}
+
+// authenticate does the work of authHelper except calling the next handler,
+// it returns false if the request has been aborted.
+func authenticate(c *gin.Context, minRole int) bool {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -60,7 +71,7 @@ func authHelper(c *gin.Context, minRole int) {
 				"message": "No permission to perform this operation, not logged in and no access token provided",
 			})
 			c.Abort()
-			return
+			return false
 		}
 
 		// Validate the access token against the database
@@ -78,7 +89,7 @@ func authHelper(c *gin.Context, minRole int) {
 				"message": "No permission to perform this operation, access token is invalid",
 			})
 			c.Abort()
-			return
+			return false
 		}
 	}
 
@@ -93,7 +104,7 @@ func authHelper(c *gin.Context, minRole int) {
 		session.Clear()
 		_ = session.Save()
 		c.Abort()
-		return
+		return false
 	}
 
 	// Check if user has sufficient role permissions
@@ -103,14 +114,14 @@ func authHelper(c *gin.Context, minRole int) {
 			"message": "No permission to perform this operation, insufficient permissions",
 		})
 		c.Abort()
-		return
+		return false
 	}
 
 	// Authentication successful - set user context and continue
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
-	c.Next()
+	return true
 }
 
 // UserAuth returns a middleware function that requires basic user authentication.
@@ -140,6 +151,37 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth returns a middleware function that requires all the permissions.
+// The permissions are granted by the role of the user, root users have all of them.
+// Use this for management endpoints instead of AdminAuth and RootAuth.
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !authenticate(c, model.RoleCommonUser) {
+			return
+		}
+		for _, permission := range permissions {
+			ok, err := model.UserHasPermission(c.GetInt(ctxkey.Id), permission)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": fmt.Sprintf("No permission to perform this operation, %s is required", permission),
+				})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
 // TokenAuth returns a middleware function for API token-based authentication.
 // This is different from the session-based auth functions above - it's specifically
 // designed for API access using tokens (like API keys for programmatic access).
@@ -185,6 +227,12 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
+		// Set token-related context for downstream handlers
+		if err := SetupContextForToken(c, token); err != nil {
+			AbortWithError(c, http.StatusForbidden, err)
+			return
+		}
+
 		// Extract and validate the requested model (for AI/ML API endpoints)
 		requestModel, err := getRequestModel(c)
 		if err != nil && shouldCheckModel(c) {
@@ -195,20 +243,12 @@ func TokenAuth() func(c *gin.Context) {
 
 		// Check if token has model restrictions and validate access
 		if token.Models != nil && *token.Models != "" {
-			c.Set(ctxkey.AvailableModels, *token.Models)
 			if requestModel != "" && !isModelInList(requestModel, *token.Models) {
 				AbortWithError(c, http.StatusForbidden, errors.Errorf("This API key does not have permission to use the model: %s", requestModel))
 				return
 			}
 		}
 
-		// Set token-related context for downstream handlers
-		c.Set(ctxkey.Id, token.UserId)
-		c.Set(ctxkey.TokenId, token.Id)
-		c.Set(ctxkey.TokenName, token.Name)
-		c.Set(ctxkey.TokenQuota, token.RemainQuota)
-		c.Set(ctxkey.TokenQuotaUnlimited, token.UnlimitedQuota)
-
 		// Handle channel-specific routing (admin feature)
 		// Format: token_key:channel_id allows admins to specify which channel to use
 		if len(parts) > 1 {
@@ -241,6 +281,34 @@ func TokenAuth() func(c *gin.Context) {
 	}
 }
 
+// SetupContextForToken checks the organization of the token and sets the token-related context,
+// it's shared by TokenAuth and the requests relayed in process, such as the lines of the batches.
+func SetupContextForToken(c *gin.Context, token *model.Token) error {
+	// The tokens owned by an organization are only usable while the creator is still a member
+	if token.OrganizationId != 0 {
+		if err := model.ValidateOrganizationToken(token); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	c.Set(ctxkey.Id, token.UserId)
+	c.Set(ctxkey.TokenId, token.Id)
+	c.Set(ctxkey.TokenName, token.Name)
+	c.Set(ctxkey.TokenQuota, token.RemainQuota)
+	c.Set(ctxkey.TokenQuotaUnlimited, token.UnlimitedQuota)
+	c.Set(ctxkey.ResponseCacheDisabled, token.ResponseCacheDisabled)
+	c.Set(ctxkey.ResponseCacheTTL, token.ResponseCacheTTL)
+	c.Set(ctxkey.HedgeDelay, token.HedgeDelay)
+	c.Set(ctxkey.TokenRateLimitRPM, token.RateLimitRPM)
+	c.Set(ctxkey.TokenRateLimitTPM, token.RateLimitTPM)
+	c.Set(ctxkey.TokenMaxConcurrency, token.MaxConcurrency)
+	c.Set(ctxkey.OrganizationId, token.OrganizationId)
+	if token.Models != nil && *token.Models != "" {
+		c.Set(ctxkey.AvailableModels, *token.Models)
+	}
+	return nil
+}
+
 // shouldCheckModel determines whether the current endpoint requires model validation.
 // This helper function checks if the request path corresponds to AI/ML API endpoints
 // that need to validate which AI model the user is trying to access.
@@ -252,6 +320,9 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/chat/completions") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		return true
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images") {
 		return true
 	}
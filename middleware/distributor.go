@@ -8,7 +8,9 @@ import (
 	"github.com/Laisky/errors/v2"
 	gutils "github.com/Laisky/go-utils/v5"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
@@ -29,6 +31,18 @@ func Distribute() func(c *gin.Context) {
 		var requestModel string
 		var channel *model.Channel
 		channelId := c.GetInt(ctxkey.SpecificChannelId)
+		if channelId == 0 {
+			// the previous response is only stored in the channel that served it,
+			// so the chained response is pinned to that channel, and won't be retried on others
+			var err error
+			if channelId, err = getPreviousResponseChannelId(c, userId); err != nil {
+				AbortWithError(c, http.StatusNotFound, err)
+				return
+			}
+			if channelId != 0 {
+				c.Set(ctxkey.SpecificChannelId, channelId)
+			}
+		}
 		if channelId != 0 {
 			var err error
 			channel, err = model.GetChannelById(channelId, true)
@@ -61,12 +75,42 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id)
-		SetupContextForSelectedChannel(c, channel, requestModel)
+		if err := SetupContextForSelectedChannel(c, channel, requestModel); err != nil {
+			// the relay fails with the error, so the request is retried on the other channels
+			logger.Errorf(ctx, "failed to set up channel #%d: %+v", channel.Id, err)
+		}
 		c.Next()
 	}
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+// getPreviousResponseChannelId returns the channel that stored the previous_response_id of the Response API request,
+// it returns 0 if the request is not chained or the previous response is not recorded.
+func getPreviousResponseChannelId(c *gin.Context, userId int) (int, error) {
+	if c.Request.Method != http.MethodPost || c.Request.URL.Path != "/v1/responses" {
+		return 0, nil
+	}
+	var request struct {
+		PreviousResponseId string `json:"previous_response_id"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil || request.PreviousResponseId == "" {
+		return 0, nil
+	}
+
+	record, err := model.GetResponseRecord(request.PreviousResponseId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if record.UserId != userId {
+		return 0, errors.Errorf("previous response %s not found", request.PreviousResponseId)
+	}
+	return record.ChannelId, nil
+}
+
+// GetChannelRatio returns the minimal group ratio of the channel's groups
+func GetChannelRatio(channel *model.Channel) float64 {
 	// one channel could relates to multiple groups,
 	// and each groud has individual ratio,
 	// set minimal group ratio as channel_ratio
@@ -77,6 +121,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 			minimalRatio = v
 		}
 	}
+	return minimalRatio
+}
+
+// SetupContextForSelectedChannel sets the channel selected for the request in the context,
+// the error is also saved as ctxkey.ChannelError, so the relay fails without sending the request upstream.
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) (err error) {
+	defer func() {
+		c.Set(ctxkey.ChannelError, err)
+	}()
+
+	minimalRatio := GetChannelRatio(channel)
+	if discount, ok := c.Get(ctxkey.QuotaDiscount); ok {
+		minimalRatio *= discount.(float64)
+	}
 	logger.Info(c.Request.Context(), fmt.Sprintf("set channel %s ratio to %f", channel.Name, minimalRatio))
 	c.Set(ctxkey.ChannelRatio, minimalRatio)
 	c.Set(ctxkey.ChannelModel, channel)
@@ -95,7 +153,16 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	// the secrets are encrypted at rest, they're only decrypted here to build the upstream request
+	key, keyId, err := channel.SelectKey()
+	c.Set(ctxkey.ChannelKeyId, keyId)
+	if err != nil {
+		return errors.Wrapf(err, "select key of channel %d", channel.Id)
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	// x-api-key carries the one-api token for anthropic sdk clients,
+	// it must not be forwarded to the upstream with the other X- headers
+	c.Request.Header.Del("x-api-key")
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	if channel.RateLimit != nil {
 		c.Set(ctxkey.RateLimit, *channel.RateLimit)
@@ -104,6 +171,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 
 	cfg, _ := channel.LoadConfig()
+	if err := cfg.DecryptSecrets(); err != nil {
+		return errors.Wrapf(err, "decrypt config of channel %d", channel.Id)
+	}
 	// this is for backward compatibility
 	if channel.Other != nil {
 		switch channel.Type {
@@ -130,4 +200,5 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		}
 	}
 	c.Set(ctxkey.Config, cfg)
+	return nil
 }
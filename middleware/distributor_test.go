@@ -1,11 +1,20 @@
 package middleware
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/secret"
 	"github.com/songquanpeng/one-api/model"
 )
 
@@ -138,3 +147,59 @@ func TestChannelPriorityFallbackScenario(t *testing.T) {
 func ptrToInt64(v int64) *int64 {
 	return &v
 }
+
+func TestGetPreviousResponseChannelId(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ResponseRecord{}))
+	originalDB := model.DB
+	model.DB = db
+	defer func() { model.DB = originalDB }()
+	require.NoError(t, (&model.ResponseRecord{ResponseId: "resp_1", UserId: 1, ChannelId: 7}).Insert())
+
+	newContext := func(path, body string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		return c
+	}
+
+	channelId, err := getPreviousResponseChannelId(newContext("/v1/responses", `{"previous_response_id":"resp_1"}`), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 7, channelId)
+
+	// unknown responses are routed as usual
+	channelId, err = getPreviousResponseChannelId(newContext("/v1/responses", `{"previous_response_id":"resp_2"}`), 1)
+	require.NoError(t, err)
+	assert.Zero(t, channelId)
+
+	channelId, err = getPreviousResponseChannelId(newContext("/v1/chat/completions", `{"previous_response_id":"resp_1"}`), 1)
+	require.NoError(t, err)
+	assert.Zero(t, channelId)
+
+	// the response of other users can not be chained
+	_, err = getPreviousResponseChannelId(newContext("/v1/responses", `{"previous_response_id":"resp_1"}`), 2)
+	assert.Error(t, err)
+}
+
+func TestSetupContextForSelectedChannelKeyError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { _ = secret.SetMasterKeys("") })
+	require.NoError(t, secret.SetMasterKeys("master-key-1"))
+	key, err := secret.Encrypt("sk-test")
+	require.NoError(t, err)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	channel := &model.Channel{Id: 1, Name: "test", Key: key, Group: "default"}
+	require.NoError(t, SetupContextForSelectedChannel(c, channel, "gpt-4o"))
+	assert.Equal(t, "Bearer sk-test", c.Request.Header.Get("Authorization"))
+	assert.Nil(t, c.Value(ctxkey.ChannelError))
+
+	// the key encrypted by an unknown master key can't be decrypted
+	require.NoError(t, secret.SetMasterKeys("master-key-2"))
+	err = SetupContextForSelectedChannel(c, channel, "gpt-4o")
+	require.Error(t, err)
+	assert.Equal(t, err, c.Value(ctxkey.ChannelError))
+	assert.Equal(t, 1, c.GetInt(ctxkey.ChannelId))
+}
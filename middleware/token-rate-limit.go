@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
+)
+
+// TokenRateLimit enforces the requests per minute, tokens per minute and max concurrent requests of the token,
+// and sets the OpenAI-style x-ratelimit-* headers, so the retry logic of the SDKs works.
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := gmw.Ctx(c)
+		tokenId := c.GetInt(ctxkey.TokenId)
+
+		if limit := c.GetInt(ctxkey.TokenRateLimitRPM); limit > 0 {
+			result, ok := ratelimit.AllowRequest(ctx, tokenId, limit)
+			setRateLimitHeaders(c, "requests", result)
+			if !ok {
+				abortWithRateLimit(c, result.Reset, errors.Errorf("rate limit reached for requests per minute: limit %d", limit))
+				return
+			}
+		}
+
+		if limit := c.GetInt(ctxkey.TokenRateLimitTPM); limit > 0 {
+			result, ok := ratelimit.AllowTokens(ctx, tokenId, limit)
+			setRateLimitHeaders(c, "tokens", result)
+			if !ok {
+				abortWithRateLimit(c, result.Reset, errors.Errorf("rate limit reached for tokens per minute: limit %d", limit))
+				return
+			}
+		}
+
+		if limit := c.GetInt(ctxkey.TokenMaxConcurrency); limit > 0 {
+			release, ok := ratelimit.Acquire(ctx, tokenId, limit)
+			if !ok {
+				abortWithRateLimit(c, time.Second, errors.Errorf("rate limit reached for concurrent requests: limit %d", limit))
+				return
+			}
+			defer release()
+		}
+
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders sets the x-ratelimit-* headers of the kind, which is either requests or tokens
+func setRateLimitHeaders(c *gin.Context, kind string, result ratelimit.Result) {
+	c.Header("x-ratelimit-limit-"+kind, strconv.Itoa(result.Limit))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.Itoa(result.Remaining))
+	c.Header("x-ratelimit-reset-"+kind, result.Reset.Round(time.Millisecond).String())
+}
+
+func abortWithRateLimit(c *gin.Context, retryAfter time.Duration, err error) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.Header("retry-after-ms", strconv.FormatInt(retryAfter.Milliseconds(), 10))
+	AbortWithError(c, http.StatusTooManyRequests, err)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+func TestTokenRateLimit(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	t.Cleanup(func() { common.RedisEnabled = redisEnabled })
+	common.RedisEnabled = false
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.TokenId, 1001)
+		c.Set(ctxkey.TokenRateLimitRPM, 2)
+		c.Set(ctxkey.TokenRateLimitTPM, 1000)
+	}, TokenRateLimit())
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		return recorder
+	}
+
+	recorder := request()
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1", recorder.Header().Get("x-ratelimit-remaining-requests"))
+	assert.NotEmpty(t, recorder.Header().Get("x-ratelimit-reset-requests"))
+	assert.Equal(t, "1000", recorder.Header().Get("x-ratelimit-limit-tokens"))
+	assert.Equal(t, "1000", recorder.Header().Get("x-ratelimit-remaining-tokens"))
+
+	assert.Equal(t, http.StatusOK, request().Code)
+	recorder = request()
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("x-ratelimit-remaining-requests"))
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+}
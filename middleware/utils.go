@@ -38,6 +38,14 @@ func AbortWithError(c *gin.Context, statusCode int, err error) {
 }
 
 func getRequestModel(c *gin.Context) (string, error) {
+	// files api does not have a model, and the uploaded file
+	// should not be buffered in memory.
+	// batches api does not have a model either, the models are in the input file.
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/files") ||
+		strings.HasPrefix(c.Request.URL.Path, "/v1/batches") {
+		return "", nil
+	}
+
 	var modelRequest ModelRequest
 	err := common.UnmarshalBodyReusable(c, &modelRequest)
 	if err != nil {
@@ -63,6 +71,11 @@ func getRequestModel(c *gin.Context) (string, error) {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "whisper-1"
 		}
+	case strings.HasPrefix(c.Request.URL.Path, "/v1/realtime"):
+		// the realtime session is a GET request with the model in the query
+		if modelRequest.Model == "" {
+			modelRequest.Model = c.DefaultQuery("model", "gpt-4o-realtime-preview")
+		}
 	}
 
 	return modelRequest.Model, nil
@@ -78,12 +91,35 @@ func isModelInList(modelName string, models string) bool {
 	return false
 }
 
-// GetTokenKeyParts extracts the token key parts from the Authorization header
+// GetTokenKeyParts extracts the token key parts from the Authorization header,
+// or from the x-api-key header used by anthropic sdk,
+// or from the WebSocket subprotocol used by the browsers for the realtime API.
 //
 // key like `sk-{token}[-{channelid}]`
 func GetTokenKeyParts(c *gin.Context) []string {
 	key := c.Request.Header.Get("Authorization")
+	if key == "" {
+		key = c.Request.Header.Get("x-api-key")
+	}
+	if key == "" {
+		key = getWebSocketProtocolKey(c)
+	}
 	key = strings.TrimPrefix(key, "Bearer ")
 	key = strings.TrimPrefix(strings.TrimPrefix(key, "sk-"), "laisky-")
 	return strings.Split(key, "-")
 }
+
+// websocketKeyProtocolPrefix is the prefix of the subprotocol carrying the api key,
+// since the browsers could not set the headers of the WebSocket handshake.
+const websocketKeyProtocolPrefix = "openai-insecure-api-key."
+
+// getWebSocketProtocolKey returns the api key in the Sec-WebSocket-Protocol header
+func getWebSocketProtocolKey(c *gin.Context) string {
+	for _, protocol := range strings.Split(c.Request.Header.Get("Sec-WebSocket-Protocol"), ",") {
+		protocol = strings.TrimSpace(protocol)
+		if strings.HasPrefix(protocol, websocketKeyProtocolPrefix) {
+			return strings.TrimPrefix(protocol, websocketKeyProtocolPrefix)
+		}
+	}
+	return ""
+}
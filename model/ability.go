@@ -25,7 +25,6 @@ type Ability struct {
 }
 
 func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
-	ability := Ability{}
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -34,7 +33,6 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 	}
 	now := time.Now()
 
-	var err error = nil
 	var channelQuery *gorm.DB
 	if ignoreFirstPriority {
 		channelQuery = DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)", group, model, now)
@@ -42,19 +40,36 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)", group, model, now)
 		channelQuery = DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND priority = (?) AND (suspend_until IS NULL OR suspend_until < ?)", group, model, maxPrioritySubQuery, now)
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
-	}
+	channel, err := pickAbilityChannel(channelQuery, group, model)
 	if err != nil {
 		return nil, errors.Wrap(err, "get random satisfied channel")
 	}
+	return channel, nil
+}
+
+// pickAbilityChannel picks one of the channels of the abilities matched by channelQuery,
+// by the load balancing strategy of the model in the group.
+func pickAbilityChannel(channelQuery *gorm.DB, group string, model string) (*Channel, error) {
+	var abilities []Ability
+	if err := channelQuery.Find(&abilities).Error; err != nil {
+		return nil, errors.Wrap(err, "find abilities")
+	}
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	if len(channelIds) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
 
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	var channels []*Channel
+	if err := DB.Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+		return nil, errors.Wrap(err, "find channels")
+	}
+	if channels = filterAvailableChannels(model, channels); len(channels) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return pickChannel(group, model, channels), nil
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -185,7 +200,6 @@ func SuspendAbility(ctx context.Context, group string, modelName string, channel
 }
 
 func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool) (*Channel, error) {
-	ability := Ability{}
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -194,7 +208,6 @@ func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstP
 	}
 	now := time.Now()
 
-	var err error = nil
 	var channelQuery *gorm.DB
 
 	// Build base query with exclusions
@@ -271,17 +284,9 @@ func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstP
 		}
 	}
 
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
-	}
+	channel, err := pickAbilityChannel(channelQuery, group, model)
 	if err != nil {
 		return nil, errors.Wrap(err, "get random satisfied channel excluding failed ones")
 	}
-
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	return channel, nil
 }
@@ -12,29 +12,28 @@ import (
 	"github.com/songquanpeng/one-api/common"
 )
 
-func setupTestDB(t *testing.T) *gorm.DB {
+// setupTestDB replaces DB and LOG_DB with an in-memory SQLite database migrated with the models,
+// the original databases are restored once the test finishes.
+func setupTestDB(t *testing.T, models ...any) *gorm.DB {
 	// Create in-memory SQLite database for testing
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
 	// Auto-migrate the tables
-	err = db.AutoMigrate(&Channel{}, &Ability{})
+	err = db.AutoMigrate(models...)
 	require.NoError(t, err)
 
+	// Replace the databases, and set SQLite flag for proper query handling
+	originalDB, originalLogDB, originalUsingSQLite := DB, LOG_DB, common.UsingSQLite
+	DB, LOG_DB, common.UsingSQLite = db, db, true
+	t.Cleanup(func() { DB, LOG_DB, common.UsingSQLite = originalDB, originalLogDB, originalUsingSQLite })
+
 	return db
 }
 
 func TestGetRandomSatisfiedChannelExcluding_PriorityLogic(t *testing.T) {
 	// Setup test database
-	testDB := setupTestDB(t)
-	originalDB := DB
-	DB = testDB
-	defer func() { DB = originalDB }()
-
-	// Set SQLite flag for proper query handling
-	originalUsingSQLite := common.UsingSQLite
-	common.UsingSQLite = true
-	defer func() { common.UsingSQLite = originalUsingSQLite }()
+	setupTestDB(t, &Channel{}, &Ability{})
 
 	// Create test channels with different priorities
 	channels := []Channel{
@@ -158,15 +157,7 @@ func TestGetRandomSatisfiedChannelExcluding_PriorityLogic(t *testing.T) {
 
 func TestGetRandomSatisfiedChannelExcluding_SuspendedChannels(t *testing.T) {
 	// Setup test database
-	testDB := setupTestDB(t)
-	originalDB := DB
-	DB = testDB
-	defer func() { DB = originalDB }()
-
-	// Set SQLite flag for proper query handling
-	originalUsingSQLite := common.UsingSQLite
-	common.UsingSQLite = true
-	defer func() { common.UsingSQLite = originalUsingSQLite }()
+	setupTestDB(t, &Channel{}, &Ability{})
 
 	// Create test channels
 	channels := []Channel{
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// AuditRedacted replaces the values of the sensitive fields in the audit logs
+const AuditRedacted = "[REDACTED]"
+
+// ErrAuditLogImmutable is returned if an audit log is updated or deleted
+var ErrAuditLogImmutable = errors.New("audit logs are append-only")
+
+// AuditLog records who changed what through the management APIs, it's append-only.
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);default:''"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64);default:''"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target,priority:2"`
+	// Diff is a JSON object of the changed fields, {"field": {"before": ..., "after": ...}},
+	// the values of the sensitive fields are redacted.
+	Diff string `json:"diff" gorm:"type:text"`
+}
+
+// BeforeUpdate keeps the audit logs from being changed
+func (log *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete keeps the audit logs from being deleted
+func (log *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditFieldChange is the change of a field in AuditLog.Diff
+type AuditFieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// isSensitiveAuditField returns true if the value of the field should not be saved in the audit logs
+func isSensitiveAuditField(field string) bool {
+	field = strings.ToLower(field)
+	switch field {
+	case "key", "config":
+		return true
+	}
+	return strings.Contains(field, "password") ||
+		strings.Contains(field, "secret") ||
+		strings.Contains(field, "token")
+}
+
+func auditFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal audit fields")
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.Wrap(err, "unmarshal audit fields")
+	}
+	return fields, nil
+}
+
+// AuditDiff returns the changed fields between before and after as JSON, both of them
+// should be marshaled to JSON objects, nil means the target doesn't exist.
+func AuditDiff(before any, after any) (string, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return "", err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	diff := make(map[string]AuditFieldChange)
+	for field, value := range beforeFields {
+		if afterValue, ok := afterFields[field]; !ok || !reflect.DeepEqual(value, afterValue) {
+			diff[field] = AuditFieldChange{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			diff[field] = AuditFieldChange{After: value}
+		}
+	}
+	for field, change := range diff {
+		if !isSensitiveAuditField(field) {
+			continue
+		}
+		if change.Before != nil {
+			change.Before = AuditRedacted
+		}
+		if change.After != nil {
+			change.After = AuditRedacted
+		}
+		diff[field] = change
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal audit diff")
+	}
+	return string(data), nil
+}
+
+// RecordAuditLog saves the audit log and exports it to AuditLogWebhookURL if set,
+// the failures are only logged since the change has already been made.
+func RecordAuditLog(ctx context.Context, log *AuditLog) {
+	log.Id = 0
+	log.CreatedAt = helper.GetTimestamp()
+	log.RequestId = helper.GetRequestID(ctx)
+	if err := DB.Create(log).Error; err != nil {
+		logger.Error(ctx, "failed to record audit log: "+err.Error())
+		return
+	}
+	if config.AuditLogWebhookURL != "" {
+		go exportAuditLog(ctx, config.AuditLogWebhookURL, *log)
+	}
+}
+
+func exportAuditLog(ctx context.Context, webhookURL string, log AuditLog) {
+	data, err := json.Marshal(log)
+	if err != nil {
+		logger.Error(ctx, "failed to marshal audit log: "+err.Error())
+		return
+	}
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx),
+		http.MethodPost, webhookURL, bytes.NewReader(data))
+	if err != nil {
+		logger.Error(ctx, "failed to create audit log webhook request: "+err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	httpClient := client.ImpatientHTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Error(ctx, "failed to export audit log: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		logger.Errorf(ctx, "failed to export audit log, webhook returns status %d", resp.StatusCode)
+	}
+}
+
+// AuditLogFilter filters the audit logs, the zero values are ignored
+type AuditLogFilter struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func GetAuditLogs(filter AuditLogFilter, startIdx int, num int) (logs []*AuditLog, err error) {
+	tx := DB.Model(&AuditLog{})
+	if filter.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		tx = tx.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		tx = tx.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := map[string]any{"name": "openai", "key": "sk-old", "weight": 1, "priority": 0}
+	after := map[string]any{"name": "openai-2", "key": "sk-new", "weight": 1, "models": "gpt-4o"}
+	diff, err := AuditDiff(before, after)
+	require.NoError(t, err)
+
+	changes := make(map[string]AuditFieldChange)
+	require.NoError(t, json.Unmarshal([]byte(diff), &changes))
+	assert.Equal(t, AuditFieldChange{Before: "openai", After: "openai-2"}, changes["name"])
+	assert.Equal(t, AuditFieldChange{Before: AuditRedacted, After: AuditRedacted}, changes["key"])
+	assert.Equal(t, AuditFieldChange{Before: float64(0)}, changes["priority"])
+	assert.Equal(t, AuditFieldChange{After: "gpt-4o"}, changes["models"])
+	assert.NotContains(t, changes, "weight")
+	assert.NotContains(t, diff, "sk-")
+
+	diff, err = AuditDiff(nil, map[string]string{"GitHubClientSecret": "secret"})
+	require.NoError(t, err)
+	assert.NotContains(t, diff, `"secret"`)
+}
+
+func TestRecordAuditLog(t *testing.T) {
+	setupTestDB(t, &AuditLog{})
+	webhookURL := config.AuditLogWebhookURL
+	defer func() { config.AuditLogWebhookURL = webhookURL }()
+
+	exported := make(chan AuditLog, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var log AuditLog
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&log))
+		exported <- log
+	}))
+	defer server.Close()
+	config.AuditLogWebhookURL = server.URL
+
+	RecordAuditLog(context.Background(), &AuditLog{ActorId: 1, Action: "channel.update", TargetType: "channel", TargetId: "3", Diff: "{}"})
+	config.AuditLogWebhookURL = ""
+	RecordAuditLog(context.Background(), &AuditLog{ActorId: 2, Action: "option.update", TargetType: "option", TargetId: "Theme", Diff: "{}"})
+
+	select {
+	case log := <-exported:
+		assert.Equal(t, "channel.update", log.Action)
+		assert.Equal(t, "3", log.TargetId)
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit log is not exported")
+	}
+
+	logs, err := GetAuditLogs(AuditLogFilter{TargetType: "channel"}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, 1, logs[0].ActorId)
+	logs, err = GetAuditLogs(AuditLogFilter{}, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "option.update", logs[0].Action)
+
+	// the audit logs are append-only
+	assert.ErrorIs(t, DB.Model(logs[0]).Update("action", "changed").Error, ErrAuditLogImmutable)
+	assert.ErrorIs(t, DB.Delete(logs[0]).Error, ErrAuditLogImmutable)
+}
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// https://platform.openai.com/docs/api-reference/batch/object
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// BatchActiveStatuses are the statuses of the batches that are still being processed
+var BatchActiveStatuses = []string{
+	BatchStatusValidating,
+	BatchStatusInProgress,
+	BatchStatusFinalizing,
+	BatchStatusCancelling,
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    *int   `json:"line,omitempty"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+// Batch is a batch of requests created by the batch api.
+//
+// The batch is either executed by one-api itself, or forwarded to an upstream channel
+// that supports batches natively, in which case ChannelId and UpstreamBatchId are set.
+type Batch struct {
+	Id               string             `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Object           string             `json:"object" gorm:"-"`
+	UserId           int                `json:"-" gorm:"index"`
+	TokenId          int                `json:"-"`
+	Endpoint         string             `json:"endpoint"`
+	InputFileId      string             `json:"input_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status" gorm:"type:varchar(32);index"`
+	OutputFileId     string             `json:"output_file_id,omitempty" gorm:"type:varchar(64)"`
+	ErrorFileId      string             `json:"error_file_id,omitempty" gorm:"type:varchar(64)"`
+	Errors           *BatchErrors       `json:"errors,omitempty" gorm:"serializer:json;type:text"`
+	RequestCounts    BatchRequestCounts `json:"request_counts" gorm:"embedded;embeddedPrefix:request_counts_"`
+	Metadata         map[string]string  `json:"metadata,omitempty" gorm:"serializer:json;type:text"`
+	CreatedAt        int64              `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+	InProgressAt     int64              `json:"in_progress_at,omitempty" gorm:"bigint"`
+	ExpiresAt        int64              `json:"expires_at,omitempty" gorm:"bigint"`
+	FinalizingAt     int64              `json:"finalizing_at,omitempty" gorm:"bigint"`
+	CompletedAt      int64              `json:"completed_at,omitempty" gorm:"bigint"`
+	FailedAt         int64              `json:"failed_at,omitempty" gorm:"bigint"`
+	ExpiredAt        int64              `json:"expired_at,omitempty" gorm:"bigint"`
+	CancellingAt     int64              `json:"cancelling_at,omitempty" gorm:"bigint"`
+	CancelledAt      int64              `json:"cancelled_at,omitempty" gorm:"bigint"`
+	Model            string             `json:"-"`
+	ChannelId        int                `json:"-"`
+	UpstreamBatchId  string             `json:"-" gorm:"type:varchar(128)"`
+	PreConsumedQuota int64              `json:"-"` // the quota reserved for the batch forwarded to the upstream
+}
+
+// BatchItem is the result of one request in a batch executed by one-api,
+// the results are saved one by one so the batch can be resumed after restarts.
+type BatchItem struct {
+	Id        int    `json:"id"`
+	BatchId   string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex:idx_batch_item_line"`
+	Line      int    `json:"line" gorm:"uniqueIndex:idx_batch_item_line"`
+	Success   bool   `json:"success"`
+	Result    string `json:"result" gorm:"type:text"` // one line of the output or error file
+	CreatedAt int64  `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+}
+
+// NewBatch creates a batch owned by userId
+func NewBatch(userId, tokenId int, endpoint, inputFileId, completionWindow string, metadata map[string]string) *Batch {
+	return &Batch{
+		Id:               "batch_" + random.GetUUID(),
+		Object:           "batch",
+		UserId:           userId,
+		TokenId:          tokenId,
+		Endpoint:         endpoint,
+		InputFileId:      inputFileId,
+		CompletionWindow: completionWindow,
+		Status:           BatchStatusValidating,
+		Metadata:         metadata,
+		CreatedAt:        helper.GetTimestamp(),
+	}
+}
+
+func (batch *Batch) AfterFind(tx *gorm.DB) error {
+	batch.Object = "batch"
+	return nil
+}
+
+func (batch *Batch) Insert() error {
+	return errors.Wrap(DB.Create(batch).Error, "insert batch")
+}
+
+// UpdateFields saves the columns of the batch,
+// the status should be changed by TransitStatus instead.
+func (batch *Batch) UpdateFields(columns ...string) error {
+	err := DB.Model(batch).Select(columns).Updates(batch).Error
+	return errors.Wrapf(err, "update %v of batch %s", columns, batch.Id)
+}
+
+// batchStatusTimeColumns are the columns to record when the batch enters the status
+var batchStatusTimeColumns = map[string]string{
+	BatchStatusInProgress: "in_progress_at",
+	BatchStatusFinalizing: "finalizing_at",
+	BatchStatusCompleted:  "completed_at",
+	BatchStatusFailed:     "failed_at",
+	BatchStatusExpired:    "expired_at",
+	BatchStatusCancelling: "cancelling_at",
+	BatchStatusCancelled:  "cancelled_at",
+}
+
+// TransitStatus changes the status of the batch to `to` only if the current status is one of `from`,
+// it returns false if the status is not changed.
+//
+// The status could be changed by other requests (such as cancel) or other nodes,
+// so status transitions should always be conditional.
+func (batch *Batch) TransitStatus(to string, from ...string) (bool, error) {
+	now := helper.GetTimestamp()
+	fields := map[string]any{"status": to}
+	if column, ok := batchStatusTimeColumns[to]; ok {
+		fields[column] = now
+	}
+
+	result := DB.Model(&Batch{}).Where("id = ? AND status IN ?", batch.Id, from).Updates(fields)
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "change status of batch %s to %s", batch.Id, to)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	batch.Status = to
+	switch to {
+	case BatchStatusInProgress:
+		batch.InProgressAt = now
+	case BatchStatusFinalizing:
+		batch.FinalizingAt = now
+	case BatchStatusCompleted:
+		batch.CompletedAt = now
+	case BatchStatusFailed:
+		batch.FailedAt = now
+	case BatchStatusExpired:
+		batch.ExpiredAt = now
+	case BatchStatusCancelling:
+		batch.CancellingAt = now
+	case BatchStatusCancelled:
+		batch.CancelledAt = now
+	}
+	return true, nil
+}
+
+// GetBatchById returns the batch by id
+func GetBatchById(id string) (*Batch, error) {
+	batch := &Batch{}
+	if err := DB.Where("id = ?", id).First(batch).Error; err != nil {
+		return nil, errors.Wrapf(err, "get batch %s", id)
+	}
+	return batch, nil
+}
+
+// GetBatchStatus returns the latest status of the batch
+func GetBatchStatus(id string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Pluck("status", &status).Error
+	return status, errors.Wrapf(err, "get status of batch %s", id)
+}
+
+// GetUserBatchById returns the batch only if it is owned by userId
+func GetUserBatchById(userId int, id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	batch := &Batch{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(batch).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get batch %s", id)
+	}
+	return batch, nil
+}
+
+// GetUserBatches lists the batches of userId in descending order of creation,
+// after is the id of the last batch of the previous page.
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		cursor, err := GetUserBatchById(userId, after)
+		if err != nil {
+			return nil, errors.Wrap(err, "get cursor batch")
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)",
+			cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+	}
+
+	var batches []*Batch
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, errors.Wrap(err, "list batches")
+}
+
+// GetActiveBatches returns all the batches that are still being processed
+func GetActiveBatches() ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status IN ?", BatchActiveStatuses).Order("created_at asc").Find(&batches).Error
+	return batches, errors.Wrap(err, "get active batches")
+}
+
+// SaveBatchItem saves the result of one request, it is a no-op if the result already exists
+func SaveBatchItem(item *BatchItem) error {
+	if item.CreatedAt == 0 {
+		item.CreatedAt = helper.GetTimestamp()
+	}
+	var count int64
+	if err := DB.Model(&BatchItem{}).
+		Where("batch_id = ? AND line = ?", item.BatchId, item.Line).
+		Count(&count).Error; err != nil {
+		return errors.Wrap(err, "check batch item")
+	}
+	if count > 0 {
+		return nil
+	}
+	return errors.Wrap(DB.Create(item).Error, "insert batch item")
+}
+
+// CountBatchItems returns the number of succeeded and failed requests of the batch
+func CountBatchItems(batchId string) (completed int, failed int, err error) {
+	var rows []struct {
+		Success bool
+		Count   int
+	}
+	err = DB.Model(&BatchItem{}).Select("success, count(*) as count").
+		Where("batch_id = ?", batchId).Group("success").Scan(&rows).Error
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "count items of batch %s", batchId)
+	}
+	for _, row := range rows {
+		if row.Success {
+			completed = row.Count
+		} else {
+			failed = row.Count
+		}
+	}
+	return completed, failed, nil
+}
+
+// GetBatchItems returns the results of the batch ordered by line
+func GetBatchItems(batchId string) ([]*BatchItem, error) {
+	var items []*BatchItem
+	err := DB.Where("batch_id = ?", batchId).Order("line asc").Find(&items).Error
+	return items, errors.Wrapf(err, "get items of batch %s", batchId)
+}
+
+// GetBatchFinishedLines returns the lines of the batch that already have results
+func GetBatchFinishedLines(batchId string) (map[int]bool, error) {
+	var lines []int
+	if err := DB.Model(&BatchItem{}).Where("batch_id = ?", batchId).Pluck("line", &lines).Error; err != nil {
+		return nil, errors.Wrapf(err, "get finished lines of batch %s", batchId)
+	}
+	finished := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		finished[line] = true
+	}
+	return finished, nil
+}
+
+// DeleteBatchItems removes the results of the batch after they are saved to files
+func DeleteBatchItems(batchId string) error {
+	err := DB.Where("batch_id = ?", batchId).Delete(&BatchItem{}).Error
+	return errors.Wrapf(err, "delete items of batch %s", batchId)
+}
@@ -0,0 +1,239 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// ErrBudgetExhausted is returned if the budget of the current period is used up
+var ErrBudgetExhausted = errors.New("budget exhausted")
+
+// budgetColumns are the columns of Budget
+var budgetColumns = []string{"budget_quota", "budget_period", "budget_rollover",
+	"budget_used_quota", "budget_period_start", "budget_carried_quota"}
+
+// Budget is a recurring budget of a token or a user, which is reset at the start of each period.
+// It's enforced besides the remain quota, which never resets.
+type Budget struct {
+	// BudgetQuota is the quota could be used in each period, 0 means no budget
+	BudgetQuota int64 `json:"budget_quota" gorm:"bigint;default:0"`
+	// BudgetPeriod is one of daily, weekly and monthly, empty means no budget
+	BudgetPeriod string `json:"budget_period" gorm:"type:varchar(16);default:''"`
+	// BudgetRollover carries the unused budget over to the next period, at most one period of budget
+	BudgetRollover bool `json:"budget_rollover" gorm:"default:false"`
+	// BudgetUsedQuota is the quota used in the current period
+	BudgetUsedQuota int64 `json:"budget_used_quota" gorm:"bigint;default:0"`
+	// BudgetPeriodStart is the unix time when the current period started
+	BudgetPeriodStart int64 `json:"budget_period_start" gorm:"bigint;default:0"`
+	// BudgetCarriedQuota is the unused budget carried over from the last period
+	BudgetCarriedQuota int64 `json:"budget_carried_quota" gorm:"bigint;default:0"`
+}
+
+// ValidateBudget checks the settings of the budget
+func (b *Budget) ValidateBudget() error {
+	if b.BudgetQuota < 0 {
+		return errors.New("budget quota should not be negative")
+	}
+	switch b.BudgetPeriod {
+	case "", BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly:
+	default:
+		return errors.Errorf("invalid budget period %q, should be one of daily, weekly and monthly", b.BudgetPeriod)
+	}
+	return nil
+}
+
+// BudgetEnabled returns true if the budget is set
+func (b *Budget) BudgetEnabled() bool {
+	return b.BudgetQuota > 0 && b.BudgetPeriod != ""
+}
+
+// BudgetRemainQuota returns the quota that could still be used in the current period,
+// the budget should be rolled to the current period first.
+func (b *Budget) BudgetRemainQuota() int64 {
+	return b.BudgetQuota + b.BudgetCarriedQuota - b.BudgetUsedQuota
+}
+
+// RollBudget moves the budget to the period of now if a new period has started,
+// it returns true if the budget is changed.
+func (b *Budget) RollBudget(now time.Time) bool {
+	if !b.BudgetEnabled() {
+		return false
+	}
+	start := budgetPeriodStart(b.BudgetPeriod, now)
+	if b.BudgetPeriodStart >= start.Unix() {
+		return false
+	}
+
+	carried := int64(0)
+	if b.BudgetRollover && b.BudgetPeriodStart > 0 {
+		if budgetPeriodStart(b.BudgetPeriod, start.Add(-time.Second)).Unix() == b.BudgetPeriodStart {
+			carried = min(max(b.BudgetRemainQuota(), 0), b.BudgetQuota)
+		} else {
+			// a whole period has passed without any usage
+			carried = b.BudgetQuota
+		}
+	}
+	b.BudgetPeriodStart = start.Unix()
+	b.BudgetUsedQuota = 0
+	b.BudgetCarriedQuota = carried
+	return true
+}
+
+// BudgetResetAt returns the unix time when the current period ends, 0 if no budget is set
+func (b *Budget) BudgetResetAt() int64 {
+	if !b.BudgetEnabled() || b.BudgetPeriodStart == 0 {
+		return 0
+	}
+	start := time.Unix(b.BudgetPeriodStart, 0).In(budgetLocation())
+	switch b.BudgetPeriod {
+	case BudgetPeriodWeekly:
+		return start.AddDate(0, 0, 7).Unix()
+	case BudgetPeriodMonthly:
+		return start.AddDate(0, 1, 0).Unix()
+	default:
+		return start.AddDate(0, 0, 1).Unix()
+	}
+}
+
+func budgetLocation() *time.Location {
+	if config.BudgetTimezone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(config.BudgetTimezone)
+	if err != nil {
+		logger.SysErrorf("invalid budget timezone %q: %+v", config.BudgetTimezone, err)
+		return time.Local
+	}
+	return location
+}
+
+// budgetPeriodStart returns the start of the period that t is in
+func budgetPeriodStart(period string, t time.Time) time.Time {
+	t = t.In(budgetLocation())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case BudgetPeriodWeekly:
+		// weeks start on monday
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case BudgetPeriodMonthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// loadBudget loads the budget as it's saved, which may be of a past period
+func loadBudget(model any, id int) (*Budget, error) {
+	budget := new(Budget)
+	err := DB.Model(model).Where("id = ?", id).Select(budgetColumns).Scan(budget).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "load budget")
+	}
+	return budget, nil
+}
+
+func getBudget(model any, id int) (*Budget, error) {
+	budget, err := loadBudget(model, id)
+	if err != nil {
+		return nil, err
+	}
+	budget.RollBudget(time.Now())
+	return budget, nil
+}
+
+// consumeBudget adds quota to the used budget of the current period, quota could be negative
+// if the pre-consumed quota is returned.
+func consumeBudget(model any, id int, budget Budget, quota int64) error {
+	if !budget.BudgetEnabled() || quota == 0 {
+		return nil
+	}
+	lastStart := budget.BudgetPeriodStart
+	if budget.RollBudget(time.Now()) {
+		// the period may be rolled by another request at the same time
+		err := DB.Model(model).Where("id = ? AND budget_period_start = ?", id, lastStart).Updates(map[string]any{
+			"budget_period_start":  budget.BudgetPeriodStart,
+			"budget_used_quota":    0,
+			"budget_carried_quota": budget.BudgetCarriedQuota,
+		}).Error
+		if err != nil {
+			return errors.Wrap(err, "roll budget")
+		}
+	}
+	err := DB.Model(model).Where("id = ?", id).
+		Update("budget_used_quota", gorm.Expr("budget_used_quota + ?", quota)).Error
+	if err != nil {
+		return errors.Wrap(err, "consume budget")
+	}
+	return nil
+}
+
+// GetTokenBudget returns the budget of the token in the current period
+func GetTokenBudget(id int) (*Budget, error) {
+	return getBudget(&Token{}, id)
+}
+
+// GetUserBudget returns the budget of the user in the current period
+func GetUserBudget(id int) (*Budget, error) {
+	return getBudget(&User{}, id)
+}
+
+// CheckBudget returns an error if the token or the user doesn't have quota budget left in the current period
+func CheckBudget(tokenId int, userId int, quota int64) error {
+	tokenBudget, err := GetTokenBudget(tokenId)
+	if err != nil {
+		return err
+	}
+	if tokenBudget.BudgetEnabled() && tokenBudget.BudgetRemainQuota() < max(quota, 1) {
+		return errors.Wrapf(ErrBudgetExhausted, "token %s budget resets at %s", tokenBudget.BudgetPeriod,
+			time.Unix(tokenBudget.BudgetResetAt(), 0).Format(time.RFC3339))
+	}
+
+	userBudget, err := GetUserBudget(userId)
+	if err != nil {
+		return err
+	}
+	if userBudget.BudgetEnabled() && userBudget.BudgetRemainQuota() < max(quota, 1) {
+		return errors.Wrapf(ErrBudgetExhausted, "user %s budget resets at %s", userBudget.BudgetPeriod,
+			time.Unix(userBudget.BudgetResetAt(), 0).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// consumeTokenAndUserBudget adds quota to the budgets of the token and its user
+func consumeTokenAndUserBudget(token *Token, quota int64) {
+	if err := consumeBudget(&Token{}, token.Id, token.Budget, quota); err != nil {
+		logger.SysError(fmt.Sprintf("failed to consume budget of token %d: %s", token.Id, err.Error()))
+	}
+	userBudget, err := loadBudget(&User{}, token.UserId)
+	if err == nil {
+		err = consumeBudget(&User{}, token.UserId, *userBudget, quota)
+	}
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to consume budget of user %d: %s", token.UserId, err.Error()))
+	}
+}
+
+// UpdateUserBudget updates the budget settings of the user, the used budget of the current period is kept
+func UpdateUserBudget(id int, budget Budget) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"budget_quota":    budget.BudgetQuota,
+		"budget_period":   budget.BudgetPeriod,
+		"budget_rollover": budget.BudgetRollover,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "update user budget")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestBudgetPeriodStart(t *testing.T) {
+	timezone := config.BudgetTimezone
+	defer func() { config.BudgetTimezone = timezone }()
+	config.BudgetTimezone = "UTC"
+
+	// a wednesday
+	now := time.Date(2025, 7, 16, 15, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 7, 16, 0, 0, 0, 0, time.UTC).Unix(), budgetPeriodStart(BudgetPeriodDaily, now).Unix())
+	assert.Equal(t, time.Date(2025, 7, 14, 0, 0, 0, 0, time.UTC).Unix(), budgetPeriodStart(BudgetPeriodWeekly, now).Unix())
+	assert.Equal(t, time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC).Unix(), budgetPeriodStart(BudgetPeriodMonthly, now).Unix())
+
+	config.BudgetTimezone = "Asia/Shanghai"
+	// it's already the next day in Shanghai
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 7, 17, 0, 0, 0, 0, shanghai).Unix(), budgetPeriodStart(BudgetPeriodDaily, now.Add(2*time.Hour)).Unix())
+}
+
+func TestRollBudget(t *testing.T) {
+	timezone := config.BudgetTimezone
+	defer func() { config.BudgetTimezone = timezone }()
+	config.BudgetTimezone = "UTC"
+
+	day1 := time.Date(2025, 7, 16, 10, 0, 0, 0, time.UTC)
+	budget := Budget{BudgetQuota: 100, BudgetPeriod: BudgetPeriodDaily}
+	assert.True(t, budget.RollBudget(day1))
+	assert.False(t, budget.RollBudget(day1.Add(time.Hour)))
+	assert.Equal(t, day1.Add(14*time.Hour).Unix(), budget.BudgetResetAt())
+
+	budget.BudgetUsedQuota = 70
+	assert.Equal(t, int64(30), budget.BudgetRemainQuota())
+	assert.True(t, budget.RollBudget(day1.AddDate(0, 0, 1)))
+	assert.Equal(t, int64(100), budget.BudgetRemainQuota())
+
+	// the unused budget is carried over, at most one period of budget
+	budget.BudgetRollover = true
+	budget.BudgetUsedQuota = 70
+	budget.RollBudget(day1.AddDate(0, 0, 2))
+	assert.Equal(t, int64(30), budget.BudgetCarriedQuota)
+	assert.Equal(t, int64(130), budget.BudgetRemainQuota())
+	budget.RollBudget(day1.AddDate(0, 0, 3))
+	assert.Equal(t, int64(100), budget.BudgetCarriedQuota)
+	budget.BudgetUsedQuota = 250
+	budget.RollBudget(day1.AddDate(0, 0, 4))
+	assert.Zero(t, budget.BudgetCarriedQuota)
+
+	disabled := Budget{BudgetPeriod: BudgetPeriodDaily}
+	assert.False(t, disabled.RollBudget(day1))
+}
+
+func TestConsumeBudget(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{})
+	redisEnabled, batchUpdateEnabled := common.RedisEnabled, config.BatchUpdateEnabled
+	common.RedisEnabled, config.BatchUpdateEnabled = false, false
+	defer func() { common.RedisEnabled, config.BatchUpdateEnabled = redisEnabled, batchUpdateEnabled }()
+
+	user := &User{Id: 1, Username: "budget", Quota: 10000, AccessToken: "budget", AffCode: "budget"}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, UpdateUserBudget(user.Id, Budget{BudgetQuota: 500, BudgetPeriod: BudgetPeriodMonthly}))
+	token := &Token{Id: 1, UserId: user.Id, Key: "budget", RemainQuota: 10000,
+		Budget: Budget{BudgetQuota: 100, BudgetPeriod: BudgetPeriodDaily}}
+	require.NoError(t, DB.Create(token).Error)
+
+	require.NoError(t, CheckBudget(token.Id, user.Id, 100))
+	require.NoError(t, PreConsumeTokenQuota(token.Id, 80))
+	require.NoError(t, PostConsumeTokenQuota(token.Id, -20))
+
+	tokenBudget, err := GetTokenBudget(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), tokenBudget.BudgetUsedQuota)
+	userBudget, err := GetUserBudget(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), userBudget.BudgetUsedQuota)
+
+	assert.NoError(t, CheckBudget(token.Id, user.Id, 40))
+	assert.ErrorIs(t, CheckBudget(token.Id, user.Id, 41), ErrBudgetExhausted)
+
+	// a budget of the past period is reset once used
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).
+		Update("budget_period_start", time.Now().AddDate(0, 0, -2).Unix()).Error)
+	require.NoError(t, PostConsumeTokenQuota(token.Id, 10))
+	tokenBudget, err = GetTokenBudget(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), tokenBudget.BudgetUsedQuota)
+	userBudget, err = GetUserBudget(user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(70), userBudget.BudgetUsedQuota)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,7 +15,8 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/balancer"
+	"github.com/songquanpeng/one-api/relay/breaker"
 )
 
 var (
@@ -336,6 +336,13 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	copy(candidateChannels, channelsFromCache)
 	channelSyncLock.RUnlock()
 
+	// the channels with open circuit breakers are skipped, so the lower priority ones take over
+	candidateChannels = filterAvailableChannels(model, candidateChannels)
+
+	if len(candidateChannels) == 0 {
+		return nil, errors.New("all channels are unavailable due to open circuit breakers")
+	}
+
 	endIdx := len(candidateChannels)
 	// choose by priority
 	if endIdx == 0 { // Should be caught by earlier check, but as a safeguard
@@ -378,27 +385,13 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 		}
 	}
 
-	idx := rand.Intn(endIdx)
-	if ignoreFirstPriority {
-		if endIdx < len(candidateChannels) { // which means there are more than one priority
-			idx = random.RandRange(endIdx, len(candidateChannels))
-		} else {
-			// All channels have the same highest priority, or only one priority level exists.
-			// If ignoreFirstPriority is true, and we only have one priority level,
-			// it means we cannot satisfy "ignoreFirstPriority".
-			// This case might indicate no lower-priority channels exist.
-			// Depending on desired behavior, could return error or pick from existing.
-			// For now, let's assume it means "pick any if only one priority level".
-			// If truly no other channel to pick, the random selection will pick from current set.
-			// This part of logic might need refinement based on precise meaning of ignoreFirstPriority
-			// when only one priority tier exists.
-			// The original code implies if endIdx == len(channels), it picks from 0 to endIdx-1.
-			// If endIdx < len(channels), it picks from endIdx to len(channels)-1.
-			// So if ignoreFirstPriority is true and all are same priority, it will still pick from them.
-			// This seems okay.
-		}
+	channels := candidateChannels[:endIdx]
+	if ignoreFirstPriority && endIdx < len(candidateChannels) { // which means there are more than one priority
+		channels = candidateChannels[endIdx:]
 	}
-	return candidateChannels[idx], nil
+	// If ignoreFirstPriority is true but only one priority level exists,
+	// we still pick from the current set.
+	return pickChannel(group, model, channels), nil
 }
 
 // CacheGetRandomSatisfiedChannelExcluding gets a random satisfied channel while excluding specified channel IDs
@@ -417,7 +410,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 	// Filter out excluded channels
 	var candidateChannels []*Channel
 	for _, channel := range channelsFromCache {
-		if !excludeChannelIds[channel.Id] {
+		if !excludeChannelIds[channel.Id] && breaker.Available(channel.Id, model) {
 			candidateChannels = append(candidateChannels, channel)
 		}
 	}
@@ -471,8 +464,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 
 		// If there are lower priority channels available, select from them
 		if endIdx < len(candidateChannels) {
-			idx := random.RandRange(endIdx, len(candidateChannels))
-			return candidateChannels[idx], nil
+			return pickChannel(group, model, candidateChannels[endIdx:]), nil
 		} else {
 			// No lower priority channels available, return error to indicate we should try a different approach
 			return nil, errors.New("no lower priority channels available after excluding failed channels")
@@ -505,7 +497,28 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 			return nil, errors.New("no channels with maximum priority available")
 		}
 
-		idx := rand.Intn(len(maxPriorityChannels))
-		return maxPriorityChannels[idx], nil
+		return pickChannel(group, model, maxPriorityChannels), nil
+	}
+}
+
+// pickChannel picks one of channels by the load balancing strategy of the model in the group
+func pickChannel(group string, model string, channels []*Channel) *Channel {
+	candidates := make([]balancer.Candidate, len(channels))
+	for i, channel := range channels {
+		candidates[i] = balancer.Candidate{ChannelId: channel.Id, Weight: channel.GetWeight()}
+	}
+	channel := channels[balancer.Pick(balancer.GetStrategy(group, model), candidates)]
+	breaker.Acquire(channel.Id, model)
+	return channel
+}
+
+// filterAvailableChannels returns the channels whose circuit breakers of the model are not open
+func filterAvailableChannels(model string, channels []*Channel) []*Channel {
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if breaker.Available(channel.Id, model) {
+			available = append(available, channel)
+		}
 	}
+	return available
 }
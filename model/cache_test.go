@@ -5,7 +5,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/breaker"
 )
 
 func TestCacheGetRandomSatisfiedChannelExcluding(t *testing.T) {
@@ -154,3 +156,47 @@ func TestChannel_GetPriority(t *testing.T) {
 		})
 	}
 }
+
+func TestCacheGetRandomSatisfiedChannelSkipsOpenCircuitBreakers(t *testing.T) {
+	originalMemoryCacheEnabled := config.MemoryCacheEnabled
+	originalRedisEnabled := common.RedisEnabled
+	originalBreakerEnabled := config.CircuitBreakerEnabled
+	originalConsecutiveFailures := config.CircuitBreakerConsecutiveFailures
+	config.MemoryCacheEnabled = true
+	common.RedisEnabled = false
+	config.CircuitBreakerEnabled = true
+	config.CircuitBreakerConsecutiveFailures = 1
+	defer func() {
+		config.MemoryCacheEnabled = originalMemoryCacheEnabled
+		common.RedisEnabled = originalRedisEnabled
+		config.CircuitBreakerEnabled = originalBreakerEnabled
+		config.CircuitBreakerConsecutiveFailures = originalConsecutiveFailures
+	}()
+
+	testGroup := "breaker-group"
+	testModel := "gpt-4o"
+	if group2model2channels == nil {
+		group2model2channels = make(map[string]map[string][]*Channel)
+	}
+	group2model2channels[testGroup] = map[string][]*Channel{
+		testModel: {
+			{Id: 101, Priority: &[]int64{100}[0]},
+			{Id: 102, Priority: &[]int64{50}[0]},
+		},
+	}
+
+	breaker.Record(101, testModel, false)
+	defer breaker.Reset(101, testModel)
+
+	// the lower priority channel takes over
+	for i := 0; i < 10; i++ {
+		channel, err := CacheGetRandomSatisfiedChannel(testGroup, testModel, false)
+		assert.NoError(t, err)
+		assert.Equal(t, 102, channel.Id)
+	}
+
+	breaker.Record(102, testModel, false)
+	defer breaker.Reset(102, testModel)
+	_, err := CacheGetRandomSatisfiedChannel(testGroup, testModel, false)
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -42,6 +43,9 @@ type Channel struct {
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
 	RateLimit          *int    `json:"ratelimit" gorm:"column:ratelimit;default:0"`
+	// KeyStrategy is the strategy to choose a key if the key is a list of keys, one key per line,
+	// it's empty if the channel has a single key.
+	KeyStrategy string `json:"key_strategy" gorm:"type:varchar(32);default:''"`
 	// Channel-specific pricing tables
 	// DEPRECATED: Use ModelConfigs instead. These fields are kept for backward compatibility and migration.
 	ModelRatio      *string `json:"model_ratio" gorm:"type:text"`      // DEPRECATED: JSON string of model pricing ratios
@@ -107,6 +111,11 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	for i := range channels {
+		if err = channels[i].encryptSecrets(); err != nil {
+			return err
+		}
+	}
 	err = DB.Create(&channels).Error
 	if err != nil {
 		return err
@@ -128,6 +137,13 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+func (channel *Channel) GetWeight() uint {
+	if channel.Weight == nil {
+		return 0
+	}
+	return *channel.Weight
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -511,10 +527,19 @@ func ValidateInferenceProfileArnMapJSON(jsonStr string) error {
 
 func (channel *Channel) Insert() error {
 	var err error
+	key := channel.Key
+	if err = channel.encryptSecrets(); err != nil {
+		return err
+	}
 	err = DB.Create(channel).Error
 	if err != nil {
 		return err
 	}
+	if channel.IsMultiKey() {
+		if _, err = syncChannelKeys(channel.Id, splitChannelKeys(key)); err != nil {
+			return err
+		}
+	}
 	err = channel.AddAbilities()
 	if err == nil {
 		InitChannelCache()
@@ -524,11 +549,23 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
+	if err = channel.encryptSecrets(); err != nil {
+		return err
+	}
 	err = DB.Model(channel).Updates(channel).Error
 	if err != nil {
 		return err
 	}
+	// Updates skips the empty key strategy, which turns the channel back to a single key
+	err = DB.Model(channel).Select("key_strategy").Updates(channel).Error
+	if err != nil {
+		return err
+	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
+	// the key states are synced with the saved key, which is kept if the key is not changed
+	if err = channel.syncKeys(); err != nil {
+		return err
+	}
 	err = channel.UpdateAbilities()
 	if err == nil {
 		InitChannelCache()
@@ -553,7 +590,13 @@ func (channel *Channel) UpdateBalance(balance float64) {
 	}).Error
 	if err != nil {
 		logger.SysError("failed to update balance: " + err.Error())
+		return
 	}
+	go EmitWebhookEvent(context.Background(), WebhookEventChannelBalanceUpdated, 0, map[string]any{
+		"channel_id":   channel.Id,
+		"channel_name": channel.Name,
+		"balance":      balance,
+	})
 }
 
 func (channel *Channel) Delete() error {
@@ -562,6 +605,9 @@ func (channel *Channel) Delete() error {
 	if err != nil {
 		return err
 	}
+	if err = DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKey{}).Error; err != nil {
+		return err
+	}
 	err = channel.DeleteAbilities()
 	if err == nil {
 		InitChannelCache()
@@ -0,0 +1,419 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// The strategies to choose a key of the multi-key channels
+const (
+	ChannelKeyStrategyRoundRobin = "round_robin"
+	ChannelKeyStrategyRandom     = "random"
+	ChannelKeyStrategyLeastUsed  = "least_used"
+)
+
+// ChannelKey is the state of a key of the multi-key channel.
+//
+// The keys themselves are saved in the key of the channel, one key per line,
+// and they're matched to the states by the hash.
+type ChannelKey struct {
+	Id        int    `json:"id"`
+	ChannelId int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_key_hash"`
+	KeyHash   string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_channel_key_hash"`
+	// KeyHint is the masked key to tell the keys apart
+	KeyHint string `json:"key_hint" gorm:"type:varchar(32)"`
+	Status  int    `json:"status" gorm:"default:1"`
+	// CooldownUntil is the timestamp the key is rate limited until
+	CooldownUntil int64  `json:"cooldown_until" gorm:"bigint;default:0"`
+	UsedCount     int64  `json:"used_count" gorm:"bigint;default:0"`
+	FailedCount   int64  `json:"failed_count" gorm:"bigint;default:0"`
+	LastError     string `json:"last_error" gorm:"type:text"`
+	LastUsedTime  int64  `json:"last_used_time" gorm:"bigint;default:0"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+// channelKeyCacheTTL is how long the cached key states are used before they're reloaded,
+// so the keys disabled or cooled down by the other nodes are skipped soon.
+const channelKeyCacheTTL = 10 * time.Second
+
+// channelKeyCursors are the round-robin cursors of the channels, channel id -> *atomic.Uint64
+var channelKeyCursors sync.Map
+
+// channelKeyStates caches the key states of the multi-key channels, channel id -> *channelKeyCache
+var channelKeyStates sync.Map
+
+type channelKeyCache struct {
+	states   []*ChannelKey
+	loadedAt time.Time
+}
+
+// channelKeyUsage is the usage of the keys not saved yet, key id -> *channelKeyUsageRecord
+var (
+	channelKeyUsage     = make(map[int]*channelKeyUsageRecord)
+	channelKeyUsageLock sync.Mutex
+)
+
+type channelKeyUsageRecord struct {
+	count        int64
+	lastUsedTime int64
+}
+
+// IsValidChannelKeyStrategy returns true if the strategy is empty, which means a single key, or a known strategy
+func IsValidChannelKeyStrategy(strategy string) bool {
+	switch strategy {
+	case "", ChannelKeyStrategyRoundRobin, ChannelKeyStrategyRandom, ChannelKeyStrategyLeastUsed:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsMultiKey returns true if the key of the channel is a list of keys
+func (channel *Channel) IsMultiKey() bool {
+	return channel.KeyStrategy != ""
+}
+
+// Keys returns the keys of the channel in plaintext, there's only one key if the channel isn't multi-key
+func (channel *Channel) Keys() ([]string, error) {
+	key, err := channel.DecryptedKey()
+	if err != nil {
+		return nil, err
+	}
+	if !channel.IsMultiKey() {
+		return []string{key}, nil
+	}
+	return splitChannelKeys(key), nil
+}
+
+// splitChannelKeys splits the keys by lines, the empty and the duplicated keys are dropped
+func splitChannelKeys(key string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, k := range strings.Split(key, "\n") {
+		if k = strings.TrimSpace(k); k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func hashChannelKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
+
+// syncChannelKeys creates the states of the new keys, and deletes the states of the removed keys.
+// The states are synced when the channel is saved, and cached for SelectKey.
+func syncChannelKeys(channelId int, keys []string) ([]*ChannelKey, error) {
+	states, err := GetChannelKeys(channelId)
+	if err != nil {
+		return nil, errors.Wrap(err, "get channel keys")
+	}
+	existing := make(map[string]*ChannelKey, len(states))
+	for _, state := range states {
+		existing[state.KeyHash] = state
+	}
+
+	created := false
+	for _, key := range keys {
+		hash := hashChannelKey(key)
+		if _, ok := existing[hash]; ok {
+			delete(existing, hash)
+			continue
+		}
+		state := &ChannelKey{
+			ChannelId:   channelId,
+			KeyHash:     hash,
+			KeyHint:     maskChannelKey(key),
+			Status:      ChannelStatusEnabled,
+			CreatedTime: helper.GetTimestamp(),
+		}
+		// the same key could be synced by the other nodes at the same time
+		if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(state).Error; err != nil {
+			return nil, errors.Wrap(err, "create channel key")
+		}
+		created = true
+	}
+
+	var removed []int
+	for _, state := range existing {
+		removed = append(removed, state.Id)
+	}
+	if len(removed) > 0 {
+		if err := DB.Delete(&ChannelKey{}, removed).Error; err != nil {
+			return nil, errors.Wrap(err, "delete channel keys")
+		}
+	}
+	if created || len(removed) > 0 {
+		if states, err = GetChannelKeys(channelId); err != nil {
+			return nil, errors.Wrap(err, "get channel keys")
+		}
+	}
+	channelKeyStates.Store(channelId, &channelKeyCache{states: states, loadedAt: time.Now()})
+
+	synced, ok := matchChannelKeyStates(states, keys)
+	if !ok {
+		return nil, errors.Errorf("the keys of channel %d are changed while syncing", channelId)
+	}
+	return synced, nil
+}
+
+// matchChannelKeyStates returns the states of the keys in the same order,
+// it returns false if any key doesn't have a state.
+func matchChannelKeyStates(states []*ChannelKey, keys []string) ([]*ChannelKey, bool) {
+	byHash := make(map[string]*ChannelKey, len(states))
+	for _, state := range states {
+		byHash[state.KeyHash] = state
+	}
+	matched := make([]*ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		state, ok := byHash[hashChannelKey(key)]
+		if !ok {
+			return nil, false
+		}
+		matched = append(matched, state)
+	}
+	return matched, true
+}
+
+// getChannelKeyStates returns the states of the keys of the channel from the cache, the states are reloaded
+// once they're expired, and synced if the keys are changed without syncing, e.g. by the channels saved by old versions.
+func getChannelKeyStates(channelId int, keys []string) ([]*ChannelKey, error) {
+	if cached, ok := channelKeyStates.Load(channelId); ok && time.Since(cached.(*channelKeyCache).loadedAt) < channelKeyCacheTTL {
+		if states, ok := matchChannelKeyStates(cached.(*channelKeyCache).states, keys); ok {
+			return states, nil
+		}
+	}
+
+	states, err := GetChannelKeys(channelId)
+	if err != nil {
+		return nil, errors.Wrap(err, "get channel keys")
+	}
+	channelKeyStates.Store(channelId, &channelKeyCache{states: states, loadedAt: time.Now()})
+	if matched, ok := matchChannelKeyStates(states, keys); ok {
+		return matched, nil
+	}
+	return syncChannelKeys(channelId, keys)
+}
+
+// syncKeys syncs the key states of the multi-key channel after the channel is saved
+func (channel *Channel) syncKeys() error {
+	if !channel.IsMultiKey() {
+		channelKeyStates.Delete(channel.Id)
+		return nil
+	}
+	keys, err := channel.Keys()
+	if err != nil {
+		return err
+	}
+	_, err = syncChannelKeys(channel.Id, keys)
+	return err
+}
+
+// recordChannelKeyUsage counts the usage of the key in the cache, it's saved by SyncChannelKeyUsage later
+func recordChannelKeyUsage(state *ChannelKey, now int64) {
+	atomic.AddInt64(&state.UsedCount, 1)
+	atomic.StoreInt64(&state.LastUsedTime, now)
+
+	channelKeyUsageLock.Lock()
+	defer channelKeyUsageLock.Unlock()
+	record, ok := channelKeyUsage[state.Id]
+	if !ok {
+		record = new(channelKeyUsageRecord)
+		channelKeyUsage[state.Id] = record
+	}
+	record.count++
+	record.lastUsedTime = now
+}
+
+// flushChannelKeyUsage saves the usage of the keys counted since the last flush
+func flushChannelKeyUsage() {
+	channelKeyUsageLock.Lock()
+	usage := channelKeyUsage
+	channelKeyUsage = make(map[int]*channelKeyUsageRecord)
+	channelKeyUsageLock.Unlock()
+
+	for keyId, record := range usage {
+		err := DB.Model(&ChannelKey{}).Where("id = ?", keyId).Updates(map[string]any{
+			"used_count":     gorm.Expr("used_count + ?", record.count),
+			"last_used_time": record.lastUsedTime,
+		}).Error
+		if err != nil {
+			logger.SysError("failed to update usage of channel key: " + err.Error())
+		}
+	}
+}
+
+// SyncChannelKeyUsage saves the usage of the keys of the multi-key channels periodically
+func SyncChannelKeyUsage(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		flushChannelKeyUsage()
+	}
+}
+
+func (state *ChannelKey) isAvailable(now int64) bool {
+	return state.Status == ChannelStatusEnabled && state.CooldownUntil <= now
+}
+
+// SelectKey chooses a key by the key strategy of the channel from the cached key states, and counts the usage of the key.
+// It returns the key in plaintext and the id of the key state, the id is 0 if the channel isn't multi-key.
+func (channel *Channel) SelectKey() (key string, keyId int, err error) {
+	keys, err := channel.Keys()
+	if err != nil {
+		return "", 0, err
+	}
+	if !channel.IsMultiKey() {
+		return keys[0], 0, nil
+	}
+	if len(keys) == 0 {
+		return "", 0, errors.Errorf("channel %d has no keys", channel.Id)
+	}
+
+	states, err := getChannelKeyStates(channel.Id, keys)
+	if err != nil {
+		return "", 0, err
+	}
+	now := helper.GetTimestamp()
+	var available []int
+	for i, state := range states {
+		if state.isAvailable(now) {
+			available = append(available, i)
+		}
+	}
+	if len(available) == 0 {
+		// the ability of the channel is suspended once all keys are rate limited,
+		// the requests in between still try the rate limited keys
+		for i, state := range states {
+			if state.Status == ChannelStatusEnabled {
+				available = append(available, i)
+			}
+		}
+	}
+	if len(available) == 0 {
+		return "", 0, errors.Errorf("all keys of channel %d are disabled", channel.Id)
+	}
+
+	var selected int
+	switch channel.KeyStrategy {
+	case ChannelKeyStrategyRandom:
+		selected = available[rand.IntN(len(available))]
+	case ChannelKeyStrategyLeastUsed:
+		selected = available[0]
+		for _, i := range available[1:] {
+			if atomic.LoadInt64(&states[i].UsedCount) < atomic.LoadInt64(&states[selected].UsedCount) {
+				selected = i
+			}
+		}
+	default:
+		cursor, _ := channelKeyCursors.LoadOrStore(channel.Id, new(atomic.Uint64))
+		selected = available[cursor.(*atomic.Uint64).Add(1)%uint64(len(available))]
+	}
+
+	state := states[selected]
+	recordChannelKeyUsage(state, now)
+	return keys[selected], state.Id, nil
+}
+
+// GetKeyById returns the key of the key state keyId in plaintext, which is selected by SelectKey before.
+// The only key is returned if the channel isn't multi-key.
+func (channel *Channel) GetKeyById(keyId int) (string, error) {
+	keys, err := channel.Keys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errors.Errorf("channel %d has no keys", channel.Id)
+	}
+	if !channel.IsMultiKey() || keyId == 0 {
+		return keys[0], nil
+	}
+
+	state := new(ChannelKey)
+	if err = DB.Where("id = ? AND channel_id = ?", keyId, channel.Id).First(state).Error; err != nil {
+		return "", errors.Wrapf(err, "get key %d of channel %d", keyId, channel.Id)
+	}
+	for _, key := range keys {
+		if hashChannelKey(key) == state.KeyHash {
+			return key, nil
+		}
+	}
+	return "", errors.Errorf("key %d of channel %d has been removed", keyId, channel.Id)
+}
+
+// RecordChannelKeyError records the failed request of the key, the key is cooled down if cooldown is positive,
+// and disabled if disable is true. It returns the number of the keys of the channel still available.
+func RecordChannelKeyError(keyId int, message string, cooldown time.Duration, disable bool) (available int64, err error) {
+	state := new(ChannelKey)
+	if err = DB.First(state, "id = ?", keyId).Error; err != nil {
+		return 0, errors.Wrapf(err, "get channel key %d", keyId)
+	}
+	updates := map[string]any{
+		"failed_count": gorm.Expr("failed_count + ?", 1),
+		"last_error":   message,
+	}
+	if cooldown > 0 {
+		updates["cooldown_until"] = time.Now().Add(cooldown).Unix()
+	}
+	if disable {
+		updates["status"] = ChannelStatusAutoDisabled
+	}
+	if err = DB.Model(&ChannelKey{}).Where("id = ?", keyId).Updates(updates).Error; err != nil {
+		return 0, errors.Wrapf(err, "update channel key %d", keyId)
+	}
+	channelKeyStates.Delete(state.ChannelId)
+	err = DB.Model(&ChannelKey{}).
+		Where("channel_id = ? AND status = ? AND cooldown_until <= ?", state.ChannelId, ChannelStatusEnabled, helper.GetTimestamp()).
+		Count(&available).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "count available keys of channel %d", state.ChannelId)
+	}
+	return available, nil
+}
+
+// GetChannelKeys returns the key states of the multi-key channel
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var states []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Order("id").Find(&states).Error
+	return states, err
+}
+
+// UpdateChannelKeyStatus enables or disables a key of the channel manually, the cooldown is reset on enabling
+func UpdateChannelKeyStatus(channelId int, keyId int, status int) error {
+	if status != ChannelStatusEnabled && status != ChannelStatusManuallyDisabled {
+		return errors.Errorf("invalid key status %d", status)
+	}
+	updates := map[string]any{"status": status}
+	if status == ChannelStatusEnabled {
+		updates["cooldown_until"] = 0
+	}
+	result := DB.Model(&ChannelKey{}).Where("id = ? AND channel_id = ?", keyId, channelId).Updates(updates)
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "update channel key %d", keyId)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("key %d of channel %d not found", keyId, channelId)
+	}
+	channelKeyStates.Delete(channelId)
+	return nil
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelSelectKey(t *testing.T) {
+	setupTestDB(t, &Channel{}, &ChannelKey{}, &Ability{})
+
+	channel := &Channel{Name: "openai", Key: "sk-test-key-1\nsk-test-key-2\n\nsk-test-key-3\nsk-test-key-1", Models: "gpt-4o", Group: "default",
+		KeyStrategy: ChannelKeyStrategyRoundRobin}
+	require.NoError(t, channel.Insert())
+	states, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, states, 3)
+	assert.Equal(t, "sk-...ey-1", states[0].KeyHint)
+
+	used := make(map[string]int)
+	keyIds := make(map[string]int)
+	for range 6 {
+		key, keyId, err := channel.SelectKey()
+		require.NoError(t, err)
+		used[key]++
+		keyIds[key] = keyId
+	}
+	assert.Equal(t, map[string]int{"sk-test-key-1": 2, "sk-test-key-2": 2, "sk-test-key-3": 2}, used)
+
+	// the revoked key is disabled, and the rate limited key is cooled down
+	available, err := RecordChannelKeyError(keyIds["sk-test-key-1"], "invalid api key", 0, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, available)
+	available, err = RecordChannelKeyError(keyIds["sk-test-key-2"], "rate limited", time.Minute, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, available)
+	for range 3 {
+		key, _, err := channel.SelectKey()
+		require.NoError(t, err)
+		assert.Equal(t, "sk-test-key-3", key)
+	}
+
+	// the rate limited keys are still tried once no key is available
+	_, err = RecordChannelKeyError(keyIds["sk-test-key-3"], "rate limited", time.Minute, false)
+	require.NoError(t, err)
+	key, _, err := channel.SelectKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, "sk-test-key-1", key)
+
+	require.NoError(t, UpdateChannelKeyStatus(channel.Id, keyIds["sk-test-key-2"], ChannelStatusEnabled))
+	key, _, err = channel.SelectKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-key-2", key)
+
+	// the usage is saved in batches
+	flushChannelKeyUsage()
+	state := new(ChannelKey)
+	require.NoError(t, DB.First(state, "id = ?", keyIds["sk-test-key-1"]).Error)
+	assert.Equal(t, ChannelStatusAutoDisabled, state.Status)
+	assert.EqualValues(t, 1, state.FailedCount)
+	assert.Equal(t, "invalid api key", state.LastError)
+	assert.EqualValues(t, 2, state.UsedCount)
+}
+
+func TestChannelSelectKeyLeastUsed(t *testing.T) {
+	setupTestDB(t, &Channel{}, &ChannelKey{}, &Ability{})
+
+	channel := &Channel{Name: "openai", Key: "sk-test-key-1\nsk-test-key-2", Models: "gpt-4o", Group: "default",
+		KeyStrategy: ChannelKeyStrategyLeastUsed}
+	require.NoError(t, channel.Insert())
+	states, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(states[0]).Update("used_count", 10).Error)
+	// the states are reloaded once the cache is expired
+	channelKeyStates.Delete(channel.Id)
+
+	key, _, err := channel.SelectKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-key-2", key)
+
+	// the states of the removed keys are deleted
+	flushChannelKeyUsage()
+	channel.Key = "sk-test-key-2\nsk-test-key-4"
+	require.NoError(t, channel.Update())
+	states, err = GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	assert.EqualValues(t, 1, states[0].UsedCount)
+	assert.Equal(t, "sk-...ey-4", states[1].KeyHint)
+
+	// the channels with a single key have no key states
+	single := &Channel{Name: "single", Key: "sk-single\nsk-other", Models: "gpt-4o", Group: "default"}
+	require.NoError(t, single.Insert())
+	key, keyId, err := single.SelectKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-single\nsk-other", key)
+	assert.Zero(t, keyId)
+}
+
+func TestChannelGetKeyById(t *testing.T) {
+	setupTestDB(t, &Channel{}, &ChannelKey{}, &Ability{})
+
+	channel := &Channel{Name: "openai", Key: "sk-test-key-1\nsk-test-key-2", Models: "gpt-4o", Group: "default",
+		KeyStrategy: ChannelKeyStrategyRoundRobin}
+	require.NoError(t, channel.Insert())
+	for range 2 {
+		key, keyId, err := channel.SelectKey()
+		require.NoError(t, err)
+		got, err := channel.GetKeyById(keyId)
+		require.NoError(t, err)
+		assert.Equal(t, key, got)
+	}
+
+	key, err := channel.GetKeyById(0)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-key-1", key)
+	_, err = channel.GetKeyById(12345)
+	assert.Error(t, err)
+}
+
+func TestChannelKeyStrategyCleared(t *testing.T) {
+	setupTestDB(t, &Channel{}, &ChannelKey{}, &Ability{})
+
+	channel := &Channel{Name: "openai", Key: "sk-test-key-1\nsk-test-key-2", Models: "gpt-4o", Group: "default",
+		KeyStrategy: ChannelKeyStrategyRoundRobin}
+	require.NoError(t, channel.Insert())
+
+	// the key is kept if it's not changed, and the key states are synced with the saved key
+	update := &Channel{Id: channel.Id, Name: "openai", KeyStrategy: ChannelKeyStrategyRandom}
+	require.NoError(t, update.Update())
+	states, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Len(t, states, 2)
+
+	update = &Channel{Id: channel.Id, Name: "openai"}
+	require.NoError(t, update.Update())
+	saved, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.Empty(t, saved.KeyStrategy)
+	key, keyId, err := saved.SelectKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test-key-1\nsk-test-key-2", key)
+	assert.Zero(t, keyId)
+}
@@ -17,6 +17,7 @@ type UserRequestCost struct {
 	UserID      int     `json:"user_id"`
 	RequestID   string  `json:"request_id"`
 	Quota       int64   `json:"quota"`
+	CacheHit    bool    `json:"cache_hit" gorm:"default:false"` // served by the response cache
 	CostUSD     float64 `json:"cost_usd" gorm:"-"`
 }
 
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+)
+
+// File is a file uploaded by the files api,
+// the content is saved in the storage by StorageKey.
+type File struct {
+	Id         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Object     string `json:"object" gorm:"-"`
+	UserId     int    `json:"-" gorm:"index"`
+	TokenId    int    `json:"-"`
+	Bytes      int64  `json:"bytes" gorm:"bigint"`
+	Filename   string `json:"filename"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	Status     string `json:"status" gorm:"type:varchar(32)"`
+	StorageKey string `json:"-"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+}
+
+// FileMirror records the copy of a file uploaded to an upstream channel,
+// so the file is uploaded to each channel at most once.
+type FileMirror struct {
+	Id             int    `json:"id"`
+	FileId         string `json:"file_id" gorm:"type:varchar(64);uniqueIndex:idx_file_mirror"`
+	ChannelId      int    `json:"channel_id" gorm:"uniqueIndex:idx_file_mirror"`
+	UpstreamFileId string `json:"upstream_file_id"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+}
+
+// NewFile creates a file owned by userId, the storage key is derived from the file id
+func NewFile(userId, tokenId int, filename, purpose string, size int64) *File {
+	id := "file-" + random.GetUUID()
+	return &File{
+		Id:         id,
+		Object:     "file",
+		UserId:     userId,
+		TokenId:    tokenId,
+		Bytes:      size,
+		Filename:   filename,
+		Purpose:    purpose,
+		Status:     FileStatusProcessed,
+		StorageKey: "files/" + id,
+		CreatedAt:  helper.GetTimestamp(),
+	}
+}
+
+func (file *File) AfterFind(tx *gorm.DB) error {
+	file.Object = "file"
+	return nil
+}
+
+func (file *File) Insert() error {
+	return errors.Wrap(DB.Create(file).Error, "insert file")
+}
+
+// Delete removes the file and its mirrors
+func (file *File) Delete() error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", file.Id).Delete(&FileMirror{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(file).Error
+	})
+	return errors.Wrapf(err, "delete file %s", file.Id)
+}
+
+// GetUserFileById returns the file only if it is owned by userId
+func GetUserFileById(userId int, id string) (*File, error) {
+	if id == "" {
+		return nil, errors.New("file id is empty")
+	}
+	file := &File{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(file).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get file %s", id)
+	}
+	return file, nil
+}
+
+// GetUserFiles lists the files of userId ordered by creation time,
+// after is the id of the last file of the previous page.
+func GetUserFiles(userId int, purpose string, after string, limit int, ascending bool) ([]*File, error) {
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+
+	order := "created_at desc, id desc"
+	cmp := "<"
+	if ascending {
+		order = "created_at asc, id asc"
+		cmp = ">"
+	}
+	if after != "" {
+		cursor, err := GetUserFileById(userId, after)
+		if err != nil {
+			return nil, errors.Wrap(err, "get cursor file")
+		}
+		query = query.Where("created_at "+cmp+" ? OR (created_at = ? AND id "+cmp+" ?)",
+			cursor.CreatedAt, cursor.CreatedAt, cursor.Id)
+	}
+
+	var files []*File
+	err := query.Order(order).Limit(limit).Find(&files).Error
+	return files, errors.Wrap(err, "list files")
+}
+
+// GetFileMirror returns the mirror of the file on the channel
+func GetFileMirror(fileId string, channelId int) (*FileMirror, error) {
+	mirror := &FileMirror{}
+	err := DB.Where("file_id = ? AND channel_id = ?", fileId, channelId).First(mirror).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get mirror of file %s on channel %d", fileId, channelId)
+	}
+	return mirror, nil
+}
+
+// GetFileMirrors returns all the mirrors of the file
+func GetFileMirrors(fileId string) ([]*FileMirror, error) {
+	var mirrors []*FileMirror
+	err := DB.Where("file_id = ?", fileId).Find(&mirrors).Error
+	return mirrors, errors.Wrapf(err, "get mirrors of file %s", fileId)
+}
+
+func (mirror *FileMirror) Insert() error {
+	if mirror.CreatedAt == 0 {
+		mirror.CreatedAt = helper.GetTimestamp()
+	}
+	return errors.Wrap(DB.Create(mirror).Error, "insert file mirror")
+}
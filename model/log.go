@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -10,16 +11,20 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/logsink"
 )
 
 type Log struct {
-	Id                int    `json:"id"`
-	UserId            int    `json:"user_id" gorm:"index"`
-	CreatedAt         int64  `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
-	Type              int    `json:"type" gorm:"index:idx_created_at_type"`
-	Content           string `json:"content"`
-	Username          string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
-	TokenName         string `json:"token_name" gorm:"index;default:''"`
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
+	Type      int    `json:"type" gorm:"index:idx_created_at_type"`
+	Content   string `json:"content"`
+	Username  string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
+	TokenName string `json:"token_name" gorm:"index;default:''"`
+	TokenId   int    `json:"token_id" gorm:"index;default:0"`
+	// Group is the group of the user when the request is sent
+	Group             string `json:"group" gorm:"type:varchar(32);default:''"`
 	ModelName         string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota             int    `json:"quota" gorm:"default:0"`
 	PromptTokens      int    `json:"prompt_tokens" gorm:"default:0"`
@@ -29,6 +34,7 @@ type Log struct {
 	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0"` // unit is ms
 	IsStream          bool   `json:"is_stream" gorm:"default:false"`
 	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	CacheHit          bool   `json:"cache_hit" gorm:"default:false"` // served by the response cache
 }
 
 const (
@@ -38,6 +44,8 @@ const (
 	LogTypeManage
 	LogTypeSystem
 	LogTypeTest
+	// LogTypeError is a relay request failed after all the retries
+	LogTypeError
 )
 
 func recordLogHelper(ctx context.Context, log *Log) {
@@ -82,9 +90,28 @@ func RecordConsumeLog(ctx context.Context, log *Log) {
 		return
 	}
 	log.Username = GetUsernameById(log.UserId)
+	if log.Group == "" {
+		log.Group, _ = CacheGetUserGroup(log.UserId)
+	}
 	log.CreatedAt = helper.GetTimestamp()
 	log.Type = LogTypeConsume
 	recordLogHelper(ctx, log)
+	// the log is shipped even if it's failed to save, the sink is the copy for finance
+	logsink.Append(log)
+}
+
+// RecordErrorLog records a relay request which failed after all the retries, it's counted by the analytics
+func RecordErrorLog(ctx context.Context, log *Log) {
+	if !config.LogConsumeEnabled {
+		return
+	}
+	log.Username = GetUsernameById(log.UserId)
+	if log.Group == "" {
+		log.Group, _ = CacheGetUserGroup(log.UserId)
+	}
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeError
+	recordLogHelper(ctx, log)
 }
 
 func RecordTestLog(ctx context.Context, log *Log) {
@@ -94,6 +121,26 @@ func RecordTestLog(ctx context.Context, log *Log) {
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int) (logs []*Log, err error) {
+	tx := filterAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, err
+}
+
+// ExportLogs iterates the logs matching the same filters as GetAllLogs in batches, the earliest first,
+// so the logs could be streamed without loading all of them.
+func ExportLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int,
+	fn func(logs []*Log) error) error {
+	tx := filterAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
+	var logs []*Log
+	return tx.FindInBatches(&logs, exportLogsBatchSize, func(_ *gorm.DB, _ int) error {
+		return fn(logs)
+	}).Error
+}
+
+// exportLogsBatchSize is the number of logs loaded at a time by ExportLogs
+const exportLogsBatchSize = 1000
+
+func filterAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int) *gorm.DB {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -118,8 +165,7 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
-	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
-	return logs, err
+	return tx
 }
 
 func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int) (logs []*Log, err error) {
@@ -155,7 +201,26 @@ func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
 	return logs, err
 }
 
+// SumUsedQuota sums the quota of the consume logs, the full hours aggregated by the hourly rollups are read from them,
+// and the rest from the logs.
 func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int) (quota int64) {
+	watermark, err := getLogRollupWatermark(LOG_DB)
+	if err != nil {
+		logger.SysError("failed to get log rollup watermark: " + err.Error())
+	}
+	rollupStart, rollupEnd, rawStart, ok := splitRollupRange(watermark, startTimestamp, endTimestamp)
+	if !ok {
+		return sumLogsQuota(startTimestamp, endTimestamp, modelName, username, tokenName, channel)
+	}
+	if startTimestamp < rollupStart {
+		quota += sumLogsQuota(startTimestamp, rollupStart-1, modelName, username, tokenName, channel)
+	}
+	quota += sumRollupQuota(rollupStart, rollupEnd, modelName, username, tokenName, channel)
+	quota += sumLogsQuota(rawStart, endTimestamp, modelName, username, tokenName, channel)
+	return quota
+}
+
+func sumLogsQuota(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int) (quota int64) {
 	ifnull := "ifnull"
 	if common.UsingPostgreSQL {
 		ifnull = "COALESCE"
@@ -222,16 +287,25 @@ type LogStatistic struct {
 	CompletionTokens int    `gorm:"column:completion_tokens"`
 }
 
+// SearchLogsByDayAndModel returns the usage of each day and model, the days aggregated by the daily rollups are read from them,
+// and the rest from the logs.
 func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
-	groupSelect := "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
-
-	if common.UsingPostgreSQL {
-		groupSelect = "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
+	watermark, err := getLogRollupWatermark(LOG_DB)
+	if err != nil {
+		logger.SysError("failed to get log rollup watermark: " + err.Error())
+	}
+	if watermark <= int64(start) {
+		return searchLogsByDayAndModel(userId, start, end)
 	}
+	return searchRollupsByDayAndModel(userId, int64(start), int64(end), watermark)
+}
 
-	if common.UsingSQLite {
-		groupSelect = "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
+func searchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
+	daySelect, err := analyticsBucketSelect(AnalyticsGranularityDay, statisticsOffset(time.Unix(int64(start), 0)))
+	if err != nil {
+		return nil, err
 	}
+	groupSelect := daySelect + " as day"
 
 	// If userId is 0, query all users (site-wide statistics)
 	var query string
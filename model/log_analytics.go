@@ -0,0 +1,227 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// The time buckets of the analytics
+const (
+	AnalyticsGranularityHour  = "hour"
+	AnalyticsGranularityDay   = "day"
+	AnalyticsGranularityWeek  = "week"
+	AnalyticsGranularityMonth = "month"
+)
+
+// AnalyticsDimensions are the dimensions the analytics could be grouped by
+var AnalyticsDimensions = []string{"user", "token", "model", "channel", "group", "is_stream"}
+
+// AnalyticsQuery selects the consume and error logs to aggregate
+type AnalyticsQuery struct {
+	// UserId limits the logs to the user, 0 means all users
+	UserId         int
+	Username       string
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	TokenName      string
+	ChannelId      int
+	// Granularity is one of hour, day, week and month, empty aggregates the whole time range
+	Granularity string
+	// GroupBy are the dimensions in AnalyticsDimensions
+	GroupBy []string
+}
+
+// AnalyticsRow is the usage of a time bucket and a combination of the dimensions,
+// the dimensions not grouped by are left empty.
+type AnalyticsRow struct {
+	Bucket           string  `json:"bucket,omitempty" gorm:"column:bucket"`
+	UserId           int     `json:"user_id,omitempty" gorm:"column:user_id"`
+	Username         string  `json:"username,omitempty" gorm:"column:username"`
+	TokenId          int     `json:"token_id,omitempty" gorm:"column:token_id"`
+	TokenName        string  `json:"token_name,omitempty" gorm:"column:token_name"`
+	ModelName        string  `json:"model_name,omitempty" gorm:"column:model_name"`
+	ChannelId        int     `json:"channel_id,omitempty" gorm:"column:channel_id"`
+	Group            string  `json:"group,omitempty" gorm:"column:group_name"`
+	IsStream         *bool   `json:"is_stream,omitempty" gorm:"column:is_stream"`
+	Requests         int64   `json:"requests" gorm:"column:requests"`
+	PromptTokens     int64   `json:"prompt_tokens" gorm:"column:prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" gorm:"column:completion_tokens"`
+	Quota            int64   `json:"quota" gorm:"column:quota"`
+	USD              float64 `json:"usd" gorm:"-"`
+	AvgLatency       float64 `json:"avg_latency" gorm:"column:avg_latency"` // unit is ms
+	Errors           int64   `json:"errors" gorm:"column:errors"`
+}
+
+// statisticsLocation returns the timezone the logs are bucketed into the days, weeks and months
+func statisticsLocation() *time.Location {
+	if config.StatisticsTimezone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(config.StatisticsTimezone)
+	if err != nil {
+		logger.SysErrorf("invalid statistics timezone %q: %+v", config.StatisticsTimezone, err)
+		return time.Local
+	}
+	return location
+}
+
+// statisticsOffset returns the offset in seconds of the statistics timezone at t,
+// the buckets are computed by the database with the fixed offset, so the result doesn't depend on
+// the timezone of the database session, and the daylight saving changes in the time range are not applied.
+func statisticsOffset(t time.Time) int {
+	_, offset := t.In(statisticsLocation()).Zone()
+	return offset
+}
+
+// analyticsBucketSelect returns the expression formatting created_at shifted by offset seconds to the time bucket,
+// the shifted time is formatted as UTC, the week is labeled by its monday.
+func analyticsBucketSelect(granularity string, offset int) (string, error) {
+	switch {
+	case common.UsingPostgreSQL:
+		local := fmt.Sprintf("(to_timestamp(created_at + %d) AT TIME ZONE 'UTC')", offset)
+		switch granularity {
+		case AnalyticsGranularityHour:
+			return "TO_CHAR(date_trunc('hour', " + local + "), 'YYYY-MM-DD HH24:00')", nil
+		case AnalyticsGranularityDay:
+			return "TO_CHAR(date_trunc('day', " + local + "), 'YYYY-MM-DD')", nil
+		case AnalyticsGranularityWeek:
+			return "TO_CHAR(date_trunc('week', " + local + "), 'YYYY-MM-DD')", nil
+		case AnalyticsGranularityMonth:
+			return "TO_CHAR(date_trunc('month', " + local + "), 'YYYY-MM')", nil
+		}
+	case common.UsingSQLite:
+		switch granularity {
+		case AnalyticsGranularityHour:
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00', datetime(created_at + %d, 'unixepoch'))", offset), nil
+		case AnalyticsGranularityDay:
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d', datetime(created_at + %d, 'unixepoch'))", offset), nil
+		case AnalyticsGranularityWeek:
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d', datetime(created_at + %d, 'unixepoch', 'weekday 0', '-6 days'))", offset), nil
+		case AnalyticsGranularityMonth:
+			return fmt.Sprintf("strftime('%%Y-%%m', datetime(created_at + %d, 'unixepoch'))", offset), nil
+		}
+	default:
+		// FROM_UNIXTIME converts to the timezone of the session, so the time is added to the epoch instead
+		local := fmt.Sprintf("(CAST('1970-01-01 00:00:00' AS DATETIME) + INTERVAL (created_at + %d) SECOND)", offset)
+		switch granularity {
+		case AnalyticsGranularityHour:
+			return "DATE_FORMAT(" + local + ", '%Y-%m-%d %H:00')", nil
+		case AnalyticsGranularityDay:
+			return "DATE_FORMAT(" + local + ", '%Y-%m-%d')", nil
+		case AnalyticsGranularityWeek:
+			return "DATE_FORMAT(DATE_SUB(" + local + ", INTERVAL WEEKDAY(" + local + ") DAY), '%Y-%m-%d')", nil
+		case AnalyticsGranularityMonth:
+			return "DATE_FORMAT(" + local + ", '%Y-%m')", nil
+		}
+	}
+	return "", errors.Errorf("invalid granularity %q, should be one of hour, day, week and month", granularity)
+}
+
+// analyticsDimensionColumns returns the columns of the dimension
+func analyticsDimensionColumns(dimension string) []string {
+	switch dimension {
+	case "user":
+		return []string{"user_id", "username"}
+	case "token":
+		return []string{"token_id", "token_name"}
+	case "model":
+		return []string{"model_name"}
+	case "channel":
+		return []string{"channel_id"}
+	case "group":
+		if common.UsingPostgreSQL {
+			return []string{`"group"`}
+		}
+		return []string{"`group`"}
+	case "is_stream":
+		return []string{"is_stream"}
+	default:
+		return nil
+	}
+}
+
+// GetLogAnalytics aggregates the consume and error logs by the time bucket and the dimensions
+func GetLogAnalytics(query AnalyticsQuery) ([]*AnalyticsRow, error) {
+	var selects, groups []string
+	if query.Granularity != "" {
+		bucket, err := analyticsBucketSelect(query.Granularity, statisticsOffset(time.Unix(query.StartTimestamp, 0)))
+		if err != nil {
+			return nil, err
+		}
+		selects = append(selects, bucket+" AS bucket")
+		groups = append(groups, "bucket")
+	}
+	var dimensions []string
+	for _, dimension := range query.GroupBy {
+		dimension = strings.TrimSpace(dimension)
+		if dimension == "" || slices.Contains(dimensions, dimension) {
+			continue
+		}
+		columns := analyticsDimensionColumns(dimension)
+		if columns == nil {
+			return nil, errors.Errorf("invalid group by %q, should be in %s", dimension, strings.Join(AnalyticsDimensions, ", "))
+		}
+		dimensions = append(dimensions, dimension)
+		for _, column := range columns {
+			if dimension == "group" {
+				selects = append(selects, column+" AS group_name")
+			} else {
+				selects = append(selects, column)
+			}
+			groups = append(groups, column)
+		}
+	}
+	selects = append(selects,
+		"COUNT(1) AS requests",
+		"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens",
+		"COALESCE(SUM(completion_tokens), 0) AS completion_tokens",
+		"COALESCE(SUM(quota), 0) AS quota",
+		"COALESCE(AVG(elapsed_time), 0) AS avg_latency",
+		"COALESCE(SUM(CASE WHEN type = ? THEN 1 ELSE 0 END), 0) AS errors",
+	)
+
+	tx := LOG_DB.Table("logs").Select(strings.Join(selects, ", "), LogTypeError).
+		Where("type IN ?", []int{LogTypeConsume, LogTypeError})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Username != "" {
+		tx = tx.Where("username = ?", query.Username)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if query.TokenName != "" {
+		tx = tx.Where("token_name = ?", query.TokenName)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if len(groups) > 0 {
+		tx = tx.Group(strings.Join(groups, ", ")).Order(strings.Join(groups, ", "))
+	}
+
+	var rows []*AnalyticsRow
+	if err := tx.Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "get log analytics")
+	}
+	for _, row := range rows {
+		row.USD = float64(row.Quota) / config.QuotaPerUnit
+	}
+	return rows, nil
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupLogAnalyticsTestDB(t *testing.T) {
+	setupTestDB(t, &Log{})
+	timezone := config.StatisticsTimezone
+	config.StatisticsTimezone = "UTC"
+	t.Cleanup(func() { config.StatisticsTimezone = timezone })
+}
+
+func TestGetLogAnalytics(t *testing.T) {
+	setupLogAnalyticsTestDB(t)
+
+	// 2024-01-01 is a monday
+	monday := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).Unix()
+	sunday := time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC).Unix()
+	nextMonday := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC).Unix()
+	logs := []*Log{
+		{UserId: 1, Username: "alice", CreatedAt: monday, Type: LogTypeConsume, ModelName: "gpt-4o",
+			Group: "default", Quota: 1000, PromptTokens: 10, CompletionTokens: 20, ElapsedTime: 100},
+		{UserId: 1, Username: "alice", CreatedAt: sunday, Type: LogTypeConsume, ModelName: "gpt-4o",
+			Group: "default", Quota: 3000, PromptTokens: 30, CompletionTokens: 40, ElapsedTime: 300, IsStream: true},
+		{UserId: 1, Username: "alice", CreatedAt: sunday, Type: LogTypeError, ModelName: "gpt-4o",
+			Group: "default", ElapsedTime: 200},
+		{UserId: 2, Username: "bob", CreatedAt: nextMonday, Type: LogTypeConsume, ModelName: "claude-3",
+			Group: "vip", Quota: 500, PromptTokens: 5, CompletionTokens: 5, ElapsedTime: 50},
+		// the logs other than consume and error are ignored
+		{UserId: 2, Username: "bob", CreatedAt: nextMonday, Type: LogTypeTopup, Quota: 100000},
+	}
+	require.NoError(t, LOG_DB.Create(logs).Error)
+
+	rows, err := GetLogAnalytics(AnalyticsQuery{Granularity: AnalyticsGranularityWeek, GroupBy: []string{"model", "group"}})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "2024-01-01", rows[0].Bucket)
+	assert.Equal(t, "gpt-4o", rows[0].ModelName)
+	assert.Equal(t, "default", rows[0].Group)
+	assert.EqualValues(t, 3, rows[0].Requests)
+	assert.EqualValues(t, 4000, rows[0].Quota)
+	assert.EqualValues(t, 40, rows[0].PromptTokens)
+	assert.EqualValues(t, 60, rows[0].CompletionTokens)
+	assert.EqualValues(t, 1, rows[0].Errors)
+	assert.InDelta(t, 200, rows[0].AvgLatency, 0.001)
+	assert.InDelta(t, 4000/config.QuotaPerUnit, rows[0].USD, 1e-9)
+	assert.Equal(t, "2024-01-08", rows[1].Bucket)
+	assert.Equal(t, "vip", rows[1].Group)
+
+	// the user-scoped analytics only covers the user
+	rows, err = GetLogAnalytics(AnalyticsQuery{UserId: 1, Granularity: AnalyticsGranularityDay, GroupBy: []string{"is_stream"}})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "2024-01-01", rows[0].Bucket)
+	require.NotNil(t, rows[0].IsStream)
+	assert.False(t, *rows[0].IsStream)
+	assert.Equal(t, "2024-01-07", rows[2].Bucket)
+	assert.True(t, *rows[2].IsStream)
+
+	// without the granularity and the dimensions, the whole range is aggregated
+	rows, err = GetLogAnalytics(AnalyticsQuery{StartTimestamp: sunday})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.EqualValues(t, 3, rows[0].Requests)
+	assert.EqualValues(t, 3500, rows[0].Quota)
+
+	_, err = GetLogAnalytics(AnalyticsQuery{Granularity: "year"})
+	require.Error(t, err)
+	_, err = GetLogAnalytics(AnalyticsQuery{GroupBy: []string{"content"}})
+	require.Error(t, err)
+}
+
+func TestGetLogAnalyticsTimezone(t *testing.T) {
+	setupLogAnalyticsTestDB(t)
+	config.StatisticsTimezone = "Asia/Shanghai"
+
+	// 2024-01-07 20:00 UTC is 2024-01-08 04:00 in Shanghai, which is the next week
+	createdAt := time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC).Unix()
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 1, CreatedAt: createdAt, Type: LogTypeConsume, Quota: 100}).Error)
+
+	for granularity, bucket := range map[string]string{
+		AnalyticsGranularityHour:  "2024-01-08 04:00",
+		AnalyticsGranularityDay:   "2024-01-08",
+		AnalyticsGranularityWeek:  "2024-01-08",
+		AnalyticsGranularityMonth: "2024-01",
+	} {
+		rows, err := GetLogAnalytics(AnalyticsQuery{Granularity: granularity})
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, bucket, rows[0].Bucket, granularity)
+	}
+
+	statistics, err := searchLogsByDayAndModel(1, int(createdAt-86400), int(createdAt+86400))
+	require.NoError(t, err)
+	require.Len(t, statistics, 1)
+	assert.Equal(t, "2024-01-08", statistics[0].Day)
+}
@@ -0,0 +1,381 @@
+package model
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	// rollupLagSeconds leaves the latest logs to the next run, since a log may be saved a while after its created_at
+	rollupLagSeconds = 60
+	// rollupWindowSeconds is the longest time range of the logs aggregated in a transaction
+	rollupWindowSeconds = 3600
+)
+
+// LogRollup is the usage aggregated from the consume and error logs in a time bucket,
+// keyed by the user, the token, the model and the channel.
+type LogRollup struct {
+	// BucketStart is the unix time when the bucket starts, the hours are aligned to UTC and the days to STATISTICS_TIMEZONE
+	BucketStart      int64  `json:"bucket_start" gorm:"bigint;uniqueIndex:,composite:rollup_key,priority:1"`
+	UserId           int    `json:"user_id" gorm:"uniqueIndex:,composite:rollup_key,priority:2"`
+	TokenId          int    `json:"token_id" gorm:"uniqueIndex:,composite:rollup_key,priority:3"`
+	TokenName        string `json:"token_name" gorm:"type:varchar(255);uniqueIndex:,composite:rollup_key,priority:4;default:''"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(255);uniqueIndex:,composite:rollup_key,priority:5;default:''"`
+	ChannelId        int    `json:"channel_id" gorm:"uniqueIndex:,composite:rollup_key,priority:6"`
+	Username         string `json:"username" gorm:"type:varchar(64);default:''"`
+	Requests         int64  `json:"requests" gorm:"bigint;default:0"`
+	Errors           int64  `json:"errors" gorm:"bigint;default:0"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	// ElapsedTime is the sum of the elapsed time in ms, divide it by Requests + Errors for the average
+	ElapsedTime int64 `json:"elapsed_time" gorm:"bigint;default:0"`
+}
+
+// HourlyLogRollup is the usage of each hour
+type HourlyLogRollup struct {
+	Id        int `json:"id"`
+	LogRollup `gorm:"embedded"`
+}
+
+func (HourlyLogRollup) TableName() string {
+	return "log_rollups_hourly"
+}
+
+// DailyLogRollup is the usage of each day
+type DailyLogRollup struct {
+	Id        int `json:"id"`
+	LogRollup `gorm:"embedded"`
+}
+
+func (DailyLogRollup) TableName() string {
+	return "log_rollups_daily"
+}
+
+// LogRollupState records the progress of the rollups, the logs created before Watermark are aggregated
+type LogRollupState struct {
+	Id          int   `json:"id"`
+	Watermark   int64 `json:"watermark" gorm:"bigint"`
+	UpdatedTime int64 `json:"updated_time" gorm:"bigint"`
+}
+
+// logRollupStateId is the id of the only row of LogRollupState
+const logRollupStateId = 1
+
+// rollupKey is the key of a rollup row without the metrics
+type rollupKey struct {
+	BucketStart int64
+	UserId      int
+	TokenId     int
+	TokenName   string
+	ModelName   string
+	ChannelId   int
+}
+
+func hourBucketStart(createdAt int64) int64 {
+	return createdAt - createdAt%3600
+}
+
+// dayBucketStart returns the start of the day in location
+func dayBucketStart(createdAt int64, location *time.Location) int64 {
+	t := time.Unix(createdAt, 0).In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Unix()
+}
+
+// getLogRollupWatermark returns the time before which the logs are aggregated, 0 if the rollups have never run
+func getLogRollupWatermark(db *gorm.DB) (int64, error) {
+	var states []LogRollupState
+	if err := db.Where("id = ?", logRollupStateId).Limit(1).Find(&states).Error; err != nil {
+		return 0, errors.Wrap(err, "get log rollup state")
+	}
+	if len(states) == 0 {
+		return 0, nil
+	}
+	return states[0].Watermark, nil
+}
+
+// RollupLogs aggregates the logs created since the watermark into the hourly and daily rollups,
+// window by window until the logs of the last rollupLagSeconds. Each window is committed with the watermark
+// in a transaction, so a log is aggregated exactly once even if the job is interrupted.
+func RollupLogs(ctx context.Context, now time.Time) error {
+	cutoff := now.Unix() - rollupLagSeconds
+	watermark, err := getLogRollupWatermark(LOG_DB)
+	if err != nil {
+		return err
+	}
+	if watermark == 0 {
+		// starts from the earliest log
+		var earliest []int64
+		err = LOG_DB.Model(&Log{}).Where("type IN ?", []int{LogTypeConsume, LogTypeError}).
+			Order("created_at").Limit(1).Pluck("created_at", &earliest).Error
+		if err != nil {
+			return errors.Wrap(err, "get earliest log")
+		}
+		start := cutoff
+		if len(earliest) > 0 && earliest[0] < cutoff {
+			start = earliest[0]
+		}
+		err = LOG_DB.Create(&LogRollupState{Id: logRollupStateId, Watermark: start, UpdatedTime: helper.GetTimestamp()}).Error
+		if err != nil {
+			return errors.Wrap(err, "create log rollup state")
+		}
+		watermark = start
+	}
+
+	for watermark < cutoff {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		end := min(watermark+rollupWindowSeconds, cutoff)
+		if err = rollupLogWindow(watermark, end); err != nil {
+			return errors.Wrapf(err, "rollup logs in [%d, %d)", watermark, end)
+		}
+		watermark = end
+	}
+	return nil
+}
+
+// rollupLogWindow aggregates the logs in [start, end) and moves the watermark from start to end
+func rollupLogWindow(start int64, end int64) error {
+	hourly := make(map[rollupKey]*LogRollup)
+	daily := make(map[rollupKey]*LogRollup)
+	location := statisticsLocation()
+	var logs []*Log
+	err := LOG_DB.Select("id", "created_at", "type", "user_id", "username", "token_id", "token_name", "model_name",
+		"channel_id", "quota", "prompt_tokens", "completion_tokens", "elapsed_time").
+		Where("type IN ? AND created_at >= ? AND created_at < ?", []int{LogTypeConsume, LogTypeError}, start, end).
+		FindInBatches(&logs, exportLogsBatchSize, func(_ *gorm.DB, _ int) error {
+			for _, log := range logs {
+				addLogToRollup(hourly, hourBucketStart(log.CreatedAt), log)
+				addLogToRollup(daily, dayBucketStart(log.CreatedAt, location), log)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "get logs")
+	}
+
+	return LOG_DB.Transaction(func(tx *gorm.DB) error {
+		// the watermark is checked, so the window is skipped if it's aggregated by another run
+		result := tx.Model(&LogRollupState{}).Where("id = ? AND watermark = ?", logRollupStateId, start).
+			Updates(map[string]any{"watermark": end, "updated_time": helper.GetTimestamp()})
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "update log rollup state")
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("the log rollup watermark is moved from %d by another run", start)
+		}
+		for _, rollup := range hourly {
+			if err := upsertLogRollup(tx, &HourlyLogRollup{LogRollup: *rollup}); err != nil {
+				return err
+			}
+		}
+		for _, rollup := range daily {
+			if err := upsertLogRollup(tx, &DailyLogRollup{LogRollup: *rollup}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func addLogToRollup(rollups map[rollupKey]*LogRollup, bucketStart int64, log *Log) {
+	key := rollupKey{
+		BucketStart: bucketStart,
+		UserId:      log.UserId,
+		TokenId:     log.TokenId,
+		TokenName:   log.TokenName,
+		ModelName:   log.ModelName,
+		ChannelId:   log.ChannelId,
+	}
+	rollup, ok := rollups[key]
+	if !ok {
+		rollup = &LogRollup{
+			BucketStart: key.BucketStart,
+			UserId:      key.UserId,
+			TokenId:     key.TokenId,
+			TokenName:   key.TokenName,
+			ModelName:   key.ModelName,
+			ChannelId:   key.ChannelId,
+		}
+		rollups[key] = rollup
+	}
+	rollup.Username = log.Username
+	if log.Type == LogTypeError {
+		rollup.Errors++
+	} else {
+		rollup.Requests++
+	}
+	rollup.Quota += int64(log.Quota)
+	rollup.PromptTokens += int64(log.PromptTokens)
+	rollup.CompletionTokens += int64(log.CompletionTokens)
+	rollup.ElapsedTime += log.ElapsedTime
+}
+
+// upsertLogRollup adds the metrics to the row of the same key, or creates the row
+func upsertLogRollup(tx *gorm.DB, row any) error {
+	var rollup *LogRollup
+	switch r := row.(type) {
+	case *HourlyLogRollup:
+		rollup = &r.LogRollup
+	case *DailyLogRollup:
+		rollup = &r.LogRollup
+	default:
+		return errors.Errorf("unknown rollup type %T", row)
+	}
+	result := tx.Model(row).
+		Where("bucket_start = ? AND user_id = ? AND token_id = ? AND token_name = ? AND model_name = ? AND channel_id = ?",
+			rollup.BucketStart, rollup.UserId, rollup.TokenId, rollup.TokenName, rollup.ModelName, rollup.ChannelId).
+		Updates(map[string]any{
+			"username":          rollup.Username,
+			"requests":          gorm.Expr("requests + ?", rollup.Requests),
+			"errors":            gorm.Expr("errors + ?", rollup.Errors),
+			"quota":             gorm.Expr("quota + ?", rollup.Quota),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", rollup.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", rollup.CompletionTokens),
+			"elapsed_time":      gorm.Expr("elapsed_time + ?", rollup.ElapsedTime),
+		})
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "update log rollup")
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return errors.Wrap(tx.Create(row).Error, "create log rollup")
+}
+
+// RebuildLogRollups drops the rollups and aggregates all the logs again,
+// the usage of the logs deleted by the retention is lost, so it should only be used for the existing data.
+func RebuildLogRollups(ctx context.Context) error {
+	err := LOG_DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []any{&HourlyLogRollup{}, &DailyLogRollup{}, &LogRollupState{}} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error; err != nil {
+				return errors.Wrap(err, "delete log rollups")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.SysLog("log rollups are deleted, aggregating all the logs")
+	return RollupLogs(ctx, time.Now())
+}
+
+// splitRollupRange splits [start, end] of the logs, the hours in [rollupStart, rollupEnd) are read from the hourly rollups,
+// which only cover the logs before the watermark, and the rest are read from the logs in [start, rollupStart) and [rawStart, end].
+// end 0 means no limit, and ok is false if the rollups cover no full hour of the range.
+func splitRollupRange(watermark int64, start int64, end int64) (rollupStart int64, rollupEnd int64, rawStart int64, ok bool) {
+	if watermark == 0 {
+		return 0, 0, 0, false
+	}
+	rollupStart = hourBucketStart(start + 3599)
+	rollupEnd = hourBucketStart(watermark) + 3600
+	if end != 0 {
+		rollupEnd = min(rollupEnd, hourBucketStart(end+1))
+	}
+	if rollupEnd <= rollupStart {
+		return 0, 0, 0, false
+	}
+	rawStart = min(max(watermark, rollupStart), rollupEnd)
+	return rollupStart, rollupEnd, rawStart, true
+}
+
+func sumRollupQuota(rollupStart int64, rollupEnd int64, modelName string, username string, tokenName string, channel int) (quota int64) {
+	tx := LOG_DB.Model(&HourlyLogRollup{}).Select("COALESCE(SUM(quota), 0)").
+		Where("bucket_start >= ? AND bucket_start < ?", rollupStart, rollupEnd)
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if tokenName != "" {
+		tx = tx.Where("token_name = ?", tokenName)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	if err := tx.Scan(&quota).Error; err != nil {
+		logger.SysError("failed to sum quota of log rollups: " + err.Error())
+	}
+	return quota
+}
+
+// searchRollupsByDayAndModel reads the days before the watermark from the daily rollups, and the rest from the logs
+func searchRollupsByDayAndModel(userId int, start int64, end int64, watermark int64) ([]*LogStatistic, error) {
+	location := statisticsLocation()
+	var rows []struct {
+		BucketStart      int64
+		ModelName        string
+		Requests         int64
+		Quota            int64
+		PromptTokens     int64
+		CompletionTokens int64
+	}
+	tx := LOG_DB.Model(&DailyLogRollup{}).
+		Select("bucket_start, model_name, SUM(requests) AS requests, SUM(quota) AS quota, "+
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens").
+		Where("bucket_start >= ? AND bucket_start <= ? AND requests > 0", dayBucketStart(start, location), min(end, watermark))
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err := tx.Group("bucket_start, model_name").Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "get daily log rollups")
+	}
+
+	statistics := make(map[[2]string]*LogStatistic)
+	add := func(bucketStart int64, modelName string, requests, quota, promptTokens, completionTokens int64) {
+		key := [2]string{time.Unix(bucketStart, 0).In(location).Format("2006-01-02"), modelName}
+		statistic, ok := statistics[key]
+		if !ok {
+			statistic = &LogStatistic{Day: key[0], ModelName: modelName}
+			statistics[key] = statistic
+		}
+		statistic.RequestCount += int(requests)
+		statistic.Quota += int(quota)
+		statistic.PromptTokens += int(promptTokens)
+		statistic.CompletionTokens += int(completionTokens)
+	}
+	for _, row := range rows {
+		add(row.BucketStart, row.ModelName, row.Requests, row.Quota, row.PromptTokens, row.CompletionTokens)
+	}
+
+	if watermark <= end {
+		var logs []*Log
+		tx = LOG_DB.Select("id", "created_at", "model_name", "quota", "prompt_tokens", "completion_tokens").
+			Where("type = ? AND created_at >= ? AND created_at <= ?", LogTypeConsume, watermark, end)
+		if userId != 0 {
+			tx = tx.Where("user_id = ?", userId)
+		}
+		err := tx.FindInBatches(&logs, exportLogsBatchSize, func(_ *gorm.DB, _ int) error {
+			for _, log := range logs {
+				add(log.CreatedAt, log.ModelName, 1, int64(log.Quota), int64(log.PromptTokens), int64(log.CompletionTokens))
+			}
+			return nil
+		}).Error
+		if err != nil {
+			return nil, errors.Wrap(err, "get logs after the rollups")
+		}
+	}
+
+	result := make([]*LogStatistic, 0, len(statistics))
+	for _, statistic := range statistics {
+		result = append(result, statistic)
+	}
+	slices.SortFunc(result, func(a, b *LogStatistic) int {
+		if a.Day != b.Day {
+			return strings.Compare(a.Day, b.Day)
+		}
+		return strings.Compare(a.ModelName, b.ModelName)
+	})
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupLogRollupTestDB(t *testing.T) {
+	setupTestDB(t, &Log{}, &HourlyLogRollup{}, &DailyLogRollup{}, &LogRollupState{})
+	timezone := config.StatisticsTimezone
+	config.StatisticsTimezone = "UTC"
+	t.Cleanup(func() { config.StatisticsTimezone = timezone })
+}
+
+func TestSplitRollupRange(t *testing.T) {
+	// no rollups
+	_, _, _, ok := splitRollupRange(0, 0, 0)
+	assert.False(t, ok)
+
+	rollupStart, rollupEnd, rawStart, ok := splitRollupRange(7200+100, 0, 0)
+	require.True(t, ok)
+	assert.EqualValues(t, 0, rollupStart)
+	assert.EqualValues(t, 10800, rollupEnd)
+	assert.EqualValues(t, 7300, rawStart)
+
+	// the partial hours at both ends are read from the logs
+	rollupStart, rollupEnd, rawStart, ok = splitRollupRange(100000, 1800, 9000)
+	require.True(t, ok)
+	assert.EqualValues(t, 3600, rollupStart)
+	assert.EqualValues(t, 7200, rollupEnd)
+	assert.EqualValues(t, 7200, rawStart)
+
+	// less than a full hour
+	_, _, _, ok = splitRollupRange(100000, 1800, 5400)
+	assert.False(t, ok)
+}
+
+func TestRollupLogs(t *testing.T) {
+	setupLogRollupTestDB(t)
+	ctx := context.Background()
+
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC).Unix()
+	logs := []*Log{
+		{UserId: 1, Username: "alice", CreatedAt: base + 900, Type: LogTypeConsume, ModelName: "gpt-4o", TokenId: 1, Quota: 100, PromptTokens: 1},
+		{UserId: 1, Username: "alice", CreatedAt: base + 2700, Type: LogTypeConsume, ModelName: "gpt-4o", TokenId: 1, Quota: 200, PromptTokens: 2},
+		{UserId: 1, Username: "alice", CreatedAt: base + 3000, Type: LogTypeError, ModelName: "gpt-4o", TokenId: 1},
+		{UserId: 2, Username: "bob", CreatedAt: base + 5400, Type: LogTypeConsume, ModelName: "claude-3", Quota: 400, CompletionTokens: 4},
+		// the other logs are not aggregated
+		{UserId: 2, Username: "bob", CreatedAt: base + 5400, Type: LogTypeTopup, Quota: 100000},
+	}
+	require.NoError(t, LOG_DB.Create(logs).Error)
+
+	now := time.Unix(base+7200, 0)
+	require.NoError(t, RollupLogs(ctx, now))
+	// the logs are only aggregated once
+	require.NoError(t, RollupLogs(ctx, now))
+
+	var hourly []*HourlyLogRollup
+	require.NoError(t, LOG_DB.Order("bucket_start, user_id").Find(&hourly).Error)
+	require.Len(t, hourly, 2)
+	assert.EqualValues(t, base, hourly[0].BucketStart)
+	assert.EqualValues(t, 2, hourly[0].Requests)
+	assert.EqualValues(t, 1, hourly[0].Errors)
+	assert.EqualValues(t, 300, hourly[0].Quota)
+	assert.EqualValues(t, 3, hourly[0].PromptTokens)
+	assert.EqualValues(t, base+3600, hourly[1].BucketStart)
+	assert.Equal(t, "bob", hourly[1].Username)
+
+	// the logs after the watermark are added to the same rows
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 1, Username: "alice", CreatedAt: base + 7150, Type: LogTypeConsume,
+		ModelName: "gpt-4o", TokenId: 1, Quota: 800}).Error)
+	require.NoError(t, RollupLogs(ctx, time.Unix(base+7200+rollupLagSeconds, 0)))
+	var daily []*DailyLogRollup
+	require.NoError(t, LOG_DB.Where("user_id = ?", 1).Find(&daily).Error)
+	require.Len(t, daily, 1)
+	assert.EqualValues(t, dayBucketStart(base, statisticsLocation()), daily[0].BucketStart)
+	assert.EqualValues(t, 3, daily[0].Requests)
+	assert.EqualValues(t, 1100, daily[0].Quota)
+
+	// the aggregates are kept after the logs are deleted by the retention
+	assert.EqualValues(t, 1500, SumUsedQuota(LogTypeConsume, 0, 0, "", "", "", 0))
+	assert.EqualValues(t, 1100, SumUsedQuota(LogTypeConsume, 0, 0, "", "alice", "", 0))
+	_, err := DeleteOldLog(base + 7200)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1500, SumUsedQuota(LogTypeConsume, 0, 0, "", "", "", 0))
+	assert.EqualValues(t, 400, SumUsedQuota(LogTypeConsume, base+3600, base+7199, "claude-3", "", "", 0))
+
+	// the logs after the watermark are read from the logs
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 1, Username: "alice", CreatedAt: base + 7300, Type: LogTypeConsume,
+		ModelName: "gpt-4o", Quota: 1000}).Error)
+	assert.EqualValues(t, 2500, SumUsedQuota(LogTypeConsume, 0, 0, "", "", "", 0))
+	statistics, err := SearchLogsByDayAndModel(1, int(dayBucketStart(base, statisticsLocation())), int(base+86399))
+	require.NoError(t, err)
+	require.Len(t, statistics, 1)
+	assert.Equal(t, "gpt-4o", statistics[0].ModelName)
+	assert.Equal(t, 4, statistics[0].RequestCount)
+	assert.Equal(t, 2100, statistics[0].Quota)
+}
+
+func TestDayBucketStart(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	// 2024-01-07 20:00 UTC is 2024-01-08 04:00 in Shanghai
+	createdAt := time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC).Unix()
+	assert.EqualValues(t, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC).Unix(), dayBucketStart(createdAt, time.UTC))
+	assert.EqualValues(t, time.Date(2024, 1, 8, 0, 0, 0, 0, shanghai).Unix(), dayBucketStart(createdAt, shanghai))
+}
@@ -43,6 +43,7 @@ func CreateRootAccountIfNeed() error {
 			Username:    "root",
 			Password:    hashedPassword,
 			Role:        RoleRootUser,
+			RoleName:    RolePresetRoot,
 			Status:      UserStatusEnabled,
 			DisplayName: "Root User",
 			AccessToken: accessToken,
@@ -159,7 +160,7 @@ func InitDB() {
 
 func migrateDB() error {
 	var err error
-	if err = DB.AutoMigrate(&Channel{}); err != nil {
+	if err = DB.AutoMigrate(&Channel{}, &ChannelKey{}); err != nil {
 		return err
 	}
 	if err = DB.AutoMigrate(&Token{}); err != nil {
@@ -177,13 +178,40 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return err
 	}
-	if err = DB.AutoMigrate(&Log{}); err != nil {
+	if err = DB.AutoMigrate(&Log{}, &HourlyLogRollup{}, &DailyLogRollup{}, &LogRollupState{}); err != nil {
 		return err
 	}
 	if err = DB.AutoMigrate(&UserRequestCost{}); err != nil {
 		return err
 	}
-	return nil
+	if err = DB.AutoMigrate(&File{}, &FileMirror{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Batch{}, &BatchItem{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Task{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ResponseRecord{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Organization{}, &OrganizationMember{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Role{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Webhook{}, &WebhookDelivery{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&NotificationPreference{}, &Notification{}); err != nil {
+		return err
+	}
+	return migrateUserRoles()
 }
 
 func InitLogDB() {
@@ -217,7 +245,7 @@ func InitLogDB() {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &HourlyLogRollup{}, &DailyLogRollup{}, &LogRollupState{}); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,359 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// The events notified to the users
+const (
+	NotificationEventQuotaLow      = "quota.low"
+	NotificationEventTokenExpiring = "token.expiring"
+	NotificationEventBudgetLow     = "budget.low"
+	NotificationEventTest          = "notification.test"
+)
+
+// The channels the notifications are sent by
+const (
+	NotificationChannelEmail           = "email"
+	NotificationChannelWebhook         = "webhook"
+	NotificationChannelIncomingWebhook = "incoming_webhook"
+)
+
+// maxTokenExpiryHours is the longest time to warn before a token expires
+const maxTokenExpiryHours = 30 * 24
+
+// NotificationPreference is how a user is notified, the users without preferences use DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserId       int  `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	EmailEnabled bool `json:"email_enabled"`
+	// WebhookURL receives the notifications as JSON by POST, it's encrypted at rest
+	WebhookURL string `json:"webhook_url" gorm:"type:text"`
+	// IncomingWebhookType is one of slack, lark and dingtalk, IncomingWebhookURL is encrypted at rest
+	IncomingWebhookType string `json:"incoming_webhook_type" gorm:"type:varchar(16)"`
+	IncomingWebhookURL  string `json:"incoming_webhook_url" gorm:"type:text"`
+	// QuotaThreshold warns once the quota of the user falls below it,
+	// 0 means QuotaRemindThreshold and negative disables the warning
+	QuotaThreshold int64 `json:"quota_threshold" gorm:"bigint"`
+	// TokenExpiryHours warns the tokens expiring in these hours, 0 disables the warning
+	TokenExpiryHours int `json:"token_expiry_hours"`
+	// BudgetThresholdPercent warns once the used budget of the current period reaches the percent, 0 disables the warning
+	BudgetThresholdPercent int   `json:"budget_threshold_percent"`
+	UpdatedTime            int64 `json:"updated_time" gorm:"bigint"`
+}
+
+// Notification is a notification sent to a user
+type Notification struct {
+	Id      int    `json:"id"`
+	UserId  int    `json:"user_id" gorm:"index"`
+	Event   string `json:"event" gorm:"type:varchar(32)"`
+	Title   string `json:"title" gorm:"type:varchar(255)"`
+	Content string `json:"content" gorm:"type:text"`
+	// Channels are the channels the notification is sent by successfully, separated by comma
+	Channels string `json:"channels" gorm:"type:varchar(64)"`
+	Error    string `json:"error" gorm:"type:text"`
+	// DedupKey makes sure the same warning is only sent once
+	DedupKey    string `json:"-" gorm:"type:varchar(128);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+// DefaultNotificationPreference returns the preference of the users who haven't set one
+func DefaultNotificationPreference(userId int) *NotificationPreference {
+	return &NotificationPreference{
+		UserId:                 userId,
+		EmailEnabled:           true,
+		TokenExpiryHours:       24,
+		BudgetThresholdPercent: 80,
+	}
+}
+
+// ValidateNotificationPreference checks the urls and the thresholds of the preference
+func (pref *NotificationPreference) ValidateNotificationPreference() error {
+	if pref.WebhookURL != "" && !isValidNotificationURL(pref.WebhookURL) {
+		return errors.Errorf("invalid webhook url %q", pref.WebhookURL)
+	}
+	if pref.IncomingWebhookURL != "" {
+		if !message.IsValidIncomingWebhookType(pref.IncomingWebhookType) {
+			return errors.Errorf("invalid incoming webhook type %q, should be one of slack, lark and dingtalk",
+				pref.IncomingWebhookType)
+		}
+		if !isValidNotificationURL(pref.IncomingWebhookURL) {
+			return errors.New("invalid incoming webhook url")
+		}
+	}
+	if pref.TokenExpiryHours < 0 || pref.TokenExpiryHours > maxTokenExpiryHours {
+		return errors.Errorf("token expiry hours should be between 0 and %d", maxTokenExpiryHours)
+	}
+	if pref.BudgetThresholdPercent < 0 || pref.BudgetThresholdPercent > 100 {
+		return errors.New("budget threshold percent should be between 0 and 100")
+	}
+	return nil
+}
+
+// isValidNotificationURL checks the url like the webhooks, the internal addresses are rejected
+func isValidNotificationURL(rawURL string) bool {
+	return client.ValidatePublicURL(rawURL) == nil
+}
+
+// quotaThreshold returns the quota threshold of the user, negative if the warning is disabled
+func (pref *NotificationPreference) quotaThreshold() int64 {
+	if pref.QuotaThreshold == 0 {
+		return config.QuotaRemindThreshold
+	}
+	return pref.QuotaThreshold
+}
+
+// GetNotificationPreference returns the preference of the user with the urls in plaintext
+func GetNotificationPreference(userId int) (*NotificationPreference, error) {
+	pref := new(NotificationPreference)
+	err := DB.First(pref, "user_id = ?", userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultNotificationPreference(userId), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get notification preference")
+	}
+	if pref.WebhookURL, err = secret.Decrypt(pref.WebhookURL); err != nil {
+		return nil, errors.Wrap(err, "decrypt webhook url")
+	}
+	if pref.IncomingWebhookURL, err = secret.Decrypt(pref.IncomingWebhookURL); err != nil {
+		return nil, errors.Wrap(err, "decrypt incoming webhook url")
+	}
+	return pref, nil
+}
+
+// SaveNotificationPreference saves the preference, the urls are encrypted since they usually carry tokens
+func SaveNotificationPreference(pref NotificationPreference) (err error) {
+	if pref.WebhookURL, err = secret.Encrypt(pref.WebhookURL); err != nil {
+		return errors.Wrap(err, "encrypt webhook url")
+	}
+	if pref.IncomingWebhookURL, err = secret.Encrypt(pref.IncomingWebhookURL); err != nil {
+		return errors.Wrap(err, "encrypt incoming webhook url")
+	}
+	pref.UpdatedTime = helper.GetTimestamp()
+	return DB.Save(&pref).Error
+}
+
+// GetNotifications returns the notifications sent to the user, the latest first
+func GetNotifications(userId int, startIdx int, num int) ([]*Notification, error) {
+	var notifications []*Notification
+	err := DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&notifications).Error
+	return notifications, err
+}
+
+// NotifyUser sends the notification by the channels of the user's preference, and records it to the history.
+// The notification is skipped if one of the same dedupKey has been sent, an empty dedupKey is never skipped.
+// The notification failed on every channel is not recorded, so it would be retried by the next check.
+func NotifyUser(ctx context.Context, userId int, event string, title string, content string, dedupKey string) error {
+	return notifyUser(ctx, userId, event, title, content, "", dedupKey)
+}
+
+// notifyUser is NotifyUser with the HTML body of the email, the content is escaped as the body if it's empty
+func notifyUser(ctx context.Context, userId int, event string, title string, content string, emailContent string, dedupKey string) error {
+	if dedupKey != "" {
+		var count int64
+		err := DB.Model(&Notification{}).Where("user_id = ? AND dedup_key = ?", userId, dedupKey).Count(&count).Error
+		if err != nil {
+			return errors.Wrap(err, "check notification history")
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+	pref, err := GetNotificationPreference(userId)
+	if err != nil {
+		return err
+	}
+
+	notification := &Notification{
+		UserId:      userId,
+		Event:       event,
+		Title:       title,
+		Content:     content,
+		DedupKey:    dedupKey,
+		CreatedTime: helper.GetTimestamp(),
+	}
+	var channels, errs []string
+	if pref.EmailEnabled {
+		email, err := GetUserEmail(userId)
+		if err == nil && email != "" {
+			if emailContent == "" {
+				emailContent = fmt.Sprintf("<p>%s</p>", strings.ReplaceAll(html.EscapeString(content), "\n", "<br>"))
+			}
+			err = message.SendEmail(title, email, message.EmailTemplate(title, emailContent))
+		}
+		if err != nil {
+			errs = append(errs, "email: "+err.Error())
+		} else if email != "" {
+			channels = append(channels, NotificationChannelEmail)
+		}
+	}
+	if pref.WebhookURL != "" {
+		body, _ := json.Marshal(notification)
+		_, err := message.SendWebhook(ctx, pref.WebhookURL, "", event, "", notification.CreatedTime, body)
+		if err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		} else {
+			channels = append(channels, NotificationChannelWebhook)
+		}
+	}
+	if pref.IncomingWebhookURL != "" {
+		err := message.SendIncomingWebhook(ctx, pref.IncomingWebhookType, pref.IncomingWebhookURL, title, content)
+		if err != nil {
+			errs = append(errs, "incoming webhook: "+err.Error())
+		} else {
+			channels = append(channels, NotificationChannelIncomingWebhook)
+		}
+	}
+	notification.Channels = strings.Join(channels, ",")
+	notification.Error = strings.Join(errs, "; ")
+	if len(channels) == 0 && len(errs) > 0 {
+		return errors.Errorf("failed to notify user %d: %s", userId, notification.Error)
+	}
+	if err = DB.Create(notification).Error; err != nil {
+		return errors.Wrap(err, "record notification")
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("failed to notify user %d: %s", userId, notification.Error)
+	}
+	return nil
+}
+
+// notificationPreferences caches the preferences during a check
+type notificationPreferences map[int]*NotificationPreference
+
+func (prefs notificationPreferences) get(userId int) (*NotificationPreference, error) {
+	if pref, ok := prefs[userId]; ok {
+		return pref, nil
+	}
+	pref, err := GetNotificationPreference(userId)
+	if err != nil {
+		return nil, err
+	}
+	prefs[userId] = pref
+	return pref, nil
+}
+
+// CheckNotifications warns the users whose tokens are about to expire, whose budgets are about to run out,
+// and whose quota is below their own threshold. Each warning is only sent once.
+func CheckNotifications(ctx context.Context, now time.Time) error {
+	prefs := make(notificationPreferences)
+	if err := checkExpiringTokens(ctx, now, prefs); err != nil {
+		return err
+	}
+	if err := checkBudgets(ctx, now, prefs); err != nil {
+		return err
+	}
+	return checkQuotaThresholds(ctx, now)
+}
+
+func checkExpiringTokens(ctx context.Context, now time.Time, prefs notificationPreferences) error {
+	var tokens []*Token
+	err := DB.Select("id", "user_id", "name", "expired_time").
+		Where("status = ? AND expired_time > ? AND expired_time <= ?", TokenStatusEnabled,
+			now.Unix(), now.Add(maxTokenExpiryHours*time.Hour).Unix()).
+		Find(&tokens).Error
+	if err != nil {
+		return errors.Wrap(err, "get expiring tokens")
+	}
+	for _, token := range tokens {
+		pref, err := prefs.get(token.UserId)
+		if err != nil {
+			return err
+		}
+		if pref.TokenExpiryHours <= 0 || token.ExpiredTime > now.Add(time.Duration(pref.TokenExpiryHours)*time.Hour).Unix() {
+			continue
+		}
+		expiredAt := time.Unix(token.ExpiredTime, 0).Format(time.RFC3339)
+		err = NotifyUser(ctx, token.UserId, NotificationEventTokenExpiring, "Token Expiry Reminder",
+			fmt.Sprintf("Your token %s (#%d) expires at %s.", token.Name, token.Id, expiredAt),
+			fmt.Sprintf("%s:%d:%d", NotificationEventTokenExpiring, token.Id, token.ExpiredTime))
+		if err != nil {
+			logger.Errorf(ctx, "failed to notify expiring token %d: %+v", token.Id, err)
+		}
+	}
+	return nil
+}
+
+// budgetOwner is a token or a user with a budget
+type budgetOwner struct {
+	Id     int
+	UserId int
+	Name   string
+	Budget `gorm:"embedded"`
+}
+
+func checkBudgets(ctx context.Context, now time.Time, prefs notificationPreferences) error {
+	for _, kind := range []string{"token", "user"} {
+		var owners []*budgetOwner
+		query := DB.Model(&Token{}).Select(append([]string{"id", "user_id", "name"}, budgetColumns...))
+		if kind == "user" {
+			query = DB.Model(&User{}).Select(append([]string{"id", "id AS user_id", "username AS name"}, budgetColumns...))
+		}
+		err := query.Where("budget_quota > 0 AND budget_period <> ''").Scan(&owners).Error
+		if err != nil {
+			return errors.Wrapf(err, "get %s budgets", kind)
+		}
+		for _, owner := range owners {
+			owner.RollBudget(now)
+			pref, err := prefs.get(owner.UserId)
+			if err != nil {
+				return err
+			}
+			total := owner.BudgetQuota + owner.BudgetCarriedQuota
+			if pref.BudgetThresholdPercent <= 0 || total <= 0 ||
+				owner.BudgetUsedQuota*100 < total*int64(pref.BudgetThresholdPercent) {
+				continue
+			}
+			resetAt := time.Unix(owner.BudgetResetAt(), 0).Format(time.RFC3339)
+			err = NotifyUser(ctx, owner.UserId, NotificationEventBudgetLow, "Budget Reminder",
+				fmt.Sprintf("The %s budget of %s %s has used %s of %s, it resets at %s.", owner.BudgetPeriod, kind,
+					owner.Name, common.LogQuota(owner.BudgetUsedQuota), common.LogQuota(total), resetAt),
+				fmt.Sprintf("%s:%s:%d:%d", NotificationEventBudgetLow, kind, owner.Id, owner.BudgetPeriodStart))
+			if err != nil {
+				logger.Errorf(ctx, "failed to notify budget of %s %d: %+v", kind, owner.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkQuotaThresholds warns the users with their own quota threshold at most once a day,
+// the default threshold is checked when the quota is consumed.
+func checkQuotaThresholds(ctx context.Context, now time.Time) error {
+	var users []struct {
+		Id    int
+		Quota int64
+	}
+	err := DB.Model(&User{}).Select("users.id, users.quota").
+		Joins("JOIN notification_preferences ON notification_preferences.user_id = users.id").
+		Where("notification_preferences.quota_threshold > 0 AND users.quota < notification_preferences.quota_threshold").
+		Scan(&users).Error
+	if err != nil {
+		return errors.Wrap(err, "get users below quota threshold")
+	}
+	for _, user := range users {
+		err = NotifyUser(ctx, user.Id, NotificationEventQuotaLow, "Quota Reminder",
+			fmt.Sprintf("Your quota is about to be exhausted, your current remaining quota is %s.", common.LogQuota(user.Quota)),
+			fmt.Sprintf("%s:%s", NotificationEventQuotaLow, now.Format("2006-01-02")))
+		if err != nil {
+			logger.Errorf(ctx, "failed to notify quota of user %d: %+v", user.Id, err)
+		}
+	}
+	return nil
+}
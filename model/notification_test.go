@@ -0,0 +1,152 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupNotificationTestDB(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &NotificationPreference{}, &Notification{})
+	allowPrivate := config.WebhookAllowPrivateNetwork
+	// the test servers listen on the loopback address
+	config.WebhookAllowPrivateNetwork = true
+	t.Cleanup(func() { config.WebhookAllowPrivateNetwork = allowPrivate })
+}
+
+func TestValidateNotificationPreference(t *testing.T) {
+	pref := DefaultNotificationPreference(1)
+	require.NoError(t, pref.ValidateNotificationPreference())
+
+	pref.WebhookURL = "ftp://example.com"
+	require.Error(t, pref.ValidateNotificationPreference())
+	pref.WebhookURL = "http://169.254.169.254/latest/meta-data"
+	require.Error(t, pref.ValidateNotificationPreference())
+	pref.WebhookURL = "https://example.com/hook"
+	require.NoError(t, pref.ValidateNotificationPreference())
+
+	pref.IncomingWebhookURL = "https://hooks.slack.com/services/xxx"
+	require.Error(t, pref.ValidateNotificationPreference())
+	pref.IncomingWebhookType = "slack"
+	require.NoError(t, pref.ValidateNotificationPreference())
+
+	pref.TokenExpiryHours = maxTokenExpiryHours + 1
+	require.Error(t, pref.ValidateNotificationPreference())
+	pref.TokenExpiryHours = 24
+	pref.BudgetThresholdPercent = 101
+	require.Error(t, pref.ValidateNotificationPreference())
+}
+
+func TestNotifyUser(t *testing.T) {
+	setupNotificationTestDB(t)
+	ctx := context.Background()
+
+	var webhookCalls, slackCalls atomic.Int32
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCalls.Add(1)
+		notification := new(Notification)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(notification))
+		assert.Equal(t, NotificationEventTest, notification.Event)
+	}))
+	defer webhookServer.Close()
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slackCalls.Add(1)
+		var payload map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Contains(t, payload["text"], "hello")
+	}))
+	defer slackServer.Close()
+
+	require.NoError(t, SaveNotificationPreference(NotificationPreference{
+		UserId:              1,
+		WebhookURL:          webhookServer.URL,
+		IncomingWebhookType: "slack",
+		IncomingWebhookURL:  slackServer.URL,
+	}))
+	pref, err := GetNotificationPreference(1)
+	require.NoError(t, err)
+	assert.Equal(t, webhookServer.URL, pref.WebhookURL)
+	assert.False(t, pref.EmailEnabled)
+
+	// the same dedup key is only sent once
+	for range 2 {
+		require.NoError(t, NotifyUser(ctx, 1, NotificationEventTest, "Test", "hello", "test:1"))
+	}
+	assert.EqualValues(t, 1, webhookCalls.Load())
+	assert.EqualValues(t, 1, slackCalls.Load())
+
+	notifications, err := GetNotifications(1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "webhook,incoming_webhook", notifications[0].Channels)
+	assert.Empty(t, notifications[0].Error)
+}
+
+func TestNotifyUserRetry(t *testing.T) {
+	setupNotificationTestDB(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first delivery fails
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	require.NoError(t, SaveNotificationPreference(NotificationPreference{UserId: 1, WebhookURL: server.URL}))
+
+	// the failed notification is not recorded, so the same dedup key is sent again
+	require.Error(t, NotifyUser(ctx, 1, NotificationEventTest, "Test", "hello", "test:retry"))
+	require.NoError(t, NotifyUser(ctx, 1, NotificationEventTest, "Test", "hello", "test:retry"))
+	require.NoError(t, NotifyUser(ctx, 1, NotificationEventTest, "Test", "hello", "test:retry"))
+	assert.EqualValues(t, 2, calls.Load())
+
+	notifications, err := GetNotifications(1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "webhook", notifications[0].Channels)
+}
+
+func TestCheckNotifications(t *testing.T) {
+	setupNotificationTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", Quota: 1000}).Error)
+	require.NoError(t, SaveNotificationPreference(NotificationPreference{
+		UserId:                 1,
+		TokenExpiryHours:       24,
+		BudgetThresholdPercent: 80,
+	}))
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: "expiring", Name: "expiring",
+		Status: TokenStatusEnabled, ExpiredTime: now.Add(time.Hour).Unix()}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 2, UserId: 1, Key: "later", Name: "later",
+		Status: TokenStatusEnabled, ExpiredTime: now.Add(48 * time.Hour).Unix()}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 3, UserId: 1, Key: "budget", Name: "budget",
+		Status: TokenStatusEnabled, ExpiredTime: -1, Budget: Budget{
+			BudgetQuota:       100,
+			BudgetPeriod:      BudgetPeriodDaily,
+			BudgetUsedQuota:   90,
+			BudgetPeriodStart: budgetPeriodStart(BudgetPeriodDaily, now).Unix(),
+		}}).Error)
+
+	// the warnings are only sent once however many times it's checked
+	for range 2 {
+		require.NoError(t, CheckNotifications(ctx, now))
+	}
+	notifications, err := GetNotifications(1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, notifications, 2)
+	events := []string{notifications[0].Event, notifications[1].Event}
+	assert.ElementsMatch(t, []string{NotificationEventTokenExpiring, NotificationEventBudgetLow}, events)
+}
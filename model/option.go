@@ -1,13 +1,19 @@
 package model
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Laisky/errors/v2"
+
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
+	"github.com/songquanpeng/one-api/relay/balancer"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/hedge"
 )
 
 type Option struct {
@@ -74,6 +80,10 @@ func InitOptionMap() {
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
 	config.OptionMap["Theme"] = config.Theme
+	config.OptionMap["LoadBalancingStrategy"] = config.LoadBalancingStrategy
+	config.OptionMap["GroupLoadBalancingStrategy"] = balancer.GroupStrategy2JSONString()
+	config.OptionMap["ModelLoadBalancingStrategy"] = balancer.ModelStrategy2JSONString()
+	config.OptionMap["GroupHedgeDelay"] = hedge.GroupDelay2JSONString()
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
 }
@@ -85,7 +95,15 @@ func loadOptionsFromDatabase() {
 		if option.Key == "ModelRatio" || option.Key == "CompletionRatio" {
 			continue
 		}
-		err := updateOptionMap(option.Key, option.Value)
+		value := option.Value
+		if IsSecretOption(option.Key) {
+			var err error
+			if value, err = secret.Decrypt(value); err != nil {
+				logger.SysError(fmt.Sprintf("failed to decrypt option %s: %s", option.Key, err.Error()))
+				continue
+			}
+		}
+		err := updateOptionMap(option.Key, value)
 		if err != nil {
 			logger.SysError("failed to update option map: " + err.Error())
 		}
@@ -108,6 +126,13 @@ func UpdateOption(key string, value string) error {
 	// https://gorm.io/docs/update.html#Save-All-Fields
 	DB.FirstOrCreate(&option, Option{Key: key})
 	option.Value = value
+	if IsSecretOption(key) {
+		encrypted, err := secret.Encrypt(value)
+		if err != nil {
+			return errors.Wrapf(err, "encrypt option %s", key)
+		}
+		option.Value = encrypted
+	}
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
@@ -238,6 +263,17 @@ func updateOptionMap(key string, value string) (err error) {
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
 		config.Theme = value
+	case "LoadBalancingStrategy":
+		if !balancer.IsValidStrategy(value) {
+			return errors.Errorf("invalid load balancing strategy %q", value)
+		}
+		config.LoadBalancingStrategy = value
+	case "GroupLoadBalancingStrategy":
+		err = balancer.UpdateGroupStrategyByJSONString(value)
+	case "ModelLoadBalancingStrategy":
+		err = balancer.UpdateModelStrategyByJSONString(value)
+	case "GroupHedgeDelay":
+		err = hedge.UpdateGroupDelayByJSONString(value)
 	}
 	return err
 }
@@ -0,0 +1,343 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2
+)
+
+// The roles of the members in an organization, they're independent of the global roles of the users
+const (
+	// OrganizationRoleOwner manages everything of the organization
+	OrganizationRoleOwner = "owner"
+	// OrganizationRoleBilling manages the quota pool and the spending caps of the members
+	OrganizationRoleBilling = "billing"
+	// OrganizationRoleDeveloper creates and uses the tokens of the organization
+	OrganizationRoleDeveloper = "developer"
+	// OrganizationRoleViewer only views the organization
+	OrganizationRoleViewer = "viewer"
+)
+
+// Organization owns a quota pool shared by its members, and the tokens created by the members for it
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	// Quota is the remaining quota of the pool
+	Quota     int64 `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota int64 `json:"used_quota" gorm:"bigint;default:0"`
+}
+
+// OrganizationMember is the membership of a user in an organization
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_organization_member"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_organization_member;index"`
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	// QuotaLimit caps the quota the member could spend from the pool, 0 means unlimited
+	QuotaLimit int64 `json:"quota_limit" gorm:"bigint;default:0"`
+	// UsedQuota is the quota the member has spent from the pool
+	UsedQuota int64 `json:"used_quota" gorm:"bigint;default:0"`
+	// Username is filled when listing the members
+	Username string `json:"username" gorm:"-"`
+}
+
+// UserOrganization is an organization with the role of the user in it
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleBilling, OrganizationRoleDeveloper, OrganizationRoleViewer:
+		return true
+	}
+	return false
+}
+
+// CanManageMembers returns true if the member could add, update and remove the members
+func (m *OrganizationMember) CanManageMembers() bool {
+	return m.Role == OrganizationRoleOwner
+}
+
+// CanManageBilling returns true if the member could top up the pool and set the spending caps
+func (m *OrganizationMember) CanManageBilling() bool {
+	return m.Role == OrganizationRoleOwner || m.Role == OrganizationRoleBilling
+}
+
+// CanUseTokens returns true if the member could create and use the tokens of the organization
+func (m *OrganizationMember) CanUseTokens() bool {
+	return m.Role == OrganizationRoleOwner || m.Role == OrganizationRoleDeveloper
+}
+
+// CreateOrganization creates an organization, and makes the user its owner
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	org := &Organization{
+		Name:        name,
+		Status:      OrganizationStatusEnabled,
+		CreatedTime: helper.GetTimestamp(),
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    helper.GetTimestamp(),
+		}).Error
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create organization")
+	}
+	return org, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id is empty!")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, err
+}
+
+// GetUserOrganizations returns the organizations the user is a member of
+func GetUserOrganizations(userId int) (orgs []*UserOrganization, err error) {
+	err = DB.Model(&Organization{}).
+		Select("organizations.*, organization_members.role").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userId).
+		Order("organizations.id desc").
+		Scan(&orgs).Error
+	return orgs, err
+}
+
+// Update updates the name and the status of the organization
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "status").Updates(org).Error
+}
+
+// DeleteOrganization deletes the organization, its members and its tokens.
+// The pool should be used up or cleared by the admins first, since it may be funded by several members.
+func DeleteOrganization(ctx context.Context, id int, userId int) error {
+	var tokens []*Token
+	if err := DB.Where("organization_id = ?", id).Find(&tokens).Error; err != nil {
+		return errors.Wrap(err, "get organization tokens")
+	}
+	org := &Organization{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(org, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if org.Quota > 0 {
+			return errors.Errorf("the pool still has %s, which should be used up or cleared by the admins first",
+				common.LogQuota(org.Quota))
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&Token{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "delete organization")
+	}
+	for _, token := range tokens {
+		clearTokenCache(token.Key)
+	}
+	RecordLog(ctx, userId, LogTypeManage, fmt.Sprintf("Deleted organization %s", org.Name))
+	return nil
+}
+
+// SetOrganizationQuota sets the remaining quota of the pool
+func SetOrganizationQuota(id int, quota int64) error {
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", quota).Error
+}
+
+// TransferQuotaToOrganization moves quota from the user to the pool of the organization
+func TransferQuotaToOrganization(ctx context.Context, id int, userId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("quota should be positive")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("user quota is not enough")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "transfer quota to organization")
+	}
+	RecordLog(ctx, userId, LogTypeTopup, fmt.Sprintf("Transferred %s to organization #%d", common.LogQuota(quota), id))
+	return nil
+}
+
+func GetOrganizationMember(id int, userId int) (*OrganizationMember, error) {
+	member := OrganizationMember{}
+	err := DB.First(&member, "organization_id = ? AND user_id = ?", id, userId).Error
+	return &member, err
+}
+
+func GetOrganizationMembers(id int) (members []*OrganizationMember, err error) {
+	err = DB.Where("organization_id = ?", id).Order("id").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		member.Username = GetUsernameById(member.UserId)
+	}
+	return members, nil
+}
+
+func (m *OrganizationMember) Insert() error {
+	m.CreatedTime = helper.GetTimestamp()
+	return DB.Create(m).Error
+}
+
+// Update updates the role and the spending cap of the member
+func (m *OrganizationMember) Update() error {
+	return DB.Model(m).Select("role", "quota_limit").Updates(m).Error
+}
+
+func (m *OrganizationMember) Delete() error {
+	return DB.Delete(m).Error
+}
+
+// CountOrganizationOwners returns the number of the owners, an organization should have at least one owner
+func CountOrganizationOwners(id int) (count int64, err error) {
+	err = DB.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND role = ?", id, OrganizationRoleOwner).Count(&count).Error
+	return count, err
+}
+
+// GetOrganizationTokens returns the tokens of the organization,
+// the keys of the tokens created by the others than userId are masked.
+func GetOrganizationTokens(id int, userId int) (tokens []*Token, err error) {
+	err = DB.Where("organization_id = ?", id).Order("id desc").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if token.UserId != userId {
+			token.Key = maskTokenKey(token.Key)
+		}
+	}
+	return tokens, nil
+}
+
+func maskTokenKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+// ValidateOrganizationToken checks the organization of the token is enabled,
+// and the user created the token is still a member allowed to use the tokens.
+func ValidateOrganizationToken(token *Token) error {
+	org, err := GetOrganizationById(token.OrganizationId)
+	if err != nil {
+		return errors.Wrap(err, "get organization of the token")
+	}
+	if org.Status != OrganizationStatusEnabled {
+		return errors.Errorf("organization %s is disabled", org.Name)
+	}
+	member, err := GetOrganizationMember(token.OrganizationId, token.UserId)
+	if err != nil || !member.CanUseTokens() {
+		return errors.Errorf("the creator of this API key is not allowed to use the tokens of organization %s", org.Name)
+	}
+	return nil
+}
+
+// GetOrganizationAvailableQuota returns the quota the member could spend from the pool,
+// which is limited by both the pool and the spending cap of the member.
+func GetOrganizationAvailableQuota(id int, userId int) (int64, error) {
+	org, err := GetOrganizationById(id)
+	if err != nil {
+		return 0, errors.Wrap(err, "get organization")
+	}
+	member, err := GetOrganizationMember(id, userId)
+	if err != nil {
+		return 0, errors.Wrap(err, "get organization member")
+	}
+	quota := org.Quota
+	if member.QuotaLimit > 0 {
+		quota = min(quota, member.QuotaLimit-member.UsedQuota)
+	}
+	return quota, nil
+}
+
+// errInsufficientOrganizationQuota is returned if the pool or the spending cap of the member could not afford the quota
+var errInsufficientOrganizationQuota = errors.New("Insufficient organization quota")
+
+// consumeOrganizationQuota charges the pool and the spending cap of the member, quota could be negative
+// if the pre-consumed quota is returned.
+//
+// The pool never goes negative. If strict, the charge fails unless both the pool and the spending cap could afford it,
+// otherwise the usage beyond the pool is recorded, but the pool is only drained to zero.
+func consumeOrganizationQuota(id int, userId int, quota int64, strict bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Organization{}).Where("id = ? AND (quota >= ? OR ? <= 0)", id, quota, quota).
+			Updates(map[string]any{
+				"quota":      gorm.Expr("quota - ?", quota),
+				"used_quota": gorm.Expr("used_quota + ?", quota),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if strict {
+				return errInsufficientOrganizationQuota
+			}
+			logger.SysWarnf("the pool of organization #%d could not afford %d quota, it's drained to zero", id, quota)
+			err := tx.Model(&Organization{}).Where("id = ?", id).Updates(map[string]any{
+				"quota":      0,
+				"used_quota": gorm.Expr("used_quota + ?", quota),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		query := tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", id, userId)
+		if strict && quota > 0 {
+			query = query.Where("quota_limit = 0 OR used_quota + ? <= quota_limit", quota)
+		}
+		result = query.Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if strict && result.RowsAffected == 0 {
+			return errInsufficientOrganizationQuota
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupOrganizationTestDB(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &Organization{}, &OrganizationMember{}, &Log{})
+	redisEnabled, batchUpdateEnabled := common.RedisEnabled, config.BatchUpdateEnabled
+	common.RedisEnabled, config.BatchUpdateEnabled = false, false
+	t.Cleanup(func() { common.RedisEnabled, config.BatchUpdateEnabled = redisEnabled, batchUpdateEnabled })
+}
+
+func TestOrganizationTokenQuota(t *testing.T) {
+	setupOrganizationTestDB(t)
+
+	owner := &User{Id: 1, Username: "owner", Quota: 1000, AccessToken: "owner", AffCode: "owner"}
+	developer := &User{Id: 2, Username: "developer", Quota: 0, AccessToken: "developer", AffCode: "developer"}
+	require.NoError(t, DB.Create(owner).Error)
+	require.NoError(t, DB.Create(developer).Error)
+
+	org, err := CreateOrganization("acme", owner.Id)
+	require.NoError(t, err)
+	require.NoError(t, TransferQuotaToOrganization(t.Context(), org.Id, owner.Id, 800))
+	assert.Error(t, TransferQuotaToOrganization(t.Context(), org.Id, owner.Id, 800))
+
+	member := &OrganizationMember{OrganizationId: org.Id, UserId: developer.Id,
+		Role: OrganizationRoleDeveloper, QuotaLimit: 300}
+	require.NoError(t, member.Insert())
+
+	token := &Token{Id: 1, UserId: developer.Id, Key: "organization", UnlimitedQuota: true, OrganizationId: org.Id}
+	require.NoError(t, DB.Create(token).Error)
+	require.NoError(t, ValidateOrganizationToken(token))
+
+	// the pool is charged instead of the user
+	require.NoError(t, PreConsumeTokenQuota(token.Id, 200))
+	require.NoError(t, PostConsumeTokenQuota(token.Id, -50))
+
+	org, err = GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(650), org.Quota)
+	assert.Equal(t, int64(150), org.UsedQuota)
+	userQuota, err := GetUserQuota(developer.Id)
+	require.NoError(t, err)
+	assert.Zero(t, userQuota)
+
+	// the spending cap of the member is enforced
+	available, err := GetOrganizationAvailableQuota(org.Id, developer.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), available)
+	assert.Error(t, PreConsumeTokenQuota(token.Id, 151))
+
+	// the usage beyond the pool drains it to zero instead of overdrawing it
+	require.NoError(t, SetOrganizationQuota(org.Id, 100))
+	assert.ErrorIs(t, PreConsumeTokenQuota(token.Id, 101), errInsufficientOrganizationQuota)
+	require.NoError(t, PostConsumeTokenQuota(token.Id, 120))
+	org, err = GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Zero(t, org.Quota)
+	assert.Equal(t, int64(270), org.UsedQuota)
+
+	// the other members could not read the keys of the tokens
+	tokens, err := GetOrganizationTokens(org.Id, owner.Id)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "orga****tion", tokens[0].Key)
+	tokens, err = GetOrganizationTokens(org.Id, developer.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "organization", tokens[0].Key)
+	assert.Equal(t, "sk-a****wxyz", maskTokenKey("sk-abcdefghijklmnopqrstuvwxyz"))
+
+	// viewers could not use the tokens any more
+	member.Role = OrganizationRoleViewer
+	require.NoError(t, member.Update())
+	assert.Error(t, ValidateOrganizationToken(token))
+
+	// the organization with quota left in the pool could not be deleted
+	require.NoError(t, SetOrganizationQuota(org.Id, 50))
+	assert.Error(t, DeleteOrganization(t.Context(), org.Id, owner.Id))
+	require.NoError(t, SetOrganizationQuota(org.Id, 0))
+	require.NoError(t, DeleteOrganization(t.Context(), org.Id, owner.Id))
+	userQuota, err = GetUserQuota(owner.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), userQuota)
+	_, err = GetTokenById(token.Id)
+	assert.Error(t, err)
+}
@@ -86,6 +86,11 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 		return 0, errors.New("Redeem failed, " + err.Error())
 	}
 	RecordLog(ctx, userId, LogTypeTopup, fmt.Sprintf("Recharged %s using redemption code", common.LogQuota(redemption.Quota)))
+	go EmitWebhookEvent(context.WithoutCancel(ctx), WebhookEventRedemptionUsed, userId, map[string]any{
+		"redemption_id":   redemption.Id,
+		"redemption_name": redemption.Name,
+		"quota":           redemption.Quota,
+	})
 	return redemption.Quota, nil
 }
 
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// ResponseRecord records the channel that served a Response API call,
+// so the stored response can be retrieved, deleted or cancelled through the same channel,
+// and the requests with previous_response_id are routed to the channel that holds the response.
+type ResponseRecord struct {
+	Id         int    `json:"id"`
+	ResponseId string `json:"response_id" gorm:"type:varchar(128);uniqueIndex"` // the response id returned by the upstream
+	UserId     int    `json:"user_id" gorm:"index"`
+	TokenId    int    `json:"token_id"`
+	ChannelId  int    `json:"channel_id"`
+	Model      string `json:"model"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+}
+
+// Insert saves the record, it is a no-op if the response is already recorded
+func (record *ResponseRecord) Insert() error {
+	if record.CreatedAt == 0 {
+		record.CreatedAt = helper.GetTimestamp()
+	}
+	var count int64
+	if err := DB.Model(&ResponseRecord{}).
+		Where("response_id = ?", record.ResponseId).
+		Count(&count).Error; err != nil {
+		return errors.Wrap(err, "check response record")
+	}
+	if count > 0 {
+		return nil
+	}
+	return errors.Wrap(DB.Create(record).Error, "insert response record")
+}
+
+// GetResponseRecord returns the record of the response
+func GetResponseRecord(responseId string) (*ResponseRecord, error) {
+	record := &ResponseRecord{}
+	err := DB.Where("response_id = ?", responseId).First(record).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get record of response %s", responseId)
+	}
+	return record, nil
+}
+
+// GetUserResponseRecord returns the record of the response only if it is created by userId
+func GetUserResponseRecord(userId int, responseId string) (*ResponseRecord, error) {
+	if responseId == "" {
+		return nil, errors.New("response id is empty")
+	}
+	record := &ResponseRecord{}
+	err := DB.Where("response_id = ? AND user_id = ?", responseId, userId).First(record).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get record of response %s", responseId)
+	}
+	return record, nil
+}
+
+// DeleteResponseRecord removes the record after the response is deleted from the upstream
+func DeleteResponseRecord(responseId string) error {
+	err := DB.Where("response_id = ?", responseId).Delete(&ResponseRecord{}).Error
+	return errors.Wrapf(err, "delete record of response %s", responseId)
+}
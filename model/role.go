@@ -0,0 +1,322 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// The permissions checked by the management routes
+const (
+	PermissionChannelRead        = "channel:read"
+	PermissionChannelWrite       = "channel:write"
+	PermissionChannelKeyReveal   = "channel:key:reveal"
+	PermissionUserRead           = "user:read"
+	PermissionUserManage         = "user:manage"
+	PermissionLogRead            = "log:read"
+	PermissionLogDelete          = "log:delete"
+	PermissionRedemptionRead     = "redemption:read"
+	PermissionRedemptionCreate   = "redemption:create"
+	PermissionOptionRead         = "option:read"
+	PermissionOptionWrite        = "option:write"
+	PermissionOrganizationManage = "organization:manage"
+	PermissionRoleManage         = "role:manage"
+	PermissionAuditRead          = "audit:read"
+	PermissionWebhookManage      = "webhook:manage"
+)
+
+// AllPermissions lists all the permissions could be granted to a role
+var AllPermissions = []string{
+	PermissionChannelRead,
+	PermissionChannelWrite,
+	PermissionChannelKeyReveal,
+	PermissionUserRead,
+	PermissionUserManage,
+	PermissionLogRead,
+	PermissionLogDelete,
+	PermissionRedemptionRead,
+	PermissionRedemptionCreate,
+	PermissionOptionRead,
+	PermissionOptionWrite,
+	PermissionOrganizationManage,
+	PermissionRoleManage,
+	PermissionAuditRead,
+	PermissionWebhookManage,
+}
+
+// The built-in role presets, the users of the legacy roles are migrated to them
+const (
+	RolePresetCommon = "common"
+	RolePresetAdmin  = "admin"
+	RolePresetRoot   = "root"
+)
+
+// Role is a named bundle of permissions, the users with a role of any permission are administrators.
+type Role struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(32);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	// Permissions is separated by comma
+	Permissions string `json:"permissions" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	BuiltIn     bool   `json:"built_in" gorm:"-"`
+}
+
+var builtInRoles = []*Role{
+	{
+		Name:        RolePresetCommon,
+		Description: "Common users without any management permission",
+		BuiltIn:     true,
+	},
+	{
+		Name:        RolePresetAdmin,
+		Description: "Administrators, who could manage everything except the options and the roles",
+		Permissions: strings.Join([]string{
+			PermissionChannelRead,
+			PermissionChannelWrite,
+			PermissionChannelKeyReveal,
+			PermissionUserRead,
+			PermissionUserManage,
+			PermissionLogRead,
+			PermissionLogDelete,
+			PermissionRedemptionRead,
+			PermissionRedemptionCreate,
+			PermissionOrganizationManage,
+		}, ","),
+		BuiltIn: true,
+	},
+	{
+		Name:        RolePresetRoot,
+		Description: "Root users with all permissions",
+		Permissions: strings.Join(AllPermissions, ","),
+		BuiltIn:     true,
+	},
+}
+
+// RolePresetName returns the built-in role preset of the legacy role
+func RolePresetName(role int) string {
+	switch {
+	case role >= RoleRootUser:
+		return RolePresetRoot
+	case role >= RoleAdminUser:
+		return RolePresetAdmin
+	default:
+		return RolePresetCommon
+	}
+}
+
+func IsValidPermission(permission string) bool {
+	return slices.Contains(AllPermissions, permission)
+}
+
+// PermissionList returns the permissions of the role
+func (role *Role) PermissionList() []string {
+	if role.Permissions == "" {
+		return nil
+	}
+	return strings.Split(role.Permissions, ",")
+}
+
+func (role *Role) HasPermission(permission string) bool {
+	return slices.Contains(role.PermissionList(), permission)
+}
+
+// ValidateRole checks the name and the permissions of a custom role, and normalizes the permissions
+func (role *Role) ValidateRole() error {
+	if role.Name == "" || len(role.Name) > 32 {
+		return errors.New("role name should be 1 to 32 characters")
+	}
+	if getBuiltInRole(role.Name) != nil {
+		return errors.Errorf("role %s is built-in", role.Name)
+	}
+	var permissions []string
+	for _, permission := range strings.Split(role.Permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" || slices.Contains(permissions, permission) {
+			continue
+		}
+		if !IsValidPermission(permission) {
+			return errors.Errorf("invalid permission %q", permission)
+		}
+		permissions = append(permissions, permission)
+	}
+	role.Permissions = strings.Join(permissions, ",")
+	return nil
+}
+
+func getBuiltInRole(name string) *Role {
+	for _, role := range builtInRoles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+// GetAllRoles returns the built-in role presets and the custom roles
+func GetAllRoles() ([]*Role, error) {
+	var roles []*Role
+	if err := DB.Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(builtInRoles), roles...), nil
+}
+
+func GetRoleByName(name string) (*Role, error) {
+	if role := getBuiltInRole(name); role != nil {
+		return role, nil
+	}
+	role := Role{}
+	if err := DB.First(&role, "name = ?", name).Error; err != nil {
+		return nil, errors.Wrapf(err, "get role %s", name)
+	}
+	return &role, nil
+}
+
+func GetRoleById(id int) (*Role, error) {
+	role := Role{}
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+func (role *Role) Insert() error {
+	role.CreatedTime = helper.GetTimestamp()
+	return DB.Create(role).Error
+}
+
+// Update updates the description and the permissions of the role, the name is kept
+// since it's referenced by the users.
+func (role *Role) Update() error {
+	defer invalidateUserPermissions(0)
+	return DB.Model(role).Select("description", "permissions").Updates(role).Error
+}
+
+// Delete deletes the role if no user is assigned to it
+func (role *Role) Delete() error {
+	var count int64
+	if err := DB.Model(&User{}).Where("role_name = ?", role.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.Errorf("role %s is still assigned to %d users", role.Name, count)
+	}
+	defer invalidateUserPermissions(0)
+	return DB.Delete(role).Error
+}
+
+// SetUserRole assigns the role to the user, the legacy role of the user is changed to
+// admin if the role grants any permission, otherwise common user.
+func SetUserRole(userId int, roleName string) error {
+	role, err := GetRoleByName(roleName)
+	if err != nil {
+		return err
+	}
+	if role.Name == RolePresetRoot {
+		return errors.New("root role could not be assigned")
+	}
+	legacyRole := RoleCommonUser
+	if len(role.PermissionList()) > 0 {
+		legacyRole = RoleAdminUser
+	}
+	err = DB.Model(&User{}).Where("id = ? AND role != ?", userId, RoleRootUser).Updates(map[string]any{
+		"role":      legacyRole,
+		"role_name": role.Name,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "set user role")
+	}
+	invalidateUserPermissions(userId)
+	return nil
+}
+
+// permissionsCacheTTL is how long the permissions of a user are cached,
+// so the roles changed on the other nodes are applied soon.
+const permissionsCacheTTL = 10 * time.Second
+
+// userPermissions caches the permissions of the users, user id -> *cachedPermissions
+var userPermissions sync.Map
+
+type cachedPermissions struct {
+	permissions []string
+	loadedAt    time.Time
+}
+
+// invalidateUserPermissions drops the cached permissions of the user, or of all users if userId is 0
+func invalidateUserPermissions(userId int) {
+	if userId == 0 {
+		userPermissions.Clear()
+		return
+	}
+	userPermissions.Delete(userId)
+}
+
+// GetUserPermissions returns the permissions granted by the role of the user.
+// Root users have all the permissions, and users below administrators have none.
+func GetUserPermissions(userId int) ([]string, error) {
+	if cached, ok := userPermissions.Load(userId); ok && time.Since(cached.(*cachedPermissions).loadedAt) < permissionsCacheTTL {
+		return cached.(*cachedPermissions).permissions, nil
+	}
+
+	user := User{}
+	if err := DB.Select("id", "role", "role_name").First(&user, "id = ?", userId).Error; err != nil {
+		return nil, errors.Wrap(err, "get user role")
+	}
+	var permissions []string
+	switch {
+	case user.Role >= RoleRootUser:
+		permissions = AllPermissions
+	case user.Role >= RoleAdminUser:
+		roleName := user.RoleName
+		if roleName == "" {
+			roleName = RolePresetName(user.Role)
+		}
+		role, err := GetRoleByName(roleName)
+		if err != nil {
+			return nil, err
+		}
+		permissions = role.PermissionList()
+	}
+	userPermissions.Store(userId, &cachedPermissions{permissions: permissions, loadedAt: time.Now()})
+	return permissions, nil
+}
+
+// UserHasPermission returns true if the role of the user grants the permission
+func UserHasPermission(userId int, permission string) (bool, error) {
+	permissions, err := GetUserPermissions(userId)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, permission), nil
+}
+
+// CheckGrantable returns an error if the user doesn't hold all the permissions,
+// so the users could only grant or revoke the permissions they have.
+func CheckGrantable(userId int, permissions []string) error {
+	held, err := GetUserPermissions(userId)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(held, permission) {
+			return errors.Errorf("permission %s could not be granted or revoked without holding it", permission)
+		}
+	}
+	return nil
+}
+
+// migrateUserRoles assigns the built-in role presets to the users of the legacy roles
+func migrateUserRoles() error {
+	for _, legacyRole := range []int{RoleCommonUser, RoleAdminUser, RoleRootUser} {
+		err := DB.Model(&User{}).Where("role = ? AND (role_name = '' OR role_name IS NULL)", legacyRole).
+			Update("role_name", RolePresetName(legacyRole)).Error
+		if err != nil {
+			return errors.Wrap(err, "migrate user roles")
+		}
+	}
+	return nil
+}
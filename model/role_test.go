@@ -0,0 +1,80 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHasPermission(t *testing.T) {
+	setupTestDB(t, &User{}, &Role{})
+	invalidateUserPermissions(0)
+	defer invalidateUserPermissions(0)
+
+	users := []*User{
+		{Id: 1, Username: "root", Role: RoleRootUser, AccessToken: "root", AffCode: "root"},
+		{Id: 2, Username: "admin", Role: RoleAdminUser, AccessToken: "admin", AffCode: "admin"},
+		{Id: 3, Username: "common", Role: RoleCommonUser, AccessToken: "common", AffCode: "common"},
+	}
+	for _, user := range users {
+		require.NoError(t, DB.Create(user).Error)
+	}
+	require.NoError(t, migrateUserRoles())
+	user, err := GetUserById(2, false)
+	require.NoError(t, err)
+	assert.Equal(t, RolePresetAdmin, user.RoleName)
+
+	// the presets keep the permissions of the legacy roles
+	for _, c := range []struct {
+		userId     int
+		permission string
+		expected   bool
+	}{
+		{1, PermissionOptionWrite, true},
+		{2, PermissionChannelKeyReveal, true},
+		{2, PermissionOptionWrite, false},
+		{3, PermissionLogRead, false},
+	} {
+		ok, err := UserHasPermission(c.userId, c.permission)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, ok, "user %d %s", c.userId, c.permission)
+	}
+
+	role := &Role{Name: "auditor", Permissions: "log:read, channel:read,log:read"}
+	require.NoError(t, role.ValidateRole())
+	assert.Equal(t, "log:read,channel:read", role.Permissions)
+	require.NoError(t, role.Insert())
+	assert.Error(t, (&Role{Name: RolePresetAdmin}).ValidateRole())
+	assert.Error(t, (&Role{Name: "bad", Permissions: "channel:delete"}).ValidateRole())
+
+	// a common user with a custom role becomes an administrator of its permissions only
+	require.NoError(t, SetUserRole(3, "auditor"))
+	ok, err := UserHasPermission(3, PermissionLogRead)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = UserHasPermission(3, PermissionChannelWrite)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Error(t, role.Delete())
+
+	// the cached permissions are dropped once the role is updated
+	role.Permissions = "log:read,channel:write"
+	require.NoError(t, role.Update())
+	ok, err = UserHasPermission(3, PermissionChannelWrite)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// the users could only grant the permissions they hold
+	require.NoError(t, CheckGrantable(1, []string{PermissionOptionWrite, PermissionRoleManage}))
+	require.NoError(t, CheckGrantable(3, []string{PermissionLogRead}))
+	assert.Error(t, CheckGrantable(3, []string{PermissionLogRead, PermissionOptionWrite}))
+	assert.Error(t, CheckGrantable(2, []string{PermissionOptionWrite}))
+
+	assert.Error(t, SetUserRole(3, RolePresetRoot))
+	require.NoError(t, SetUserRole(3, RolePresetCommon))
+	ok, err = UserHasPermission(3, PermissionLogRead)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, role.Delete())
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// channelConfigSecrets are the fields of ChannelConfig encrypted at rest
+var channelConfigSecrets = []string{"sk", "vertex_ai_adc"}
+
+// secretOptions are the options encrypted at rest
+var secretOptions = []string{
+	"SMTPToken",
+	"GitHubClientSecret",
+	"LarkClientSecret",
+	"OidcClientSecret",
+	"WeChatServerToken",
+	"MessagePusherToken",
+	"TurnstileSecretKey",
+}
+
+// IsSecretOption returns true if the option is encrypted at rest, they're also hidden by GetOptions
+func IsSecretOption(key string) bool {
+	return slices.Contains(secretOptions, key)
+}
+
+// transformChannelConfig applies fn to the secret fields of the channel config,
+// the other fields are kept as they are.
+func transformChannelConfig(channelConfig string, fn func(string) (string, error)) (string, error) {
+	if channelConfig == "" {
+		return channelConfig, nil
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal([]byte(channelConfig), &fields); err != nil {
+		return "", errors.Wrap(err, "unmarshal channel config")
+	}
+	changed := false
+	for _, name := range channelConfigSecrets {
+		value, ok := fields[name].(string)
+		if !ok || value == "" {
+			continue
+		}
+		newValue, err := fn(value)
+		if err != nil {
+			return "", errors.Wrapf(err, "channel config %s", name)
+		}
+		if newValue != value {
+			fields[name] = newValue
+			changed = true
+		}
+	}
+	if !changed {
+		return channelConfig, nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal channel config")
+	}
+	return string(data), nil
+}
+
+// encryptSecrets encrypts the key and the secret config fields of the channel before it's saved
+func (channel *Channel) encryptSecrets() (err error) {
+	if !secret.Enabled() {
+		return nil
+	}
+	if channel.Key, err = secret.Encrypt(channel.Key); err != nil {
+		return errors.Wrap(err, "encrypt channel key")
+	}
+	if channel.Config, err = transformChannelConfig(channel.Config, secret.Encrypt); err != nil {
+		return errors.Wrap(err, "encrypt channel config")
+	}
+	return nil
+}
+
+// DecryptedKey returns the key of the channel in plaintext, it should only be called right before
+// the key is sent to the upstream.
+func (channel *Channel) DecryptedKey() (string, error) {
+	key, err := secret.Decrypt(channel.Key)
+	if err != nil {
+		return "", errors.Wrapf(err, "decrypt key of channel %d", channel.Id)
+	}
+	return key, nil
+}
+
+// DecryptSecrets decrypts the secret fields of the config in place
+func (cfg *ChannelConfig) DecryptSecrets() (err error) {
+	if cfg.SK, err = secret.Decrypt(cfg.SK); err != nil {
+		return errors.Wrap(err, "decrypt sk")
+	}
+	if cfg.VertexAIADC, err = secret.Decrypt(cfg.VertexAIADC); err != nil {
+		return errors.Wrap(err, "decrypt vertex ai adc")
+	}
+	return nil
+}
+
+// ReencryptSecrets encrypts the channel keys, the channel config secrets, the webhook secrets,
+// the notification urls and the secret options with the current master key,
+// whether they're in plaintext or encrypted by an old master key. It returns the number of the updated rows.
+func ReencryptSecrets() (updated int, err error) {
+	if !secret.Enabled() {
+		return 0, errors.New("master key is not set")
+	}
+
+	var channels []*Channel
+	if err = DB.Select("id", "key", "config").Find(&channels).Error; err != nil {
+		return 0, errors.Wrap(err, "get channels")
+	}
+	for _, channel := range channels {
+		key, err := secret.Reencrypt(channel.Key)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt key of channel %d", channel.Id)
+		}
+		channelConfig, err := transformChannelConfig(channel.Config, secret.Reencrypt)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt config of channel %d", channel.Id)
+		}
+		if key == channel.Key && channelConfig == channel.Config {
+			continue
+		}
+		err = DB.Model(&Channel{}).Where("id = ?", channel.Id).Updates(map[string]any{
+			"key":    key,
+			"config": channelConfig,
+		}).Error
+		if err != nil {
+			return updated, errors.Wrapf(err, "update channel %d", channel.Id)
+		}
+		updated++
+	}
+
+	var webhooks []*Webhook
+	if err = DB.Select("id", "secret").Find(&webhooks).Error; err != nil {
+		return updated, errors.Wrap(err, "get webhooks")
+	}
+	for _, webhook := range webhooks {
+		if !secret.NeedsReencrypt(webhook.Secret) {
+			continue
+		}
+		webhookSecret, err := secret.Reencrypt(webhook.Secret)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt secret of webhook %d", webhook.Id)
+		}
+		if err = DB.Model(&Webhook{}).Where("id = ?", webhook.Id).Update("secret", webhookSecret).Error; err != nil {
+			return updated, errors.Wrapf(err, "update webhook %d", webhook.Id)
+		}
+		updated++
+	}
+
+	var prefs []*NotificationPreference
+	if err = DB.Select("user_id", "webhook_url", "incoming_webhook_url").Find(&prefs).Error; err != nil {
+		return updated, errors.Wrap(err, "get notification preferences")
+	}
+	for _, pref := range prefs {
+		if !secret.NeedsReencrypt(pref.WebhookURL) && !secret.NeedsReencrypt(pref.IncomingWebhookURL) {
+			continue
+		}
+		webhookURL, err := secret.Reencrypt(pref.WebhookURL)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt webhook url of user %d", pref.UserId)
+		}
+		incomingWebhookURL, err := secret.Reencrypt(pref.IncomingWebhookURL)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt incoming webhook url of user %d", pref.UserId)
+		}
+		err = DB.Model(&NotificationPreference{}).Where("user_id = ?", pref.UserId).Updates(map[string]any{
+			"webhook_url":          webhookURL,
+			"incoming_webhook_url": incomingWebhookURL,
+		}).Error
+		if err != nil {
+			return updated, errors.Wrapf(err, "update notification preference of user %d", pref.UserId)
+		}
+		updated++
+	}
+
+	options, err := AllOption()
+	if err != nil {
+		return updated, errors.Wrap(err, "get options")
+	}
+	for _, option := range options {
+		if !IsSecretOption(option.Key) || !secret.NeedsReencrypt(option.Value) {
+			continue
+		}
+		value, err := secret.Reencrypt(option.Value)
+		if err != nil {
+			return updated, errors.Wrapf(err, "re-encrypt option %s", option.Key)
+		}
+		if err = DB.Model(&Option{}).Where(&Option{Key: option.Key}).Update("value", value).Error; err != nil {
+			return updated, errors.Wrapf(err, "update option %s", option.Key)
+		}
+		updated++
+	}
+
+	logger.SysLogf("re-encrypted %d secrets", updated)
+	return updated, nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+func TestChannelSecretsEncryption(t *testing.T) {
+	setupTestDB(t, &Channel{}, &Ability{}, &Option{}, &Webhook{}, &NotificationPreference{})
+	optionMap := config.OptionMap
+	t.Cleanup(func() {
+		config.OptionMap = optionMap
+		_ = secret.SetMasterKeys("")
+	})
+	config.OptionMap = make(map[string]string)
+	require.NoError(t, secret.SetMasterKeys("master-key-1"))
+
+	channel := &Channel{Name: "openai", Key: "sk-channel", Models: "gpt-4o", Group: "default",
+		Config: `{"region":"us-east-1","sk":"aws-secret"}`}
+	require.NoError(t, channel.Insert())
+
+	saved, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.True(t, secret.IsEncrypted(saved.Key))
+	assert.NotContains(t, saved.Config, "aws-secret")
+	key, err := saved.DecryptedKey()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-channel", key)
+	cfg, err := saved.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", cfg.Region)
+	require.NoError(t, cfg.DecryptSecrets())
+	assert.Equal(t, "aws-secret", cfg.SK)
+
+	require.NoError(t, UpdateOption("SMTPToken", "smtp-password"))
+	assert.Equal(t, "smtp-password", config.OptionMap["SMTPToken"])
+	var option Option
+	require.NoError(t, DB.First(&option, "key = ?", "SMTPToken").Error)
+	assert.True(t, secret.IsEncrypted(option.Value))
+	require.NoError(t, UpdateOption("TurnstileSecretKey", "turnstile-secret"))
+	var turnstileOption Option
+	require.NoError(t, DB.First(&turnstileOption, "key = ?", "TurnstileSecretKey").Error)
+	assert.True(t, secret.IsEncrypted(turnstileOption.Value))
+	assert.False(t, IsSecretOption("OidcTokenEndpoint"))
+
+	webhook := &Webhook{URL: "https://example.com/hook", Secret: "whsec_test", Status: WebhookStatusEnabled}
+	require.NoError(t, webhook.Insert())
+
+	// rows saved before the encryption was enabled are in plaintext
+	require.NoError(t, DB.Create(&Channel{Name: "legacy", Key: "sk-legacy"}).Error)
+
+	require.NoError(t, secret.SetMasterKeys("master-key-2", "master-key-1"))
+	updated, err := ReencryptSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 5, updated)
+
+	require.NoError(t, secret.SetMasterKeys("master-key-2"))
+	var channels []*Channel
+	require.NoError(t, DB.Order("id").Find(&channels).Error)
+	require.Len(t, channels, 2)
+	for i, want := range []string{"sk-channel", "sk-legacy"} {
+		key, err := channels[i].DecryptedKey()
+		require.NoError(t, err)
+		assert.Equal(t, want, key)
+	}
+	require.NoError(t, DB.First(&option, "key = ?", "SMTPToken").Error)
+	value, err := secret.Decrypt(option.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "smtp-password", value)
+	require.NoError(t, DB.First(webhook, "id = ?", webhook.Id).Error)
+	value, err = secret.Decrypt(webhook.Secret)
+	require.NoError(t, err)
+	assert.Equal(t, "whsec_test", value)
+}
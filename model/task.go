@@ -0,0 +1,260 @@
+package model
+
+import (
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// TaskTypeVideo is the task created by the video api
+const TaskTypeVideo = "video"
+
+// the statuses are the same as the video object of OpenAI,
+// https://platform.openai.com/docs/api-reference/videos/object
+const (
+	TaskStatusQueued     = "queued"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusCompleted  = "completed"
+	TaskStatusFailed     = "failed"
+)
+
+// TaskActiveStatuses are the statuses of the tasks that are still running on the upstream
+var TaskActiveStatuses = []string{
+	TaskStatusQueued,
+	TaskStatusInProgress,
+}
+
+// taskPollMaxBackoffShift caps the backoff of the failing task to 2^6 poll intervals
+const taskPollMaxBackoffShift = 6
+
+type TaskError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Task is an asynchronous job created on the upstream channel, such as a video generation.
+//
+// The task is pinned to the channel and the key that created it, since the upstream task
+// could only be fetched from the same account. The cost is decided and pre-consumed when the task
+// is created, it is settled once the task is completed, and refunded if the task is failed.
+// All the state is saved in the database, so the tasks are still polled and refunded after restarts.
+type Task struct {
+	Id             string     `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Object         string     `json:"object" gorm:"-"`
+	Type           string     `json:"type" gorm:"type:varchar(32);index"`
+	UserId         int        `json:"-" gorm:"index"`
+	TokenId        int        `json:"-"`
+	TokenName      string     `json:"-"`
+	ChannelId      int        `json:"-"`
+	ChannelKeyId   int        `json:"-"`
+	Model          string     `json:"model"`
+	UpstreamModel  string     `json:"-"`
+	UpstreamTaskId string     `json:"-" gorm:"type:varchar(512)"`
+	Status         string     `json:"status" gorm:"type:varchar(32);index"`
+	Progress       int        `json:"progress"`
+	Seconds        int        `json:"seconds"`
+	Size           string     `json:"size,omitempty"`
+	Error          *TaskError `json:"error,omitempty" gorm:"serializer:json;type:text"`
+	// PromptTokens and CompletionTokens are the tokens billed with the ratios below
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	ModelRatio       float64 `json:"-"`
+	CompletionRatio  float64 `json:"-"`
+	GroupRatio       float64 `json:"-"`
+	Quota            int64   `json:"quota" gorm:"bigint"`
+	// PreConsumedQuota is consumed when the task is created, and refunded if the task is failed
+	PreConsumedQuota int64 `json:"-" gorm:"bigint"`
+	// OrganizationId is the organization owns the token, the refund goes to its pool even if the token is deleted
+	OrganizationId int `json:"-"`
+	// RefundPending is true while the pre-consumed quota of the failed task is not refunded yet
+	RefundPending bool `json:"-" gorm:"index"`
+	// NextPollAt is when the task is polled next, and PollFailures is the number of the consecutive failed polls
+	NextPollAt   int64 `json:"-" gorm:"bigint;index"`
+	PollFailures int   `json:"-"`
+	CreatedAt    int64 `json:"created_at" gorm:"bigint;autoCreateTime:false"`
+	CompletedAt  int64 `json:"completed_at,omitempty" gorm:"bigint"`
+	FailedAt     int64 `json:"failed_at,omitempty" gorm:"bigint"`
+}
+
+// NewTask creates a task of taskType owned by userId, the id is prefixed by the type
+func NewTask(taskType string, userId int) *Task {
+	now := helper.GetTimestamp()
+	return &Task{
+		Id:         taskType + "_" + random.GetUUID(),
+		Object:     "task",
+		Type:       taskType,
+		UserId:     userId,
+		Status:     TaskStatusQueued,
+		NextPollAt: now,
+		CreatedAt:  now,
+	}
+}
+
+func (task *Task) AfterFind(tx *gorm.DB) error {
+	task.Object = "task"
+	return nil
+}
+
+func (task *Task) Insert() error {
+	return errors.Wrap(DB.Create(task).Error, "insert task")
+}
+
+// UpdateFields saves the columns of the task,
+// the status should be changed by TransitStatus instead.
+func (task *Task) UpdateFields(columns ...string) error {
+	err := DB.Model(task).Select(columns).Updates(task).Error
+	return errors.Wrapf(err, "update %v of task %s", columns, task.Id)
+}
+
+// TransitStatus changes the status of the task to `to` only if the current status is one of `from`,
+// it returns false if the status is not changed.
+//
+// The task could be synced by concurrent requests, the task is only billed
+// by the one that transits it to the completed status. The failed task is marked
+// refund pending in the same update, so the refund is never lost.
+func (task *Task) TransitStatus(to string, from ...string) (bool, error) {
+	now := helper.GetTimestamp()
+	fields := map[string]any{"status": to}
+	switch to {
+	case TaskStatusCompleted:
+		fields["completed_at"] = now
+		fields["progress"] = 100
+	case TaskStatusFailed:
+		fields["failed_at"] = now
+		fields["refund_pending"] = task.PreConsumedQuota > 0
+	}
+
+	result := DB.Model(&Task{}).Where("id = ? AND status IN ?", task.Id, from).Updates(fields)
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "change status of task %s to %s", task.Id, to)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	task.Status = to
+	switch to {
+	case TaskStatusCompleted:
+		task.CompletedAt = now
+		task.Progress = 100
+	case TaskStatusFailed:
+		task.FailedAt = now
+		task.RefundPending = task.PreConsumedQuota > 0
+	}
+	return true, nil
+}
+
+// ScheduleNextPoll sets when the active task is polled next. The task is polled in the next round
+// after a successful poll, and backed off exponentially after the consecutive failed polls.
+func (task *Task) ScheduleNextPoll(failed bool) error {
+	var delay int64
+	if failed {
+		task.PollFailures++
+		delay = int64(config.TaskPollInterval) << min(task.PollFailures, taskPollMaxBackoffShift)
+	} else {
+		task.PollFailures = 0
+	}
+	task.NextPollAt = helper.GetTimestamp() + delay
+	return task.UpdateFields("next_poll_at", "poll_failures")
+}
+
+// RefundTask refunds the pre-consumed quota of the failed task to the token, and to the user or the organization.
+// The refund is marked done in the same transaction, so the quota is refunded exactly once,
+// and it still goes back to the user or the organization if the token has been deleted.
+func RefundTask(task *Task) error {
+	var token *Token
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Task{}).Where("id = ? AND refund_pending = ?", task.Id, true).Update("refund_pending", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		quota := task.PreConsumedQuota
+		organizationId := task.OrganizationId
+		found := new(Token)
+		err := tx.First(found, "id = ?", task.TokenId).Error
+		switch {
+		case err == nil:
+			token = found
+			organizationId = token.OrganizationId
+			if !token.UnlimitedQuota {
+				err = tx.Model(&Token{}).Where("id = ?", token.Id).Updates(map[string]any{
+					"remain_quota": gorm.Expr("remain_quota + ?", quota),
+					"used_quota":   gorm.Expr("used_quota - ?", quota),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if organizationId == 0 {
+			return tx.Model(&User{}).Where("id = ?", task.UserId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+		}
+		err = tx.Model(&Organization{}).Where("id = ?", organizationId).Updates(map[string]any{
+			"quota":      gorm.Expr("quota + ?", quota),
+			"used_quota": gorm.Expr("used_quota - ?", quota),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", organizationId, task.UserId).
+			Update("used_quota", gorm.Expr("used_quota - ?", quota)).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "refund %d quota of task %s", task.PreConsumedQuota, task.Id)
+	}
+
+	task.RefundPending = false
+	if token != nil {
+		clearTokenCache(token.Key)
+		consumeTokenAndUserBudget(token, -task.PreConsumedQuota)
+	}
+	return nil
+}
+
+// IsActive returns true if the task is still running on the upstream
+func (task *Task) IsActive() bool {
+	return task.Status == TaskStatusQueued || task.Status == TaskStatusInProgress
+}
+
+// GetUserTaskById returns the task only if it is owned by userId,
+// the task should be of taskType unless taskType is empty.
+func GetUserTaskById(userId int, taskType string, id string) (*Task, error) {
+	if id == "" {
+		return nil, errors.New("task id is empty")
+	}
+	query := DB.Where("id = ? AND user_id = ?", id, userId)
+	if taskType != "" {
+		query = query.Where("type = ?", taskType)
+	}
+	task := &Task{}
+	if err := query.First(task).Error; err != nil {
+		return nil, errors.Wrapf(err, "get task %s", id)
+	}
+	return task, nil
+}
+
+// GetActiveTasks returns the tasks still running on the upstream that are due to be polled,
+// the least recently polled first, so the failing tasks do not starve the others.
+func GetActiveTasks(limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := DB.Where("status IN ? AND next_poll_at <= ?", TaskActiveStatuses, helper.GetTimestamp()).
+		Order("next_poll_at asc").Limit(limit).Find(&tasks).Error
+	return tasks, errors.Wrap(err, "get active tasks")
+}
+
+// GetRefundPendingTasks returns the failed tasks whose pre-consumed quota is not refunded yet
+func GetRefundPendingTasks(limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := DB.Where("refund_pending = ?", true).Limit(limit).Find(&tasks).Error
+	return tasks, errors.Wrap(err, "get refund pending tasks")
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestTaskTransitStatus(t *testing.T) {
+	setupTestDB(t, &Task{}, &User{}, &Token{}, &Organization{}, &OrganizationMember{})
+
+	task := NewTask(TaskTypeVideo, 1)
+	task.Error = &TaskError{Code: "test", Message: "test error"}
+	require.NoError(t, task.Insert())
+	assert.True(t, task.IsActive())
+
+	transited, err := task.TransitStatus(TaskStatusInProgress, TaskStatusQueued)
+	require.NoError(t, err)
+	assert.True(t, transited)
+
+	// only one of the concurrent syncs completes the task
+	stale := *task
+	transited, err = task.TransitStatus(TaskStatusCompleted, TaskActiveStatuses...)
+	require.NoError(t, err)
+	assert.True(t, transited)
+	transited, err = stale.TransitStatus(TaskStatusCompleted, TaskActiveStatuses...)
+	require.NoError(t, err)
+	assert.False(t, transited)
+
+	got, err := GetUserTaskById(1, TaskTypeVideo, task.Id)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCompleted, got.Status)
+	assert.Equal(t, 100, got.Progress)
+	assert.NotZero(t, got.CompletedAt)
+	assert.False(t, got.IsActive())
+	assert.Equal(t, &TaskError{Code: "test", Message: "test error"}, got.Error)
+}
+
+func TestGetUserTaskById(t *testing.T) {
+	setupTestDB(t, &Task{}, &User{}, &Token{}, &Organization{}, &OrganizationMember{})
+
+	task := NewTask(TaskTypeVideo, 1)
+	require.NoError(t, task.Insert())
+
+	_, err := GetUserTaskById(2, TaskTypeVideo, task.Id)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = GetUserTaskById(1, "batch", task.Id)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = GetUserTaskById(1, TaskTypeVideo, "")
+	assert.Error(t, err)
+}
+
+func TestGetActiveTasks(t *testing.T) {
+	setupTestDB(t, &Task{}, &User{}, &Token{}, &Organization{}, &OrganizationMember{})
+
+	older := NewTask(TaskTypeVideo, 1)
+	older.NextPollAt -= 10
+	require.NoError(t, older.Insert())
+	newer := NewTask(TaskTypeVideo, 2)
+	require.NoError(t, newer.Insert())
+	done := NewTask(TaskTypeVideo, 1)
+	require.NoError(t, done.Insert())
+	_, err := done.TransitStatus(TaskStatusFailed, TaskActiveStatuses...)
+	require.NoError(t, err)
+
+	tasks, err := GetActiveTasks(10)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	assert.Equal(t, older.Id, tasks[0].Id)
+	assert.Equal(t, newer.Id, tasks[1].Id)
+	assert.Equal(t, "task", tasks[0].Object)
+
+	tasks, err = GetActiveTasks(1)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	// the failing task is backed off, and the polled one goes after the others
+	require.NoError(t, older.ScheduleNextPoll(true))
+	assert.Equal(t, 1, older.PollFailures)
+	tasks, err = GetActiveTasks(10)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, newer.Id, tasks[0].Id)
+	require.NoError(t, older.ScheduleNextPoll(false))
+	assert.Zero(t, older.PollFailures)
+	require.NoError(t, newer.ScheduleNextPoll(false))
+	tasks, err = GetActiveTasks(10)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+
+	// the task of any type is returned if the type is empty
+	task, err := GetUserTaskById(1, "", done.Id)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusFailed, task.Status)
+}
+
+func TestRefundTask(t *testing.T) {
+	setupTestDB(t, &Task{}, &User{}, &Token{}, &Organization{}, &OrganizationMember{})
+	originalRedisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = originalRedisEnabled })
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "user", Quota: 100}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: "refund-test-key", RemainQuota: 50, UsedQuota: 30}).Error)
+	require.NoError(t, DB.Create(&Organization{Id: 1, Name: "org", Quota: 100, UsedQuota: 30}).Error)
+	require.NoError(t, DB.Create(&OrganizationMember{OrganizationId: 1, UserId: 1, UsedQuota: 30}).Error)
+
+	task := NewTask(TaskTypeVideo, 1)
+	task.TokenId = 1
+	task.PreConsumedQuota = 30
+	require.NoError(t, task.Insert())
+	transited, err := task.TransitStatus(TaskStatusFailed, TaskActiveStatuses...)
+	require.NoError(t, err)
+	require.True(t, transited)
+	assert.True(t, task.RefundPending)
+	pending, err := GetRefundPendingTasks(10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	// the task is refunded only once
+	require.NoError(t, RefundTask(task))
+	require.NoError(t, RefundTask(pending[0]))
+	user, err := GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(130), user.Quota)
+	token, err := GetTokenById(1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), token.RemainQuota)
+	assert.Zero(t, token.UsedQuota)
+	pending, err = GetRefundPendingTasks(10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// the quota goes back to the organization if the token has been deleted
+	orgTask := NewTask(TaskTypeVideo, 1)
+	orgTask.TokenId = 2
+	orgTask.OrganizationId = 1
+	orgTask.PreConsumedQuota = 30
+	require.NoError(t, orgTask.Insert())
+	_, err = orgTask.TransitStatus(TaskStatusFailed, TaskActiveStatuses...)
+	require.NoError(t, err)
+	require.NoError(t, RefundTask(orgTask))
+	org := new(Organization)
+	require.NoError(t, DB.First(org, 1).Error)
+	assert.Equal(t, int64(130), org.Quota)
+	assert.Zero(t, org.UsedQuota)
+	member := new(OrganizationMember)
+	require.NoError(t, DB.First(member, "organization_id = ? AND user_id = ?", 1, 1).Error)
+	assert.Zero(t, member.UsedQuota)
+	user, err = GetUserById(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(130), user.Quota)
+}
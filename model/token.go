@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Laisky/errors/v2"
@@ -10,7 +11,6 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/message"
 )
 
 const (
@@ -34,6 +34,24 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"type:text"`            // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	// ResponseCacheDisabled opts out the response cache for the requests of this token
+	ResponseCacheDisabled bool `json:"response_cache_disabled" gorm:"default:false"`
+	// ResponseCacheTTL overrides the time to live of the response cache in seconds, 0 means the default
+	ResponseCacheTTL int `json:"response_cache_ttl" gorm:"default:0"`
+	// HedgeDelay races a second channel if the first one hasn't responded in these milliseconds,
+	// 0 means the setting of the group
+	HedgeDelay int `json:"hedge_delay" gorm:"default:0"`
+	// RateLimitRPM, RateLimitTPM and MaxConcurrency limit the requests per minute,
+	// the prompt and completion tokens per minute, and the concurrent requests of this token,
+	// 0 means unlimited
+	RateLimitRPM   int `json:"rate_limit_rpm" gorm:"default:0"`
+	RateLimitTPM   int `json:"rate_limit_tpm" gorm:"default:0"`
+	MaxConcurrency int `json:"max_concurrency" gorm:"default:0"`
+	// Budget is the recurring budget of this token besides RemainQuota
+	Budget
+	// OrganizationId is the organization owns this token, its requests are charged to the pool
+	// of the organization instead of the user created it, 0 means the token is owned by the user
+	OrganizationId int `json:"organization_id" gorm:"index;default:0"`
 }
 
 func clearTokenCache(key string) {
@@ -95,6 +113,12 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			err := token.SelectUpdate()
 			if err != nil {
 				logger.SysError("failed to update token status" + err.Error())
+			} else {
+				go EmitWebhookEvent(context.Background(), WebhookEventTokenExpired, token.UserId, map[string]any{
+					"token_id":     token.Id,
+					"token_name":   token.Name,
+					"expired_time": token.ExpiredTime,
+				})
 			}
 		} else {
 			// If Redis is enabled, the cache will be updated by the next fetch
@@ -155,7 +179,10 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet",
+		"response_cache_disabled", "response_cache_ttl", "hedge_delay",
+		"rate_limit_rpm", "rate_limit_tpm", "max_concurrency",
+		"budget_quota", "budget_period", "budget_rollover").Updates(t).Error
 	if err == nil {
 		clearTokenCache(t.Key)
 	}
@@ -282,6 +309,9 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return errors.New("Insufficient token quota")
 	}
+	if token.OrganizationId != 0 {
+		return preConsumeOrganizationTokenQuota(token, quota)
+	}
 	userQuota, err := GetUserQuota(token.UserId)
 	if err != nil {
 		return err
@@ -293,22 +323,30 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	noMoreQuota := userQuota-quota <= 0
 	if quotaTooLow || noMoreQuota {
 		go func() {
-			email, err := GetUserEmail(token.UserId)
+			ctx := context.Background()
+			EmitWebhookEvent(ctx, WebhookEventQuotaLow, token.UserId, map[string]any{
+				"quota":     userQuota - quota,
+				"threshold": config.QuotaRemindThreshold,
+				"exhausted": noMoreQuota,
+			})
+			pref, err := GetNotificationPreference(token.UserId)
 			if err != nil {
-				logger.SysError("failed to fetch user email: " + err.Error())
+				logger.SysError("failed to get notification preference: " + err.Error())
+				return
+			}
+			// the users with their own threshold are warned by CheckNotifications, except for the exhaustion
+			if pref.QuotaThreshold < 0 || (pref.QuotaThreshold > 0 && !noMoreQuota) {
+				return
 			}
-			prompt := "Quota Reminder"
-			var contentText string
+			contentText := "Your quota is about to be exhausted"
 			if noMoreQuota {
 				contentText = "Your quota has been exhausted"
-			} else {
-				contentText = "Your quota is about to be exhausted"
 			}
-			if email != "" {
-				topUpLink := fmt.Sprintf("%s/topup", config.ServerAddress)
-				content := message.EmailTemplate(
-					prompt,
-					fmt.Sprintf(`
+			topUpLink := fmt.Sprintf("%s/topup", config.ServerAddress)
+			content := fmt.Sprintf("%s, your current remaining quota is %d.\n"+
+				"To avoid any disruption to your service, please top up in a timely manner: %s",
+				contentText, userQuota, topUpLink)
+			emailContent := fmt.Sprintf(`
 								<p>Hello!</p>
 								<p>%s, your current remaining quota is <strong>%d</strong>.</p>
 								<p>To avoid any disruption to your service, please top up in a timely manner.</p>
@@ -317,12 +355,10 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 								</p>
 								<p style="color: #666;">If the button does not work, please copy the following link and paste it into your browser:</p>
 								<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px; word-break: break-all;">%s</p>
-							`, contentText, userQuota, topUpLink, topUpLink),
-				)
-				err = message.SendEmail(prompt, email, content)
-				if err != nil {
-					logger.SysError("failed to send email: " + err.Error())
-				}
+							`, contentText, userQuota, topUpLink, topUpLink)
+			err = notifyUser(ctx, token.UserId, NotificationEventQuotaLow, "Quota Reminder", content, emailContent, "")
+			if err != nil {
+				logger.SysError("failed to send quota reminder: " + err.Error())
 			}
 		}()
 	}
@@ -331,9 +367,14 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 		if err != nil {
 			return err
 		}
+		emitTokenExhausted(token, quota)
 	}
 	err = DecreaseUserQuota(token.UserId, quota)
-	return err
+	if err != nil {
+		return err
+	}
+	consumeTokenAndUserBudget(token, quota)
+	return nil
 }
 
 func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
@@ -341,7 +382,9 @@ func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if err != nil {
 		return err
 	}
-	if quota > 0 {
+	if token.OrganizationId != 0 {
+		err = consumeOrganizationQuota(token.OrganizationId, token.UserId, quota, false)
+	} else if quota > 0 {
 		err = DecreaseUserQuota(token.UserId, quota)
 	} else {
 		err = IncreaseUserQuota(token.UserId, -quota)
@@ -349,6 +392,7 @@ func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if !token.UnlimitedQuota {
 		if quota > 0 {
 			err = DecreaseTokenQuota(tokenId, quota)
+			emitTokenExhausted(token, quota)
 		} else {
 			err = IncreaseTokenQuota(tokenId, -quota)
 		}
@@ -356,5 +400,33 @@ func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 			return err
 		}
 	}
+	consumeTokenAndUserBudget(token, quota)
+	return nil
+}
+
+// emitTokenExhausted emits the token.exhausted event if the quota uses up the remaining quota of the token
+func emitTokenExhausted(token *Token, quota int64) {
+	if token.RemainQuota <= 0 || token.RemainQuota > quota {
+		return
+	}
+	go EmitWebhookEvent(context.Background(), WebhookEventTokenExhausted, token.UserId, map[string]any{
+		"token_id":   token.Id,
+		"token_name": token.Name,
+	})
+}
+
+// preConsumeOrganizationTokenQuota pre-consumes the quota of a token owned by an organization from its pool
+func preConsumeOrganizationTokenQuota(token *Token, quota int64) error {
+	// the pool and the spending cap are checked and charged atomically, so the concurrent requests could not overdraw them
+	if err := consumeOrganizationQuota(token.OrganizationId, token.UserId, quota, true); err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota {
+		if err := DecreaseTokenQuota(token.Id, quota); err != nil {
+			return err
+		}
+		emitTokenExhausted(token, quota)
+	}
+	consumeTokenAndUserBudget(token, quota)
 	return nil
 }
@@ -52,6 +52,10 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	// RoleName is the role granting the management permissions, it's updated by SetUserRole
+	RoleName string `json:"role_name" gorm:"type:varchar(32);default:'';index"`
+	// Budget is the recurring budget of this user besides Quota, it's updated by UpdateUserBudget
+	Budget
 }
 
 func GetMaxUserId() int {
@@ -129,10 +133,16 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 	user.Quota = config.QuotaForNewUser
 	user.AccessToken = random.GetUUID()
 	user.AffCode = random.GetRandomString(4)
+	user.RoleName = RolePresetName(user.Role)
 	result := DB.Create(user)
 	if result.Error != nil {
 		return result.Error
 	}
+	go EmitWebhookEvent(context.WithoutCancel(ctx), WebhookEventUserRegistered, 0, map[string]any{
+		"user_id":    user.Id,
+		"username":   user.Username,
+		"inviter_id": inviterId,
+	})
 	if config.QuotaForNewUser > 0 {
 		RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("New user registration gift %s", common.LogQuota(config.QuotaForNewUser)))
 	}
@@ -178,7 +188,8 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Updates(user).Error
+	err = DB.Model(user).Omit(append(budgetColumns, "role_name")...).Updates(user).Error
+	invalidateUserPermissions(user.Id)
 	return err
 }
 
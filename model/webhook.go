@@ -0,0 +1,305 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gutils "github.com/Laisky/go-utils/v5"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/secret"
+)
+
+// The events delivered to the webhooks
+const (
+	WebhookEventChannelDisabled       = "channel.disabled"
+	WebhookEventChannelEnabled        = "channel.enabled"
+	WebhookEventChannelBalanceUpdated = "channel.balance_updated"
+	WebhookEventQuotaLow              = "quota.low"
+	WebhookEventTokenExhausted        = "token.exhausted"
+	WebhookEventTokenExpired          = "token.expired"
+	WebhookEventUserRegistered        = "user.registered"
+	WebhookEventRedemptionUsed        = "redemption.used"
+	// WebhookEventTest is only sent by the test API
+	WebhookEventTest = "webhook.test"
+)
+
+// AllWebhookEvents lists the events could be subscribed by the global webhooks
+var AllWebhookEvents = []string{
+	WebhookEventChannelDisabled,
+	WebhookEventChannelEnabled,
+	WebhookEventChannelBalanceUpdated,
+	WebhookEventQuotaLow,
+	WebhookEventTokenExhausted,
+	WebhookEventTokenExpired,
+	WebhookEventUserRegistered,
+	WebhookEventRedemptionUsed,
+}
+
+// UserWebhookEvents lists the events of a user, which could be subscribed by the webhooks of the user
+var UserWebhookEvents = []string{
+	WebhookEventQuotaLow,
+	WebhookEventTokenExhausted,
+	WebhookEventTokenExpired,
+	WebhookEventRedemptionUsed,
+}
+
+const (
+	WebhookStatusEnabled  = 1
+	WebhookStatusDisabled = 2
+)
+
+// webhookRetryInterval is the interval before the first retry, it's doubled on each retry
+var webhookRetryInterval = time.Second
+
+// Webhook receives the events signed by its secret
+type Webhook struct {
+	Id int `json:"id"`
+	// UserId is the owner of the webhook, 0 means a global webhook receiving the events of all users
+	UserId int    `json:"user_id" gorm:"index"`
+	Name   string `json:"name" gorm:"type:varchar(64)"`
+	URL    string `json:"url" gorm:"column:url;type:text"`
+	// Secret signs the events, it's encrypted at rest and only returned on creation
+	Secret string `json:"secret,omitempty" gorm:"type:text"`
+	// Events is separated by comma, empty means all the events could be subscribed
+	Events      string `json:"events" gorm:"type:text"`
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// WebhookDelivery is the delivery log of an event to a webhook
+type WebhookDelivery struct {
+	Id          int    `json:"id"`
+	WebhookId   int    `json:"webhook_id" gorm:"index"`
+	EventId     string `json:"event_id" gorm:"type:varchar(64)"`
+	Event       string `json:"event" gorm:"type:varchar(64)"`
+	Payload     string `json:"payload" gorm:"type:text"`
+	Success     bool   `json:"success"`
+	StatusCode  int    `json:"status_code"`
+	Attempts    int    `json:"attempts"`
+	Error       string `json:"error" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// WebhookEvent is the body posted to the webhooks
+type WebhookEvent struct {
+	Id        string `json:"id"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"created_at"`
+	// UserId is the user the event is about, 0 for the system events
+	UserId int `json:"user_id,omitempty"`
+	Data   any `json:"data"`
+}
+
+// ValidateWebhook checks the url and the events of the webhook, the events are normalized
+func (webhook *Webhook) ValidateWebhook() error {
+	if len(webhook.Name) > 64 {
+		return errors.New("webhook name is too long")
+	}
+	if err := client.ValidatePublicURL(webhook.URL); err != nil {
+		return errors.Wrap(err, "invalid webhook url")
+	}
+	if webhook.Status != WebhookStatusEnabled && webhook.Status != WebhookStatusDisabled {
+		return errors.Errorf("invalid webhook status %d", webhook.Status)
+	}
+
+	allowed := AllWebhookEvents
+	if webhook.UserId != 0 {
+		allowed = UserWebhookEvents
+	}
+	var events []string
+	for _, event := range strings.Split(webhook.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" || slices.Contains(events, event) {
+			continue
+		}
+		if !slices.Contains(allowed, event) {
+			return errors.Errorf("unknown or not allowed webhook event %q", event)
+		}
+		events = append(events, event)
+	}
+	webhook.Events = strings.Join(events, ",")
+	return nil
+}
+
+// Subscribes returns true if the webhook receives the event
+func (webhook *Webhook) Subscribes(event string) bool {
+	if event == WebhookEventTest {
+		return true
+	}
+	if webhook.Events == "" {
+		return webhook.UserId == 0 || slices.Contains(UserWebhookEvents, event)
+	}
+	return slices.Contains(strings.Split(webhook.Events, ","), event)
+}
+
+// Insert creates the webhook with a random secret if it's not set, the secret is kept in plaintext on the webhook
+func (webhook *Webhook) Insert() error {
+	if webhook.Secret == "" {
+		webhook.Secret = "whsec_" + random.GetRandomString(32)
+	}
+	plaintext := webhook.Secret
+	encrypted, err := secret.Encrypt(plaintext)
+	if err != nil {
+		return errors.Wrap(err, "encrypt webhook secret")
+	}
+	webhook.Secret = encrypted
+	webhook.CreatedTime = helper.GetTimestamp()
+	if err = DB.Create(webhook).Error; err != nil {
+		return errors.Wrap(err, "create webhook")
+	}
+	webhook.Secret = plaintext
+	return nil
+}
+
+// Update updates the name, the url, the events and the status of the webhook
+func (webhook *Webhook) Update() error {
+	return DB.Model(webhook).Select("name", "url", "events", "status").Updates(webhook).Error
+}
+
+// GetWebhooks returns the webhooks of the user, userId 0 means the global webhooks
+func GetWebhooks(userId int) ([]*Webhook, error) {
+	var webhooks []*Webhook
+	err := DB.Omit("secret").Where("user_id = ?", userId).Order("id desc").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetWebhookById returns the webhook of the user, userId 0 means the global webhooks
+func GetWebhookById(id int, userId int) (*Webhook, error) {
+	webhook := new(Webhook)
+	err := DB.Omit("secret").Where("id = ? AND user_id = ?", id, userId).First(webhook).Error
+	return webhook, err
+}
+
+// DeleteWebhook deletes the webhook of the user and its delivery logs
+func DeleteWebhook(id int, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Delete(&Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("webhook %d not found", id)
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+}
+
+// GetWebhookDeliveries returns the delivery logs of the webhook, the latest first
+func GetWebhookDeliveries(webhookId int, startIdx int, num int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := DB.Where("webhook_id = ?", webhookId).Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func newWebhookEvent(event string, userId int, data any) *WebhookEvent {
+	return &WebhookEvent{
+		Id:        gutils.UUID7(),
+		Event:     event,
+		CreatedAt: helper.GetTimestamp(),
+		UserId:    userId,
+		Data:      data,
+	}
+}
+
+// EmitWebhookEvent delivers the event in background to the global webhooks,
+// and to the webhooks of the user if userId is not 0.
+func EmitWebhookEvent(ctx context.Context, event string, userId int, data any) {
+	db := DB
+	if db == nil {
+		return
+	}
+	var webhooks []*Webhook
+	err := db.Where("status = ? AND (user_id = 0 OR user_id = ?)", WebhookStatusEnabled, userId).Find(&webhooks).Error
+	if err != nil {
+		logger.Errorf(ctx, "failed to get webhooks of event %s: %+v", event, err)
+		return
+	}
+
+	evt := newWebhookEvent(event, userId, data)
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		go func(webhook *Webhook) {
+			if _, err := deliverWebhookEvent(context.WithoutCancel(ctx), db, webhook, evt); err != nil {
+				logger.Errorf(ctx, "failed to deliver event %s to webhook %d: %+v", event, webhook.Id, err)
+			}
+		}(webhook)
+	}
+}
+
+// SendTestWebhookEvent delivers a test event to the webhook and waits for the result
+func SendTestWebhookEvent(ctx context.Context, webhookId int) (*WebhookDelivery, error) {
+	webhook := new(Webhook)
+	if err := DB.First(webhook, "id = ?", webhookId).Error; err != nil {
+		return nil, errors.Wrapf(err, "get webhook %d", webhookId)
+	}
+	evt := newWebhookEvent(WebhookEventTest, webhook.UserId, map[string]any{"webhook_id": webhook.Id})
+	return deliverWebhookEvent(ctx, DB, webhook, evt)
+}
+
+// deliverWebhookEvent posts the event to the webhook, retries with an exponential backoff on failure,
+// and records the delivery log.
+func deliverWebhookEvent(ctx context.Context, db *gorm.DB, webhook *Webhook, evt *WebhookEvent) (*WebhookDelivery, error) {
+	body, err := json.Marshal(evt)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal webhook event")
+	}
+	webhookSecret, err := secret.Decrypt(webhook.Secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt webhook secret")
+	}
+	delivery := &WebhookDelivery{
+		WebhookId:   webhook.Id,
+		EventId:     evt.Id,
+		Event:       evt.Event,
+		Payload:     string(body),
+		CreatedTime: helper.GetTimestamp(),
+	}
+	if err = db.Create(delivery).Error; err != nil {
+		return nil, errors.Wrap(err, "create webhook delivery")
+	}
+
+	interval := webhookRetryInterval
+	var sendErr error
+retry:
+	for {
+		delivery.Attempts++
+		delivery.StatusCode, sendErr = message.SendWebhook(ctx, webhook.URL, webhookSecret, evt.Event,
+			strconv.Itoa(delivery.Id), time.Now().Unix(), body)
+		if sendErr == nil || delivery.Attempts > config.WebhookMaxRetries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break retry
+		case <-time.After(interval):
+			interval *= 2
+		}
+	}
+
+	delivery.Success = sendErr == nil
+	delivery.Error = ""
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+	delivery.UpdatedTime = helper.GetTimestamp()
+	err = db.Model(delivery).Select("success", "status_code", "attempts", "error", "updated_time").Updates(delivery).Error
+	if err != nil {
+		return delivery, errors.Wrap(err, "update webhook delivery")
+	}
+	return delivery, nil
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/message"
+)
+
+func setupWebhookTestDB(t *testing.T) {
+	setupTestDB(t, &Webhook{}, &WebhookDelivery{})
+	retryInterval, allowPrivate := webhookRetryInterval, config.WebhookAllowPrivateNetwork
+	// the test servers listen on the loopback address
+	webhookRetryInterval, config.WebhookAllowPrivateNetwork = time.Millisecond, true
+	t.Cleanup(func() { webhookRetryInterval, config.WebhookAllowPrivateNetwork = retryInterval, allowPrivate })
+}
+
+func TestValidateWebhook(t *testing.T) {
+	webhook := &Webhook{URL: "https://example.com/hook", Status: WebhookStatusEnabled,
+		Events: " quota.low ,channel.disabled,quota.low"}
+	require.NoError(t, webhook.ValidateWebhook())
+	assert.Equal(t, "quota.low,channel.disabled", webhook.Events)
+	assert.True(t, webhook.Subscribes(WebhookEventQuotaLow))
+	assert.False(t, webhook.Subscribes(WebhookEventUserRegistered))
+
+	// the users could only subscribe their own events
+	webhook.UserId = 1
+	assert.Error(t, webhook.ValidateWebhook())
+	webhook.Events = ""
+	require.NoError(t, webhook.ValidateWebhook())
+	assert.True(t, webhook.Subscribes(WebhookEventTokenExpired))
+	assert.False(t, webhook.Subscribes(WebhookEventChannelDisabled))
+
+	webhook.URL = "ftp://example.com"
+	assert.Error(t, webhook.ValidateWebhook())
+	for _, internal := range []string{"http://127.0.0.1:8080", "http://localhost/hook", "http://169.254.169.254/latest",
+		"http://10.0.0.1", "http://[::1]:3000", "http://[::ffff:192.168.1.1]"} {
+		webhook.URL = internal
+		assert.ErrorIs(t, webhook.ValidateWebhook(), client.ErrPrivateAddress, internal)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	setupWebhookTestDB(t)
+
+	var requests atomic.Int32
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(message.WebhookHeaderTimestamp), 10, 64)
+		assert.Equal(t, message.SignWebhook("whsec_test", timestamp, body), r.Header.Get(message.WebhookHeaderSignature))
+		// the first attempt fails to test the retry
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		received <- request{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	global := &Webhook{Name: "global", URL: server.URL, Secret: "whsec_test", Status: WebhookStatusEnabled,
+		Events: WebhookEventQuotaLow}
+	own := &Webhook{UserId: 1, URL: server.URL, Secret: "whsec_test", Status: WebhookStatusEnabled}
+	other := &Webhook{UserId: 2, URL: server.URL, Secret: "whsec_test", Status: WebhookStatusEnabled}
+	for _, webhook := range []*Webhook{global, own, other} {
+		require.NoError(t, webhook.Insert())
+		assert.Equal(t, "whsec_test", webhook.Secret)
+	}
+
+	EmitWebhookEvent(context.Background(), WebhookEventQuotaLow, 1, map[string]any{"quota": 100})
+	deliveredTo := make(map[string]bool)
+	for range 2 {
+		select {
+		case r := <-received:
+			assert.Equal(t, WebhookEventQuotaLow, r.header.Get(message.WebhookHeaderEvent))
+			var evt WebhookEvent
+			require.NoError(t, json.Unmarshal(r.body, &evt))
+			assert.Equal(t, 1, evt.UserId)
+			deliveredTo[r.header.Get(message.WebhookHeaderDelivery)] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook event is not delivered")
+		}
+	}
+	assert.Len(t, deliveredTo, 2)
+
+	require.Eventually(t, func() bool {
+		var count int64
+		DB.Model(&WebhookDelivery{}).Where("success = ?", true).Count(&count)
+		return count == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	var deliveries []*WebhookDelivery
+	require.NoError(t, DB.Order("id").Find(&deliveries).Error)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, 3, deliveries[0].Attempts+deliveries[1].Attempts)
+	for _, delivery := range deliveries {
+		assert.NotEqual(t, other.Id, delivery.WebhookId)
+		assert.Equal(t, http.StatusOK, delivery.StatusCode)
+	}
+
+	delivery, err := SendTestWebhookEvent(context.Background(), other.Id)
+	require.NoError(t, err)
+	assert.True(t, delivery.Success)
+	assert.Equal(t, WebhookEventTest, delivery.Event)
+}
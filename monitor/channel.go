@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/songquanpeng/one-api/common/config"
@@ -30,6 +31,11 @@ func notifyRootUser(subject string, content string) {
 // DisableChannel disable & notify
 func DisableChannel(channelId int, channelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
+	go model.EmitWebhookEvent(context.Background(), model.WebhookEventChannelDisabled, 0, map[string]any{
+		"channel_id":   channelId,
+		"channel_name": channelName,
+		"reason":       reason,
+	})
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled: %s", channelId, reason))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -46,6 +52,10 @@ func DisableChannel(channelId int, channelName string, reason string) {
 
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
+	go model.EmitWebhookEvent(context.Background(), model.WebhookEventChannelDisabled, 0, map[string]any{
+		"channel_id":   channelId,
+		"success_rate": successRate,
+	})
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -63,6 +73,10 @@ func MetricDisableChannel(channelId int, successRate float64) {
 // EnableChannel enable & notify
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusEnabled)
+	go model.EmitWebhookEvent(context.Background(), model.WebhookEventChannelEnabled, 0, map[string]any{
+		"channel_id":   channelId,
+		"channel_name": channelName,
+	})
 	logger.SysLog(fmt.Sprintf("channel #%d has been enabled", channelId))
 	subject := fmt.Sprintf("Channel Status Change Reminder")
 	content := message.EmailTemplate(
@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/balancer"
 )
 
 var store = make(map[int][]bool)
@@ -66,6 +67,8 @@ func init() {
 }
 
 func Emit(channelId int, success bool) {
+	// the success rate is always recorded for the load balancing
+	balancer.RecordResult(channelId, success)
 	if !config.EnableMetric {
 		return
 	}
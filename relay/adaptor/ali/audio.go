@@ -0,0 +1,135 @@
+package ali
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// ttsVoices are the voices of the qwen-tts models, the OpenAI voices fall back to defaultTTSVoice
+var ttsVoices = []string{"Cherry", "Serena", "Ethan", "Chelsie", "Dylan", "Jada", "Sunny"}
+
+const defaultTTSVoice = "Cherry"
+
+// TextToSpeechRequest is the speech synthesis request of the qwen-tts models,
+// https://help.aliyun.com/zh/model-studio/qwen-tts
+type TextToSpeechRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Text  string `json:"text"`
+		Voice string `json:"voice"`
+	} `json:"input"`
+}
+
+// TextToSpeechResponse returns the url of the wav audio, or the base64 encoded audio
+type TextToSpeechResponse struct {
+	Output struct {
+		Audio struct {
+			Url  string `json:"url"`
+			Data string `json:"data"`
+		} `json:"audio"`
+	} `json:"output"`
+	Error
+}
+
+// ConvertAudioRequest implements adaptor.AudioAdaptor, only the speech is supported
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error) {
+	if meta.Mode != relaymode.AudioSpeech {
+		return nil, errors.New("ali only supports the speech synthesis, the transcription is not supported")
+	}
+
+	var ttsRequest openai.TextToSpeechRequest
+	if err := json.Unmarshal(requestBody, &ttsRequest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal speech request")
+	}
+	if ttsRequest.ResponseFormat != "" && ttsRequest.ResponseFormat != "wav" {
+		return nil, errors.Errorf("response_format %s is not supported, only wav is supported", ttsRequest.ResponseFormat)
+	}
+
+	aliRequest := TextToSpeechRequest{Model: meta.ActualModelName}
+	aliRequest.Input.Text = ttsRequest.Input
+	aliRequest.Input.Voice = defaultTTSVoice
+	for _, voice := range ttsVoices {
+		if strings.EqualFold(voice, ttsRequest.Voice) {
+			aliRequest.Input.Voice = voice
+		}
+	}
+
+	body, err := json.Marshal(aliRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal speech request")
+	}
+	return bytes.NewReader(body), nil
+}
+
+// DoAudioResponse implements adaptor.AudioAdaptor, the synthesized audio is downloaded and sent to the client
+func (a *Adaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	if err = resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+
+	var ttsResponse TextToSpeechResponse
+	if err = json.Unmarshal(responseBody, &ttsResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if ttsResponse.Code != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: ttsResponse.Message,
+				Type:    "ali_error",
+				Code:    ttsResponse.Code,
+			},
+			StatusCode: resp.StatusCode,
+		}
+	}
+
+	audio := ttsResponse.Output.Audio
+	if audio.Data != "" {
+		data, err := base64.StdEncoding.DecodeString(audio.Data)
+		if err != nil {
+			return openai.ErrorWrapper(err, "decode_audio_failed", http.StatusInternalServerError)
+		}
+		c.Data(http.StatusOK, "audio/wav", data)
+		return nil
+	}
+	if audio.Url == "" {
+		return openai.ErrorWrapper(errors.New("no audio is returned"), "invalid_response", http.StatusInternalServerError)
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, audio.Url, nil)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	audioResp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "download_audio_failed", http.StatusInternalServerError)
+	}
+	defer audioResp.Body.Close()
+	if audioResp.StatusCode != http.StatusOK {
+		return openai.ErrorWrapper(errors.Errorf("download audio got status %d", audioResp.StatusCode),
+			"download_audio_failed", http.StatusInternalServerError)
+	}
+
+	c.Writer.Header().Set("Content-Type", "audio/wav")
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(c.Writer, audioResp.Body); err != nil {
+		return openai.ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
@@ -31,6 +31,8 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 
 	// Qwen Audio Models
 	"qwen-audio-turbo": {Ratio: 1.4286, CompletionRatio: 1},
+	"qwen-tts":         {Ratio: 1.6 * ratio.MilliTokensRmb, CompletionRatio: 1},
+	"qwen-tts-latest":  {Ratio: 1.6 * ratio.MilliTokensRmb, CompletionRatio: 1},
 
 	// Qwen Math Models
 	"qwen-math-plus":         {Ratio: 4 * ratio.MilliTokensRmb, CompletionRatio: 1},
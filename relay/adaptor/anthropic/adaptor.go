@@ -1,15 +1,18 @@
 package anthropic
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -50,6 +53,13 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 		betaHeaders = append(betaHeaders, "interleaved-thinking-2025-05-14")
 	}
 
+	// keep the beta features requested by native Messages API clients
+	for _, beta := range strings.Split(c.Request.Header.Get("anthropic-beta"), ",") {
+		if beta = strings.TrimSpace(beta); beta != "" && !slices.Contains(betaHeaders, beta) {
+			betaHeaders = append(betaHeaders, beta)
+		}
+	}
+
 	if len(betaHeaders) > 0 {
 		req.Header.Set("anthropic-beta", strings.Join(betaHeaders, ","))
 	}
@@ -86,6 +96,21 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return
 }
 
+// SupportClaudeMessages reports whether the model could be served by the native Messages API,
+// anthropic channels always speak it.
+func (a *Adaptor) SupportClaudeMessages(modelName string) bool {
+	return true
+}
+
+// DoClaudeMessages forwards the native Messages API request to anthropic
+func (a *Adaptor) DoClaudeMessages(c *gin.Context, meta *meta.Meta, requestBody []byte) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	resp, doErr := a.DoRequest(c, meta, bytes.NewReader(requestBody))
+	if doErr != nil {
+		return nil, openai.ErrorWrapper(doErr, "do_request_failed", http.StatusInternalServerError)
+	}
+	return DoMessagesResponse(c, resp, meta)
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return adaptor.GetModelListFromPricing(ModelRatios)
 }
@@ -0,0 +1,670 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ParseMessagesContent parses the content of a native Messages API message,
+// which could be a plain string or a list of content blocks.
+func ParseMessagesContent(raw json.RawMessage) ([]MessagesContentBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, errors.Wrap(err, "unmarshal string content")
+		}
+		return []MessagesContentBlock{{Type: "text", Text: &text}}, nil
+	}
+
+	var blocks []MessagesContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, errors.Wrap(err, "unmarshal content blocks")
+	}
+	return blocks, nil
+}
+
+// messagesContentText joins all text blocks of the content
+func messagesContentText(raw json.RawMessage) (string, error) {
+	blocks, err := ParseMessagesContent(raw)
+	if err != nil {
+		return "", err
+	}
+
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != nil {
+			texts = append(texts, *block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// ConvertMessagesRequest converts a native Messages API request to the OpenAI format,
+// it is used when the selected channel does not speak the Messages API natively.
+func ConvertMessagesRequest(request *MessagesRequest) (*model.GeneralOpenAIRequest, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+
+	openaiRequest := &model.GeneralOpenAIRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Stream:      request.Stream,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		TopK:        request.TopK,
+	}
+	if len(request.StopSequences) > 0 {
+		openaiRequest.Stop = request.StopSequences
+	}
+	if request.Metadata != nil && request.Metadata.UserId != "" {
+		openaiRequest.User = request.Metadata.UserId
+	}
+
+	if len(request.System) > 0 {
+		systemPrompt, err := messagesContentText(request.System)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse system prompt")
+		}
+		if systemPrompt != "" {
+			openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+				Role:    "system",
+				Content: systemPrompt,
+			})
+		}
+	}
+
+	for i := range request.Messages {
+		messages, err := convertMessagesMessage(&request.Messages[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "convert message %d", i)
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, messages...)
+	}
+
+	for _, tool := range request.Tools {
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	if request.ToolChoice != nil && len(openaiRequest.Tools) > 0 {
+		switch request.ToolChoice.Type {
+		case "any":
+			openaiRequest.ToolChoice = "required"
+		case "none":
+			openaiRequest.ToolChoice = "none"
+		case "tool":
+			openaiRequest.ToolChoice = map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": request.ToolChoice.Name,
+				},
+			}
+		default:
+			openaiRequest.ToolChoice = "auto"
+		}
+	}
+
+	return openaiRequest, nil
+}
+
+// convertMessagesMessage converts one native message to one or more OpenAI messages,
+// tool_result blocks are split into standalone tool messages.
+func convertMessagesMessage(message *MessagesMessage) ([]model.Message, error) {
+	blocks, err := ParseMessagesContent(message.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		toolMessages []model.Message
+		parts        []model.MessageContent
+		toolCalls    []model.Tool
+		textContent  strings.Builder
+		hasImage     bool
+	)
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			if block.Text == nil {
+				continue
+			}
+			text := *block.Text
+			textContent.WriteString(text)
+			parts = append(parts, model.MessageContent{
+				Type: model.ContentTypeText,
+				Text: &text,
+			})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			imageURL := block.Source.Url
+			if block.Source.Type == "base64" {
+				imageURL = fmt.Sprintf("data:%s;base64,%s", block.Source.MediaType, block.Source.Data)
+			}
+			hasImage = true
+			parts = append(parts, model.MessageContent{
+				Type:     model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{Url: imageURL},
+			})
+		case "tool_use":
+			args, err := json.Marshal(block.Input)
+			if err != nil {
+				return nil, errors.Wrapf(err, "marshal input of tool %s", block.Name)
+			}
+			if block.Input == nil {
+				args = []byte("{}")
+			}
+			toolCalls = append(toolCalls, model.Tool{
+				Id:   block.Id,
+				Type: "function",
+				Function: model.Function{
+					Name:      block.Name,
+					Arguments: string(args),
+				},
+			})
+		case "tool_result":
+			result, err := messagesContentText(block.Content)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parse result of tool call %s", block.ToolUseId)
+			}
+			toolMessages = append(toolMessages, model.Message{
+				Role:       "tool",
+				Content:    result,
+				ToolCallId: block.ToolUseId,
+			})
+		case "thinking", "redacted_thinking":
+			// thinking blocks are signed by anthropic and meaningless for other providers,
+			// some of them even reject reasoning content in the input messages
+		default:
+			logger.Warnf(context.Background(), "unknown messages content block type %q", block.Type)
+		}
+	}
+
+	messages := toolMessages
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return messages, nil
+	}
+
+	openaiMessage := model.Message{
+		Role:      message.Role,
+		ToolCalls: toolCalls,
+	}
+	if hasImage {
+		openaiMessage.Content = parts
+	} else {
+		openaiMessage.Content = textContent.String()
+	}
+	return append(messages, openaiMessage), nil
+}
+
+// stopReasonOpenAI2Claude converts an OpenAI finish_reason to a Messages API stop_reason
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// messagesResponseId converts an upstream response id to the Messages API style
+func messagesResponseId(id string) string {
+	id = strings.TrimPrefix(id, "chatcmpl-")
+	if id == "" {
+		id = random.GetUUID()
+	}
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + id
+}
+
+// messageReasoning returns the reasoning content of an OpenAI message in any supported format
+func messageReasoning(message *model.Message) string {
+	switch {
+	case message.ReasoningContent != nil:
+		return *message.ReasoningContent
+	case message.Reasoning != nil:
+		return *message.Reasoning
+	case message.Thinking != nil:
+		return *message.Thinking
+	}
+	return ""
+}
+
+// toolArguments returns the arguments of an OpenAI tool call as a JSON string
+func toolArguments(tool *model.Tool) string {
+	switch args := tool.Function.Arguments.(type) {
+	case string:
+		return args
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(args)
+		return string(data)
+	}
+}
+
+// ResponseOpenAI2Claude converts an OpenAI chat completion response to the Messages API format
+func ResponseOpenAI2Claude(openaiResponse *openai.TextResponse, usage *model.Usage) *MessagesResponse {
+	response := &MessagesResponse{
+		Id:      messagesResponseId(openaiResponse.Id),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   openaiResponse.Model,
+		Content: []MessagesContentBlock{},
+	}
+
+	stopReason := "end_turn"
+	for _, choice := range openaiResponse.Choices {
+		if reasoning := messageReasoning(&choice.Message); reasoning != "" {
+			response.Content = append(response.Content, MessagesContentBlock{
+				Type:      "thinking",
+				Thinking:  &reasoning,
+				Signature: choice.Message.Signature,
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			response.Content = append(response.Content, MessagesContentBlock{
+				Type: "text",
+				Text: &text,
+			})
+		}
+		for i := range choice.Message.ToolCalls {
+			input := map[string]any{}
+			if args := toolArguments(&choice.Message.ToolCalls[i]); args != "" {
+				if err := json.Unmarshal([]byte(args), &input); err != nil {
+					logger.Warnf(context.Background(), "unmarshal tool call arguments %q: %v", args, err)
+				}
+			}
+			response.Content = append(response.Content, MessagesContentBlock{
+				Type:  "tool_use",
+				Id:    choice.Message.ToolCalls[i].Id,
+				Name:  choice.Message.ToolCalls[i].Function.Name,
+				Input: input,
+			})
+		}
+		if choice.FinishReason != "" {
+			stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+		}
+	}
+	response.StopReason = &stopReason
+
+	if usage == nil {
+		usage = &openaiResponse.Usage
+	}
+	response.Usage = Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	return response
+}
+
+// MessagesStreamConverter converts OpenAI chat completion chunks to Messages API stream events.
+//
+// It keeps track of the currently opened content block, because the Messages API
+// requires every block to be explicitly started and stopped.
+type MessagesStreamConverter struct {
+	// Model is used when the upstream chunk does not carry a model name
+	Model string
+	// PromptTokens is reported in message_start before the upstream usage is known
+	PromptTokens int
+
+	started    bool
+	blockIndex int
+	blockType  string
+	// toolBlocks maps the OpenAI tool call index to the Messages API block index
+	toolBlocks map[int]int
+	stopReason string
+}
+
+// Convert converts one OpenAI stream chunk to zero or more Messages API events
+func (s *MessagesStreamConverter) Convert(chunk *openai.ChatCompletionsStreamResponse) []MessagesStreamEvent {
+	var events []MessagesStreamEvent
+	if !s.started {
+		events = append(events, s.start(chunk.Id, chunk.Model)...)
+	}
+
+	for _, choice := range chunk.Choices {
+		if reasoning := messageReasoning(&choice.Delta); reasoning != "" {
+			events = append(events, s.ensureBlock("thinking", MessagesContentBlock{
+				Type:     "thinking",
+				Thinking: new(string),
+			})...)
+			events = append(events, s.delta(&MessagesDelta{Type: "thinking_delta", Thinking: &reasoning}))
+		}
+		if choice.Delta.Signature != nil && *choice.Delta.Signature != "" && s.blockType == "thinking" {
+			events = append(events, s.delta(&MessagesDelta{Type: "signature_delta", Signature: choice.Delta.Signature}))
+		}
+
+		if text, ok := choice.Delta.Content.(string); ok && text != "" {
+			events = append(events, s.ensureBlock("text", MessagesContentBlock{
+				Type: "text",
+				Text: new(string),
+			})...)
+			events = append(events, s.delta(&MessagesDelta{Type: "text_delta", Text: &text}))
+		}
+
+		for i := range choice.Delta.ToolCalls {
+			tool := &choice.Delta.ToolCalls[i]
+			toolIndex := i
+			if tool.Index != nil {
+				toolIndex = *tool.Index
+			}
+			if _, ok := s.toolBlocks[toolIndex]; !ok {
+				events = append(events, s.closeBlock()...)
+				events = append(events, s.openBlock("tool_use", MessagesContentBlock{
+					Type:  "tool_use",
+					Id:    tool.Id,
+					Name:  tool.Function.Name,
+					Input: map[string]any{},
+				}))
+				if s.toolBlocks == nil {
+					s.toolBlocks = make(map[int]int)
+				}
+				s.toolBlocks[toolIndex] = s.blockIndex
+			}
+			if args := toolArguments(tool); args != "" {
+				index := s.toolBlocks[toolIndex]
+				events = append(events, MessagesStreamEvent{
+					Type:  "content_block_delta",
+					Index: &index,
+					Delta: &MessagesDelta{Type: "input_json_delta", PartialJson: &args},
+				})
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+
+	return events
+}
+
+// Finish closes the opened content block and emits the final message events
+func (s *MessagesStreamConverter) Finish(usage *model.Usage) []MessagesStreamEvent {
+	var events []MessagesStreamEvent
+	if !s.started {
+		events = append(events, s.start("", "")...)
+	}
+	events = append(events, s.closeBlock()...)
+
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	finalUsage := &Usage{}
+	if usage != nil {
+		finalUsage.InputTokens = usage.PromptTokens
+		finalUsage.OutputTokens = usage.CompletionTokens
+	}
+	events = append(events,
+		MessagesStreamEvent{
+			Type:  "message_delta",
+			Delta: &MessagesDelta{StopReason: &stopReason},
+			Usage: finalUsage,
+		},
+		MessagesStreamEvent{Type: "message_stop"},
+	)
+	return events
+}
+
+func (s *MessagesStreamConverter) start(id, modelName string) []MessagesStreamEvent {
+	s.started = true
+	s.blockIndex = -1
+	if modelName == "" {
+		modelName = s.Model
+	}
+	return []MessagesStreamEvent{{
+		Type: "message_start",
+		Message: &MessagesResponse{
+			Id:      messagesResponseId(id),
+			Type:    "message",
+			Role:    "assistant",
+			Content: []MessagesContentBlock{},
+			Model:   modelName,
+			Usage:   Usage{InputTokens: s.PromptTokens},
+		},
+	}}
+}
+
+// ensureBlock opens a new block of blockType unless it is already the current block
+func (s *MessagesStreamConverter) ensureBlock(blockType string, block MessagesContentBlock) []MessagesStreamEvent {
+	if s.blockType == blockType {
+		return nil
+	}
+	events := s.closeBlock()
+	return append(events, s.openBlock(blockType, block))
+}
+
+func (s *MessagesStreamConverter) openBlock(blockType string, block MessagesContentBlock) MessagesStreamEvent {
+	s.blockIndex++
+	s.blockType = blockType
+	index := s.blockIndex
+	return MessagesStreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: &block,
+	}
+}
+
+func (s *MessagesStreamConverter) closeBlock() []MessagesStreamEvent {
+	if s.blockType == "" {
+		return nil
+	}
+	s.blockType = ""
+	index := s.blockIndex
+	return []MessagesStreamEvent{{Type: "content_block_stop", Index: &index}}
+}
+
+func (s *MessagesStreamConverter) delta(delta *MessagesDelta) MessagesStreamEvent {
+	index := s.blockIndex
+	return MessagesStreamEvent{
+		Type:  "content_block_delta",
+		Index: &index,
+		Delta: delta,
+	}
+}
+
+// UpdateUsageFromStreamEvent accumulates the usage reported by a native Messages API stream event
+func UpdateUsageFromStreamEvent(event *StreamResponse, usage *model.Usage) {
+	switch event.Type {
+	case string(TypeStart):
+		if event.Message != nil {
+			u := event.Message.Usage
+			usage.PromptTokens = u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+			usage.CompletionTokens = u.OutputTokens
+		}
+	case string(TypeMessageDelta):
+		// output_tokens in message_delta is cumulative
+		if event.Usage != nil && event.Usage.OutputTokens > 0 {
+			usage.CompletionTokens = event.Usage.OutputTokens
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+}
+
+// MessagesErrorHandler converts an upstream native Messages API error response
+func MessagesErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	_ = resp.Body.Close()
+
+	errResp := &model.ErrorWithStatusCode{
+		StatusCode: resp.StatusCode,
+		Error: model.Error{
+			Message: string(responseBody),
+			Type:    "upstream_error",
+			Code:    "bad_response_status_code",
+		},
+	}
+	var claudeErr MessagesErrorResponse
+	if err = json.Unmarshal(responseBody, &claudeErr); err == nil && claudeErr.Error.Message != "" {
+		errResp.Error.Message = claudeErr.Error.Message
+		errResp.Error.Type = claudeErr.Error.Type
+		errResp.Error.Code = claudeErr.Error.Type
+	}
+	return errResp
+}
+
+// DoMessagesResponse handles the upstream response of a native Messages API request
+func DoMessagesResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, MessagesErrorHandler(resp)
+	}
+
+	if meta.IsStream {
+		err, usage = MessagesStreamHandler(c, resp)
+	} else {
+		err, usage = MessagesHandler(c, resp)
+	}
+	return
+}
+
+// MessagesHandler forwards a non-stream native Messages API response to the client
+func MessagesHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err = resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	logger.Debugf(c.Request.Context(), "messages response <- %s\n", string(responseBody))
+
+	var claudeResponse Response
+	if err = json.Unmarshal(responseBody, &claudeResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if claudeResponse.Error.Type != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: claudeResponse.Error.Message,
+				Type:    claudeResponse.Error.Type,
+				Code:    claudeResponse.Error.Type,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	u := claudeResponse.Usage
+	usage := &model.Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	if _, err = c.Writer.Write(responseBody); err != nil {
+		logger.Warnf(c.Request.Context(), "write messages response: %v", err)
+	}
+	return nil, usage
+}
+
+// MessagesStreamHandler forwards native Messages API server-sent events to the client
+// unchanged, while collecting the usage from message_start and message_delta events.
+func MessagesStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	usage := &model.Usage{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, err := io.WriteString(c.Writer, line+"\n"); err != nil {
+			logger.Warnf(c.Request.Context(), "write messages stream: %v", err)
+			break
+		}
+		if line == "" {
+			c.Writer.Flush()
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var event StreamResponse
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			logger.Warnf(c.Request.Context(), "unmarshal messages stream event %q: %v", data, err)
+			continue
+		}
+		UpdateUsageFromStreamEvent(&event, usage)
+	}
+	c.Writer.Flush()
+
+	if err := scanner.Err(); err != nil {
+		logger.Errorf(c.Request.Context(), "read messages stream: %v", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, usage
+}
+
+// RewriteMessagesRequest sets and deletes top-level fields of a native Messages API request body,
+// the other fields are kept untouched so that new upstream features pass through.
+func RewriteMessagesRequest(body []byte, set map[string]any, del ...string) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, errors.Wrap(err, "unmarshal messages request")
+	}
+
+	for key, value := range set {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal field %s", key)
+		}
+		fields[key] = data
+	}
+	for _, key := range del {
+		delete(fields, key)
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal messages request")
+	}
+	return body, nil
+}
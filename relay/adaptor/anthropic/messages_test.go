@@ -0,0 +1,208 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertMessagesRequest(t *testing.T) {
+	body := `{
+		"model": "claude-3-5-sonnet",
+		"max_tokens": 1024,
+		"system": [{"type": "text", "text": "be brief"}],
+		"stop_sequences": ["END"],
+		"tools": [{"name": "get_weather", "description": "weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "tool", "name": "get_weather"},
+		"messages": [
+			{"role": "user", "content": "weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "hmm", "signature": "sig"},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "sunny"}]},
+				{"type": "text", "text": "and now?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+			]}
+		]
+	}`
+	request := new(MessagesRequest)
+	require.NoError(t, json.Unmarshal([]byte(body), request))
+
+	converted, err := ConvertMessagesRequest(request)
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-3-5-sonnet", converted.Model)
+	assert.Equal(t, 1024, converted.MaxTokens)
+	assert.Equal(t, []string{"END"}, converted.Stop)
+	require.Len(t, converted.Tools, 1)
+	assert.Equal(t, "get_weather", converted.Tools[0].Function.Name)
+	assert.Equal(t, map[string]any{
+		"type":     "function",
+		"function": map[string]any{"name": "get_weather"},
+	}, converted.ToolChoice)
+
+	require.Len(t, converted.Messages, 5)
+	assert.Equal(t, "system", converted.Messages[0].Role)
+	assert.Equal(t, "be brief", converted.Messages[0].StringContent())
+	assert.Equal(t, "user", converted.Messages[1].Role)
+	assert.Equal(t, "weather in Paris?", converted.Messages[1].StringContent())
+
+	// thinking blocks are dropped, tool_use becomes tool_calls
+	assistant := converted.Messages[2]
+	assert.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", assistant.ToolCalls[0].Id)
+	assert.JSONEq(t, `{"city":"Paris"}`, assistant.ToolCalls[0].Function.Arguments.(string))
+
+	// tool_result is split into a tool message placed before the user content
+	assert.Equal(t, "tool", converted.Messages[3].Role)
+	assert.Equal(t, "toolu_1", converted.Messages[3].ToolCallId)
+	assert.Equal(t, "sunny", converted.Messages[3].StringContent())
+
+	user := converted.Messages[4]
+	parts, ok := user.Content.([]model.MessageContent)
+	require.True(t, ok)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "and now?", *parts[0].Text)
+	assert.Equal(t, "data:image/png;base64,AAAA", parts[1].ImageURL.Url)
+}
+
+func TestConvertMessagesRequest_ToolChoice(t *testing.T) {
+	tools := []MessagesTool{{Name: "f", InputSchema: map[string]any{"type": "object"}}}
+	cases := map[string]any{
+		"any":  "required",
+		"none": "none",
+		"auto": "auto",
+	}
+	for choice, expected := range cases {
+		converted, err := ConvertMessagesRequest(&MessagesRequest{
+			Model:      "m",
+			Tools:      tools,
+			ToolChoice: &ToolChoice{Type: choice},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, converted.ToolChoice, choice)
+	}
+}
+
+func TestResponseOpenAI2Claude(t *testing.T) {
+	openaiResponse := &openai.TextResponse{
+		Id:    "chatcmpl-1",
+		Model: "gpt-4o",
+		Choices: []openai.TextResponseChoice{{
+			Message: model.Message{
+				Role:    "assistant",
+				Content: "let me check",
+				ToolCalls: []model.Tool{{
+					Id:       "call_1",
+					Type:     "function",
+					Function: model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+				}},
+			},
+			FinishReason: "tool_calls",
+		}},
+		Usage: model.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+
+	response := ResponseOpenAI2Claude(openaiResponse, nil)
+	assert.Equal(t, "msg_1", response.Id)
+	assert.Equal(t, "message", response.Type)
+	assert.Equal(t, "gpt-4o", response.Model)
+	require.NotNil(t, response.StopReason)
+	assert.Equal(t, "tool_use", *response.StopReason)
+	assert.Equal(t, 10, response.Usage.InputTokens)
+	assert.Equal(t, 5, response.Usage.OutputTokens)
+
+	require.Len(t, response.Content, 2)
+	assert.Equal(t, "text", response.Content[0].Type)
+	assert.Equal(t, "let me check", *response.Content[0].Text)
+	assert.Equal(t, "tool_use", response.Content[1].Type)
+	assert.Equal(t, "call_1", response.Content[1].Id)
+	assert.Equal(t, map[string]any{"city": "Paris"}, response.Content[1].Input)
+}
+
+func TestMessagesStreamConverter(t *testing.T) {
+	converter := &MessagesStreamConverter{Model: "gpt-4o", PromptTokens: 7}
+	text := func(s string) *openai.ChatCompletionsStreamResponse {
+		return &openai.ChatCompletionsStreamResponse{
+			Id:      "chatcmpl-1",
+			Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: s}}},
+		}
+	}
+	toolIndex := 0
+	stop := "tool_calls"
+
+	var events []MessagesStreamEvent
+	events = append(events, converter.Convert(text("hel"))...)
+	events = append(events, converter.Convert(text("lo"))...)
+	events = append(events, converter.Convert(&openai.ChatCompletionsStreamResponse{
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{
+			Delta: model.Message{ToolCalls: []model.Tool{{
+				Index:    &toolIndex,
+				Id:       "call_1",
+				Function: model.Function{Name: "get_weather", Arguments: `{"city":`},
+			}}},
+		}},
+	})...)
+	events = append(events, converter.Convert(&openai.ChatCompletionsStreamResponse{
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{
+			Delta: model.Message{ToolCalls: []model.Tool{{
+				Index:    &toolIndex,
+				Function: model.Function{Arguments: `"Paris"}`},
+			}}},
+			FinishReason: &stop,
+		}},
+	})...)
+	events = append(events, converter.Finish(&model.Usage{PromptTokens: 7, CompletionTokens: 3})...)
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta",
+		"content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta",
+		"content_block_stop",
+		"message_delta", "message_stop",
+	}, types)
+
+	assert.Equal(t, "gpt-4o", events[0].Message.Model)
+	assert.Equal(t, 7, events[0].Message.Usage.InputTokens)
+	assert.Equal(t, 0, *events[1].Index)
+	assert.Equal(t, "lo", *events[3].Delta.Text)
+	assert.Equal(t, 1, *events[5].Index)
+	assert.Equal(t, "call_1", events[5].ContentBlock.Id)
+	assert.Equal(t, "input_json_delta", events[7].Delta.Type)
+	assert.Equal(t, `"Paris"}`, *events[7].Delta.PartialJson)
+	assert.Equal(t, "tool_use", *events[9].Delta.StopReason)
+	assert.Equal(t, 3, events[9].Usage.OutputTokens)
+}
+
+func TestUpdateUsageFromStreamEvent(t *testing.T) {
+	usage := &model.Usage{}
+	UpdateUsageFromStreamEvent(&StreamResponse{
+		Type: "message_start",
+		Message: &Response{Usage: Usage{
+			InputTokens:          10,
+			CacheReadInputTokens: 5,
+			OutputTokens:         1,
+		}},
+	}, usage)
+	UpdateUsageFromStreamEvent(&StreamResponse{
+		Type:  "message_delta",
+		Usage: &Usage{OutputTokens: 20},
+	}, usage)
+
+	assert.Equal(t, 15, usage.PromptTokens)
+	assert.Equal(t, 20, usage.CompletionTokens)
+	assert.Equal(t, 35, usage.TotalTokens)
+}
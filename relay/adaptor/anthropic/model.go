@@ -1,6 +1,10 @@
 package anthropic
 
-import "github.com/songquanpeng/one-api/relay/model"
+import (
+	"encoding/json"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
 
 // https://docs.anthropic.com/claude/reference/messages_post
 
@@ -66,6 +70,9 @@ type Request struct {
 type Usage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+	// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 type Error struct {
@@ -117,3 +124,121 @@ type StreamResponse struct {
 	Delta        *Delta    `json:"delta"`
 	Usage        *Usage    `json:"usage"`
 }
+
+// -------------------------------------
+// Native Messages API (/v1/messages)
+// -------------------------------------
+
+// MessagesRequest is the native Anthropic Messages API request accepted by the
+// /v1/messages relay endpoint.
+//
+// Unlike Request, it keeps the flexible shapes allowed by the upstream API,
+// system and message content may be either a string or a list of content blocks.
+//
+// https://docs.anthropic.com/en/api/messages
+type MessagesRequest struct {
+	Model         string            `json:"model"`
+	Messages      []MessagesMessage `json:"messages"`
+	System        json.RawMessage   `json:"system,omitempty"`
+	MaxTokens     int               `json:"max_tokens"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+	Stream        bool              `json:"stream,omitempty"`
+	Temperature   *float64          `json:"temperature,omitempty"`
+	TopP          *float64          `json:"top_p,omitempty"`
+	TopK          int               `json:"top_k,omitempty"`
+	Tools         []MessagesTool    `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice       `json:"tool_choice,omitempty"`
+	Thinking      *model.Thinking   `json:"thinking,omitempty"`
+	Metadata      *Metadata         `json:"metadata,omitempty"`
+}
+
+// MessagesMessage is a single message of MessagesRequest,
+// content is a string or a list of MessagesContentBlock.
+type MessagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// MessagesContentBlock is a content block used in native Messages API requests and responses
+type MessagesContentBlock struct {
+	Type string  `json:"type"`
+	Text *string `json:"text,omitempty"`
+	// image
+	Source *MessagesImageSource `json:"source,omitempty"`
+	// tool_use
+	Id    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Input any    `json:"input,omitempty"`
+	// tool_result, content is a string or a list of content blocks
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	// thinking & redacted_thinking
+	Thinking  *string `json:"thinking,omitempty"`
+	Signature *string `json:"signature,omitempty"`
+	Data      string  `json:"data,omitempty"`
+}
+
+// MessagesImageSource is the source of an image block, type is base64 or url
+type MessagesImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+// MessagesTool is a client tool definition of the native Messages API
+type MessagesTool struct {
+	Type        string         `json:"type,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema,omitempty"`
+}
+
+// ToolChoice is how the model should use the provided tools,
+// type should be one of auto/any/tool/none.
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// MessagesResponse is the native Messages API response returned to the client
+type MessagesResponse struct {
+	Id           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Role         string                 `json:"role"`
+	Content      []MessagesContentBlock `json:"content"`
+	Model        string                 `json:"model"`
+	StopReason   *string                `json:"stop_reason"`
+	StopSequence *string                `json:"stop_sequence"`
+	Usage        Usage                  `json:"usage"`
+}
+
+// MessagesDelta is the delta of content_block_delta and message_delta stream events
+type MessagesDelta struct {
+	Type         string  `json:"type,omitempty"`
+	Text         *string `json:"text,omitempty"`
+	PartialJson  *string `json:"partial_json,omitempty"`
+	Thinking     *string `json:"thinking,omitempty"`
+	Signature    *string `json:"signature,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// MessagesStreamEvent is a server-sent event of the native Messages API
+//
+// https://docs.anthropic.com/en/docs/build-with-claude/streaming
+type MessagesStreamEvent struct {
+	Type         string                `json:"type"`
+	Message      *MessagesResponse     `json:"message,omitempty"`
+	Index        *int                  `json:"index,omitempty"`
+	ContentBlock *MessagesContentBlock `json:"content_block,omitempty"`
+	Delta        *MessagesDelta        `json:"delta,omitempty"`
+	Usage        *Usage                `json:"usage,omitempty"`
+}
+
+// MessagesErrorResponse is the error body of the native Messages API
+type MessagesErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	claude "github.com/songquanpeng/one-api/relay/adaptor/aws/claude"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -61,6 +63,28 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return a.awsAdapter.DoResponse(c, a.AwsClient, meta)
 }
 
+// SupportClaudeMessages reports whether the model is a bedrock claude model,
+// which could be served by the native Messages API.
+func (a *Adaptor) SupportClaudeMessages(modelName string) bool {
+	_, ok := GetAdaptor(modelName).(*claude.Adaptor)
+	return ok
+}
+
+// DoClaudeMessages forwards the native Messages API request to bedrock
+func (a *Adaptor) DoClaudeMessages(c *gin.Context, meta *meta.Meta, requestBody []byte) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if a.AwsClient == nil {
+		return nil, utils.WrapErr(errors.New("aws client is not initialized"))
+	}
+
+	c.Set(ctxkey.RequestModel, meta.ActualModelName)
+	if meta.IsStream {
+		err, usage = claude.MessagesStreamHandler(c, a.AwsClient, requestBody)
+	} else {
+		err, usage = claude.MessagesHandler(c, a.AwsClient, requestBody)
+	}
+	return
+}
+
 func (a *Adaptor) GetModelList() (models []string) {
 	for model := range adaptors {
 		models = append(models, model)
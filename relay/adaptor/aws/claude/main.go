@@ -22,6 +22,7 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
@@ -271,3 +272,111 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 	return nil, &usage
 }
+
+// messagesModelID resolves the bedrock model id or inference profile ARN for the request model
+func messagesModelID(c *gin.Context, awsCli *bedrockruntime.Client) (string, error) {
+	if arn := AwsClaudeModelTransArn(c, awsCli); arn != "" {
+		return arn, nil
+	}
+
+	awsModelID, err := AwsModelID(c.GetString(ctxkey.RequestModel))
+	if err != nil {
+		return "", errors.Wrap(err, "AwsModelID")
+	}
+	return utils.ConvertModelID2CrossRegionProfileWithFallback(c.Request.Context(), awsModelID, awsCli.Options().Region, awsCli), nil
+}
+
+// convertMessagesRequest converts a native Messages API request body for bedrock,
+// which expects the model in the request input and the anthropic_version in the body.
+func convertMessagesRequest(body []byte) ([]byte, error) {
+	return anthropic.RewriteMessagesRequest(body,
+		map[string]any{"anthropic_version": "bedrock-2023-05-31"}, "model", "stream")
+}
+
+// MessagesHandler forwards a non-stream native Messages API request to bedrock
+func MessagesHandler(c *gin.Context, awsCli *bedrockruntime.Client, requestBody []byte) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	modelID, err := messagesModelID(c, awsCli)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+	body, err := convertMessagesRequest(requestBody)
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "convert request")), nil
+	}
+
+	startTime := time.Now()
+	awsResp, err := awsCli.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(modelID),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	utils.UpdateRegionHealthMetrics(awsCli.Options().Region, err == nil, time.Since(startTime), err)
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "InvokeModel")), nil
+	}
+
+	claudeResponse := new(anthropic.Response)
+	if err = json.Unmarshal(awsResp.Body, claudeResponse); err != nil {
+		return utils.WrapErr(errors.Wrap(err, "unmarshal response")), nil
+	}
+	u := claudeResponse.Usage
+	usage := relaymodel.Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	c.Data(http.StatusOK, "application/json", awsResp.Body)
+	return nil, &usage
+}
+
+// MessagesStreamHandler forwards a stream native Messages API request to bedrock,
+// bedrock chunks already carry the native stream events, they are rendered as SSE.
+func MessagesStreamHandler(c *gin.Context, awsCli *bedrockruntime.Client, requestBody []byte) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	modelID, err := messagesModelID(c, awsCli)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+	body, err := convertMessagesRequest(requestBody)
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "convert request")), nil
+	}
+
+	startTime := time.Now()
+	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(modelID),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	utils.UpdateRegionHealthMetrics(awsCli.Options().Region, err == nil, time.Since(startTime), err)
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "InvokeModelWithResponseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	common.SetEventStreamHeaders(c)
+	var usage relaymodel.Usage
+	for event := range stream.Events() {
+		chunk, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			logger.Warnf(c.Request.Context(), "unknown bedrock stream event %T", event)
+			continue
+		}
+
+		claudeResp := new(anthropic.StreamResponse)
+		if err := json.Unmarshal(chunk.Value.Bytes, claudeResp); err != nil {
+			logger.Warnf(c.Request.Context(), "unmarshal stream response: %v", err)
+			continue
+		}
+		anthropic.UpdateUsageFromStreamEvent(claudeResp, &usage)
+		render.EventData(c, claudeResp.Type, string(chunk.Value.Bytes))
+	}
+	if err := stream.Err(); err != nil {
+		logger.Errorf(c.Request.Context(), "read bedrock stream: %v", err)
+	}
+
+	return nil, &usage
+}
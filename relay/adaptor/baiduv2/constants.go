@@ -45,6 +45,9 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"deepseek-r1":                  {Ratio: 0.01 * ratio.MilliTokensRmb, CompletionRatio: 8},  // ¥0.01 / 1k tokens
 	"deepseek-r1-distill-qwen-32b": {Ratio: 0.004 * ratio.MilliTokensRmb, CompletionRatio: 1}, // ¥0.004 / 1k tokens
 	"deepseek-r1-distill-qwen-14b": {Ratio: 0.003 * ratio.MilliTokensRmb, CompletionRatio: 1}, // ¥0.003 / 1k tokens
+
+	// Rerank Models
+	"bce-reranker-base": {Ratio: 0.0005 * ratio.MilliTokensRmb, CompletionRatio: 1}, // ¥0.0005 / 1k tokens
 }
 
 // ModelList derived from ModelRatios for backward compatibility
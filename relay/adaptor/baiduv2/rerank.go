@@ -0,0 +1,32 @@
+package baiduv2
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertRerankRequest converts the canonical rerank request to the qianfan v2 rerankers request,
+// which always returns the documents and does not accept return_documents.
+//
+// https://cloud.baidu.com/doc/qianfan-api/s/2m7u4zt74
+func ConvertRerankRequest(request *model.RerankRequest) *openai_compatible.RerankRequest {
+	rerankRequest := openai_compatible.ConvertRerankRequest(request)
+	rerankRequest.ReturnDocuments = nil
+	return rerankRequest
+}
+
+// ConvertRerankRequest implements adaptor.RerankAdaptor
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	return ConvertRerankRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor, the response is in the Jina style
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	err, rerankResponse := openai_compatible.RerankHandler(c, resp)
+	return rerankResponse, err
+}
@@ -17,6 +17,10 @@ import (
 
 type Adaptor struct {
 	meta *meta.Meta
+	// audioContentType is the content type of the converted audio request
+	audioContentType string
+	// responseFormat is the format of the transcription requested by the client
+	responseFormat string
 }
 
 // ConvertImageRequest implements adaptor.Adaptor.
@@ -61,6 +65,9 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	adaptor.SetupCommonRequestHeader(c, req, meta)
+	if a.audioContentType != "" {
+		req.Header.Set("Content-Type", a.audioContentType)
+	}
 	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 	return nil
 }
@@ -147,6 +154,12 @@ func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
 		"@cf/qwen/qwen1.5-14b-chat-awq": {Ratio: 0.125 * MilliTokensUsd, CompletionRatio: 1}, // $0.125 per 1M tokens
 		"@cf/qwen/qwen1.5-7b-chat-awq":  {Ratio: 0.125 * MilliTokensUsd, CompletionRatio: 1}, // $0.125 per 1M tokens
 
+		// Audio Models, the transcription is billed by the audio duration, and the speech by the input length
+		"@cf/openai/whisper":                {Ratio: 0.83 * MilliTokensUsd, CompletionRatio: 1}, // $0.0005 per audio minute
+		"@cf/openai/whisper-tiny-en":        {Ratio: 0.83 * MilliTokensUsd, CompletionRatio: 1}, // $0.0005 per audio minute
+		"@cf/openai/whisper-large-v3-turbo": {Ratio: 0.83 * MilliTokensUsd, CompletionRatio: 1}, // $0.0005 per audio minute
+		"@cf/myshell-ai/melotts":            {Ratio: 0.2 * MilliTokensUsd, CompletionRatio: 1},
+
 		// Specialized Models
 		"@cf/defog/sqlcoder-7b-2":                {Ratio: 0.125 * MilliTokensUsd, CompletionRatio: 1}, // $0.125 per 1M tokens
 		"@hf/nexusflow/starling-lm-7b-beta":      {Ratio: 0.125 * MilliTokensUsd, CompletionRatio: 1}, // $0.125 per 1M tokens
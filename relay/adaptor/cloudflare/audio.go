@@ -0,0 +1,174 @@
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// whisperJSONModel accepts the base64 encoded audio in a JSON body and supports the translation,
+// the other whisper models only accept the raw audio.
+const whisperJSONModel = "@cf/openai/whisper-large-v3-turbo"
+
+// WhisperRequest is the JSON request of whisperJSONModel
+type WhisperRequest struct {
+	Audio         string `json:"audio"`
+	Task          string `json:"task,omitempty"`
+	Language      string `json:"language,omitempty"`
+	InitialPrompt string `json:"initial_prompt,omitempty"`
+}
+
+// WhisperResponse is the transcription of the whisper models
+type WhisperResponse struct {
+	Result struct {
+		Text              string `json:"text"`
+		Vtt               string `json:"vtt,omitempty"`
+		TranscriptionInfo *struct {
+			Language string  `json:"language"`
+			Duration float64 `json:"duration"`
+		} `json:"transcription_info,omitempty"`
+	} `json:"result"`
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// TextToSpeechRequest is the request of the text-to-speech models like @cf/myshell-ai/melotts
+type TextToSpeechRequest struct {
+	Prompt string `json:"prompt"`
+	Lang   string `json:"lang,omitempty"`
+}
+
+// TextToSpeechResponse contains the base64 encoded mp3 audio
+type TextToSpeechResponse struct {
+	Result struct {
+		Audio string `json:"audio"`
+	} `json:"result"`
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// ConvertAudioRequest implements adaptor.AudioAdaptor
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error) {
+	if meta.Mode == relaymode.AudioSpeech {
+		var ttsRequest openai.TextToSpeechRequest
+		if err := json.Unmarshal(requestBody, &ttsRequest); err != nil {
+			return nil, errors.Wrap(err, "unmarshal speech request")
+		}
+		if ttsRequest.ResponseFormat != "" && ttsRequest.ResponseFormat != "mp3" {
+			return nil, errors.Errorf("response_format %s is not supported, only mp3 is supported", ttsRequest.ResponseFormat)
+		}
+
+		a.audioContentType = "application/json"
+		body, err := json.Marshal(TextToSpeechRequest{Prompt: ttsRequest.Input})
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal speech request")
+		}
+		return bytes.NewReader(body), nil
+	}
+
+	request, err := model.ParseAudioTranscriptionRequest(c.Request.Header.Get("Content-Type"), requestBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse transcription request")
+	}
+	switch request.ResponseFormat {
+	case "json", "text", "verbose_json", "vtt":
+		a.responseFormat = request.ResponseFormat
+	default:
+		return nil, errors.Errorf("response_format %s is not supported", request.ResponseFormat)
+	}
+
+	if meta.ActualModelName != whisperJSONModel {
+		if meta.Mode == relaymode.AudioTranslation {
+			return nil, errors.Errorf("model %s does not support translation, please use %s", meta.ActualModelName, whisperJSONModel)
+		}
+		a.audioContentType = "application/octet-stream"
+		return bytes.NewReader(request.File), nil
+	}
+
+	whisperRequest := WhisperRequest{
+		Audio:         base64.StdEncoding.EncodeToString(request.File),
+		Task:          "transcribe",
+		Language:      request.Language,
+		InitialPrompt: request.Prompt,
+	}
+	if meta.Mode == relaymode.AudioTranslation {
+		whisperRequest.Task = "translate"
+	}
+	a.audioContentType = "application/json"
+	body, err := json.Marshal(whisperRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal transcription request")
+	}
+	return bytes.NewReader(body), nil
+}
+
+// DoAudioResponse implements adaptor.AudioAdaptor
+func (a *Adaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	if err = resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+
+	if meta.Mode == relaymode.AudioSpeech {
+		var ttsResponse TextToSpeechResponse
+		if err = json.Unmarshal(responseBody, &ttsResponse); err != nil {
+			return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		audio, err := base64.StdEncoding.DecodeString(ttsResponse.Result.Audio)
+		if err != nil {
+			return openai.ErrorWrapper(err, "decode_audio_failed", http.StatusInternalServerError)
+		}
+		c.Data(http.StatusOK, "audio/mpeg", audio)
+		return nil
+	}
+
+	var whisperResponse WhisperResponse
+	if err = json.Unmarshal(responseBody, &whisperResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if !whisperResponse.Success && len(whisperResponse.Errors) != 0 {
+		return openai.ErrorWrapper(errors.New(whisperResponse.Errors[0].Message), "cloudflare_error", http.StatusInternalServerError)
+	}
+
+	result := whisperResponse.Result
+	switch a.responseFormat {
+	case "text":
+		c.String(http.StatusOK, strings.TrimSpace(result.Text))
+	case "vtt":
+		c.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(result.Vtt))
+	case "verbose_json":
+		verboseResponse := openai.WhisperVerboseJSONResponse{
+			Task: "transcribe",
+			Text: strings.TrimSpace(result.Text),
+		}
+		if meta.Mode == relaymode.AudioTranslation {
+			verboseResponse.Task = "translate"
+		}
+		if result.TranscriptionInfo != nil {
+			verboseResponse.Language = result.TranscriptionInfo.Language
+			verboseResponse.Duration = result.TranscriptionInfo.Duration
+		}
+		c.JSON(http.StatusOK, verboseResponse)
+	default:
+		c.JSON(http.StatusOK, openai.WhisperJSONResponse{Text: strings.TrimSpace(result.Text)})
+	}
+	return nil
+}
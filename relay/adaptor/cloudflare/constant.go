@@ -48,6 +48,12 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"@cf/qwen/qwen1.5-14b-chat-awq": {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},
 	"@cf/qwen/qwen1.5-7b-chat-awq":  {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},
 
+	// Audio Models
+	"@cf/openai/whisper":                {Ratio: 0.83 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"@cf/openai/whisper-tiny-en":        {Ratio: 0.83 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"@cf/openai/whisper-large-v3-turbo": {Ratio: 0.83 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"@cf/myshell-ai/melotts":            {Ratio: 0.2 * ratio.MilliTokensUsd, CompletionRatio: 1},
+
 	// Specialized Models
 	"@cf/defog/sqlcoder-7b-2":                {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},
 	"@hf/nexusflow/starling-lm-7b-beta":      {Ratio: 0.1 * ratio.MilliTokensUsd, CompletionRatio: 1},
@@ -0,0 +1,91 @@
+package cohere
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the v2 rerank request, https://docs.cohere.com/reference/rerank
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+// RerankResponse is the v2 rerank response, which does not contain the documents
+type RerankResponse struct {
+	Id      string `json:"id"`
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+	Meta struct {
+		BilledUnits struct {
+			SearchUnits int `json:"search_units"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+	Message string `json:"message,omitempty"`
+}
+
+// ConvertRerankRequest converts the canonical rerank request to the v2 rerank request
+func ConvertRerankRequest(request *model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.Documents,
+		TopN:      request.TopN,
+	}
+}
+
+// ConvertRerankResponse converts the v2 rerank response to the canonical response
+func ConvertRerankResponse(response *RerankResponse) *model.RerankResponse {
+	rerankResponse := &model.RerankResponse{
+		Id:      response.Id,
+		Results: make([]model.RerankResult, 0, len(response.Results)),
+		Usage: model.RerankUsage{
+			SearchUnits: response.Meta.BilledUnits.SearchUnits,
+		},
+	}
+	for _, result := range response.Results {
+		rerankResponse.Results = append(rerankResponse.Results, model.RerankResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+		})
+	}
+	return rerankResponse
+}
+
+// RerankHandler converts the v2 rerank response to the canonical response
+func RerankHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.RerankResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var cohereResponse RerankResponse
+	err = json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Id == "" && cohereResponse.Message != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Code:    resp.StatusCode,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	return nil, ConvertRerankResponse(&cohereResponse)
+}
@@ -76,6 +76,16 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, request *model.ImageReques
 	return nil, errors.New("groq does not support image generation")
 }
 
+// ConvertAudioRequest implements adaptor.AudioAdaptor, the whisper models are served by the OpenAI compatible transcription API
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error) {
+	return openai_compatible.ConvertAudioRequest(requestBody), nil
+}
+
+// DoAudioResponse implements adaptor.AudioAdaptor
+func (a *Adaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode {
+	return openai_compatible.AudioHandler(c, resp)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	return adaptor.DoRequestHelper(a, c, meta, requestBody)
 }
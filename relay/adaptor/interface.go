@@ -1,6 +1,7 @@
 package adaptor
 
 import (
+	"context"
 	"io"
 	"net/http"
 
@@ -39,6 +40,70 @@ type Adaptor interface {
 	GetCompletionRatio(modelName string) float64
 }
 
+// ClaudeMessagesAdaptor is an optional interface implemented by adaptors whose upstream
+// speaks the Anthropic Messages API natively, so that /v1/messages requests
+// can be forwarded without converting them to the OpenAI format.
+type ClaudeMessagesAdaptor interface {
+	// SupportClaudeMessages reports whether the model could be served natively
+	SupportClaudeMessages(modelName string) bool
+	// DoClaudeMessages forwards the native request body to the upstream
+	// and writes the upstream response back to the client.
+	DoClaudeMessages(c *gin.Context, meta *meta.Meta, requestBody []byte) (usage *model.Usage, err *model.ErrorWithStatusCode)
+}
+
+// RerankAdaptor is an optional interface implemented by adaptors whose upstream
+// could rerank documents, so that the canonical /v1/rerank requests
+// are converted to the upstream format and back.
+type RerankAdaptor interface {
+	// ConvertRerankRequest converts the canonical request to the upstream request body
+	ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error)
+	// DoRerankResponse converts the upstream response to the canonical response,
+	// which is normalized and written to the client by the caller.
+	DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode)
+}
+
+// AudioAdaptor is an optional interface implemented by adaptors whose upstream could
+// synthesize speech or transcribe audio, so that the /v1/audio requests are routed
+// to the channel by the adaptor like the chat requests.
+type AudioAdaptor interface {
+	// ConvertAudioRequest converts the OpenAI style audio request body to the upstream request body,
+	// the body is JSON for the speech, and a multipart form for the transcription and translation.
+	ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error)
+	// DoAudioResponse converts the upstream response to the OpenAI format and writes it to the client
+	DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode
+}
+
+// RealtimeAdaptor is an optional interface implemented by adaptors whose upstream
+// serves the OpenAI Realtime API, so that the /v1/realtime WebSocket sessions
+// could be proxied to the channel.
+type RealtimeAdaptor interface {
+	// GetRealtimeURL returns the WebSocket URL of the upstream realtime session
+	GetRealtimeURL(meta *meta.Meta) (string, error)
+	// SetupRealtimeHeader sets the authentication headers of the upstream handshake
+	SetupRealtimeHeader(c *gin.Context, header http.Header, meta *meta.Meta) error
+}
+
+// TaskAdaptor is an optional interface implemented by adaptors whose upstream runs jobs asynchronously,
+// so that the tasks created on the channel are polled by the background task poller,
+// instead of polling the upstream inside the request.
+type TaskAdaptor interface {
+	// FetchTask fetches the status of the upstream task
+	FetchTask(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (*model.TaskResult, error)
+}
+
+// VideoAdaptor is an optional interface implemented by adaptors whose upstream generates
+// videos asynchronously, so that the /v1/videos tasks are created on the channel,
+// and fetched from the same channel later.
+type VideoAdaptor interface {
+	TaskAdaptor
+	// ConvertVideoRequest converts the canonical request to the upstream request body that creates the task
+	ConvertVideoRequest(c *gin.Context, meta *meta.Meta, request *model.VideoRequest) (any, error)
+	// DoVideoResponse parses the upstream response of the task creation, and returns the upstream task id
+	DoVideoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (upstreamTaskId string, err *model.ErrorWithStatusCode)
+	// GetVideoContent downloads the video of the completed task, the caller should close the content
+	GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (content io.ReadCloser, contentType string, err error)
+}
+
 // DefaultPricingMethods provides default implementations for adapters without specific pricing
 type DefaultPricingMethods struct{}
 
@@ -25,7 +25,7 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	// https://github.com/ollama/ollama/blob/main/docs/api.md
 	fullRequestURL := fmt.Sprintf("%s/api/chat", meta.BaseURL)
-	if meta.Mode == relaymode.Embeddings {
+	if meta.Mode == relaymode.Embeddings || meta.Mode == relaymode.Rerank {
 		fullRequestURL = fmt.Sprintf("%s/api/embed", meta.BaseURL)
 	}
 	return fullRequestURL, nil
@@ -75,6 +75,17 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor, the documents are reranked by the embeddings
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	return ConvertRerankRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	err, rerankResponse := RerankHandler(c, resp)
+	return rerankResponse, err
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return ModelList
 }
@@ -0,0 +1,83 @@
+package ollama
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertRerankRequest embeds the query along with the documents.
+//
+// Ollama has no rerank API, so the documents are scored by the cosine similarity
+// between their embeddings and the query's, which works with the embedding models like bge-m3.
+func ConvertRerankRequest(request *model.RerankRequest) *EmbeddingRequest {
+	input := make([]string, 0, len(request.Documents)+1)
+	input = append(input, request.Query)
+	input = append(input, request.Documents...)
+	return &EmbeddingRequest{
+		Model: request.Model,
+		Input: input,
+	}
+}
+
+// RerankHandler scores the documents by the embeddings returned for ConvertRerankRequest
+func RerankHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.RerankResponse) {
+	var ollamaResponse EmbeddingResponse
+	err := json.NewDecoder(resp.Body).Decode(&ollamaResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if ollamaResponse.Error != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: ollamaResponse.Error,
+				Type:    "ollama_error",
+				Param:   "",
+				Code:    "ollama_error",
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	if len(ollamaResponse.Embeddings) == 0 {
+		return openai.ErrorWrapper(errors.New("no embedding is returned"), "invalid_response", http.StatusInternalServerError), nil
+	}
+
+	query := ollamaResponse.Embeddings[0]
+	rerankResponse := &model.RerankResponse{
+		Model:   ollamaResponse.Model,
+		Results: make([]model.RerankResult, 0, len(ollamaResponse.Embeddings)-1),
+		Usage:   model.RerankUsage{TotalTokens: ollamaResponse.PromptEvalCount},
+	}
+	for i, embedding := range ollamaResponse.Embeddings[1:] {
+		rerankResponse.Results = append(rerankResponse.Results, model.RerankResult{
+			Index:          i,
+			RelevanceScore: cosineSimilarity(query, embedding),
+		})
+	}
+	return nil, rerankResponse
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiOpenaiCompatible"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/novita"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	"github.com/songquanpeng/one-api/relay/adaptor/siliconflow"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -406,6 +408,41 @@ func (a *Adaptor) DoResponse(c *gin.Context,
 	return
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor,
+// the rerank requests are sent in the Jina style unless the channel has its own format.
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	switch a.ChannelType {
+	case channeltype.BaiduV2:
+		return baiduv2.ConvertRerankRequest(request), nil
+	case channeltype.SiliconFlow:
+		return new(siliconflow.Adaptor).ConvertRerankRequest(c, request)
+	default:
+		return openai_compatible.ConvertRerankRequest(request), nil
+	}
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	err, rerankResponse := openai_compatible.RerankHandler(c, resp)
+	return rerankResponse, err
+}
+
+// ConvertAudioRequest implements adaptor.AudioAdaptor, the audio requests are passed through
+// unless the channel has its own format.
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error) {
+	switch a.ChannelType {
+	case channeltype.SiliconFlow:
+		return new(siliconflow.Adaptor).ConvertAudioRequest(c, meta, requestBody)
+	default:
+		return openai_compatible.ConvertAudioRequest(requestBody), nil
+	}
+}
+
+// DoAudioResponse implements adaptor.AudioAdaptor
+func (a *Adaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode {
+	return openai_compatible.AudioHandler(c, resp)
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return adaptor.GetModelListFromPricing(ModelRatios)
 }
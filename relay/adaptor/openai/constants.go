@@ -52,6 +52,10 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"gpt-4o-realtime-preview-2025-06-03":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
 	"gpt-4o-mini-realtime-preview":            {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
 	"gpt-4o-mini-realtime-preview-2024-12-17": {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
+	"gpt-4o-realtime-preview-2024-12-17":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
+	"gpt-4o-realtime-preview-2024-10-01":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
+	"gpt-realtime":                            {Ratio: 4.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
+	"gpt-realtime-2025-08-28":                 {Ratio: 4.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
 
 	// GPT-4.5 Models
 	"gpt-4.5-preview":            {Ratio: 75.0 * ratio.MilliTokensUsd, CompletionRatio: 2.0},
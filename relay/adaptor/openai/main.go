@@ -13,6 +13,7 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/render"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
@@ -616,6 +617,8 @@ func ResponseAPIDirectHandler(c *gin.Context, resp *http.Response, promptTokens
 			StatusCode: resp.StatusCode,
 		}, nil
 	}
+	// record the response id, so the stored response can be routed back to this channel
+	c.Set(ctxkey.ResponseId, responseAPIResp.Id)
 
 	// Extract usage information for billing
 	var finalUsage *model.Usage
@@ -710,7 +713,11 @@ func ResponseAPIDirectStreamHandler(c *gin.Context, resp *http.Response, relayMo
 		var responseAPIChunk ResponseAPIResponse
 		if fullResponse != nil {
 			responseAPIChunk = *fullResponse
+			c.Set(ctxkey.ResponseId, fullResponse.Id)
 		} else if streamEvent != nil {
+			if streamEvent.Response != nil && streamEvent.Response.Id != "" {
+				c.Set(ctxkey.ResponseId, streamEvent.Response.Id)
+			}
 			// Convert streaming event to ResponseAPIResponse for processing
 			responseAPIChunk = ConvertStreamEventToResponse(streamEvent)
 		} else {
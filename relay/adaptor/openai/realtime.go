@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// defaultAzureRealtimeAPIVersion is used if the api version of the Azure channel is not configured,
+// the realtime API is only available in the preview versions.
+const defaultAzureRealtimeAPIVersion = "2024-10-01-preview"
+
+// GetRealtimeURL implements adaptor.RealtimeAdaptor
+func (a *Adaptor) GetRealtimeURL(meta *meta.Meta) (string, error) {
+	var fullRequestURL string
+	switch meta.ChannelType {
+	case channeltype.Azure:
+		// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/realtime-audio-websockets
+		apiVersion := meta.Config.APIVersion
+		if apiVersion == "" {
+			apiVersion = defaultAzureRealtimeAPIVersion
+		}
+		fullRequestURL = fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s",
+			strings.TrimSuffix(meta.BaseURL, "/"), apiVersion, url.QueryEscape(meta.ActualModelName))
+	default:
+		// https://platform.openai.com/docs/guides/realtime-websocket
+		requestURL := "/v1/realtime?model=" + url.QueryEscape(meta.ActualModelName)
+		fullRequestURL = GetFullRequestURL(meta.BaseURL, requestURL, meta.ChannelType)
+	}
+
+	switch {
+	case strings.HasPrefix(fullRequestURL, "https://"):
+		return "wss://" + strings.TrimPrefix(fullRequestURL, "https://"), nil
+	case strings.HasPrefix(fullRequestURL, "http://"):
+		return "ws://" + strings.TrimPrefix(fullRequestURL, "http://"), nil
+	case strings.HasPrefix(fullRequestURL, "wss://"), strings.HasPrefix(fullRequestURL, "ws://"):
+		return fullRequestURL, nil
+	default:
+		return "", errors.Errorf("invalid base url %q of the realtime channel", meta.BaseURL)
+	}
+}
+
+// SetupRealtimeHeader implements adaptor.RealtimeAdaptor.
+//
+// The beta interface is only requested if the client asks for it,
+// by the OpenAI-Beta header or by the openai-beta.realtime-v1 subprotocol of the browsers.
+func (a *Adaptor) SetupRealtimeHeader(c *gin.Context, header http.Header, meta *meta.Meta) error {
+	if meta.ChannelType == channeltype.Azure {
+		header.Set("api-key", meta.APIKey)
+	} else {
+		header.Set("Authorization", "Bearer "+meta.APIKey)
+	}
+
+	if beta := c.Request.Header.Get("OpenAI-Beta"); beta != "" {
+		header.Set("OpenAI-Beta", beta)
+	} else if strings.Contains(c.Request.Header.Get("Sec-WebSocket-Protocol"), "openai-beta.realtime-v1") {
+		header.Set("OpenAI-Beta", "realtime=v1")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package openai_compatible
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertAudioRequest passes the OpenAI style audio request through as is
+func ConvertAudioRequest(requestBody []byte) io.Reader {
+	return bytes.NewReader(requestBody)
+}
+
+// AudioHandler forwards the OpenAI style audio response to the client as is,
+// which is the audio for the speech, and the text in the requested format for the transcription.
+func AudioHandler(c *gin.Context, resp *http.Response) *model.ErrorWithStatusCode {
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		return ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
+	}
+	if err := resp.Body.Close(); err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
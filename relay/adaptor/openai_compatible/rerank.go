@@ -0,0 +1,137 @@
+package openai_compatible
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the Jina style rerank request,
+// which is also accepted by SiliconFlow, Baidu Qianfan and most self-hosted rerankers.
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments *bool    `json:"return_documents,omitempty"`
+}
+
+// RerankResponse is the Jina style rerank response,
+// the Voyage style response returns the results in Data instead.
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Results []RerankResult `json:"results,omitempty"`
+	Data    []RerankResult `json:"data,omitempty"`
+	Usage   *RerankUsage   `json:"usage,omitempty"`
+	Meta    *RerankMeta    `json:"meta,omitempty"`
+}
+
+type RerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	// Document is either a string or an object with a text field
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+type RerankUsage struct {
+	PromptTokens int `json:"prompt_tokens,omitempty"`
+	TotalTokens  int `json:"total_tokens,omitempty"`
+}
+
+// RerankMeta is the usage reported by SiliconFlow and Cohere compatible servers
+type RerankMeta struct {
+	Tokens *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"tokens,omitempty"`
+	BilledUnits *struct {
+		SearchUnits int `json:"search_units"`
+	} `json:"billed_units,omitempty"`
+}
+
+// ConvertRerankRequest converts the canonical rerank request to the Jina style request
+func ConvertRerankRequest(request *model.RerankRequest) *RerankRequest {
+	returnDocuments := request.ReturnDocuments
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.Documents,
+		TopN:            request.TopN,
+		ReturnDocuments: &returnDocuments,
+	}
+}
+
+// ConvertRerankResponse converts the Jina or Voyage style rerank response to the canonical response
+func ConvertRerankResponse(response *RerankResponse) *model.RerankResponse {
+	results := response.Results
+	if len(results) == 0 {
+		results = response.Data
+	}
+
+	rerankResponse := &model.RerankResponse{
+		Id:      response.Id,
+		Model:   response.Model,
+		Results: make([]model.RerankResult, 0, len(results)),
+	}
+	for _, result := range results {
+		rerankResponse.Results = append(rerankResponse.Results, model.RerankResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+			Document:       parseRerankDocument(result.Document),
+		})
+	}
+
+	if response.Usage != nil {
+		rerankResponse.Usage.TotalTokens = max(response.Usage.TotalTokens, response.Usage.PromptTokens)
+	}
+	if response.Meta != nil {
+		if response.Meta.Tokens != nil && rerankResponse.Usage.TotalTokens == 0 {
+			rerankResponse.Usage.TotalTokens = response.Meta.Tokens.InputTokens + response.Meta.Tokens.OutputTokens
+		}
+		if response.Meta.BilledUnits != nil {
+			rerankResponse.Usage.SearchUnits = response.Meta.BilledUnits.SearchUnits
+		}
+	}
+
+	return rerankResponse
+}
+
+func parseRerankDocument(raw json.RawMessage) *model.RerankDocument {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return &model.RerankDocument{Text: text}
+	}
+	document := new(model.RerankDocument)
+	if err := json.Unmarshal(raw, document); err != nil {
+		return nil
+	}
+	return document
+}
+
+// RerankHandler converts the Jina or Voyage style rerank response to the canonical response
+func RerankHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.RerankResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	if err = resp.Body.Close(); err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var rerankResponse RerankResponse
+	if err = json.Unmarshal(responseBody, &rerankResponse); err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	return nil, ConvertRerankResponse(&rerankResponse)
+}
@@ -0,0 +1,32 @@
+package openai_compatible
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertRerankResponse(t *testing.T) {
+	for name, body := range map[string]string{
+		"jina": `{"model":"jina-reranker-v2","results":[{"index":1,"relevance_score":0.9,"document":{"text":"b"}}],
+			"usage":{"total_tokens":12}}`,
+		"voyage": `{"model":"rerank-2","data":[{"index":1,"relevance_score":0.9,"document":"b"}],
+			"usage":{"total_tokens":12}}`,
+		"siliconflow": `{"id":"x","results":[{"index":1,"relevance_score":0.9,"document":{"text":"b"}}],
+			"meta":{"tokens":{"input_tokens":12,"output_tokens":0}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var response RerankResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &response))
+			rerankResponse := ConvertRerankResponse(&response)
+			require.Len(t, rerankResponse.Results, 1)
+			assert.Equal(t, 1, rerankResponse.Results[0].Index)
+			assert.Equal(t, 0.9, rerankResponse.Results[0].RelevanceScore)
+			require.NotNil(t, rerankResponse.Results[0].Document)
+			assert.Equal(t, "b", rerankResponse.Results[0].Document.Text)
+			assert.Equal(t, 12, rerankResponse.Usage.TotalTokens)
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -257,6 +258,11 @@ func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
 		// Language Models - Mistral
 		"mistralai/mistral-7b-instruct-v0.2": {Ratio: 0.05 * MilliTokensUsd, CompletionRatio: 1}, // $0.05 per 1M tokens
 		"mistralai/mistral-7b-v0.1":          {Ratio: 0.05 * MilliTokensUsd, CompletionRatio: 1}, // $0.05 per 1M tokens
+
+		// Video Models, billed by ratio.TokensPerSec tokens per second of video
+		"google/veo-3":       {Ratio: 75000 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.75 per second
+		"google/veo-3-fast":  {Ratio: 40000 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.4 per second
+		"kwaivgi/kling-v2.1": {Ratio: 5000 * billingratio.MilliTokensUsd, CompletionRatio: 1},  // $0.05 per second
 	}
 }
 
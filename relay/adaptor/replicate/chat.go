@@ -6,7 +6,6 @@ import (
 	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
@@ -38,73 +37,23 @@ func ChatHandler(c *gin.Context, resp *http.Response) (
 		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
 
-	for {
-		err = func() error {
-			// get task
-			taskReq, err := http.NewRequestWithContext(c.Request.Context(),
-				http.MethodGet, respData.URLs.Get, nil)
-			if err != nil {
-				return errors.Wrap(err, "new request")
-			}
-
-			taskReq.Header.Set("Authorization", "Bearer "+meta.GetByContext(c).APIKey)
-			taskResp, err := http.DefaultClient.Do(taskReq)
-			if err != nil {
-				return errors.Wrap(err, "get task")
-			}
-			defer taskResp.Body.Close()
-
-			if taskResp.StatusCode != http.StatusOK {
-				payload, _ := io.ReadAll(taskResp.Body)
-				return errors.Errorf("bad status code [%d]%s",
-					taskResp.StatusCode, string(payload))
-			}
-
-			taskBody, err := io.ReadAll(taskResp.Body)
-			if err != nil {
-				return errors.Wrap(err, "read task response")
-			}
-
-			taskData := new(ChatResponse)
-			if err = json.Unmarshal(taskBody, taskData); err != nil {
-				return errors.Wrap(err, "decode task response")
-			}
-
-			switch taskData.Status {
-			case "succeeded":
-			case "failed", "canceled":
-				return errors.Errorf("task failed, [%s]%s", taskData.Status, taskData.Error)
-			default:
-				time.Sleep(time.Second * 3)
-				return errNextLoop
-			}
-
-			if taskData.URLs.Stream == "" {
-				return errors.New("stream url is empty")
-			}
-
-			// request stream url
-			responseText, err := chatStreamHandler(c, taskData.URLs.Stream)
-			if err != nil {
-				return errors.Wrap(err, "chat stream handler")
-			}
-
-			ctxMeta := meta.GetByContext(c)
-			usage = openai.ResponseText2Usage(responseText,
-				ctxMeta.ActualModelName, ctxMeta.PromptTokens)
-			return nil
-		}()
-		if err != nil {
-			if errors.Is(err, errNextLoop) {
-				continue
-			}
-
-			return openai.ErrorWrapper(err, "chat_task_failed", http.StatusInternalServerError), nil
-		}
+	taskData, err := waitPrediction(c.Request.Context(), meta.GetByContext(c), respData.ID)
+	if err != nil {
+		return openai.ErrorWrapper(err, "chat_task_failed", http.StatusInternalServerError), nil
+	}
+	if taskData.URLs.Stream == "" {
+		return openai.ErrorWrapper(errors.New("stream url is empty"), "chat_task_failed", http.StatusInternalServerError), nil
+	}
 
-		break
+	// request stream url
+	responseText, err := chatStreamHandler(c, taskData.URLs.Stream)
+	if err != nil {
+		return openai.ErrorWrapper(errors.Wrap(err, "chat stream handler"), "chat_task_failed", http.StatusInternalServerError), nil
 	}
 
+	ctxMeta := meta.GetByContext(c)
+	usage = openai.ResponseText2Usage(responseText,
+		ctxMeta.ActualModelName, ctxMeta.PromptTokens)
 	return nil, usage
 }
 
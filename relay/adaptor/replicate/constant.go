@@ -66,9 +66,11 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"mistralai/mistral-7b-v0.1":                 {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 5.0},  // $0.05/$0.25 per 1M tokens
 
 	// -------------------------------------
-	// Video Models (TODO: implement the adaptor)
+	// Video Models, billed by ratio.TokensPerSec tokens per second of video
 	// -------------------------------------
-	// "minimax/video-01": {Ratio: 1.0 * ratio.MilliTokensUsd, CompletionRatio: 1.0},
+	"google/veo-3":       {Ratio: 75000.0 * ratio.MilliTokensUsd, CompletionRatio: 1.0}, // $0.75 per second
+	"google/veo-3-fast":  {Ratio: 40000.0 * ratio.MilliTokensUsd, CompletionRatio: 1.0}, // $0.4 per second
+	"kwaivgi/kling-v2.1": {Ratio: 5000.0 * ratio.MilliTokensUsd, CompletionRatio: 1.0},  // $0.05 per second
 }
 
 // ModelList derived from ModelRatios for backward compatibility
@@ -10,7 +10,6 @@ import (
 	"io"
 	"net/http"
 	"sync"
-	"time"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
@@ -23,8 +22,6 @@ import (
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
-var errNextLoop = errors.New("next_loop")
-
 // ImageHandler handles the response from the image creation or remix request
 func ImageHandler(c *gin.Context, resp *http.Response) (
 	*model.ErrorWithStatusCode, *model.Usage) {
@@ -46,128 +43,87 @@ func ImageHandler(c *gin.Context, resp *http.Response) (
 		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
 
-	for {
-		err = func() error {
-			// get task
-			taskReq, err := http.NewRequestWithContext(c.Request.Context(),
-				http.MethodGet, respData.URLs.Get, nil)
+	taskData, err := waitPrediction(c.Request.Context(), meta.GetByContext(c), respData.ID)
+	if err != nil {
+		return openai.ErrorWrapper(err, "image_task_failed", http.StatusInternalServerError), nil
+	}
+	if err = writeImageResponse(c, taskData); err != nil {
+		return openai.ErrorWrapper(err, "image_task_failed", http.StatusInternalServerError), nil
+	}
+
+	return nil, nil
+}
+
+// writeImageResponse downloads the images of the succeeded prediction, and writes them to the client in base64
+func writeImageResponse(c *gin.Context, taskData *PredictionResponse) error {
+	output, err := taskData.GetOutput()
+	if err != nil {
+		return errors.Wrap(err, "get output")
+	}
+	if len(output) == 0 {
+		return errors.New("response output is empty")
+	}
+
+	var mu sync.Mutex
+	var pool errgroup.Group
+	respBody := &openai.ImageResponse{
+		Created: taskData.CompletedAt.Unix(),
+		Data:    []openai.ImageData{},
+	}
+
+	for _, imgOut := range output {
+		imgOut := imgOut
+		pool.Go(func() error {
+			// download image
+			downloadReq, err := http.NewRequestWithContext(c.Request.Context(),
+				http.MethodGet, imgOut, nil)
 			if err != nil {
 				return errors.Wrap(err, "new request")
 			}
 
-			taskReq.Header.Set("Authorization", "Bearer "+meta.GetByContext(c).APIKey)
-			taskResp, err := http.DefaultClient.Do(taskReq)
+			imgResp, err := http.DefaultClient.Do(downloadReq)
 			if err != nil {
-				return errors.Wrap(err, "get task")
+				return errors.Wrap(err, "download image")
 			}
-			defer taskResp.Body.Close()
+			defer imgResp.Body.Close()
 
-			if taskResp.StatusCode != http.StatusOK {
-				payload, _ := io.ReadAll(taskResp.Body)
+			if imgResp.StatusCode != http.StatusOK {
+				payload, _ := io.ReadAll(imgResp.Body)
 				return errors.Errorf("bad status code [%d]%s",
-					taskResp.StatusCode, string(payload))
+					imgResp.StatusCode, string(payload))
 			}
 
-			taskBody, err := io.ReadAll(taskResp.Body)
+			imgData, err := io.ReadAll(imgResp.Body)
 			if err != nil {
-				return errors.Wrap(err, "read task response")
+				return errors.Wrap(err, "read image")
 			}
 
-			taskData := new(ImageResponse)
-			if err = json.Unmarshal(taskBody, taskData); err != nil {
-				return errors.Wrap(err, "decode task response")
-			}
-
-			switch taskData.Status {
-			case "succeeded":
-			case "failed", "canceled":
-				return errors.Errorf("task failed, [%s]%s", taskData.Status, taskData.Error)
-			default:
-				time.Sleep(time.Second * 3)
-				return errNextLoop
-			}
-
-			output, err := taskData.GetOutput()
+			imgData, err = ConvertImageToPNG(imgData)
 			if err != nil {
-				return errors.Wrap(err, "get output")
-			}
-			if len(output) == 0 {
-				return errors.New("response output is empty")
-			}
-
-			var mu sync.Mutex
-			var pool errgroup.Group
-			respBody := &openai.ImageResponse{
-				Created: taskData.CompletedAt.Unix(),
-				Data:    []openai.ImageData{},
-			}
-
-			for _, imgOut := range output {
-				imgOut := imgOut
-				pool.Go(func() error {
-					// download image
-					downloadReq, err := http.NewRequestWithContext(c.Request.Context(),
-						http.MethodGet, imgOut, nil)
-					if err != nil {
-						return errors.Wrap(err, "new request")
-					}
-
-					imgResp, err := http.DefaultClient.Do(downloadReq)
-					if err != nil {
-						return errors.Wrap(err, "download image")
-					}
-					defer imgResp.Body.Close()
-
-					if imgResp.StatusCode != http.StatusOK {
-						payload, _ := io.ReadAll(imgResp.Body)
-						return errors.Errorf("bad status code [%d]%s",
-							imgResp.StatusCode, string(payload))
-					}
-
-					imgData, err := io.ReadAll(imgResp.Body)
-					if err != nil {
-						return errors.Wrap(err, "read image")
-					}
-
-					imgData, err = ConvertImageToPNG(imgData)
-					if err != nil {
-						return errors.Wrap(err, "convert image")
-					}
-
-					mu.Lock()
-					respBody.Data = append(respBody.Data, openai.ImageData{
-						B64Json: fmt.Sprintf("data:image/png;base64,%s",
-							base64.StdEncoding.EncodeToString(imgData)),
-					})
-					mu.Unlock()
-
-					return nil
-				})
+				return errors.Wrap(err, "convert image")
 			}
 
-			if err := pool.Wait(); err != nil {
-				if len(respBody.Data) == 0 {
-					return errors.WithStack(err)
-				}
-
-				logger.Error(c, fmt.Sprintf("some images failed to download: %+v", err))
-			}
+			mu.Lock()
+			respBody.Data = append(respBody.Data, openai.ImageData{
+				B64Json: fmt.Sprintf("data:image/png;base64,%s",
+					base64.StdEncoding.EncodeToString(imgData)),
+			})
+			mu.Unlock()
 
-			c.JSON(http.StatusOK, respBody)
 			return nil
-		}()
-		if err != nil {
-			if errors.Is(err, errNextLoop) {
-				continue
-			}
+		})
+	}
 
-			return openai.ErrorWrapper(err, "image_task_failed", http.StatusInternalServerError), nil
+	if err := pool.Wait(); err != nil {
+		if len(respBody.Data) == 0 {
+			return errors.WithStack(err)
 		}
 
-		break
+		logger.Error(c, fmt.Sprintf("some images failed to download: %+v", err))
 	}
 
-	return nil, nil
+	c.JSON(http.StatusOK, respBody)
+	return nil
 }
 
 // ConvertImageToPNG converts a WebP image to PNG format
@@ -269,3 +269,39 @@ type ChatResponseUrl struct {
 	Get    string `json:"get"`
 	Cancel string `json:"cancel"`
 }
+
+// VideoRequest is the request of the video models
+//
+// https://replicate.com/google/veo-3/api/schema
+type VideoRequest struct {
+	Input VideoInput `json:"input" binding:"required"`
+}
+
+// VideoInput is input of VideoRequest, the models ignore the fields they don't support
+type VideoInput struct {
+	Prompt         string `json:"prompt"`
+	Duration       int    `json:"duration,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	// Image is the first frame of the google models
+	Image string `json:"image,omitempty"`
+	// StartImage is the first frame of the kling models
+	StartImage string `json:"start_image,omitempty"`
+}
+
+// PredictionResponse is the prediction of any model
+//
+// https://replicate.com/docs/reference/http#predictions.get
+type PredictionResponse struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error"`
+	CompletedAt time.Time `json:"completed_at"`
+	// Output could be `string` or `[]string`
+	Output any             `json:"output"`
+	URLs   ChatResponseUrl `json:"urls"`
+}
+
+func (r *PredictionResponse) GetOutput() ([]string, error) {
+	return (&ImageResponse{Output: r.Output}).GetOutput()
+}
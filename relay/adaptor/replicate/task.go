@@ -0,0 +1,105 @@
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// FetchTask implements adaptor.TaskAdaptor, the upstream task id is the id of the prediction
+func (a *Adaptor) FetchTask(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (*model.TaskResult, error) {
+	prediction, err := getPrediction(ctx, meta, upstreamTaskId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return convertTaskResult(prediction), nil
+}
+
+// predictionPollInterval is the interval to poll the prediction waited inside a request
+const predictionPollInterval = 3 * time.Second
+
+// waitPrediction polls the prediction until it succeeds, it's used by the synchronous APIs
+// like the chat and the images, while the asynchronous tasks are polled by the task poller.
+func waitPrediction(ctx context.Context, meta *meta.Meta, predictionId string) (*PredictionResponse, error) {
+	for {
+		prediction, err := getPrediction(ctx, meta, predictionId)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch prediction.Status {
+		case "succeeded":
+			return prediction, nil
+		case "failed", "canceled":
+			return nil, errors.Errorf("task failed, [%s]%s", prediction.Status, prediction.Error)
+		}
+
+		select {
+		case <-time.After(predictionPollInterval):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "wait prediction")
+		}
+	}
+}
+
+// getPrediction gets the prediction by id
+func getPrediction(ctx context.Context, meta *meta.Meta, predictionId string) (*PredictionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("https://api.replicate.com/v1/predictions/%s", predictionId), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "get prediction")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read prediction response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("bad status code [%d]%s", resp.StatusCode, string(respBody))
+	}
+
+	prediction := new(PredictionResponse)
+	if err = json.Unmarshal(respBody, prediction); err != nil {
+		return nil, errors.Wrap(err, "decode prediction response")
+	}
+	return prediction, nil
+}
+
+// convertTaskResult maps the status of the prediction to the canonical task status
+func convertTaskResult(prediction *PredictionResponse) *model.TaskResult {
+	switch prediction.Status {
+	case "succeeded":
+		return &model.TaskResult{Status: model.TaskStatusCompleted, Progress: 100}
+	case "failed", "canceled":
+		message := prediction.Error
+		if message == "" {
+			message = "prediction is " + prediction.Status
+		}
+		return &model.TaskResult{
+			Status: model.TaskStatusFailed,
+			Error: &model.Error{
+				Message: message,
+				Code:    "prediction_" + prediction.Status,
+			},
+		}
+	case "processing":
+		return &model.TaskResult{Status: model.TaskStatusInProgress}
+	default:
+		return &model.TaskResult{Status: model.TaskStatusQueued}
+	}
+}
@@ -0,0 +1,21 @@
+package replicate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertTaskResult(t *testing.T) {
+	assert.Equal(t, model.TaskStatusQueued, convertTaskResult(&PredictionResponse{Status: "starting"}).Status)
+	assert.Equal(t, model.TaskStatusInProgress, convertTaskResult(&PredictionResponse{Status: "processing"}).Status)
+	assert.Equal(t, model.TaskStatusCompleted, convertTaskResult(&PredictionResponse{Status: "succeeded"}).Status)
+
+	result := convertTaskResult(&PredictionResponse{Status: "failed", Error: "out of memory"})
+	assert.Equal(t, model.TaskStatusFailed, result.Status)
+	assert.Equal(t, "out of memory", result.Error.Message)
+	result = convertTaskResult(&PredictionResponse{Status: "canceled"})
+	assert.Equal(t, "prediction is canceled", result.Error.Message)
+}
@@ -0,0 +1,100 @@
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertVideoRequest implements adaptor.VideoAdaptor
+func (a *Adaptor) ConvertVideoRequest(c *gin.Context, meta *meta.Meta, request *model.VideoRequest) (any, error) {
+	return convertVideoRequest(meta.OriginModelName, request), nil
+}
+
+func convertVideoRequest(modelName string, request *model.VideoRequest) *VideoRequest {
+	convertedReq := &VideoRequest{
+		Input: VideoInput{
+			Prompt:         request.Prompt,
+			Duration:       request.GetSeconds(),
+			AspectRatio:    request.AspectRatio(),
+			NegativePrompt: request.NegativePrompt,
+		},
+	}
+
+	// replicate accepts both the urls and the data urls of the images
+	if strings.HasPrefix(modelName, "kwaivgi/kling") {
+		convertedReq.Input.StartImage = request.InputReference
+	} else {
+		convertedReq.Input.Image = request.InputReference
+	}
+
+	return convertedReq
+}
+
+// DoVideoResponse implements adaptor.VideoAdaptor, the upstream task id is the id of the prediction
+func (a *Adaptor) DoVideoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (string, *model.ErrorWithStatusCode) {
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", openai.ErrorWrapper(
+			errors.Errorf("bad_status_code [%d]%s", resp.StatusCode, string(respBody)),
+			"bad_status_code", resp.StatusCode)
+	}
+
+	prediction := new(PredictionResponse)
+	if err = json.Unmarshal(respBody, prediction); err != nil {
+		return "", openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if prediction.ID == "" {
+		return "", openai.ErrorWrapper(errors.New("prediction id is empty"), "bad_response", http.StatusBadGateway)
+	}
+	return prediction.ID, nil
+}
+
+// GetVideoContent implements adaptor.VideoAdaptor, the output of the prediction is downloaded
+func (a *Adaptor) GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (io.ReadCloser, string, error) {
+	prediction, err := getPrediction(ctx, meta, upstreamTaskId)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	output, err := prediction.GetOutput()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "get output")
+	}
+	if len(output) == 0 {
+		return nil, "", errors.New("response output is empty")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, output[0], nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "new request")
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "download video")
+	}
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, "", errors.Errorf("bad status code [%d]%s", resp.StatusCode, string(payload))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	return resp.Body, contentType, nil
+}
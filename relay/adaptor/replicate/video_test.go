@@ -0,0 +1,30 @@
+package replicate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertVideoRequest(t *testing.T) {
+	request := &model.VideoRequest{
+		Prompt:         "a cat",
+		Seconds:        5,
+		Size:           "1280x720",
+		InputReference: "https://example.com/cat.png",
+	}
+
+	converted := convertVideoRequest("google/veo-3", request)
+	assert.Equal(t, VideoInput{
+		Prompt:      "a cat",
+		Duration:    5,
+		AspectRatio: "16:9",
+		Image:       "https://example.com/cat.png",
+	}, converted.Input)
+
+	converted = convertVideoRequest("kwaivgi/kling-v2.1", request)
+	assert.Equal(t, "https://example.com/cat.png", converted.Input.StartImage)
+	assert.Empty(t, converted.Input.Image)
+}
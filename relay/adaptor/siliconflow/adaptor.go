@@ -58,6 +58,27 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor, SiliconFlow accepts the Jina style rerank request
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	return openai_compatible.ConvertRerankRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor, the tokens are reported in meta.tokens
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	err, rerankResponse := openai_compatible.RerankHandler(c, resp)
+	return rerankResponse, err
+}
+
+// ConvertAudioRequest implements adaptor.AudioAdaptor, the speech and transcription APIs are OpenAI compatible
+func (a *Adaptor) ConvertAudioRequest(c *gin.Context, meta *meta.Meta, requestBody []byte) (io.Reader, error) {
+	return openai_compatible.ConvertAudioRequest(requestBody), nil
+}
+
+// DoAudioResponse implements adaptor.AudioAdaptor
+func (a *Adaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) *model.ErrorWithStatusCode {
+	return openai_compatible.AudioHandler(c, resp)
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return adaptor.GetModelListFromPricing(ModelRatios)
 }
@@ -30,6 +30,15 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"internlm/internlm2_5-7b-chat":            {Ratio: 0.07 * ratio.MilliTokensUsd, CompletionRatio: 1},
 	"google/gemma-2-9b-it":                    {Ratio: 0.14 * ratio.MilliTokensUsd, CompletionRatio: 1},
 	"google/gemma-2-27b-it":                   {Ratio: 0.28 * ratio.MilliTokensUsd, CompletionRatio: 1},
+
+	// Audio Models, the transcription is billed by the audio duration, and the speech by the input length
+	"FunAudioLLM/SenseVoiceSmall": {Ratio: 0.01 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"FunAudioLLM/CosyVoice2-0.5B": {Ratio: 15 * ratio.MilliTokensUsd, CompletionRatio: 1},
+
+	// Rerank Models
+	"BAAI/bge-reranker-v2-m3":             {Ratio: 0.01 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"netease-youdao/bce-reranker-base_v1": {Ratio: 0.01 * ratio.MilliTokensUsd, CompletionRatio: 1},
+	"Qwen/Qwen3-Reranker-8B":              {Ratio: 0.04 * ratio.MilliTokensUsd, CompletionRatio: 1},
 }
 
 // ModelList derived from ModelRatios for backward compatibility
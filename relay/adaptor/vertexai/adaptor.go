@@ -1,6 +1,8 @@
 package vertexai
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,7 +14,13 @@ import (
 
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	channelhelper "github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	claude "github.com/songquanpeng/one-api/relay/adaptor/vertexai/claude"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/imagen"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/ranking"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/veo"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	relayModel "github.com/songquanpeng/one-api/relay/model"
@@ -76,6 +84,92 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return adaptor.DoResponse(c, resp, meta)
 }
 
+// SupportClaudeMessages reports whether the model is a vertex claude model,
+// which could be served by the native Messages API.
+func (a *Adaptor) SupportClaudeMessages(modelName string) bool {
+	return modelMapping[modelName] == VertexAIClaude
+}
+
+// DoClaudeMessages forwards the native Messages API request to vertex rawPredict
+func (a *Adaptor) DoClaudeMessages(c *gin.Context, meta *meta.Meta, requestBody []byte) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	requestBody, convErr := claude.ConvertMessagesRequest(requestBody)
+	if convErr != nil {
+		return nil, openai.ErrorWrapper(convErr, "convert_request_failed", http.StatusBadRequest)
+	}
+
+	resp, doErr := a.DoRequest(c, meta, bytes.NewReader(requestBody))
+	if doErr != nil {
+		return nil, openai.ErrorWrapper(doErr, "do_request_failed", http.StatusInternalServerError)
+	}
+	return anthropic.DoMessagesResponse(c, resp, meta)
+}
+
+// ConvertRerankRequest implements adaptor.RerankAdaptor, the semantic ranker models
+// are served by the ranking API of Vertex AI Search.
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	if modelMapping[request.Model] != VertexAIRanking {
+		return nil, errors.Errorf("model %s does not support rerank", request.Model)
+	}
+	return ranking.ConvertRerankRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	err, rerankResponse := ranking.RerankHandler(c, resp)
+	return rerankResponse, err
+}
+
+// ConvertVideoRequest implements adaptor.VideoAdaptor, the videos are generated by the Veo models
+func (a *Adaptor) ConvertVideoRequest(c *gin.Context, meta *meta.Meta, request *model.VideoRequest) (any, error) {
+	if modelMapping[meta.ActualModelName] != VertexAIVeo {
+		return nil, errors.Errorf("model %s does not support video generation", meta.ActualModelName)
+	}
+	return veo.ConvertVideoRequest(request)
+}
+
+// DoVideoResponse implements adaptor.VideoAdaptor, the upstream task id is the name of the long-running operation
+func (a *Adaptor) DoVideoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (string, *model.ErrorWithStatusCode) {
+	return veo.ParseCreateVideoResponse(resp)
+}
+
+// FetchTask implements adaptor.TaskAdaptor, the Veo operations are fetched by fetchPredictOperation
+func (a *Adaptor) FetchTask(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (*model.TaskResult, error) {
+	operation, _, err := a.fetchVideoOperation(ctx, meta, upstreamTaskId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return veo.ConvertTaskResult(operation), nil
+}
+
+// GetVideoContent implements adaptor.VideoAdaptor
+func (a *Adaptor) GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamTaskId string) (io.ReadCloser, string, error) {
+	operation, token, err := a.fetchVideoOperation(ctx, meta, upstreamTaskId)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	if !operation.Done {
+		return nil, "", errors.Errorf("operation %s is not done", upstreamTaskId)
+	}
+	return veo.GetVideoContent(ctx, operation, token)
+}
+
+// fetchVideoOperation fetches the Veo operation, and returns the token to download the video
+func (a *Adaptor) fetchVideoOperation(ctx context.Context, meta *meta.Meta, operationName string) (*veo.PollVideoTaskResponse, string, error) {
+	predictURL, err := a.GetRequestURL(meta)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "get request url")
+	}
+	token, err := getToken(ctx, meta.ChannelId, meta.Config.VertexAIADC)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "get token")
+	}
+	operation, err := veo.FetchOperation(ctx, veo.GetFetchOperationURL(predictURL), token, operationName)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	return operation, token, nil
+}
+
 func (a *Adaptor) GetModelList() (models []string) {
 	models = modelList
 	return
@@ -106,6 +200,16 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 			location = meta.Config.Region
 			baseHost = fmt.Sprintf("%s-aiplatform.googleapis.com", meta.Config.Region)
 		}
+	case modelMapping[meta.ActualModelName] == VertexAIRanking:
+		// https://cloud.google.com/generative-ai-app-builder/docs/ranking
+		return fmt.Sprintf("https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/default_ranking_config:rank",
+			meta.Config.VertexAIProjectID,
+		), nil
+	case modelMapping[meta.ActualModelName] == VertexAIVeo:
+		// https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/veo-video-generation
+		suffix = "predictLongRunning"
+		location = meta.Config.Region
+		baseHost = fmt.Sprintf("%s-aiplatform.googleapis.com", meta.Config.Region)
 	case slices.Contains(imagen.ModelList, meta.ActualModelName):
 		return fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/imagen-3.0-generate-001:predict",
 			meta.Config.Region, meta.Config.VertexAIProjectID, meta.Config.Region,
@@ -219,8 +323,14 @@ func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
 		// VertexAI Imagen Models (image generation)
 		"imagen-3.0-generate-001": {Ratio: 0.04 * MilliTokensUsd, CompletionRatio: 1}, // Per image pricing
 
-		// VertexAI Veo Models (video generation)
-		"veo-001": {Ratio: 0.1 * MilliTokensUsd, CompletionRatio: 1}, // Per video pricing
+		// VertexAI Veo Models (video generation), billed by ratio.TokensPerSec tokens per second of video
+		"veo-2.0-generate-001":     {Ratio: 50000 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.5 per second
+		"veo-3.0-generate-preview": {Ratio: 75000 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.75 per second
+
+		// VertexAI semantic rankers, billed by search units of billingratio.RerankTokensPerSearchUnit tokens
+		"semantic-ranker-default-004": {Ratio: 1 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.001 per search unit
+		"semantic-ranker-fast-004":    {Ratio: 1 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.001 per search unit
+		"semantic-ranker-512-003":     {Ratio: 1 * billingratio.MilliTokensUsd, CompletionRatio: 1}, // $0.001 per search unit
 	}
 }
 
@@ -66,6 +66,13 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return req, nil
 }
 
+// ConvertMessagesRequest converts a native Messages API request body for vertex,
+// which expects the model in the url and the anthropic_version in the body.
+func ConvertMessagesRequest(body []byte) ([]byte, error) {
+	return anthropic.RewriteMessagesRequest(body,
+		map[string]any{"anthropic_version": anthropicVersion}, "model")
+}
+
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, request *model.ImageRequest) (any, error) {
 	return nil, errors.New("not support image request")
 }
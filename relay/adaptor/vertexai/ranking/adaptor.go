@@ -0,0 +1,89 @@
+package ranking
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ModelList are the semantic ranker models, which are billed by search units
+var ModelList = []string{
+	"semantic-ranker-default-004",
+	"semantic-ranker-fast-004",
+	"semantic-ranker-512-003",
+}
+
+// Adaptor serves the ranking models, which only support the rerank requests
+type Adaptor struct {
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	return nil, errors.New("ranking models only support the rerank requests")
+}
+
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, request *model.ImageRequest) (any, error) {
+	return nil, errors.New("ranking models only support the rerank requests")
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	return nil, openai.ErrorWrapper(errors.New("ranking models only support the rerank requests"),
+		"unsupported_relay_mode", http.StatusBadRequest)
+}
+
+// ConvertRerankRequest converts the canonical rerank request to the rank request
+func ConvertRerankRequest(request *model.RerankRequest) *RankRequest {
+	rankRequest := &RankRequest{
+		Model:                         request.Model,
+		Query:                         request.Query,
+		Records:                       make([]Record, 0, len(request.Documents)),
+		TopN:                          request.TopN,
+		IgnoreRecordDetailsInResponse: true,
+	}
+	for i, document := range request.Documents {
+		rankRequest.Records = append(rankRequest.Records, Record{
+			Id:      strconv.Itoa(i),
+			Content: document,
+		})
+	}
+	return rankRequest
+}
+
+// RerankHandler converts the rank response to the canonical rerank response
+func RerankHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.RerankResponse) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if err = resp.Body.Close(); err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	var rankResponse RankResponse
+	if err = json.Unmarshal(responseBody, &rankResponse); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+
+	rerankResponse := &model.RerankResponse{
+		Results: make([]model.RerankResult, 0, len(rankResponse.Records)),
+	}
+	for _, record := range rankResponse.Records {
+		index, err := strconv.Atoi(record.Id)
+		if err != nil {
+			return openai.ErrorWrapper(errors.Wrapf(err, "parse record id %q", record.Id),
+				"invalid_response", http.StatusInternalServerError), nil
+		}
+		rerankResponse.Results = append(rerankResponse.Results, model.RerankResult{
+			Index:          index,
+			RelevanceScore: record.Score,
+		})
+	}
+	return nil, rerankResponse
+}
@@ -0,0 +1,23 @@
+package ranking
+
+// RankRequest is the request of the ranking API of Vertex AI Search,
+// https://cloud.google.com/generative-ai-app-builder/docs/ranking
+type RankRequest struct {
+	Model                         string   `json:"model"`
+	Query                         string   `json:"query"`
+	Records                       []Record `json:"records"`
+	TopN                          int      `json:"topN,omitempty"`
+	IgnoreRecordDetailsInResponse bool     `json:"ignoreRecordDetailsInResponse,omitempty"`
+}
+
+// Record is a document to rank, its id is the index of the document in the rerank request
+type Record struct {
+	Id      string  `json:"id"`
+	Content string  `json:"content,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+// RankResponse contains the records sorted by the score in descending order
+type RankResponse struct {
+	Records []Record `json:"records"`
+}
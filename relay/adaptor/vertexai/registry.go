@@ -9,6 +9,7 @@ import (
 	claude "github.com/songquanpeng/one-api/relay/adaptor/vertexai/claude"
 	gemini "github.com/songquanpeng/one-api/relay/adaptor/vertexai/gemini"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/imagen"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/ranking"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/veo"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -21,6 +22,7 @@ const (
 	VertexAIGemini
 	VertexAIImagen
 	VertexAIVeo
+	VertexAIRanking
 )
 
 var modelMapping = map[string]VertexAIModelType{}
@@ -50,6 +52,12 @@ func init() {
 	for _, model := range veo.ModelList {
 		modelMapping[model] = VertexAIVeo
 	}
+
+	// register vertex ranking models
+	modelList = append(modelList, ranking.ModelList...)
+	for _, model := range ranking.ModelList {
+		modelMapping[model] = VertexAIRanking
+	}
 }
 
 type innerAIAdapter interface {
@@ -69,6 +77,8 @@ func GetAdaptor(model string) innerAIAdapter {
 		return &imagen.Adaptor{}
 	case VertexAIVeo:
 		return &veo.Adaptor{}
+	case VertexAIRanking:
+		return &ranking.Adaptor{}
 	default:
 		return nil
 	}
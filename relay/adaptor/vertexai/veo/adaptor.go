@@ -1,9 +1,7 @@
 package veo
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -127,6 +125,8 @@ func (a *Adaptor) GetChannelName() string {
 	return "vertex_ai_veo"
 }
 
+// pollVideoTask waits for the operation inside the chat request,
+// while the tasks of the video API are polled by the task poller instead.
 func pollVideoTask(
 	c *gin.Context,
 	resp *http.Response,
@@ -137,60 +137,19 @@ func pollVideoTask(
 		return openai.ErrorWrapper(errors.Wrap(err, "unmarshal_poll_response_failed"), "unmarshal_poll_response_failed", http.StatusInternalServerError)
 	}
 
-	pollUrl := strings.ReplaceAll(resp.Request.RequestURI,
-		actionPredictLongRunning, actionFetchOperation)
-
-	pollRequestBody := PollVideoTaskRequest{
-		OperationName: pollTask.Name,
-	}
-	pollBodyBytes, err := json.Marshal(pollRequestBody)
-	if err != nil {
-		return openai.ErrorWrapper(errors.Wrap(err, "marshal_poll_request_failed"), "marshal_poll_request_failed", http.StatusInternalServerError)
-	}
-
+	// the operation is fetched with the same url and token of the predictLongRunning request
+	fetchURL := GetFetchOperationURL(resp.Request.URL.String())
+	token := strings.TrimPrefix(resp.Request.Header.Get("Authorization"), "Bearer ")
 	for {
-		var videoResult *PollVideoTaskResponse
-		var pollAttemptErr *model.ErrorWithStatusCode
-
-		func() { // Anonymous function to scope defer
-			req, err := http.NewRequestWithContext(c.Request.Context(),
-				http.MethodPost, pollUrl, bytes.NewBuffer(pollBodyBytes))
-			if err != nil {
-				pollAttemptErr = openai.ErrorWrapper(errors.Wrap(err, "create_poll_request_failed"), "create_poll_request_failed", http.StatusInternalServerError)
-				return
-			}
-
-			req.Header.Set("Content-Type", "application/json")
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				pollAttemptErr = openai.ErrorWrapper(errors.Wrap(err, "do_poll_request_failed"), "do_poll_request_failed", http.StatusServiceUnavailable)
-				return
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				bodyBytes, _ := io.ReadAll(resp.Body)
-				errMsg := fmt.Sprintf("poll_video_task_failed, status_code: %d, body: %s", resp.StatusCode, string(bodyBytes))
-				pollAttemptErr = openai.ErrorWrapper(errors.New(errMsg), "poll_request_failed_status", resp.StatusCode)
-				return
-			}
-
-			currentVideoResult := new(PollVideoTaskResponse)
-			if err := json.NewDecoder(resp.Body).Decode(currentVideoResult); err != nil {
-				pollAttemptErr = openai.ErrorWrapper(errors.Wrap(err, "unmarshal_poll_response_failed"), "unmarshal_poll_response_failed", http.StatusInternalServerError)
-				return
-			}
-			videoResult = currentVideoResult
-		}()
-
-		if pollAttemptErr != nil {
-			return pollAttemptErr
+		videoResult, err := FetchOperation(c.Request.Context(), fetchURL, token, pollTask.Name)
+		if err != nil {
+			return openai.ErrorWrapper(err, "poll_video_task_failed", http.StatusServiceUnavailable)
 		}
-
-		if videoResult != nil {
-			if videoResult.Done {
-				return convert2OpenaiResponse(c, videoResult)
-			}
+		if videoResult.Error != nil {
+			return openai.ErrorWrapper(errors.New(videoResult.Error.Message), "veo_api_error", http.StatusInternalServerError)
+		}
+		if videoResult.Done {
+			return convert2OpenaiResponse(c, videoResult)
 		}
 
 		// Task not done, wait before next poll
@@ -46,11 +46,29 @@ type PollVideoTaskResponse struct {
 	Name     string                    `json:"name"`
 	Done     bool                      `json:"done"`
 	Response PollVideoTaskResponseData `json:"response"`
+	// Error is set if the operation is failed
+	Error *OperationError `json:"error,omitempty"`
+}
+
+type OperationError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type PollVideoTaskResponseData struct {
 	Type             string            `json:"@type"`
 	GeneratedSamples []GeneratedSample `json:"generatedSamples"`
+	// Videos is returned by the newer models instead of GeneratedSamples
+	Videos                  []GeneratedVideo `json:"videos"`
+	RaiMediaFilteredCount   int              `json:"raiMediaFilteredCount"`
+	RaiMediaFilteredReasons []string         `json:"raiMediaFilteredReasons"`
+}
+
+// GeneratedVideo is stored in GCS if the storageUri is set, otherwise it is returned in base64
+type GeneratedVideo struct {
+	GcsUri             string `json:"gcsUri"`
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+	MimeType           string `json:"mimeType"`
 }
 
 type GeneratedSample struct {
@@ -0,0 +1,208 @@
+package veo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ConvertVideoRequest converts the canonical video request to the Veo request
+func ConvertVideoRequest(request *model.VideoRequest) (*CreateVideoRequest, error) {
+	duration := request.GetSeconds()
+
+	convertedReq := &CreateVideoRequest{
+		Instances: []CreateVideoInstance{
+			{
+				Prompt: request.Prompt,
+			},
+		},
+		Parameters: CreateVideoParameters{
+			SampleCount:     1,
+			DurationSeconds: &duration,
+		},
+	}
+	if aspectRatio := request.AspectRatio(); aspectRatio != "" {
+		convertedReq.Parameters.AspectRatio = &aspectRatio
+	}
+	if request.NegativePrompt != "" {
+		convertedReq.Parameters.NegativePrompt = &request.NegativePrompt
+	}
+	if request.InputReference != "" {
+		mimeType, data, err := image.GetImageFromUrl(request.InputReference)
+		if err != nil {
+			return nil, errors.Wrap(err, "get input reference")
+		}
+		convertedReq.Instances[0].Image = &CreateVideoInstanceImage{
+			BytesBase64Encoded: data,
+			MimeType:           &mimeType,
+		}
+	}
+
+	return convertedReq, nil
+}
+
+// ParseCreateVideoResponse returns the operation name of the predictLongRunning response
+func ParseCreateVideoResponse(resp *http.Response) (string, *model.ErrorWithStatusCode) {
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", openai.ErrorWrapper(errors.New(string(respBody)), "veo_api_error", resp.StatusCode)
+	}
+
+	task := new(CreateVideoTaskResponse)
+	if err = json.Unmarshal(respBody, task); err != nil {
+		return "", openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if task.Name == "" {
+		return "", openai.ErrorWrapper(errors.New("operation name is empty"), "veo_api_error", http.StatusBadGateway)
+	}
+	return task.Name, nil
+}
+
+// FetchOperation fetches the operation by the fetchPredictOperation action,
+// the fetchURL is the predictLongRunning url with the action replaced.
+func FetchOperation(ctx context.Context, fetchURL string, token string, operationName string) (*PollVideoTaskResponse, error) {
+	body, err := json.Marshal(PollVideoTaskRequest{OperationName: operationName})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal fetch operation request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fetchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "new fetch operation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch operation")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read fetch operation response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetch operation failed, status code: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	operation := new(PollVideoTaskResponse)
+	if err = json.Unmarshal(respBody, operation); err != nil {
+		return nil, errors.Wrap(err, "unmarshal fetch operation response")
+	}
+	return operation, nil
+}
+
+// GetFetchOperationURL returns the fetchPredictOperation url of the predictLongRunning url
+func GetFetchOperationURL(predictURL string) string {
+	return strings.ReplaceAll(predictURL, actionPredictLongRunning, actionFetchOperation)
+}
+
+// ConvertTaskResult converts the operation to the canonical task result,
+// Veo doesn't report the progress of the running operation.
+func ConvertTaskResult(operation *PollVideoTaskResponse) *model.TaskResult {
+	switch {
+	case operation.Error != nil:
+		return &model.TaskResult{
+			Status: model.TaskStatusFailed,
+			Error: &model.Error{
+				Message: operation.Error.Message,
+				Code:    operation.Error.Code,
+			},
+		}
+	case !operation.Done:
+		return &model.TaskResult{Status: model.TaskStatusInProgress}
+	case len(operation.Response.Videos) == 0 && len(operation.Response.GeneratedSamples) == 0:
+		message := "no video is generated"
+		if len(operation.Response.RaiMediaFilteredReasons) != 0 {
+			message = strings.Join(operation.Response.RaiMediaFilteredReasons, "; ")
+		}
+		return &model.TaskResult{
+			Status: model.TaskStatusFailed,
+			Error: &model.Error{
+				Message: message,
+				Code:    "content_filtered",
+			},
+		}
+	default:
+		return &model.TaskResult{Status: model.TaskStatusCompleted, Progress: 100}
+	}
+}
+
+// GetVideoContent returns the first video of the done operation,
+// the video stored in GCS is downloaded with the token of the channel.
+func GetVideoContent(ctx context.Context, operation *PollVideoTaskResponse, token string) (io.ReadCloser, string, error) {
+	var video GeneratedVideo
+	switch {
+	case len(operation.Response.Videos) != 0:
+		video = operation.Response.Videos[0]
+	case len(operation.Response.GeneratedSamples) != 0:
+		video = GeneratedVideo{GcsUri: operation.Response.GeneratedSamples[0].Video.URI}
+	default:
+		return nil, "", errors.New("no video is generated")
+	}
+
+	contentType := video.MimeType
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	if video.BytesBase64Encoded != "" {
+		data, err := base64.StdEncoding.DecodeString(video.BytesBase64Encoded)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "decode video")
+		}
+		return io.NopCloser(bytes.NewReader(data)), contentType, nil
+	}
+
+	downloadURL, err := getGCSDownloadURL(video.GcsUri)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "new download request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "download video")
+	}
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, "", errors.Errorf("download video failed, status code: %d, body: %s", resp.StatusCode, string(payload))
+	}
+	if resp.Header.Get("Content-Type") != "" {
+		contentType = resp.Header.Get("Content-Type")
+	}
+	return resp.Body, contentType, nil
+}
+
+// getGCSDownloadURL converts gs://bucket/object to the url to download the object with a bearer token
+func getGCSDownloadURL(gcsUri string) (string, error) {
+	path, ok := strings.CutPrefix(gcsUri, "gs://")
+	if !ok {
+		return "", errors.Errorf("unsupported video uri %q", gcsUri)
+	}
+	bucket, object, ok := strings.Cut(path, "/")
+	if !ok || bucket == "" || object == "" {
+		return "", errors.Errorf("invalid video uri %q", gcsUri)
+	}
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, object), nil
+}
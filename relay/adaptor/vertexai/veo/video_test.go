@@ -0,0 +1,71 @@
+package veo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertVideoRequest(t *testing.T) {
+	converted, err := ConvertVideoRequest(&model.VideoRequest{
+		Prompt:         "a cat",
+		Size:           "720x1280",
+		NegativePrompt: "dogs",
+		InputReference: "data:image/png;base64,aGVsbG8=",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "a cat", converted.Instances[0].Prompt)
+	assert.Equal(t, "aGVsbG8=", converted.Instances[0].Image.BytesBase64Encoded)
+	assert.Equal(t, "image/png", *converted.Instances[0].Image.MimeType)
+	assert.Equal(t, model.DefaultVideoSeconds, *converted.Parameters.DurationSeconds)
+	assert.Equal(t, "9:16", *converted.Parameters.AspectRatio)
+	assert.Equal(t, "dogs", *converted.Parameters.NegativePrompt)
+}
+
+func TestConvertTaskResult(t *testing.T) {
+	parse := func(body string) *model.TaskResult {
+		operation := new(PollVideoTaskResponse)
+		require.NoError(t, json.Unmarshal([]byte(body), operation))
+		return ConvertTaskResult(operation)
+	}
+
+	assert.Equal(t, model.TaskStatusInProgress, parse(`{"name":"op"}`).Status)
+	assert.Equal(t, model.TaskStatusCompleted,
+		parse(`{"name":"op","done":true,"response":{"videos":[{"gcsUri":"gs://bucket/video.mp4"}]}}`).Status)
+
+	result := parse(`{"name":"op","done":true,"error":{"code":3,"message":"invalid prompt"}}`)
+	assert.Equal(t, model.TaskStatusFailed, result.Status)
+	assert.Equal(t, "invalid prompt", result.Error.Message)
+
+	result = parse(`{"name":"op","done":true,"response":{"raiMediaFilteredCount":1,"raiMediaFilteredReasons":["unsafe"]}}`)
+	assert.Equal(t, model.TaskStatusFailed, result.Status)
+	assert.Equal(t, "unsafe", result.Error.Message)
+}
+
+func TestGetVideoContent(t *testing.T) {
+	operation := &PollVideoTaskResponse{
+		Done: true,
+		Response: PollVideoTaskResponseData{
+			Videos: []GeneratedVideo{{BytesBase64Encoded: "aGVsbG8=", MimeType: "video/webm"}},
+		},
+	}
+	content, contentType, err := GetVideoContent(context.Background(), operation, "token")
+	require.NoError(t, err)
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, "video/webm", contentType)
+
+	downloadURL, err := getGCSDownloadURL("gs://bucket/path/to/video.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, "https://storage.googleapis.com/bucket/path/to/video.mp4", downloadURL)
+	_, err = getGCSDownloadURL("https://example.com/video.mp4")
+	assert.Error(t, err)
+}
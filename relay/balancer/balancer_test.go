@@ -0,0 +1,88 @@
+package balancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func countPicks(strategy string, candidates []Candidate, times int) map[int]int {
+	counts := make(map[int]int)
+	for i := 0; i < times; i++ {
+		counts[candidates[Pick(strategy, candidates)].ChannelId]++
+	}
+	return counts
+}
+
+func TestPickWeighted(t *testing.T) {
+	counts := countPicks(Weighted, []Candidate{
+		{ChannelId: 1001, Weight: 9},
+		{ChannelId: 1002, Weight: 1},
+	}, 10000)
+	assert.InDelta(t, 9000, counts[1001], 500)
+	assert.InDelta(t, 1000, counts[1002], 500)
+
+	// weight 0 is treated as 1
+	counts = countPicks(Weighted, []Candidate{{ChannelId: 1003}, {ChannelId: 1004, Weight: 1}}, 10000)
+	assert.InDelta(t, 5000, counts[1003], 500)
+}
+
+func TestPickLeastInFlight(t *testing.T) {
+	done := Start(2001)
+	defer done(true)
+	assert.EqualValues(t, 1, ChannelInFlight(2001))
+
+	// with two candidates, both are always sampled, so the idle one wins
+	counts := countPicks(LeastInFlight, []Candidate{{ChannelId: 2001}, {ChannelId: 2002}}, 100)
+	assert.Equal(t, 100, counts[2002])
+}
+
+func TestPickLatency(t *testing.T) {
+	stats.Store(3001, &channelStats{latency: 1000})
+	stats.Store(3002, &channelStats{latency: 100})
+	counts := countPicks(Latency, []Candidate{{ChannelId: 3001}, {ChannelId: 3002}}, 100)
+	assert.Equal(t, 100, counts[3002])
+
+	// failed requests don't change the latency
+	Start(3002)(false)
+	assert.EqualValues(t, 100, ChannelLatencyMs(3002))
+	assert.EqualValues(t, 0, ChannelInFlight(3002))
+}
+
+func TestPickSuccessRate(t *testing.T) {
+	assert.Equal(t, 0.5, ChannelSuccessRate(4001))
+	for i := 0; i < resultWindow*2; i++ {
+		RecordResult(4001, false)
+		RecordResult(4002, true)
+	}
+	assert.Less(t, ChannelSuccessRate(4001), 0.05)
+	assert.Greater(t, ChannelSuccessRate(4002), 0.95)
+
+	counts := countPicks(SuccessRate, []Candidate{{ChannelId: 4001}, {ChannelId: 4002}}, 10000)
+	assert.Greater(t, counts[4002], 9000)
+}
+
+func TestGetStrategy(t *testing.T) {
+	defaultStrategy := config.LoadBalancingStrategy
+	defer func() {
+		config.LoadBalancingStrategy = defaultStrategy
+		require.NoError(t, UpdateGroupStrategyByJSONString("{}"))
+		require.NoError(t, UpdateModelStrategyByJSONString("{}"))
+	}()
+
+	config.LoadBalancingStrategy = Random
+	require.NoError(t, UpdateGroupStrategyByJSONString(`{"vip": "weighted"}`))
+	require.NoError(t, UpdateModelStrategyByJSONString(`{"gpt-4o": "latency"}`))
+
+	assert.Equal(t, Latency, GetStrategy("vip", "gpt-4o"))
+	assert.Equal(t, Weighted, GetStrategy("vip", "gpt-4o-mini"))
+	assert.Equal(t, Random, GetStrategy("default", "gpt-4o-mini"))
+
+	assert.Error(t, UpdateGroupStrategyByJSONString(`{"vip": "round_robin"}`))
+	assert.Error(t, UpdateModelStrategyByJSONString(`not json`))
+	// invalid strategies don't replace the current ones
+	assert.Equal(t, Weighted, GetStrategy("vip", "gpt-4o-mini"))
+}
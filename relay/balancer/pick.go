@@ -0,0 +1,81 @@
+package balancer
+
+import (
+	"math/rand"
+)
+
+// Candidate is a channel that could serve the request
+type Candidate struct {
+	ChannelId int
+	// Weight is the weight of the channel, 0 is treated as 1
+	Weight uint
+}
+
+// Pick returns the index of the chosen candidate by strategy,
+// unknown strategies fall back to Random.
+func Pick(strategy string, candidates []Candidate) int {
+	if len(candidates) <= 1 {
+		return 0
+	}
+
+	switch strategy {
+	case Weighted:
+		return pickWeighted(candidates, func(c Candidate) float64 {
+			if c.Weight == 0 {
+				return 1
+			}
+			return float64(c.Weight)
+		})
+	case SuccessRate:
+		return pickWeighted(candidates, func(c Candidate) float64 {
+			return ChannelSuccessRate(c.ChannelId)
+		})
+	case LeastInFlight:
+		return pickTwoChoices(candidates, func(c Candidate) float64 {
+			return float64(ChannelInFlight(c.ChannelId))
+		})
+	case Latency:
+		// channels without latency have the cost of 0, so they are tried soon
+		return pickTwoChoices(candidates, func(c Candidate) float64 {
+			return ChannelLatencyMs(c.ChannelId)
+		})
+	default:
+		return rand.Intn(len(candidates))
+	}
+}
+
+// pickWeighted picks a candidate at random, the probability is proportional to its weight
+func pickWeighted(candidates []Candidate, weight func(Candidate) float64) int {
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, candidate := range candidates {
+		weights[i] = weight(candidate)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return rand.Intn(len(candidates))
+	}
+
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(candidates) - 1
+}
+
+// pickTwoChoices samples two candidates at random and returns the one with the lower cost,
+// so that the best channel is preferred without receiving all the traffic.
+func pickTwoChoices(candidates []Candidate, cost func(Candidate) float64) int {
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	if cost(candidates[j]) < cost(candidates[i]) {
+		return j
+	}
+	return i
+}
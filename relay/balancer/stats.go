@@ -0,0 +1,104 @@
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyDecay is the weight of the latest latency in the EWMA latency
+	latencyDecay = 0.3
+	// resultWindow is the number of recent results used to calculate the success rate
+	resultWindow = 50
+)
+
+// channelStats is the runtime statistics of a channel in this process
+type channelStats struct {
+	inFlight atomic.Int64
+
+	mu sync.Mutex
+	// latency is the EWMA latency of the successful requests, unit is millisecond, 0 means unknown
+	latency float64
+	// results is a ring buffer of the recent results
+	results   [resultWindow]bool
+	resultIdx int
+	resultCnt int
+}
+
+var stats sync.Map // channel id -> *channelStats
+
+func getStats(channelId int) *channelStats {
+	if s, ok := stats.Load(channelId); ok {
+		return s.(*channelStats)
+	}
+	s, _ := stats.LoadOrStore(channelId, new(channelStats))
+	return s.(*channelStats)
+}
+
+// Start marks a request to the channel as in flight,
+// the returned function should be called once the request is finished.
+func Start(channelId int) (done func(success bool)) {
+	s := getStats(channelId)
+	s.inFlight.Add(1)
+	startTime := time.Now()
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() {
+			s.inFlight.Add(-1)
+			// failed requests are usually fast, they should not make the channel look faster
+			if !success {
+				return
+			}
+			latency := float64(time.Since(startTime).Milliseconds())
+			s.mu.Lock()
+			if s.latency == 0 {
+				s.latency = latency
+			} else {
+				s.latency = latencyDecay*latency + (1-latencyDecay)*s.latency
+			}
+			s.mu.Unlock()
+		})
+	}
+}
+
+// RecordResult records the result of a request to the channel, it's fed by monitor.Emit
+func RecordResult(channelId int, success bool) {
+	s := getStats(channelId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[s.resultIdx] = success
+	s.resultIdx = (s.resultIdx + 1) % resultWindow
+	if s.resultCnt < resultWindow {
+		s.resultCnt++
+	}
+}
+
+// ChannelInFlight returns the number of requests in flight to the channel
+func ChannelInFlight(channelId int) int64 {
+	return getStats(channelId).inFlight.Load()
+}
+
+// ChannelLatencyMs returns the EWMA latency of the channel in milliseconds, 0 means unknown
+func ChannelLatencyMs(channelId int) float64 {
+	s := getStats(channelId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
+
+// ChannelSuccessRate returns the smoothed success rate of the recent requests to the channel,
+// a channel without any result has the rate of 0.5.
+func ChannelSuccessRate(channelId int) float64 {
+	s := getStats(channelId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	successes := 0
+	for i := 0; i < s.resultCnt; i++ {
+		if s.results[i] {
+			successes++
+		}
+	}
+	return float64(successes+1) / float64(s.resultCnt+2)
+}
@@ -0,0 +1,114 @@
+// Package balancer picks a channel among the channels of the same priority,
+// by the load balancing strategy configured for the model or the group.
+package balancer
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	// Random picks a channel uniformly at random
+	Random = "random"
+	// Weighted picks a channel at random, weighted by the weight of the channel
+	Weighted = "weighted"
+	// LeastInFlight prefers the channel with the fewest requests in flight
+	LeastInFlight = "least_in_flight"
+	// Latency prefers the channel with the lowest EWMA latency
+	Latency = "latency"
+	// SuccessRate picks a channel at random, weighted by its recent success rate
+	SuccessRate = "success_rate"
+)
+
+var strategyLock sync.RWMutex
+
+// GroupStrategy is the load balancing strategy of the groups, e.g. {"vip": "latency"}
+var GroupStrategy = map[string]string{}
+
+// ModelStrategy is the load balancing strategy of the models, it takes precedence over GroupStrategy
+var ModelStrategy = map[string]string{}
+
+// IsValidStrategy returns true if strategy is supported
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case Random, Weighted, LeastInFlight, Latency, SuccessRate:
+		return true
+	default:
+		return false
+	}
+}
+
+func GroupStrategy2JSONString() string {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+	return strategy2JSONString(GroupStrategy)
+}
+
+func ModelStrategy2JSONString() string {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+	return strategy2JSONString(ModelStrategy)
+}
+
+func UpdateGroupStrategyByJSONString(jsonStr string) error {
+	strategies, err := ParseStrategies(jsonStr)
+	if err != nil {
+		return err
+	}
+	strategyLock.Lock()
+	GroupStrategy = strategies
+	strategyLock.Unlock()
+	return nil
+}
+
+func UpdateModelStrategyByJSONString(jsonStr string) error {
+	strategies, err := ParseStrategies(jsonStr)
+	if err != nil {
+		return err
+	}
+	strategyLock.Lock()
+	ModelStrategy = strategies
+	strategyLock.Unlock()
+	return nil
+}
+
+// GetStrategy returns the load balancing strategy of the model in the group,
+// the strategy of the model is preferred, then the group, then the default one.
+func GetStrategy(group string, model string) string {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+	if strategy, ok := ModelStrategy[model]; ok {
+		return strategy
+	}
+	if strategy, ok := GroupStrategy[group]; ok {
+		return strategy
+	}
+	return config.LoadBalancingStrategy
+}
+
+func strategy2JSONString(strategies map[string]string) string {
+	jsonBytes, err := json.Marshal(strategies)
+	if err != nil {
+		logger.SysError("error marshalling load balancing strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// ParseStrategies parses the strategies in json, such as {"gpt-4o": "latency"}, and validates them
+func ParseStrategies(jsonStr string) (map[string]string, error) {
+	strategies := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &strategies); err != nil {
+		return nil, errors.Wrap(err, "unmarshal load balancing strategies")
+	}
+	for name, strategy := range strategies {
+		if !IsValidStrategy(strategy) {
+			return nil, errors.Errorf("invalid load balancing strategy %q of %q", strategy, name)
+		}
+	}
+	return strategies, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
 )
 
 func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId int) {
@@ -63,6 +64,7 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:           userId,
 		ChannelId:        channelId,
+		TokenId:          tokenId,
 		PromptTokens:     int(totalQuota), // NOTE: For Audio API, total quota is logged as prompt tokens
 		CompletionTokens: 0,               // NOTE: Audio API doesn't have separate completion tokens
 		ModelName:        modelName,
@@ -115,6 +117,8 @@ func PostConsumeQuotaDetailed(ctx context.Context, tokenId int, quotaDelta int64
 		return
 	}
 
+	ratelimit.RecordTokens(ctx, tokenId, promptTokens+completionTokens)
+
 	// quotaDelta is remaining quota to be consumed
 	err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
 	if err != nil {
@@ -136,6 +140,7 @@ func PostConsumeQuotaDetailed(ctx context.Context, tokenId int, quotaDelta int64
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            userId,
 		ChannelId:         channelId,
+		TokenId:           tokenId,
 		PromptTokens:      promptTokens,
 		CompletionTokens:  completionTokens,
 		ModelName:         modelName,
@@ -156,3 +161,47 @@ func PostConsumeQuotaDetailed(ctx context.Context, tokenId int, quotaDelta int64
 		logger.Error(ctx, fmt.Sprintf("totalQuota consumed is %d, something is wrong", totalQuota))
 	}
 }
+
+// PostConsumeCacheHitQuota bills a request served by the response cache.
+// The totalQuota should be already multiplied by the cache ratio,
+// and the used quota of the channel is not updated since no upstream request is sent.
+func PostConsumeCacheHitQuota(ctx context.Context, tokenId int, totalQuota int64,
+	userId int, channelId int, promptTokens int, completionTokens int,
+	modelRatio float64, groupRatio float64, cacheRatio float64, modelName string, tokenName string,
+	isStream bool, startTime time.Time, completionRatio float64) {
+	if tokenId <= 0 || userId <= 0 {
+		logger.Error(ctx, fmt.Sprintf("PostConsumeCacheHitQuota: invalid tokenId %d or userId %d", tokenId, userId))
+		return
+	}
+
+	ratelimit.RecordTokens(ctx, tokenId, promptTokens+completionTokens)
+
+	err := model.PostConsumeTokenQuota(tokenId, totalQuota)
+	if err != nil {
+		logger.SysError("error consuming token remain quota: " + err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, userId)
+	if err != nil {
+		logger.SysError("error update user quota cache: " + err.Error())
+	}
+
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:           userId,
+		ChannelId:        channelId,
+		TokenId:          tokenId,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		ModelName:        modelName,
+		TokenName:        tokenName,
+		Quota:            int(totalQuota),
+		Content: fmt.Sprintf("cache hit, cache rate %.2f, model rate %.2f, group rate %.2f, completion rate %.2f",
+			cacheRatio, modelRatio, groupRatio, completionRatio),
+		IsStream:    isStream,
+		ElapsedTime: helper.CalcElapsedTime(startTime),
+		CacheHit:    true,
+	})
+
+	if totalQuota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(userId, totalQuota)
+	}
+}
@@ -33,13 +33,21 @@ const (
 
 // AudioRatio represents the price ratio between audio tokens and text tokens
 var AudioRatio = map[string]float64{
-	"gpt-4o-audio-preview":                 16,
-	"gpt-4o-audio-preview-2024-12-17":      16,
-	"gpt-4o-audio-preview-2024-10-01":      40,
-	"gpt-4o-mini-audio-preview":            10 / 0.15,
-	"gpt-4o-mini-audio-preview-2024-12-17": 10 / 0.15,
-	"gpt-4o-transcribe":                    6 / 2.5,
-	"gpt-4o-mini-transcribe":               3 / 1.25,
+	"gpt-4o-audio-preview":                    16,
+	"gpt-4o-audio-preview-2024-12-17":         16,
+	"gpt-4o-audio-preview-2024-10-01":         40,
+	"gpt-4o-mini-audio-preview":               10 / 0.15,
+	"gpt-4o-mini-audio-preview-2024-12-17":    10 / 0.15,
+	"gpt-4o-transcribe":                       6 / 2.5,
+	"gpt-4o-mini-transcribe":                  3 / 1.25,
+	"gpt-4o-realtime-preview":                 40 / 5,
+	"gpt-4o-realtime-preview-2025-06-03":      40 / 5,
+	"gpt-4o-realtime-preview-2024-12-17":      40 / 5,
+	"gpt-4o-realtime-preview-2024-10-01":      100 / 5,
+	"gpt-4o-mini-realtime-preview":            10 / 0.6,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 10 / 0.6,
+	"gpt-realtime":                            32 / 4,
+	"gpt-realtime-2025-08-28":                 32 / 4,
 }
 
 // GetAudioPromptRatio returns the audio prompt ratio for the given model.
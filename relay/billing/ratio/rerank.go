@@ -0,0 +1,22 @@
+package ratio
+
+// RerankDocumentsPerSearchUnit is the number of documents covered by a search unit,
+// a rerank request with more documents costs several search units.
+const RerankDocumentsPerSearchUnit = 100
+
+// RerankTokensPerSearchUnit is the number of tokens a search unit is billed as,
+// so the price of a search unit is the model ratio of RerankTokensPerSearchUnit tokens.
+const RerankTokensPerSearchUnit = 1000
+
+// RerankSearchUnitModels are the rerank models billed by search units, the prices are the model ratios
+// of the adaptors, the other rerank models are billed by tokens with their model ratio.
+var RerankSearchUnitModels = map[string]bool{
+	"rerank-v3.5":                 true,
+	"rerank-english-v3.0":         true,
+	"rerank-multilingual-v3.0":    true,
+	"rerank-english-v2.0":         true,
+	"rerank-multilingual-v2.0":    true,
+	"semantic-ranker-default-004": true,
+	"semantic-ranker-fast-004":    true,
+	"semantic-ranker-512-003":     true,
+}
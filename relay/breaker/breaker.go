@@ -0,0 +1,270 @@
+// Package breaker implements the circuit breaker of each channel and model.
+//
+// The failures are counted by each node on its own traffic, while the state of the breaker
+// is shared through redis if enabled, so an open breaker stops the traffic of all nodes.
+package breaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+const (
+	redisKeyPrefix = "circuit_breaker:"
+	// redisTTL cleans up the breakers of deleted channels
+	redisTTL = 24 * time.Hour
+	// syncInterval is how often the shared state is reloaded from redis
+	syncInterval = time.Second
+)
+
+// Status is the shared state of a breaker
+type Status struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+	State     string `json:"state"`
+	Reason    string `json:"reason,omitempty"`
+	// OpenedAt is the unix time when the breaker was opened
+	OpenedAt int64 `json:"opened_at,omitempty"`
+	// ProbeAt is the unix time when the half-open probing started
+	ProbeAt int64 `json:"probe_at,omitempty"`
+	// Probes is the number of requests let through while half-open
+	Probes int `json:"probes,omitempty"`
+	// Successes is the number of probes succeeded
+	Successes int `json:"successes,omitempty"`
+}
+
+// counter counts the requests of a closed breaker in this node
+type counter struct {
+	consecutiveFailures int
+	windowStart         time.Time
+	requests            int
+	failures            int
+}
+
+type cachedStatus struct {
+	status   Status
+	loadedAt time.Time
+}
+
+var (
+	mu       sync.Mutex
+	counters = make(map[string]*counter)
+	statuses = make(map[string]*cachedStatus)
+)
+
+func key(channelId int, model string) string {
+	return fmt.Sprintf("%d:%s", channelId, model)
+}
+
+// IsFailure returns true if the status code of a relay error indicates that the channel is unhealthy,
+// other errors such as bad requests are caused by the client.
+func IsFailure(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return statusCode >= http.StatusInternalServerError
+}
+
+// Available returns false if requests to the model of the channel should not be sent
+func Available(channelId int, model string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+	status := load(channelId, model)
+	now := time.Now().Unix()
+	switch status.State {
+	case StateOpen:
+		return now >= status.OpenedAt+int64(config.CircuitBreakerOpenSeconds)
+	case StateHalfOpen:
+		// the probes without results for a long time are abandoned
+		return status.Probes < config.CircuitBreakerHalfOpenRequests ||
+			now >= status.ProbeAt+int64(config.CircuitBreakerOpenSeconds)
+	default:
+		return true
+	}
+}
+
+// Acquire should be called once a request is going to be sent to the model of the channel,
+// it lets the request through as a probe if the breaker is ready to be half-open.
+func Acquire(channelId int, model string) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+	status := load(channelId, model)
+	now := time.Now().Unix()
+	switch status.State {
+	case StateOpen:
+		if now < status.OpenedAt+int64(config.CircuitBreakerOpenSeconds) {
+			return
+		}
+		status.State = StateHalfOpen
+		status.ProbeAt, status.Probes, status.Successes = now, 1, 0
+		logger.SysLogf("circuit breaker of channel #%d model %s is half-open", channelId, model)
+	case StateHalfOpen:
+		if now >= status.ProbeAt+int64(config.CircuitBreakerOpenSeconds) {
+			status.ProbeAt, status.Probes, status.Successes = now, 1, 0
+		} else {
+			status.Probes++
+		}
+	default:
+		return
+	}
+	save(status)
+}
+
+// Record records the result of a request to the model of the channel
+func Record(channelId int, model string, success bool) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+	status := load(channelId, model)
+	switch status.State {
+	case StateHalfOpen:
+		if !success {
+			open(status, "failed while half-open")
+			return
+		}
+		status.Successes++
+		if status.Successes < config.CircuitBreakerHalfOpenRequests {
+			save(status)
+			return
+		}
+		logger.SysLogf("circuit breaker of channel #%d model %s is closed", channelId, model)
+		save(Status{ChannelId: channelId, Model: model, State: StateClosed})
+		return
+	case StateOpen:
+		// the request was sent before the breaker opened
+		return
+	}
+
+	k := key(channelId, model)
+	now := time.Now()
+	mu.Lock()
+	c, ok := counters[k]
+	if !ok {
+		c = new(counter)
+		counters[k] = c
+	}
+	if now.Sub(c.windowStart) > time.Duration(config.CircuitBreakerWindow)*time.Second {
+		c.windowStart, c.requests, c.failures = now, 0, 0
+	}
+	c.requests++
+	reason := ""
+	if success {
+		c.consecutiveFailures = 0
+	} else {
+		c.failures++
+		c.consecutiveFailures++
+		if config.CircuitBreakerConsecutiveFailures > 0 && c.consecutiveFailures >= config.CircuitBreakerConsecutiveFailures {
+			reason = fmt.Sprintf("%d consecutive failures", c.consecutiveFailures)
+		} else if config.CircuitBreakerErrorRate > 0 && c.requests >= config.CircuitBreakerMinRequests &&
+			float64(c.failures)/float64(c.requests) >= config.CircuitBreakerErrorRate {
+			reason = fmt.Sprintf("%d of %d requests failed", c.failures, c.requests)
+		}
+	}
+	if reason != "" {
+		delete(counters, k)
+	}
+	mu.Unlock()
+
+	if reason != "" {
+		open(status, reason)
+	}
+}
+
+// Get returns the status of the breaker
+func Get(channelId int, model string) Status {
+	return load(channelId, model)
+}
+
+// Reset closes the breaker
+func Reset(channelId int, model string) {
+	mu.Lock()
+	delete(counters, key(channelId, model))
+	mu.Unlock()
+	save(Status{ChannelId: channelId, Model: model, State: StateClosed})
+}
+
+func open(status Status, reason string) {
+	logger.SysLogf("circuit breaker of channel #%d model %s is open: %s", status.ChannelId, status.Model, reason)
+	save(Status{
+		ChannelId: status.ChannelId,
+		Model:     status.Model,
+		State:     StateOpen,
+		Reason:    reason,
+		OpenedAt:  time.Now().Unix(),
+	})
+}
+
+// load returns the status from the local cache, which is reloaded from redis every syncInterval
+func load(channelId int, model string) Status {
+	k := key(channelId, model)
+	mu.Lock()
+	cached, ok := statuses[k]
+	mu.Unlock()
+	if ok && (!common.RedisEnabled || time.Since(cached.loadedAt) < syncInterval) {
+		return cached.status
+	}
+
+	status := Status{ChannelId: channelId, Model: model, State: StateClosed}
+	if common.RedisEnabled {
+		value, err := common.RedisGet(redisKeyPrefix + k)
+		switch {
+		case errors.Is(err, redis.Nil):
+		case err != nil:
+			logger.SysErrorf("failed to get circuit breaker of channel #%d model %s: %+v", channelId, model, err)
+			if ok {
+				status = cached.status
+			}
+		default:
+			if err = json.Unmarshal([]byte(value), &status); err != nil {
+				logger.SysErrorf("invalid circuit breaker of channel #%d model %s: %+v", channelId, model, err)
+			}
+		}
+	}
+
+	mu.Lock()
+	statuses[k] = &cachedStatus{status: status, loadedAt: time.Now()}
+	mu.Unlock()
+	return status
+}
+
+func save(status Status) {
+	k := key(status.ChannelId, status.Model)
+	mu.Lock()
+	statuses[k] = &cachedStatus{status: status, loadedAt: time.Now()}
+	mu.Unlock()
+	if !common.RedisEnabled {
+		return
+	}
+
+	var err error
+	if status.State == StateClosed {
+		err = common.RedisDel(redisKeyPrefix + k)
+	} else {
+		var value []byte
+		if value, err = json.Marshal(status); err == nil {
+			err = common.RedisSet(redisKeyPrefix+k, string(value), redisTTL)
+		}
+	}
+	if err != nil {
+		logger.SysErrorf("failed to save circuit breaker of channel #%d model %s: %+v", status.ChannelId, status.Model, err)
+	}
+}
@@ -0,0 +1,135 @@
+package breaker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupBreakerTest(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	enabled := config.CircuitBreakerEnabled
+	consecutiveFailures := config.CircuitBreakerConsecutiveFailures
+	errorRate := config.CircuitBreakerErrorRate
+	minRequests := config.CircuitBreakerMinRequests
+	halfOpenRequests := config.CircuitBreakerHalfOpenRequests
+	openSeconds := config.CircuitBreakerOpenSeconds
+	t.Cleanup(func() {
+		common.RedisEnabled = redisEnabled
+		config.CircuitBreakerEnabled = enabled
+		config.CircuitBreakerConsecutiveFailures = consecutiveFailures
+		config.CircuitBreakerErrorRate = errorRate
+		config.CircuitBreakerMinRequests = minRequests
+		config.CircuitBreakerHalfOpenRequests = halfOpenRequests
+		config.CircuitBreakerOpenSeconds = openSeconds
+	})
+
+	common.RedisEnabled = false
+	config.CircuitBreakerEnabled = true
+	config.CircuitBreakerConsecutiveFailures = 3
+	config.CircuitBreakerErrorRate = 0.5
+	config.CircuitBreakerMinRequests = 10
+	config.CircuitBreakerHalfOpenRequests = 2
+	config.CircuitBreakerOpenSeconds = 30
+}
+
+// expireOpen pretends the breaker was opened long ago
+func expireOpen(channelId int, model string) {
+	status := Get(channelId, model)
+	status.OpenedAt = time.Now().Unix() - int64(config.CircuitBreakerOpenSeconds)
+	save(status)
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	setupBreakerTest(t)
+
+	Record(1, "gpt-4o", false)
+	Record(1, "gpt-4o", false)
+	Record(1, "gpt-4o", true)
+	Record(1, "gpt-4o", false)
+	Record(1, "gpt-4o", false)
+	assert.True(t, Available(1, "gpt-4o"))
+
+	Record(1, "gpt-4o", false)
+	assert.False(t, Available(1, "gpt-4o"))
+	assert.Equal(t, StateOpen, Get(1, "gpt-4o").State)
+	// other models of the channel are not affected
+	assert.True(t, Available(1, "gpt-4o-mini"))
+}
+
+func TestErrorRate(t *testing.T) {
+	setupBreakerTest(t)
+
+	for i := 0; i < 4; i++ {
+		Record(2, "gpt-4o", true)
+		Record(2, "gpt-4o", false)
+	}
+	Record(2, "gpt-4o", true)
+	assert.True(t, Available(2, "gpt-4o"))
+
+	Record(2, "gpt-4o", false)
+	assert.False(t, Available(2, "gpt-4o"))
+	assert.Equal(t, "5 of 10 requests failed", Get(2, "gpt-4o").Reason)
+}
+
+func TestHalfOpen(t *testing.T) {
+	setupBreakerTest(t)
+
+	for i := 0; i < 3; i++ {
+		Record(3, "gpt-4o", false)
+	}
+	Acquire(3, "gpt-4o")
+	assert.Equal(t, StateOpen, Get(3, "gpt-4o").State)
+
+	// probes are let through after the breaker has been open for a while
+	expireOpen(3, "gpt-4o")
+	assert.True(t, Available(3, "gpt-4o"))
+	Acquire(3, "gpt-4o")
+	assert.Equal(t, StateHalfOpen, Get(3, "gpt-4o").State)
+	assert.True(t, Available(3, "gpt-4o"))
+	Acquire(3, "gpt-4o")
+	assert.False(t, Available(3, "gpt-4o"))
+
+	// a failed probe opens the breaker again
+	Record(3, "gpt-4o", false)
+	assert.Equal(t, StateOpen, Get(3, "gpt-4o").State)
+
+	expireOpen(3, "gpt-4o")
+	Acquire(3, "gpt-4o")
+	Acquire(3, "gpt-4o")
+	Record(3, "gpt-4o", true)
+	assert.Equal(t, StateHalfOpen, Get(3, "gpt-4o").State)
+	Record(3, "gpt-4o", true)
+	assert.Equal(t, StateClosed, Get(3, "gpt-4o").State)
+	assert.True(t, Available(3, "gpt-4o"))
+}
+
+func TestReset(t *testing.T) {
+	setupBreakerTest(t)
+
+	for i := 0; i < 3; i++ {
+		Record(4, "gpt-4o", false)
+	}
+	assert.False(t, Available(4, "gpt-4o"))
+	Reset(4, "gpt-4o")
+	assert.True(t, Available(4, "gpt-4o"))
+
+	config.CircuitBreakerEnabled = false
+	for i := 0; i < 3; i++ {
+		Record(4, "gpt-4o", false)
+	}
+	assert.True(t, Available(4, "gpt-4o"))
+}
+
+func TestIsFailure(t *testing.T) {
+	assert.True(t, IsFailure(http.StatusInternalServerError))
+	assert.True(t, IsFailure(http.StatusTooManyRequests))
+	assert.True(t, IsFailure(http.StatusUnauthorized))
+	assert.False(t, IsFailure(http.StatusBadRequest))
+	assert.False(t, IsFailure(http.StatusNotFound))
+}
@@ -0,0 +1,152 @@
+// Package cache caches the responses of identical relay requests,
+// the responses are saved in redis if enabled, otherwise in memory.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// MaxBodySize is the maximum size of a response that could be cached
+const MaxBodySize = 1 << 20
+
+const redisKeyPrefix = "response_cache:"
+
+// Entry is a cached response, it is replayed to the client as is
+type Entry struct {
+	StatusCode       int    `json:"status_code"`
+	ContentType      string `json:"content_type"`
+	Body             []byte `json:"body"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// ChannelId is the channel that generated the response
+	ChannelId int   `json:"channel_id"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// Key returns the cache key of the request,
+// the request should be normalized by the caller, such as removing the fields that don't affect the response.
+func Key(path, group, model string, request any) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal request")
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{path, group, model} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Get returns the cached response of key,
+// maxAge limits the age of the response if it is greater than 0.
+func Get(ctx context.Context, key string, maxAge time.Duration) (*Entry, bool) {
+	var entry *Entry
+	if common.RedisEnabled {
+		value, err := common.RedisGet(redisKeyPrefix + key)
+		if err != nil {
+			return nil, false
+		}
+		entry = new(Entry)
+		if err = json.Unmarshal([]byte(value), entry); err != nil {
+			logger.Warnf(ctx, "invalid response cache %s: %+v", key, err)
+			return nil, false
+		}
+	} else {
+		var ok bool
+		if entry, ok = memory.get(key); !ok {
+			return nil, false
+		}
+	}
+
+	if maxAge > 0 && time.Duration(helper.GetTimestamp()-entry.CreatedAt)*time.Second > maxAge {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set saves the response of key for ttl
+func Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) {
+	if len(entry.Body) > MaxBodySize || ttl <= 0 {
+		return
+	}
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = helper.GetTimestamp()
+	}
+
+	if common.RedisEnabled {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			logger.Warnf(ctx, "failed to marshal response cache: %+v", err)
+			return
+		}
+		if err = common.RedisSet(redisKeyPrefix+key, string(value), ttl); err != nil {
+			logger.Warnf(ctx, "failed to save response cache: %+v", err)
+		}
+		return
+	}
+	memory.set(key, entry, ttl)
+}
+
+type memoryItem struct {
+	entry     *Entry
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+var memory = &memoryStore{items: make(map[string]memoryItem)}
+
+func (s *memoryStore) get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expiresAt) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return item.entry, true
+}
+
+func (s *memoryStore) set(key string, entry *Entry, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok && len(s.items) >= config.ResponseCacheMemoryMaxEntries {
+		now := time.Now()
+		for k, item := range s.items {
+			if now.After(item.expiresAt) {
+				delete(s.items, k)
+			}
+		}
+		// still full, evict arbitrary entries
+		for k := range s.items {
+			if len(s.items) < config.ResponseCacheMemoryMaxEntries {
+				break
+			}
+			delete(s.items, k)
+		}
+	}
+	s.items[key] = memoryItem{entry: entry, expiresAt: time.Now().Add(ttl)}
+}
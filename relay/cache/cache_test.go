@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestKey(t *testing.T) {
+	request := map[string]any{"input": "hello", "model": "text-embedding-3-small"}
+	key, err := Key("/v1/embeddings", "default", "text-embedding-3-small", request)
+	require.NoError(t, err)
+
+	same, err := Key("/v1/embeddings", "default", "text-embedding-3-small", map[string]any{"model": "text-embedding-3-small", "input": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	for _, parts := range [][3]string{
+		{"/v1/chat/completions", "default", "text-embedding-3-small"},
+		{"/v1/embeddings", "vip", "text-embedding-3-small"},
+		{"/v1/embeddings", "default", "text-embedding-3-large"},
+	} {
+		other, err := Key(parts[0], parts[1], parts[2], request)
+		require.NoError(t, err)
+		assert.NotEqual(t, key, other, parts)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = redisEnabled }()
+
+	ctx := context.Background()
+	memory = &memoryStore{items: make(map[string]memoryItem)}
+
+	_, ok := Get(ctx, "missing", 0)
+	assert.False(t, ok)
+
+	Set(ctx, "hit", &Entry{StatusCode: 200, Body: []byte(`{"ok":true}`), PromptTokens: 3}, time.Minute)
+	entry, ok := Get(ctx, "hit", time.Minute)
+	require.True(t, ok)
+	assert.Equal(t, `{"ok":true}`, string(entry.Body))
+	assert.Equal(t, 3, entry.PromptTokens)
+	assert.NotZero(t, entry.CreatedAt)
+
+	// the entry is older than the max age of the caller
+	Set(ctx, "old", &Entry{Body: []byte("old"), CreatedAt: helper.GetTimestamp() - 120}, time.Hour)
+	_, ok = Get(ctx, "old", time.Minute)
+	assert.False(t, ok)
+	_, ok = Get(ctx, "old", 0)
+	assert.True(t, ok)
+
+	Set(ctx, "expired", &Entry{Body: []byte("expired")}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = Get(ctx, "expired", 0)
+	assert.False(t, ok)
+
+	Set(ctx, "large", &Entry{Body: make([]byte, MaxBodySize+1)}, time.Minute)
+	_, ok = Get(ctx, "large", 0)
+	assert.False(t, ok)
+}
@@ -16,17 +16,17 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
+	relayadaptor "github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
 	"github.com/songquanpeng/one-api/relay/billing"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
-	"github.com/songquanpeng/one-api/relay/channeltype"
-	"github.com/songquanpeng/one-api/relay/meta"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -54,24 +54,37 @@ func countAudioTokens(c *gin.Context) (float64, error) {
 	}
 	defer reqFp.Close()
 
-	ctxMeta := meta.GetByContext(c)
+	ctxMeta := metalib.GetByContext(c)
 
 	return helper.GetAudioTokens(c.Request.Context(),
 		reqFp,
 		ratio.GetAudioPromptTokensPerSecond(ctxMeta.ActualModelName))
 }
 
+// RelayAudioHelper handles the speech, transcription and translation requests (/v1/audio).
+//
+// The request is converted by the channel's adaptor, so the audio requests are routed
+// and retried across the providers like the chat requests.
 func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
 	ctx := c.Request.Context()
-	meta := meta.GetByContext(c)
-	audioModel := "whisper-1"
+	meta := metalib.GetByContext(c)
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	doRequest := adaptor.DoRequest
+	audioAdaptor, ok := adaptor.(relayadaptor.AudioAdaptor)
+	if !ok {
+		// the channels without their own audio format are assumed to serve the OpenAI compatible audio API
+		audioAdaptor = passthroughAudioAdaptor{}
+		doRequest = doPassthroughAudioRequest
+	}
 
 	tokenId := c.GetInt(ctxkey.TokenId)
-	channelType := c.GetInt(ctxkey.Channel)
-	channelId := c.GetInt(ctxkey.ChannelId)
 	userId := c.GetInt(ctxkey.Id)
-	// group := c.GetString(ctxkey.Group)
-	tokenName := c.GetString(ctxkey.TokenName)
+	audioModel := meta.ActualModelName
 
 	var ttsRequest openai.TextToSpeechRequest
 	if relayMode == relaymode.AudioSpeech {
@@ -81,26 +94,16 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if err != nil {
 			return openai.ErrorWrapper(err, "invalid_json", http.StatusBadRequest)
 		}
-		audioModel = ttsRequest.Model
 		// Check if text is too long 4096
 		if len(ttsRequest.Input) > 4096 {
 			return openai.ErrorWrapper(errors.New("input is too long (over 4096 characters)"), "text_too_long", http.StatusBadRequest)
 		}
 	}
 
-	// get channel-specific pricing if available
-	var channelModelRatio map[string]float64
-	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
-		if channel, ok := channelModel.(*model.Channel); ok {
-			// Get from unified ModelConfigs only (after migration)
-			channelModelRatio = channel.GetModelRatioFromConfigs()
-		}
-	}
-
 	// Use three-layer pricing system
-	pricingAdaptor := relay.GetAdaptor(channelType)
+	channelModelRatio, _ := getChannelRatios(c, meta.ChannelId)
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(audioModel, channelModelRatio, pricingAdaptor)
-	// groupRatio := billingratio.GetGroupRatio(group)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 	ratio := modelRatio * groupRatio
 	var quota int64
@@ -124,18 +127,19 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
-	if err != nil {
-		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	// Check if the quota of the user or the organization is enough
+	userQuota, bizErr := checkPoolQuota(c, userId, preConsumedQuota)
+	if bizErr != nil {
+		return bizErr
 	}
-
-	// Check if user quota is enough
-	if userQuota-preConsumedQuota < 0 {
-		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	if bizErr := checkBudget(tokenId, userId, preConsumedQuota); bizErr != nil {
+		return bizErr
 	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
-	if err != nil {
-		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	if c.GetInt(ctxkey.OrganizationId) == 0 {
+		err := model.CacheDecreaseUserQuota(userId, preConsumedQuota)
+		if err != nil {
+			return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		}
 	}
 	if userQuota > 100*preConsumedQuota &&
 		(tokenQuotaUnlimited || tokenQuota > 100*preConsumedQuota) {
@@ -164,140 +168,74 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 						logger.Error(ctx, fmt.Sprintf("error rollback pre-consumed quota: %s", err.Error()))
 					}
 				}()
-			}(c.Request.Context())
+			}(ctx)
 		}
 	}()
 
-	// map model name
-	modelMapping := c.GetStringMapString(ctxkey.ModelMapping)
-	if modelMapping != nil && modelMapping[audioModel] != "" {
-		audioModel = modelMapping[audioModel]
-	}
-
-	baseURL := channeltype.ChannelBaseURLs[channelType]
-	requestURL := c.Request.URL.String()
-	if c.GetString(ctxkey.BaseURL) != "" {
-		baseURL = c.GetString(ctxkey.BaseURL)
-	}
-
-	fullRequestURL := openai.GetFullRequestURL(baseURL, requestURL, channelType)
-	if channelType == channeltype.Azure {
-		apiVersion := meta.Config.APIVersion
-		if relayMode == relaymode.AudioTranscription {
-			// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
-			fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/transcriptions?api-version=%s", baseURL, audioModel, apiVersion)
-		} else if relayMode == relaymode.AudioSpeech {
-			// https://learn.microsoft.com/en-us/azure/ai-services/openai/text-to-speech-quickstart?tabs=command-line#rest-api
-			fullRequestURL = fmt.Sprintf("%s/openai/deployments/%s/audio/speech?api-version=%s", baseURL, audioModel, apiVersion)
-		}
-	}
-
-	requestBody := &bytes.Buffer{}
-	_, err = io.Copy(requestBody, c.Request.Body)
+	requestBody, err := common.GetRequestBody(c)
 	if err != nil {
-		return openai.ErrorWrapper(err, "new_request_body_failed", http.StatusInternalServerError)
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
 	}
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody.Bytes()))
-	// responseFormat := c.DefaultPostForm("response_format", "json")
-
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	convertedBody, err := audioAdaptor.ConvertAudioRequest(c, meta, requestBody)
 	if err != nil {
-		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
-	}
-
-	if (relayMode == relaymode.AudioTranscription || relayMode == relaymode.AudioSpeech) && channelType == channeltype.Azure {
-		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
-		apiKey := c.Request.Header.Get("Authorization")
-		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
-	} else {
-		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
-	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 
-	resp, err := client.HTTPClient.Do(req)
+	resp, err := doRequest(c, meta, convertedBody)
 	if err != nil {
-		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return getDoRequestError(c, err)
 	}
-
-	err = req.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
 	}
-	err = c.Request.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
+	if bizErr := getHedgeLostError(c); bizErr != nil {
+		_ = resp.Body.Close()
+		return bizErr
 	}
 
-	// https://github.com/Laisky/one-api/pull/21
-	// Commenting out the following code because Whisper's transcription
-	// only charges for the length of the input audio, not for the output.
-	// -------------------------------------
-	// if relayMode != relaymode.AudioSpeech {
-	// 	responseBody, err := io.ReadAll(resp.Body)
-	// 	if err != nil {
-	// 		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
-	// 	}
-	// 	err = resp.Body.Close()
-	// 	if err != nil {
-	// 		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
-	// 	}
-
-	// 	var openAIErr openai.SlimTextResponse
-	// 	if err = json.Unmarshal(responseBody, &openAIErr); err == nil {
-	// 		if openAIErr.Error.Message != "" {
-	// 			return openai.ErrorWrapper(errors.Errorf("type %s, code %v, message %s", openAIErr.Error.Type, openAIErr.Error.Code, openAIErr.Error.Message), "request_error", http.StatusInternalServerError)
-	// 		}
-	// 	}
-
-	// 	var text string
-	// 	switch responseFormat {
-	// 	case "json":
-	// 		text, err = getTextFromJSON(responseBody)
-	// 	case "text":
-	// 		text, err = getTextFromText(responseBody)
-	// 	case "srt":
-	// 		text, err = getTextFromSRT(responseBody)
-	// 	case "verbose_json":
-	// 		text, err = getTextFromVerboseJSON(responseBody)
-	// 	case "vtt":
-	// 		text, err = getTextFromVTT(responseBody)
-	// 	default:
-	// 		return openai.ErrorWrapper(errors.New("unexpected_response_format"), "unexpected_response_format", http.StatusInternalServerError)
-	// 	}
-	// 	if err != nil {
-	// 		return openai.ErrorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
-	// 	}
-	// 	quota = int64(openai.CountTokenText(text, audioModel))
-	// 	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
-	// }
-
-	if resp.StatusCode != http.StatusOK {
-		return RelayErrorHandler(resp)
+	// Whisper's transcription only charges for the length of the input audio,
+	// so the response is not counted, https://github.com/Laisky/one-api/pull/21
+	if respErr := audioAdaptor.DoAudioResponse(c, resp, meta); respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return respErr
 	}
 
 	succeed = true
 	quotaDelta := quota - preConsumedQuota
-	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
-	}(c.Request.Context())
+	go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, meta.ChannelId,
+		modelRatio, groupRatio, audioModel, meta.TokenName)
 
-	for k, v := range resp.Header {
-		c.Writer.Header().Set(k, v[0])
-	}
-	c.Writer.WriteHeader(resp.StatusCode)
+	return nil
+}
+
+// passthroughAudioAdaptor forwards the audio requests of the channels without an audio adaptor as is
+type passthroughAudioAdaptor struct{}
+
+func (passthroughAudioAdaptor) ConvertAudioRequest(c *gin.Context, meta *metalib.Meta, requestBody []byte) (io.Reader, error) {
+	return openai_compatible.ConvertAudioRequest(requestBody), nil
+}
+
+func (passthroughAudioAdaptor) DoAudioResponse(c *gin.Context, resp *http.Response, meta *metalib.Meta) *relaymodel.ErrorWithStatusCode {
+	return openai_compatible.AudioHandler(c, resp)
+}
 
-	_, err = io.Copy(c.Writer, resp.Body)
+// doPassthroughAudioRequest sends the audio request to the same path of the channel's base url
+func doPassthroughAudioRequest(c *gin.Context, meta *metalib.Meta, requestBody io.Reader) (*http.Response, error) {
+	fullRequestURL := openai.GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
-		return openai.ErrorWrapper(err, "copy_response_body_failed", http.StatusInternalServerError)
+		return nil, errors.Wrap(err, "new request failed")
 	}
-	err = resp.Body.Close()
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+
+	resp, err := relayadaptor.DoRequest(c, req)
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+		return nil, errors.Wrap(err, "do request failed")
 	}
-	return nil
+	return resp, nil
 }
 
 func getTextFromVTT(body []byte) (string, error) {
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+)
+
+func TestPassthroughAudio(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if client.HTTPClient == nil {
+		client.Init()
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/speech", r.URL.Path)
+		assert.Equal(t, "Bearer sk-channel", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"model":"tts-1","input":"hello"}`, string(body))
+		w.Header().Set("Content-Type", "audio/mpeg")
+		_, _ = w.Write([]byte("mp3"))
+	}))
+	defer upstream.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"tts-1","input":"hello"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	meta := &metalib.Meta{
+		ChannelType:    channeltype.OpenAI,
+		BaseURL:        upstream.URL,
+		APIKey:         "sk-channel",
+		RequestURLPath: "/v1/audio/speech",
+	}
+
+	audioAdaptor := passthroughAudioAdaptor{}
+	body, err := audioAdaptor.ConvertAudioRequest(c, meta, []byte(`{"model":"tts-1","input":"hello"}`))
+	require.NoError(t, err)
+	resp, err := doPassthroughAudioRequest(c, meta, body)
+	require.NoError(t, err)
+	require.Nil(t, audioAdaptor.DoAudioResponse(c, resp, meta))
+	assert.Equal(t, "audio/mpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, "mp3", w.Body.String())
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/cache"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// getResponseCacheKey returns the response cache key of the request,
+// it returns an empty string if the request should not be cached.
+//
+// Only embeddings and deterministic chat completions (temperature 0 with one choice) are cached.
+func getResponseCacheKey(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest) string {
+	if !config.ResponseCacheEnabled || c.GetBool(ctxkey.ResponseCacheDisabled) {
+		return ""
+	}
+	switch meta.Mode {
+	case relaymode.Embeddings:
+	case relaymode.ChatCompletions:
+		if textRequest.Temperature == nil || *textRequest.Temperature != 0 {
+			return ""
+		}
+		if textRequest.N != nil && *textRequest.N > 1 {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	// the fields that don't affect the response are not part of the key
+	normalized := *textRequest
+	normalized.User = ""
+	normalized.Metadata = nil
+	normalized.Store = nil
+
+	key, err := cache.Key(c.Request.URL.Path, meta.Group, textRequest.Model, &normalized)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "failed to get response cache key: %+v", err)
+		return ""
+	}
+	return key
+}
+
+// getResponseCacheTTL returns the ttl of the token, or the default ttl
+func getResponseCacheTTL(c *gin.Context) time.Duration {
+	if ttl := c.GetInt(ctxkey.ResponseCacheTTL); ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return time.Duration(config.ResponseCacheTTL) * time.Second
+}
+
+// replayCachedResponse sends the cached response to the client,
+// and bills the request at the response cache ratio.
+func replayCachedResponse(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest,
+	entry *cache.Entry, modelRatio, groupRatio float64, channelCompletionRatio map[string]float64) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	completionRatio := pricing.GetCompletionRatioWithThreeLayers(textRequest.Model, channelCompletionRatio, pricingAdaptor)
+	ratio := modelRatio * groupRatio * config.ResponseCacheRatio
+	quota := int64(math.Ceil((float64(entry.PromptTokens) + float64(entry.CompletionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+
+	if _, bizErr := checkPoolQuota(c, meta.UserId, quota); bizErr != nil {
+		return bizErr
+	}
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, quota); bizErr != nil {
+		return bizErr
+	}
+	if !c.GetBool(ctxkey.TokenQuotaUnlimited) && c.GetInt64(ctxkey.TokenQuota) < quota {
+		return openai.ErrorWrapper(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
+	}
+
+	logger.Infof(ctx, "response cache hit, the response is generated by channel #%d", entry.ChannelId)
+	c.Header("Content-Type", entry.ContentType)
+	c.Header("X-Oneapi-Cache", "hit")
+	c.Status(entry.StatusCode)
+	if _, err := c.Writer.Write(entry.Body); err != nil {
+		logger.Errorf(ctx, "failed to write cached response: %+v", err)
+	}
+	c.Writer.Flush()
+	if bizErr := getHedgeLostError(c); bizErr != nil {
+		return bizErr
+	}
+
+	userId := meta.UserId
+	requestId := c.GetString(ctxkey.RequestId)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		billing.PostConsumeCacheHitQuota(ctx, meta.TokenId, quota, userId, entry.ChannelId,
+			entry.PromptTokens, entry.CompletionTokens, modelRatio, groupRatio, config.ResponseCacheRatio,
+			textRequest.Model, meta.TokenName, meta.IsStream, meta.StartTime, completionRatio)
+
+		if quota != 0 {
+			docu := model.NewUserRequestCost(userId, requestId, quota)
+			docu.CacheHit = true
+			if err := docu.Insert(); err != nil {
+				logger.Errorf(ctx, "insert user request cost failed: %+v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// responseCacheWriter records the response sent to the client, so it can be cached after success
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseCacheWriter) record(n int, p []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+n > cache.MaxBodySize {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(p[:n])
+}
+
+func (w *responseCacheWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.record(n, p)
+	return n, err
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.record(n, []byte(s))
+	return n, err
+}
+
+// startResponseCache starts recording the response sent to the client,
+// the returned function saves the response into the cache, usage should be nil if the request failed.
+func startResponseCache(c *gin.Context, key string, meta *metalib.Meta) func(usage *relaymodel.Usage) {
+	if key == "" {
+		return func(*relaymodel.Usage) {}
+	}
+	writer := &responseCacheWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	return func(usage *relaymodel.Usage) {
+		c.Writer = writer.ResponseWriter
+		if usage == nil || writer.overflow || writer.Status() != http.StatusOK {
+			return
+		}
+
+		cache.Set(c.Request.Context(), key, &cache.Entry{
+			StatusCode:       writer.Status(),
+			ContentType:      writer.Header().Get("Content-Type"),
+			Body:             writer.body.Bytes(),
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			ChannelId:        meta.ChannelId,
+		}, getResponseCacheTTL(c))
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/cache"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func newResponseCacheTestContext(path string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, path, nil)
+	return c, w
+}
+
+func TestGetResponseCacheKey(t *testing.T) {
+	enabled := config.ResponseCacheEnabled
+	config.ResponseCacheEnabled = true
+	defer func() { config.ResponseCacheEnabled = enabled }()
+
+	zero, one := 0.0, 1.0
+	two := 2
+	chatMeta := &metalib.Meta{Mode: relaymode.ChatCompletions, Group: "default"}
+	c, _ := newResponseCacheTestContext("/v1/chat/completions")
+
+	assert.Empty(t, getResponseCacheKey(c, chatMeta, &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o"}))
+	assert.Empty(t, getResponseCacheKey(c, chatMeta, &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &one}))
+	assert.Empty(t, getResponseCacheKey(c, chatMeta, &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero, N: &two}))
+
+	key := getResponseCacheKey(c, chatMeta, &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero, User: "alice"})
+	require.NotEmpty(t, key)
+	// the end user doesn't affect the response
+	assert.Equal(t, key, getResponseCacheKey(c, chatMeta, &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero, User: "bob"}))
+	assert.NotEqual(t, key, getResponseCacheKey(c, &metalib.Meta{Mode: relaymode.ChatCompletions, Group: "vip"},
+		&relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero}))
+
+	embeddingContext, _ := newResponseCacheTestContext("/v1/embeddings")
+	embeddingMeta := &metalib.Meta{Mode: relaymode.Embeddings, Group: "default"}
+	assert.NotEmpty(t, getResponseCacheKey(embeddingContext, embeddingMeta, &relaymodel.GeneralOpenAIRequest{Model: "text-embedding-3-small", Input: "hello"}))
+
+	// opt-out by token
+	embeddingContext.Set(ctxkey.ResponseCacheDisabled, true)
+	assert.Empty(t, getResponseCacheKey(embeddingContext, embeddingMeta, &relaymodel.GeneralOpenAIRequest{Model: "text-embedding-3-small", Input: "hello"}))
+}
+
+func TestStartResponseCache(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = redisEnabled }()
+
+	c, w := newResponseCacheTestContext("/v1/chat/completions")
+	c.Set(ctxkey.ResponseCacheTTL, 60)
+
+	finish := startResponseCache(c, "test-start-response-cache", &metalib.Meta{ChannelId: 3})
+	c.Header("Content-Type", "text/event-stream")
+	c.Status(http.StatusOK)
+	_, err := c.Writer.WriteString("data: {\"id\":\"1\"}\n\n")
+	require.NoError(t, err)
+	_, err = c.Writer.Write([]byte("data: [DONE]\n\n"))
+	require.NoError(t, err)
+	finish(&relaymodel.Usage{PromptTokens: 5, CompletionTokens: 7})
+
+	_, isCacheWriter := c.Writer.(*responseCacheWriter)
+	assert.False(t, isCacheWriter)
+	assert.Equal(t, "data: {\"id\":\"1\"}\n\ndata: [DONE]\n\n", w.Body.String())
+
+	entry, ok := cache.Get(c.Request.Context(), "test-start-response-cache", 0)
+	require.True(t, ok)
+	assert.Equal(t, w.Body.String(), string(entry.Body))
+	assert.Equal(t, "text/event-stream", entry.ContentType)
+	assert.Equal(t, 5, entry.PromptTokens)
+	assert.Equal(t, 7, entry.CompletionTokens)
+	assert.Equal(t, 3, entry.ChannelId)
+
+	// failed requests are not cached
+	c, _ = newResponseCacheTestContext("/v1/chat/completions")
+	finish = startResponseCache(c, "test-start-response-cache-failed", &metalib.Meta{})
+	_, _ = c.Writer.WriteString("data: partial\n\n")
+	finish(nil)
+	_, ok = cache.Get(c.Request.Context(), "test-start-response-cache-failed", 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayClaudeMessagesHelper handles native Anthropic Messages API requests (/v1/messages).
+//
+// Channels that speak the Messages API natively (anthropic, aws claude, vertex claude)
+// receive the request body as is. Other channels receive the request converted to
+// the OpenAI format, and their responses are converted back to the Messages API format.
+func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := metalib.GetByContext(c)
+
+	claudeRequest, err := getAndValidateClaudeMessagesRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateClaudeMessagesRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_claude_messages_request", http.StatusBadRequest)
+	}
+	meta.IsStream = claudeRequest.Stream
+
+	// the OpenAI format request is used for billing and for non-native channels
+	textRequest, err := anthropic.ConvertMessagesRequest(claudeRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_claude_messages_request_failed", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = claudeRequest.Model
+	textRequest.Model = meta.ActualModelName
+
+	// get channel-specific pricing if available
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c, meta.ChannelId)
+
+	// get model ratio using three-layer pricing system
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(textRequest.Model, channelModelRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	promptTokens := openai.CountTokenMessages(ctx, textRequest.Messages, textRequest.Model)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(c, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	var usage *relaymodel.Usage
+	if claudeAdaptor, ok := getClaudeMessagesAdaptor(adaptor, meta.ActualModelName); ok {
+		usage, bizErr = doNativeClaudeMessages(c, meta, claudeAdaptor)
+	} else {
+		usage, bizErr = doConvertedClaudeMessages(c, meta, textRequest, adaptor)
+	}
+	if bizErr == nil {
+		bizErr = getHedgeLostError(c)
+	} else if c.Request.Context().Err() != nil {
+		// the native adaptor sends the request by itself, the hedged attempt may be cancelled inside it
+		if lostErr := getHedgeLostError(c); lostErr != nil {
+			bizErr = lostErr
+		}
+	}
+	if bizErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return bizErr
+	}
+
+	// post-consume quota
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+
+	// Record detailed Prometheus metrics
+	recordTextRelayMetrics(c, meta, usage)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		quota := postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, false, channelCompletionRatio)
+
+		// also update user request cost
+		if quota != 0 {
+			docu := model.NewUserRequestCost(
+				quotaId,
+				requestId,
+				quota,
+			)
+			if err := docu.Insert(); err != nil {
+				logger.Errorf(ctx, "insert user request cost failed: %+v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// getAndValidateClaudeMessagesRequest gets and validates the native Messages API request
+func getAndValidateClaudeMessagesRequest(c *gin.Context) (*anthropic.MessagesRequest, error) {
+	claudeRequest := &anthropic.MessagesRequest{}
+	if err := common.UnmarshalBodyReusable(c, claudeRequest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal request")
+	}
+
+	if claudeRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if claudeRequest.MaxTokens <= 0 {
+		return nil, errors.New("max_tokens is required and must be positive")
+	}
+	if len(claudeRequest.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	return claudeRequest, nil
+}
+
+// getClaudeMessagesAdaptor returns the adaptor if it could serve the model by the native Messages API
+func getClaudeMessagesAdaptor(a adaptor.Adaptor, modelName string) (adaptor.ClaudeMessagesAdaptor, bool) {
+	claudeAdaptor, ok := a.(adaptor.ClaudeMessagesAdaptor)
+	if !ok || !claudeAdaptor.SupportClaudeMessages(modelName) {
+		return nil, false
+	}
+	return claudeAdaptor, true
+}
+
+// doNativeClaudeMessages passes the request body through to a channel that speaks the Messages API
+func doNativeClaudeMessages(c *gin.Context, meta *metalib.Meta, claudeAdaptor adaptor.ClaudeMessagesAdaptor) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	if meta.ActualModelName != meta.OriginModelName {
+		requestBody, err = anthropic.RewriteMessagesRequest(requestBody, map[string]any{"model": meta.ActualModelName})
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+	}
+
+	logger.Debugf(c.Request.Context(), "native claude messages request: %s", string(requestBody))
+	return claudeAdaptor.DoClaudeMessages(c, meta, requestBody)
+}
+
+// doConvertedClaudeMessages sends the request to an OpenAI compatible channel,
+// and converts the response back to the Messages API format.
+func doConvertedClaudeMessages(c *gin.Context,
+	meta *metalib.Meta,
+	textRequest *relaymodel.GeneralOpenAIRequest,
+	adaptor adaptor.Adaptor) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+
+	// the converted request is an ordinary chat completion request for the adaptor
+	meta.Mode = relaymode.ChatCompletions
+	meta.RequestURLPath = "/v1/chat/completions"
+
+	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, textRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_converted_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted claude messages request: \n%s", string(jsonData))
+
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return nil, getDoRequestError(c, err)
+	}
+	if isErrorHappened(meta, resp) {
+		return nil, RelayErrorHandler(resp)
+	}
+
+	writer := &claudeMessagesWriter{
+		ResponseWriter: c.Writer,
+		isStream:       meta.IsStream,
+		statusCode:     http.StatusOK,
+		converter: anthropic.MessagesStreamConverter{
+			Model:        meta.ActualModelName,
+			PromptTokens: meta.PromptTokens,
+		},
+	}
+	c.Writer = writer
+	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	c.Writer = writer.ResponseWriter
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return nil, respErr
+	}
+
+	if err = writer.finish(usage); err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_response_failed", http.StatusInternalServerError)
+	}
+	return usage, nil
+}
+
+// claudeMessagesWriter converts the OpenAI format response written by adaptors
+// to the native Messages API format.
+//
+// Stream responses are converted chunk by chunk, non-stream responses are
+// buffered and converted in finish.
+type claudeMessagesWriter struct {
+	gin.ResponseWriter
+	isStream   bool
+	statusCode int
+	converter  anthropic.MessagesStreamConverter
+	buf        bytes.Buffer
+}
+
+func (w *claudeMessagesWriter) WriteHeader(code int) {
+	if w.isStream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *claudeMessagesWriter) WriteHeaderNow() {
+	if w.isStream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *claudeMessagesWriter) Write(data []byte) (int, error) {
+	w.buf.Write(data)
+	if w.isStream {
+		if err := w.convertStreamLines(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *claudeMessagesWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *claudeMessagesWriter) Flush() {
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// convertStreamLines converts all complete `data:` lines in the buffer
+func (w *claudeMessagesWriter) convertStreamLines() error {
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			return nil
+		}
+		line := strings.TrimSpace(string(w.buf.Next(idx + 1)))
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.Warnf(context.Background(), "unmarshal stream chunk %q: %v", data, err)
+			continue
+		}
+		if err := w.writeEvents(w.converter.Convert(&chunk)); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *claudeMessagesWriter) writeEvents(events []anthropic.MessagesStreamEvent) error {
+	for i := range events {
+		data, err := json.Marshal(events[i])
+		if err != nil {
+			return errors.Wrap(err, "marshal messages stream event")
+		}
+		if _, err = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", events[i].Type, data); err != nil {
+			return errors.Wrap(err, "write messages stream event")
+		}
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// finish writes the remaining response to the client
+func (w *claudeMessagesWriter) finish(usage *relaymodel.Usage) error {
+	if w.isStream {
+		if err := w.convertStreamLines(); err != nil {
+			return err
+		}
+		return w.writeEvents(w.converter.Finish(usage))
+	}
+
+	var openaiResponse openai.TextResponse
+	if err := json.Unmarshal(w.buf.Bytes(), &openaiResponse); err != nil {
+		return errors.Wrap(err, "unmarshal openai response")
+	}
+	claudeResponse := anthropic.ResponseOpenAI2Claude(&openaiResponse, usage)
+	if claudeResponse.Model == "" {
+		claudeResponse.Model = w.converter.Model
+	}
+
+	data, err := json.Marshal(claudeResponse)
+	if err != nil {
+		return errors.Wrap(err, "marshal claude response")
+	}
+	// the upstream content length does not match the converted body
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err = w.ResponseWriter.Write(data)
+	return err
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/constant/role"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/hedge"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/pricing"
@@ -97,21 +98,59 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 	return baseQuota
 }
 
+// checkBudget returns an error if the token or the user has used up the budget of the current period
+func checkBudget(tokenId int, userId int, quota int64) *relaymodel.ErrorWithStatusCode {
+	err := model.CheckBudget(tokenId, userId, quota)
+	switch {
+	case errors.Is(err, model.ErrBudgetExhausted):
+		return openai.ErrorWrapper(err, "insufficient_budget", http.StatusForbidden)
+	case err != nil:
+		return openai.ErrorWrapper(err, "get_budget_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// checkPoolQuota returns the remaining quota of the pool charged by the request, which is the organization
+// owns the token, or the user. It returns an error if the pool doesn't have quota left for the request.
+func checkPoolQuota(c *gin.Context, userId int, quota int64) (int64, *relaymodel.ErrorWithStatusCode) {
+	if organizationId := c.GetInt(ctxkey.OrganizationId); organizationId != 0 {
+		organizationQuota, err := model.GetOrganizationAvailableQuota(organizationId, userId)
+		if err != nil {
+			return 0, openai.ErrorWrapper(err, "get_organization_quota_failed", http.StatusInternalServerError)
+		}
+		if organizationQuota < quota {
+			return organizationQuota, openai.ErrorWrapper(errors.New("organization quota is not enough"), "insufficient_organization_quota", http.StatusForbidden)
+		}
+		return organizationQuota, nil
+	}
+
+	userQuota, err := model.CacheGetUserQuota(c.Request.Context(), userId)
+	if err != nil {
+		return 0, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota < quota {
+		return userQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	return userQuota, nil
+}
+
 func preConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(c.Request.Context(), meta.UserId)
-	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	userQuota, bizErr := checkPoolQuota(c, meta.UserId, preConsumedQuota)
+	if bizErr != nil {
+		return preConsumedQuota, bizErr
 	}
-	if userQuota-preConsumedQuota < 0 {
-		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, preConsumedQuota); bizErr != nil {
+		return preConsumedQuota, bizErr
 	}
-	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
-	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	if c.GetInt(ctxkey.OrganizationId) == 0 {
+		err := model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
+		if err != nil {
+			return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		}
 	}
 	if userQuota > 100*preConsumedQuota &&
 		(tokenQuotaUnlimited || tokenQuota > 100*preConsumedQuota) {
@@ -129,6 +168,26 @@ func preConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIReques
 	return preConsumedQuota, nil
 }
 
+// preConsumeFixedQuota consumes the quota decided before the request, e.g. the whole cost of an asynchronous task,
+// which is settled by the task poller after the request, or the reservation of a realtime session.
+func preConsumeFixedQuota(c *gin.Context, meta *meta.Meta, quota int64) *relaymodel.ErrorWithStatusCode {
+	if _, bizErr := checkPoolQuota(c, meta.UserId, quota); bizErr != nil {
+		return bizErr
+	}
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, quota); bizErr != nil {
+		return bizErr
+	}
+	if c.GetInt(ctxkey.OrganizationId) == 0 {
+		if err := model.CacheDecreaseUserQuota(meta.UserId, quota); err != nil {
+			return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		}
+	}
+	if err := model.PreConsumeTokenQuota(meta.TokenId, quota); err != nil {
+		return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	}
+	return nil
+}
+
 func postConsumeQuota(ctx context.Context,
 	usage *relaymodel.Usage,
 	meta *meta.Meta,
@@ -217,3 +276,23 @@ func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIReque
 	logger.Infof(ctx, "add system prompt")
 	return true
 }
+
+// getHedgeLostError returns an error if the request is a hedged attempt that lost the race,
+// its response is discarded, so the pre-consumed quota should be returned instead of billing it.
+func getHedgeLostError(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	if !hedge.IsLost(c) {
+		return nil
+	}
+	return openai.ErrorWrapper(hedge.ErrLost, "hedge_lost", hedge.StatusLost)
+}
+
+// getDoRequestError wraps the error of DoRequest. The hedged attempt that lost the race is cancelled
+// while it's still waiting for the upstream, which is not a failure of the channel.
+func getDoRequestError(c *gin.Context, err error) *relaymodel.ErrorWithStatusCode {
+	if c.Request.Context().Err() != nil {
+		if bizErr := getHedgeLostError(c); bizErr != nil {
+			return bizErr
+		}
+	}
+	return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+}
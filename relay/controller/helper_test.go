@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/hedge"
+)
+
+func TestGetDoRequestError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+	race := hedge.NewRace(c.Writer)
+	loser := race.NewWriter(cancel)
+	winner := race.NewWriter(func() {})
+	c.Writer = loser
+
+	// the attempt failed before any attempt won is a failure of the channel
+	bizErr := getDoRequestError(c, errors.New("connection refused"))
+	require.NotNil(t, bizErr)
+	assert.Equal(t, http.StatusInternalServerError, bizErr.StatusCode)
+
+	// the loser is cancelled once the winner writes the first byte
+	_, err := winner.WriteString("data")
+	require.NoError(t, err)
+	bizErr = getDoRequestError(c, context.Canceled)
+	require.NotNil(t, bizErr)
+	assert.Equal(t, hedge.StatusLost, bizErr.StatusCode)
+}
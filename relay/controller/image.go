@@ -286,7 +286,6 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
 	var usedQuota int64
 	switch meta.ChannelType {
@@ -297,8 +296,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		usedQuota = int64(ratio*imageCostRatio) * int64(imageRequest.N) * 1000
 	}
 
-	if userQuota < usedQuota {
-		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	if _, bizErr := checkPoolQuota(c, meta.UserId, usedQuota); bizErr != nil {
+		return bizErr
+	}
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, usedQuota); bizErr != nil {
+		return bizErr
 	}
 
 	// do request
@@ -331,6 +333,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			model.RecordConsumeLog(ctx, &model.Log{
 				UserId:           meta.UserId,
 				ChannelId:        meta.ChannelId,
+				TokenId:          meta.TokenId,
 				PromptTokens:     promptTokens,
 				CompletionTokens: completionTokens,
 				ModelName:        imageRequest.Model,
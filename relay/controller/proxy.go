@@ -54,6 +54,7 @@ func RelayProxyHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		model.RecordConsumeLog(ctx, &model.Log{
 			UserId:           meta.UserId,
 			ChannelId:        meta.ChannelId,
+			TokenId:          meta.TokenId,
 			PromptTokens:     usage.PromptTokens,
 			CompletionTokens: usage.CompletionTokens,
 			ModelName:        "proxy",
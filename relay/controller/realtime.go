@@ -0,0 +1,408 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	relayadaptor "github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+// realtimeDrainTimeout is how long the upstream is still read after the client is gone,
+// so the usage of the cancelled response in flight is reported and billed.
+const realtimeDrainTimeout = 10 * time.Second
+
+var realtimeUpgrader = websocket.Upgrader{
+	CheckOrigin:  checkRealtimeOrigin,
+	Subprotocols: []string{"realtime"},
+}
+
+var realtimeDialer = websocket.Dialer{
+	Proxy:            http.ProxyFromEnvironment,
+	HandshakeTimeout: 10 * time.Second,
+}
+
+// checkRealtimeOrigin allows the clients without the Origin header, such as the servers, and the web pages
+// of the same origin, ServerAddress or REALTIME_ALLOWED_ORIGINS, so the keys are only used by the trusted pages.
+func checkRealtimeOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	allowed := append([]string{config.ServerAddress}, strings.Split(config.RealtimeAllowedOrigins, ",")...)
+	for _, allowedOrigin := range allowed {
+		allowedOrigin = strings.TrimSuffix(strings.TrimSpace(allowedOrigin), "/")
+		if allowedOrigin == "*" || (allowedOrigin != "" && strings.EqualFold(allowedOrigin, origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RelayRealtimeHelper proxies an OpenAI Realtime API WebSocket session (/v1/realtime).
+//
+// The upstream session is connected before the client's connection is upgraded,
+// so that the handshake failures could still be retried on other channels.
+// A reservation is pre-consumed when the session starts, the usage in the response.done events
+// is billed once each response is done, and the session is closed when the quota runs out.
+// The reservation is refunded when the session ends, or consumed as the cost of the response
+// in flight whose usage is never reported.
+func RelayRealtimeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := metalib.GetByContext(c)
+
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("the realtime API requires a WebSocket connection"), "invalid_request", http.StatusBadRequest)
+	}
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	realtimeAdaptor, ok := adaptor.(relayadaptor.RealtimeAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(errors.Errorf("channel %s does not support the realtime API", adaptor.GetChannelName()),
+			"unsupported_realtime_channel", http.StatusBadRequest)
+	}
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c, meta.ChannelId)
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	session := &realtimeSession{
+		c:               c,
+		meta:            meta,
+		modelRatio:      pricing.GetModelRatioWithThreeLayers(meta.ActualModelName, channelModelRatio, pricingAdaptor),
+		completionRatio: pricing.GetCompletionRatioWithThreeLayers(meta.ActualModelName, channelCompletionRatio, pricingAdaptor),
+		groupRatio:      c.GetFloat64(ctxkey.ChannelRatio),
+		lastBilledAt:    time.Now(),
+	}
+	if bizErr := checkRealtimeQuota(c, meta); bizErr != nil {
+		return bizErr
+	}
+	session.reservedQuota = getRealtimeQuota(int(config.PreConsumedQuota), 0,
+		session.modelRatio, session.completionRatio, session.groupRatio)
+	if bizErr := preConsumeFixedQuota(c, meta, session.reservedQuota); bizErr != nil {
+		return bizErr
+	}
+
+	upstreamConn, bizErr := dialRealtimeUpstream(c, meta, realtimeAdaptor)
+	if bizErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, session.reservedQuota, meta.TokenId)
+		return bizErr
+	}
+
+	clientConn, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already replied the error to the client
+		logger.Warnf(ctx, "upgrade realtime connection failed: %s", err.Error())
+		_ = upstreamConn.Close()
+		billing.ReturnPreConsumedQuota(ctx, session.reservedQuota, meta.TokenId)
+		return nil
+	}
+
+	session.clientConn = clientConn
+	session.upstreamConn = upstreamConn
+	session.run()
+	return nil
+}
+
+// dialRealtimeUpstream connects the realtime session of the upstream
+func dialRealtimeUpstream(c *gin.Context, meta *metalib.Meta, realtimeAdaptor relayadaptor.RealtimeAdaptor) (*websocket.Conn, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	upstreamURL, err := realtimeAdaptor.GetRealtimeURL(meta)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+	header := http.Header{}
+	if err = realtimeAdaptor.SetupRealtimeHeader(c, header, meta); err != nil {
+		return nil, openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	upstreamConn, resp, err := realtimeDialer.DialContext(ctx, upstreamURL, header)
+	if err != nil {
+		logger.Errorf(ctx, "dial realtime upstream failed: %s", err.Error())
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return nil, RelayErrorHandler(resp)
+		}
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	return upstreamConn, nil
+}
+
+// checkRealtimeQuota checks that the user, the token and the budget still have quota left for the session
+func checkRealtimeQuota(c *gin.Context, meta *metalib.Meta) *relaymodel.ErrorWithStatusCode {
+	if _, bizErr := checkPoolQuota(c, meta.UserId, 1); bizErr != nil {
+		return bizErr
+	}
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, 1); bizErr != nil {
+		return bizErr
+	}
+	if c.GetBool(ctxkey.TokenQuotaUnlimited) {
+		return nil
+	}
+
+	token, err := model.GetTokenById(meta.TokenId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_token_failed", http.StatusInternalServerError)
+	}
+	if token.RemainQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
+	}
+	return nil
+}
+
+// realtimeSession proxies the events between the client and the upstream.
+// Each connection is only written by one goroutine, the control frames are written by WriteControl.
+// The usage is billed by another goroutine with a context that outlives the connections.
+type realtimeSession struct {
+	c            *gin.Context
+	meta         *metalib.Meta
+	clientConn   *websocket.Conn
+	upstreamConn *websocket.Conn
+
+	modelRatio      float64
+	completionRatio float64
+	groupRatio      float64
+	reservedQuota   int64
+	lastBilledAt    time.Time
+
+	// billingC is the copy of c used by the billing goroutine, its context is not cancelled when the client is gone
+	billingC *gin.Context
+	usages   chan *relaymodel.RealtimeUsage
+	// inFlight is true between the response.created and the response.done events
+	inFlight   atomic.Bool
+	clientGone atomic.Bool
+	quotaErr   atomic.Pointer[relaymodel.ErrorWithStatusCode]
+
+	closeOnce sync.Once
+}
+
+// run blocks until any side of the session is closed and the usage is settled
+func (s *realtimeSession) run() {
+	ctx := context.WithoutCancel(s.c.Request.Context())
+	s.billingC = s.c.Copy()
+	s.billingC.Request = s.c.Request.WithContext(ctx)
+	s.usages = make(chan *relaymodel.RealtimeUsage, 16)
+	billed := make(chan struct{})
+	go func() {
+		defer close(billed)
+		s.billUsages()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.drainUpstream(s.forward(s.clientConn, s.upstreamConn, nil))
+	}()
+
+	closeErr := s.forward(s.upstreamConn, s.clientConn, s.handleUpstreamEvent)
+	if bizErr := s.quotaErr.Load(); bizErr != nil {
+		s.sendError(bizErr)
+	} else if closeErr != nil && !s.clientGone.Load() {
+		_ = s.clientConn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeErr.Code, closeErr.Text), time.Now().Add(time.Second))
+	}
+	s.close()
+	<-done
+
+	close(s.usages)
+	<-billed
+	s.settle(ctx)
+}
+
+// forward copies the messages from src to dst until any of them is closed, it returns the close frame of src if any.
+// handle is called after each text message, and src is still read after dst is gone if handle is set,
+// so the usage of the response in flight is still reported.
+func (s *realtimeSession) forward(src, dst *websocket.Conn, handle func(message []byte)) *websocket.CloseError {
+	ctx := s.c.Request.Context()
+	dstGone := false
+	for {
+		messageType, message, err := src.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return closeErr
+			}
+			return nil
+		}
+		if !dstGone {
+			if err = dst.WriteMessage(messageType, message); err != nil {
+				logger.Debugf(ctx, "forward realtime message failed: %s", err.Error())
+				if handle == nil {
+					return nil
+				}
+				dstGone = true
+			}
+		}
+
+		if handle != nil && messageType == websocket.TextMessage {
+			handle(message)
+		}
+	}
+}
+
+// drainUpstream is called once the client is gone. The response in flight is cancelled, and the upstream
+// is still read for a while to bill its usage, otherwise the upstream is closed right away.
+func (s *realtimeSession) drainUpstream(closeErr *websocket.CloseError) {
+	s.clientGone.Store(true)
+	if !s.inFlight.Load() {
+		if closeErr != nil {
+			_ = s.upstreamConn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeErr.Code, closeErr.Text), time.Now().Add(time.Second))
+		}
+		s.close()
+		return
+	}
+	_ = s.upstreamConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"response.cancel"}`))
+	_ = s.upstreamConn.SetReadDeadline(time.Now().Add(realtimeDrainTimeout))
+}
+
+// handleUpstreamEvent tracks the response in flight, and queues the usage of the done responses to be billed
+func (s *realtimeSession) handleUpstreamEvent(message []byte) {
+	event := new(relaymodel.RealtimeEvent)
+	if err := json.Unmarshal(message, event); err != nil {
+		logger.Warnf(s.c.Request.Context(), "unmarshal realtime event failed: %s", err.Error())
+		return
+	}
+	switch event.Type {
+	case "response.created":
+		s.inFlight.Store(true)
+	case "response.done":
+		if event.Response != nil && event.Response.Usage != nil {
+			s.usages <- event.Response.Usage
+		}
+		s.inFlight.Store(false)
+		// the client is gone, and the usage of the last response is reported
+		if s.clientGone.Load() {
+			_ = s.upstreamConn.Close()
+		}
+	}
+}
+
+// billUsages bills the usage of the done responses in order, the upstream is closed
+// once the quota runs out, which ends the session with an error event.
+func (s *realtimeSession) billUsages() {
+	for usage := range s.usages {
+		s.bill(usage)
+		if s.quotaErr.Load() != nil {
+			continue
+		}
+		if bizErr := checkRealtimeQuota(s.billingC, s.meta); bizErr != nil {
+			logger.Warnf(s.billingC.Request.Context(), "close realtime session: %s", bizErr.Message)
+			s.quotaErr.Store(bizErr)
+			_ = s.upstreamConn.Close()
+		}
+	}
+}
+
+// bill consumes the quota of a done response
+func (s *realtimeSession) bill(usage *relaymodel.RealtimeUsage) {
+	ctx := s.billingC.Request.Context()
+	modelName := s.meta.ActualModelName
+	promptTokens, completionTokens := getRealtimeTokens(modelName, usage, s.completionRatio)
+	quota := getRealtimeQuota(promptTokens, completionTokens, s.modelRatio, s.completionRatio, s.groupRatio)
+
+	billing.PostConsumeQuotaDetailed(ctx, s.meta.TokenId, quota, quota, s.meta.UserId, s.meta.ChannelId,
+		promptTokens, completionTokens, s.modelRatio, s.groupRatio, modelName, s.meta.TokenName,
+		true, s.lastBilledAt, false, s.completionRatio, 0)
+	s.lastBilledAt = time.Now()
+}
+
+// settle refunds the reservation once the session ends, or consumes it as the cost of the response
+// still in flight, whose usage is not reported before the upstream is closed.
+func (s *realtimeSession) settle(ctx context.Context) {
+	if s.reservedQuota == 0 {
+		return
+	}
+	if !s.inFlight.Load() {
+		billing.ReturnPreConsumedQuota(ctx, s.reservedQuota, s.meta.TokenId)
+		return
+	}
+	logger.Warnf(ctx, "the usage of the realtime response in flight is not reported, consume the reserved %d quota", s.reservedQuota)
+	billing.PostConsumeQuotaDetailed(ctx, s.meta.TokenId, 0, s.reservedQuota, s.meta.UserId, s.meta.ChannelId,
+		0, 0, s.modelRatio, s.groupRatio, s.meta.ActualModelName, s.meta.TokenName,
+		true, s.lastBilledAt, false, s.completionRatio, 0)
+}
+
+// sendError sends the error event to the client, and closes the session
+func (s *realtimeSession) sendError(bizErr *relaymodel.ErrorWithStatusCode) {
+	errorEvent := relaymodel.RealtimeEvent{
+		Type:  "error",
+		Error: &bizErr.Error,
+	}
+	if err := s.clientConn.WriteJSON(errorEvent); err != nil {
+		logger.Debugf(s.c.Request.Context(), "send realtime error failed: %s", err.Error())
+	}
+	_ = s.clientConn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, bizErr.Message), time.Now().Add(time.Second))
+}
+
+// close closes both connections, which stops the forwarding goroutines
+func (s *realtimeSession) close() {
+	s.closeOnce.Do(func() {
+		_ = s.clientConn.Close()
+		_ = s.upstreamConn.Close()
+	})
+}
+
+// getRealtimeTokens converts the realtime usage to the text tokens billed with the model ratio,
+// the audio tokens are weighted by the audio ratios of the model.
+func getRealtimeTokens(modelName string, usage *relaymodel.RealtimeUsage, completionRatio float64) (promptTokens int, completionTokens int) {
+	input := usage.InputTokenDetails
+	if input.TextTokens == 0 && input.AudioTokens == 0 {
+		promptTokens = usage.InputTokens
+	} else {
+		promptTokens = input.TextTokens +
+			int(math.Ceil(float64(input.AudioTokens)*billingratio.GetAudioPromptRatio(modelName)))
+	}
+
+	output := usage.OutputTokenDetails
+	if output.TextTokens == 0 && output.AudioTokens == 0 {
+		completionTokens = usage.OutputTokens
+	} else {
+		// the audio completion ratio is relative to the audio prompt price,
+		// while the completion tokens are billed with the text completion ratio
+		audioOutputRatio := billingratio.GetAudioPromptRatio(modelName) * billingratio.GetAudioCompletionRatio(modelName)
+		if completionRatio > 0 {
+			audioOutputRatio /= completionRatio
+		}
+		completionTokens = output.TextTokens + int(math.Ceil(float64(output.AudioTokens)*audioOutputRatio))
+	}
+	return promptTokens, completionTokens
+}
+
+// getRealtimeQuota returns the quota of the tokens of a realtime response
+func getRealtimeQuota(promptTokens int, completionTokens int, modelRatio float64, completionRatio float64, groupRatio float64) int64 {
+	ratio := modelRatio * groupRatio
+	quota := int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return quota
+}
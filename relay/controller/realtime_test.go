@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestGetRealtimeTokens(t *testing.T) {
+	usage := &relaymodel.RealtimeUsage{
+		InputTokens:  150,
+		OutputTokens: 60,
+		InputTokenDetails: relaymodel.RealtimeInputTokenDetails{
+			RealtimeTokenDetails: relaymodel.RealtimeTokenDetails{TextTokens: 100, AudioTokens: 50},
+		},
+		OutputTokenDetails: relaymodel.RealtimeTokenDetails{TextTokens: 10, AudioTokens: 50},
+	}
+
+	// audio input is $40 and audio output is $80 per 1M tokens, text input is $5 and output is $20
+	promptTokens, completionTokens := getRealtimeTokens("gpt-4o-realtime-preview", usage, 4)
+	assert.Equal(t, 100+50*8, promptTokens)
+	assert.Equal(t, 10+50*4, completionTokens)
+
+	// the totals are used without the details
+	promptTokens, completionTokens = getRealtimeTokens("gpt-4o-realtime-preview",
+		&relaymodel.RealtimeUsage{InputTokens: 7, OutputTokens: 3}, 4)
+	assert.Equal(t, 7, promptTokens)
+	assert.Equal(t, 3, completionTokens)
+}
+
+func TestGetRealtimeQuota(t *testing.T) {
+	assert.EqualValues(t, 180, getRealtimeQuota(100, 20, 1, 4, 1))
+	assert.EqualValues(t, 360, getRealtimeQuota(100, 20, 1, 4, 2))
+	// the tiny usage is billed at least 1
+	assert.EqualValues(t, 1, getRealtimeQuota(1, 0, 0.001, 4, 1))
+	assert.EqualValues(t, 0, getRealtimeQuota(100, 20, 0, 4, 1))
+}
+
+func TestRealtimeSessionForward(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upgrader := websocket.Upgrader{}
+
+	// the upstream echoes the client events back as the server events
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	relayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := gin.CreateTestContext(w)
+		c.Request = r
+		upstreamConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(upstream.URL, "http"), nil)
+		require.NoError(t, err)
+		clientConn, err := realtimeUpgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+
+		session := &realtimeSession{
+			c:            c,
+			meta:         &metalib.Meta{ActualModelName: "gpt-4o-realtime-preview"},
+			clientConn:   clientConn,
+			upstreamConn: upstreamConn,
+		}
+		session.run()
+	}))
+	defer relayServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"realtime"}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(relayServer.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "realtime", resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	event := `{"type":"session.update","session":{"modalities":["text"]}}`
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(event)))
+	messageType, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.JSONEq(t, event, string(message))
+
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error: %v", err)
+}
+
+func TestCheckRealtimeOrigin(t *testing.T) {
+	originServerAddress, originAllowedOrigins := config.ServerAddress, config.RealtimeAllowedOrigins
+	defer func() {
+		config.ServerAddress, config.RealtimeAllowedOrigins = originServerAddress, originAllowedOrigins
+	}()
+	config.ServerAddress = "https://api.example.com"
+	config.RealtimeAllowedOrigins = "https://app.example.com/, https://chat.example.com"
+
+	for origin, allowed := range map[string]bool{
+		"":                         true,
+		"http://relay.local":       true,
+		"https://api.example.com":  true,
+		"https://app.example.com":  true,
+		"https://chat.example.com": true,
+		"https://evil.example.com": false,
+		"null":                     false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://relay.local/v1/realtime", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		assert.Equal(t, allowed, checkRealtimeOrigin(r), origin)
+	}
+
+	config.RealtimeAllowedOrigins = "*"
+	r := httptest.NewRequest(http.MethodGet, "http://relay.local/v1/realtime", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	assert.True(t, checkRealtimeOrigin(r))
+}
+
+func TestRealtimeSessionInFlight(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/realtime", nil)
+	session := &realtimeSession{c: c, meta: &metalib.Meta{}, usages: make(chan *relaymodel.RealtimeUsage, 1)}
+
+	session.handleUpstreamEvent([]byte(`{"type":"response.created","response":{"id":"resp_1"}}`))
+	assert.True(t, session.inFlight.Load())
+	session.handleUpstreamEvent([]byte(`{"type":"response.done","response":{"id":"resp_1","usage":{"input_tokens":10,"output_tokens":5}}}`))
+	assert.False(t, session.inFlight.Load())
+	require.Len(t, session.usages, 1)
+	assert.Equal(t, 10, (<-session.usages).InputTokens)
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+// RelayRerankHelper handles the canonical rerank requests (/v1/rerank).
+//
+// The request is converted by the adaptor to the upstream format, and the upstream response
+// is converted back, sorted by the relevance score and truncated to top_n.
+// The models priced per search unit are billed by the search units, the others by the tokens.
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := metalib.GetByContext(c)
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	rerankAdaptor, ok := getRerankAdaptor(adaptor)
+	if !ok {
+		// the channels without the canonical rerank support forward the request as is
+		return RelayTextHelper(c)
+	}
+
+	rerankRequest, err := getAndValidateRerankRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateRerankRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model = meta.ActualModelName
+
+	// get model ratio using three-layer pricing system
+	channelModelRatio, _ := getChannelRatios(c, meta.ChannelId)
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(rerankRequest.Model, channelModelRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+
+	// pre-consume quota
+	promptTokens := countRerankTokens(rerankRequest)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(c, &relaymodel.GeneralOpenAIRequest{Model: rerankRequest.Model},
+		promptTokens, modelRatio*groupRatio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	rerankResponse, bizErr := doRerank(c, meta, adaptor, rerankAdaptor, rerankRequest)
+	if bizErr == nil {
+		bizErr = getHedgeLostError(c)
+	}
+	if bizErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return bizErr
+	}
+
+	normalizeRerankResponse(rerankRequest, rerankResponse, promptTokens)
+	rerankResponse.Model = meta.OriginModelName
+	c.JSON(http.StatusOK, rerankResponse)
+
+	// post-consume quota
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+	usage := &relaymodel.Usage{
+		PromptTokens: rerankResponse.Usage.TotalTokens,
+		TotalTokens:  rerankResponse.Usage.TotalTokens,
+	}
+	recordTextRelayMetrics(c, meta, usage)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		quota := getRerankQuota(rerankRequest.Model, rerankResponse.Usage, modelRatio, groupRatio)
+		billing.PostConsumeQuotaDetailed(ctx, meta.TokenId, quota-preConsumedQuota, quota, meta.UserId, meta.ChannelId,
+			usage.PromptTokens, 0, modelRatio, groupRatio, rerankRequest.Model, meta.TokenName,
+			false, meta.StartTime, false, 1, 0)
+
+		// also update user request cost
+		if quota != 0 {
+			docu := model.NewUserRequestCost(
+				quotaId,
+				requestId,
+				quota,
+			)
+			if err := docu.Insert(); err != nil {
+				logger.Errorf(ctx, "insert user request cost failed: %+v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// getRerankAdaptor returns the adaptor if it could convert the canonical rerank requests
+func getRerankAdaptor(a adaptor.Adaptor) (adaptor.RerankAdaptor, bool) {
+	rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+	return rerankAdaptor, ok
+}
+
+// getAndValidateRerankRequest gets and validates the canonical rerank request
+func getAndValidateRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	if err := common.UnmarshalBodyReusable(c, rerankRequest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal request")
+	}
+
+	if rerankRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if rerankRequest.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return nil, errors.New("documents is required")
+	}
+	if rerankRequest.TopN < 0 {
+		return nil, errors.New("top_n should not be negative")
+	}
+
+	return rerankRequest, nil
+}
+
+// doRerank sends the converted request to the upstream and converts the response back
+func doRerank(c *gin.Context,
+	meta *metalib.Meta,
+	adaptor adaptor.Adaptor,
+	rerankAdaptor adaptor.RerankAdaptor,
+	rerankRequest *relaymodel.RerankRequest) (*relaymodel.RerankResponse, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, rerankRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_converted_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted rerank request: \n%s", string(jsonData))
+
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return nil, getDoRequestError(c, err)
+	}
+	if isErrorHappened(meta, resp) {
+		return nil, RelayErrorHandler(resp)
+	}
+
+	rerankResponse, respErr := rerankAdaptor.DoRerankResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		return nil, respErr
+	}
+	return rerankResponse, nil
+}
+
+// countRerankTokens estimates the tokens of the query and the documents
+func countRerankTokens(request *relaymodel.RerankRequest) int {
+	tokens := openai.CountTokenText(request.Query, request.Model)
+	for _, document := range request.Documents {
+		tokens += openai.CountTokenText(document, request.Model)
+	}
+	return tokens
+}
+
+// normalizeRerankResponse makes the responses of all providers look the same:
+// the results are sorted by the relevance score and truncated to top_n,
+// the documents are only returned if requested, and the missing usage is estimated.
+func normalizeRerankResponse(request *relaymodel.RerankRequest, response *relaymodel.RerankResponse, promptTokens int) {
+	results := make([]relaymodel.RerankResult, 0, len(response.Results))
+	for _, result := range response.Results {
+		if result.Index < 0 || result.Index >= len(request.Documents) {
+			continue
+		}
+		if request.ReturnDocuments {
+			if result.Document == nil {
+				result.Document = &relaymodel.RerankDocument{Text: request.Documents[result.Index]}
+			}
+		} else {
+			result.Document = nil
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RelevanceScore > results[j].RelevanceScore
+	})
+	if request.TopN > 0 && len(results) > request.TopN {
+		results = results[:request.TopN]
+	}
+	response.Results = results
+
+	if response.Usage.TotalTokens == 0 {
+		response.Usage.TotalTokens = promptTokens
+	}
+	if billingratio.RerankSearchUnitModels[request.Model] && response.Usage.SearchUnits == 0 {
+		response.Usage.SearchUnits = (len(request.Documents) + billingratio.RerankDocumentsPerSearchUnit - 1) /
+			billingratio.RerankDocumentsPerSearchUnit
+	}
+}
+
+// getRerankQuota returns the quota of a rerank request with the model ratio, the models priced per search unit
+// are billed by the search units as billingratio.RerankTokensPerSearchUnit tokens each, the others by the tokens.
+func getRerankQuota(modelName string, usage relaymodel.RerankUsage, modelRatio float64, groupRatio float64) int64 {
+	tokens := usage.TotalTokens
+	if billingratio.RerankSearchUnitModels[modelName] {
+		tokens = usage.SearchUnits * billingratio.RerankTokensPerSearchUnit
+	}
+
+	ratio := modelRatio * groupRatio
+	quota := int64(math.Ceil(float64(tokens) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return quota
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/cohere"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestRerankRequestDocuments(t *testing.T) {
+	var request relaymodel.RerankRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model":"rerank-v3.5","query":"q",
+		"documents":["a",{"text":"b"}],"top_n":1}`), &request))
+	assert.Equal(t, relaymodel.RerankDocuments{"a", "b"}, request.Documents)
+
+	require.Error(t, json.Unmarshal([]byte(`{"documents":[1]}`), &request))
+}
+
+func TestNormalizeRerankResponse(t *testing.T) {
+	request := &relaymodel.RerankRequest{
+		Model:           "BAAI/bge-reranker-v2-m3",
+		Query:           "q",
+		Documents:       relaymodel.RerankDocuments{"a", "b", "c"},
+		TopN:            2,
+		ReturnDocuments: true,
+	}
+	response := &relaymodel.RerankResponse{
+		Results: []relaymodel.RerankResult{
+			{Index: 0, RelevanceScore: 0.1},
+			{Index: 2, RelevanceScore: 0.9, Document: &relaymodel.RerankDocument{Text: "c"}},
+			{Index: 1, RelevanceScore: 0.5},
+			// the invalid index is dropped
+			{Index: 3, RelevanceScore: 1},
+		},
+	}
+	normalizeRerankResponse(request, response, 42)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, 2, response.Results[0].Index)
+	assert.Equal(t, 1, response.Results[1].Index)
+	assert.Equal(t, "b", response.Results[1].Document.Text)
+	assert.Equal(t, 42, response.Usage.TotalTokens)
+	assert.Zero(t, response.Usage.SearchUnits)
+
+	// the documents are not returned unless requested
+	request.ReturnDocuments = false
+	request.Model = "rerank-v3.5"
+	request.Documents = make(relaymodel.RerankDocuments, 150)
+	normalizeRerankResponse(request, response, 0)
+	assert.Nil(t, response.Results[0].Document)
+	assert.Equal(t, 2, response.Usage.SearchUnits)
+}
+
+func TestGetRerankQuota(t *testing.T) {
+	// billed by search units, $0.002 per search unit
+	modelRatio := cohere.ModelRatios["rerank-v3.5"].Ratio
+	quota := getRerankQuota("rerank-v3.5", relaymodel.RerankUsage{TotalTokens: 1000, SearchUnits: 2}, modelRatio, 1)
+	assert.EqualValues(t, 2000, quota)
+	// the channel overrides the price of the search unit
+	quota = getRerankQuota("rerank-v3.5", relaymodel.RerankUsage{TotalTokens: 1000, SearchUnits: 2}, modelRatio/2, 1)
+	assert.EqualValues(t, 1000, quota)
+
+	// billed by tokens
+	quota = getRerankQuota("BAAI/bge-reranker-v2-m3", relaymodel.RerankUsage{TotalTokens: 1000}, 0.5, 2)
+	assert.EqualValues(t, 1000, quota)
+	quota = getRerankQuota("BAAI/bge-reranker-v2-m3", relaymodel.RerankUsage{}, 0.5, 1)
+	assert.EqualValues(t, 1, quota)
+}
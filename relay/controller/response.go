@@ -67,6 +67,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
 		return openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(meta)
@@ -74,6 +75,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// get request body - for Response API, we pass through directly without conversion
 	requestBody, err := getResponseAPIRequestBody(c, meta, responseAPIRequest, adaptor)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
@@ -85,7 +87,8 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
-		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
+		return getDoRequestError(c, err)
 	}
 
 	// Check for HTTP errors
@@ -96,12 +99,17 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	// do response
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr == nil {
+		respErr = getHedgeLostError(c)
+	}
 	if respErr != nil {
 		logger.Errorf(ctx, "DoResponse failed: %+v", *respErr)
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, c.GetInt(ctxkey.TokenId))
 		return respErr
 	}
 
+	recordResponse(c, meta, responseAPIRequest)
+
 	// post-consume quota
 	quotaId := c.GetInt(ctxkey.Id)
 	requestId := c.GetString(ctxkey.RequestId)
@@ -128,6 +136,29 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	return nil
 }
 
+// recordResponse records the channel that served the response,
+// the stored response could only be accessed through the same channel.
+func recordResponse(c *gin.Context, meta *metalib.Meta, responseAPIRequest *openai.ResponseAPIRequest) {
+	responseId := c.GetString(ctxkey.ResponseId)
+	if responseId == "" {
+		return
+	}
+	if responseAPIRequest.Store != nil && !*responseAPIRequest.Store {
+		return
+	}
+
+	record := &model.ResponseRecord{
+		ResponseId: responseId,
+		UserId:     meta.UserId,
+		TokenId:    meta.TokenId,
+		ChannelId:  meta.ChannelId,
+		Model:      responseAPIRequest.Model,
+	}
+	if err := record.Insert(); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to record response %s: %+v", responseId, err)
+	}
+}
+
 // getChannelRatios gets channel model and completion ratios from unified ModelConfigs
 func getChannelRatios(c *gin.Context, channelId int) (map[string]float64, map[string]float64) {
 	channel := c.MustGet(ctxkey.ChannelModel).(*model.Channel)
@@ -230,19 +261,18 @@ func preConsumeResponseAPIQuota(c *gin.Context, responseAPIRequest *openai.Respo
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(c.Request.Context(), meta.UserId)
-	if err != nil {
-		return baseQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	if _, bizErr := checkPoolQuota(c, meta.UserId, baseQuota); bizErr != nil {
+		return baseQuota, bizErr
 	}
-	if userQuota-baseQuota < 0 {
-		return baseQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	if bizErr := checkBudget(meta.TokenId, meta.UserId, baseQuota); bizErr != nil {
+		return baseQuota, bizErr
 	}
 
 	if !tokenQuotaUnlimited && tokenQuota > 0 && tokenQuota-baseQuota < 0 {
 		return baseQuota, openai.ErrorWrapper(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
 	}
 
-	err = model.PreConsumeTokenQuota(c.GetInt(ctxkey.TokenId), baseQuota)
+	err := model.PreConsumeTokenQuota(c.GetInt(ctxkey.TokenId), baseQuota)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 	}
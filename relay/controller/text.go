@@ -22,6 +22,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
 	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/cache"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	metalib "github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
@@ -43,6 +44,8 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
 	}
 	meta.IsStream = textRequest.Stream
+	// the key is based on the request sent by the client, before the model mapping
+	cacheKey := getResponseCacheKey(c, meta, textRequest)
 
 	if reqBody, ok := c.Get(ctxkey.KeyRequestBody); ok {
 		logger.Debugf(c.Request.Context(), "get text request: %s\n", string(reqBody.([]byte)))
@@ -73,6 +76,12 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 
 	ratio := modelRatio * groupRatio
+	if cacheKey != "" {
+		if entry, ok := cache.Get(ctx, cacheKey, getResponseCacheTTL(c)); ok {
+			return replayCachedResponse(c, meta, textRequest, entry, modelRatio, groupRatio, channelCompletionRatio)
+		}
+	}
+
 	// pre-consume quota
 	promptTokens := getPromptTokens(c.Request.Context(), textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
@@ -84,6 +93,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(meta)
@@ -91,6 +101,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
 	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
@@ -102,7 +113,8 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
-		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return getDoRequestError(c, err)
 	}
 	if isErrorHappened(meta, resp) {
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
@@ -110,58 +122,25 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	}
 
 	// do response
+	finishResponseCache := startResponseCache(c, cacheKey, meta)
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr == nil {
+		respErr = getHedgeLostError(c)
+	}
 	if respErr != nil {
+		finishResponseCache(nil)
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return respErr
 	}
+	finishResponseCache(usage)
 
 	// post-consume quota
 	quotaId := c.GetInt(ctxkey.Id)
 	requestId := c.GetString(ctxkey.RequestId)
 
 	// Record detailed Prometheus metrics
-	if usage != nil {
-		// Get user information for metrics
-		userId := strconv.Itoa(meta.UserId)
-		username := c.GetString(ctxkey.Username)
-		if username == "" {
-			username = "unknown"
-		}
-		group := meta.Group
-		if group == "" {
-			group = "default"
-		}
-
-		// Record relay request metrics with actual usage
-		metrics.GlobalRecorder.RecordRelayRequest(
-			meta.StartTime,
-			meta.ChannelId,
-			channeltype.IdToName(meta.ChannelType),
-			meta.ActualModelName,
-			userId,
-			true,
-			usage.PromptTokens,
-			usage.CompletionTokens,
-			0, // Will be calculated in postConsumeQuota
-		)
-
-		// Record user metrics
-		userBalance := float64(c.GetInt64(ctxkey.UserQuota))
-		metrics.GlobalRecorder.RecordUserMetrics(
-			userId,
-			username,
-			group,
-			0, // Will be calculated in postConsumeQuota
-			usage.PromptTokens,
-			usage.CompletionTokens,
-			userBalance,
-		)
-
-		// Record model usage metrics
-		metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
-	}
+	recordTextRelayMetrics(c, meta, usage)
 
 	go func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -185,6 +164,52 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	return nil
 }
 
+// recordTextRelayMetrics records the Prometheus metrics of a text relay request with actual usage
+func recordTextRelayMetrics(c *gin.Context, meta *metalib.Meta, usage *relaymodel.Usage) {
+	if usage == nil {
+		return
+	}
+
+	// Get user information for metrics
+	userId := strconv.Itoa(meta.UserId)
+	username := c.GetString(ctxkey.Username)
+	if username == "" {
+		username = "unknown"
+	}
+	group := meta.Group
+	if group == "" {
+		group = "default"
+	}
+
+	// Record relay request metrics with actual usage
+	metrics.GlobalRecorder.RecordRelayRequest(
+		meta.StartTime,
+		meta.ChannelId,
+		channeltype.IdToName(meta.ChannelType),
+		meta.ActualModelName,
+		userId,
+		true,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		0, // Will be calculated in postConsumeQuota
+	)
+
+	// Record user metrics
+	userBalance := float64(c.GetInt64(ctxkey.UserQuota))
+	metrics.GlobalRecorder.RecordUserMetrics(
+		userId,
+		username,
+		group,
+		0, // Will be calculated in postConsumeQuota
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		userBalance,
+	)
+
+	// Record model usage metrics
+	metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
+}
+
 func getRequestBody(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
 	if !config.EnforceIncludeUsage &&
 		meta.APIType == apitype.OpenAI &&
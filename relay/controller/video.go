@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	relayadaptor "github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+)
+
+// RelayVideoHelper creates an asynchronous video task on the upstream (/v1/videos).
+//
+// The video is billed by ratio.TokensPerSec completion tokens per second, the cost is pre-consumed
+// when the task is created, and the task is settled or refunded by the task poller.
+func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := metalib.GetByContext(c)
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+	videoAdaptor, ok := adaptor.(relayadaptor.VideoAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(errors.Errorf("channel %s does not support video generation", adaptor.GetChannelName()),
+			"unsupported_video_channel", http.StatusBadRequest)
+	}
+
+	videoRequest, err := getAndValidateVideoRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateVideoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = videoRequest.Model
+	videoRequest.Model = meta.ActualModelName
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c, meta.ChannelId)
+	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(meta.ActualModelName, channelModelRatio, pricingAdaptor)
+	completionRatio := pricing.GetCompletionRatioWithThreeLayers(meta.ActualModelName, channelCompletionRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+
+	seconds := videoRequest.GetSeconds()
+	completionTokens := seconds * billingratio.TokensPerSec
+	quota, err := getVideoQuota(completionTokens, modelRatio, completionRatio, groupRatio)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+	if bizErr := preConsumeFixedQuota(c, meta, quota); bizErr != nil {
+		logger.Warnf(ctx, "preConsumeFixedQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	upstreamTaskId, bizErr := createVideoTask(c, meta, adaptor, videoAdaptor, videoRequest)
+	if bizErr == nil {
+		bizErr = getHedgeLostError(c)
+	}
+	if bizErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, quota, meta.TokenId)
+		return bizErr
+	}
+
+	task := model.NewTask(model.TaskTypeVideo, meta.UserId)
+	task.TokenId = meta.TokenId
+	task.TokenName = meta.TokenName
+	task.OrganizationId = c.GetInt(ctxkey.OrganizationId)
+	task.ChannelId = meta.ChannelId
+	task.ChannelKeyId = c.GetInt(ctxkey.ChannelKeyId)
+	task.Model = meta.OriginModelName
+	task.UpstreamModel = meta.ActualModelName
+	task.UpstreamTaskId = upstreamTaskId
+	task.Seconds = seconds
+	task.Size = videoRequest.Size
+	task.CompletionTokens = completionTokens
+	task.ModelRatio = modelRatio
+	task.CompletionRatio = completionRatio
+	task.GroupRatio = groupRatio
+	task.Quota = quota
+	task.PreConsumedQuota = quota
+	if err = task.Insert(); err != nil {
+		logger.Errorf(ctx, "insert video task of upstream task %s failed: %+v", upstreamTaskId, err)
+		billing.ReturnPreConsumedQuota(ctx, quota, meta.TokenId)
+		return openai.ErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
+	}
+
+	c.JSON(http.StatusOK, GetVideoObject(task))
+	return nil
+}
+
+// getAndValidateVideoRequest gets and validates the canonical video request
+func getAndValidateVideoRequest(c *gin.Context) (*relaymodel.VideoRequest, error) {
+	videoRequest := &relaymodel.VideoRequest{}
+	if err := common.UnmarshalBodyReusable(c, videoRequest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal request")
+	}
+
+	if videoRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if videoRequest.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+	if videoRequest.Seconds < 0 {
+		return nil, errors.New("seconds should not be negative")
+	}
+	if int(videoRequest.Seconds) > config.VideoMaxSeconds {
+		return nil, errors.Errorf("seconds should not exceed %d", config.VideoMaxSeconds)
+	}
+
+	return videoRequest, nil
+}
+
+// createVideoTask sends the converted request to the upstream, and returns the id of the upstream task
+func createVideoTask(c *gin.Context,
+	meta *metalib.Meta,
+	adaptor relayadaptor.Adaptor,
+	videoAdaptor relayadaptor.VideoAdaptor,
+	videoRequest *relaymodel.VideoRequest) (string, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+
+	convertedRequest, err := videoAdaptor.ConvertVideoRequest(c, meta, videoRequest)
+	if err != nil {
+		return "", openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return "", openai.ErrorWrapper(err, "marshal_converted_request_failed", http.StatusInternalServerError)
+	}
+
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return "", getDoRequestError(c, err)
+	}
+	if isErrorHappened(meta, resp) {
+		return "", RelayErrorHandler(resp)
+	}
+	upstreamTaskId, bizErr := videoAdaptor.DoVideoResponse(c, resp, meta)
+	if bizErr != nil {
+		logger.Errorf(ctx, "DoVideoResponse failed: %+v", bizErr)
+		return "", bizErr
+	}
+	return upstreamTaskId, nil
+}
+
+// getVideoQuota returns the quota of the completion tokens of the video,
+// it returns an error if the quota overflows instead of billing a wrapped value.
+func getVideoQuota(completionTokens int, modelRatio float64, completionRatio float64, groupRatio float64) (int64, error) {
+	ratio := modelRatio * groupRatio
+	cost := math.Ceil(float64(completionTokens) * completionRatio * ratio)
+	if math.IsNaN(cost) || cost >= math.MaxInt64 {
+		return 0, errors.Errorf("the quota of %d completion tokens overflows", completionTokens)
+	}
+	quota := int64(cost)
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return quota, nil
+}
+
+// GetVideoObject converts the video task to the video object returned to the client
+func GetVideoObject(task *model.Task) *relaymodel.Video {
+	video := &relaymodel.Video{
+		Id:        task.Id,
+		Object:    "video",
+		Model:     task.Model,
+		Status:    task.Status,
+		Progress:  task.Progress,
+		Seconds:   strconv.Itoa(task.Seconds),
+		Size:      task.Size,
+		CreatedAt: task.CreatedAt,
+	}
+	if task.CompletedAt != 0 {
+		video.CompletedAt = &task.CompletedAt
+	}
+	if task.Error != nil {
+		video.Error = &relaymodel.VideoError{
+			Code:    task.Error.Code,
+			Message: task.Error.Message,
+		}
+	}
+	return video
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestGetVideoQuota(t *testing.T) {
+	getQuota := func(completionTokens int, modelRatio float64, completionRatio float64, groupRatio float64) int64 {
+		quota, err := getVideoQuota(completionTokens, modelRatio, completionRatio, groupRatio)
+		require.NoError(t, err)
+		return quota
+	}
+	// $0.5 per second, 8 seconds
+	assert.EqualValues(t, 2000000, getQuota(80, 25000, 1, 1))
+	assert.EqualValues(t, 1000000, getQuota(80, 25000, 1, 0.5))
+	// the tiny cost is billed at least 1
+	assert.EqualValues(t, 1, getQuota(10, 0.0001, 1, 1))
+	assert.EqualValues(t, 0, getQuota(10, 0, 1, 1))
+
+	// the overflowed quota is rejected instead of being billed as 1
+	_, err := getVideoQuota(1e18, 25000, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestGetAndValidateVideoRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	validate := func(body string) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/videos", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		_, err := getAndValidateVideoRequest(c)
+		return err
+	}
+
+	assert.NoError(t, validate(`{"model":"veo-3.0-generate-001","prompt":"a cat"}`))
+	assert.NoError(t, validate(`{"model":"veo-3.0-generate-001","prompt":"a cat","seconds":"`+strconv.Itoa(config.VideoMaxSeconds)+`"}`))
+	assert.Error(t, validate(`{"model":"veo-3.0-generate-001","prompt":"a cat","seconds":"`+strconv.Itoa(config.VideoMaxSeconds+1)+`"}`))
+	assert.Error(t, validate(`{"model":"veo-3.0-generate-001","prompt":"a cat","seconds":100000000000000000}`))
+	assert.Error(t, validate(`{"model":"veo-3.0-generate-001","prompt":"a cat","seconds":-1}`))
+}
+
+func TestGetVideoObject(t *testing.T) {
+	task := &model.Task{
+		Id:        "video_1",
+		Model:     "veo-3.0-generate-preview",
+		Status:    model.TaskStatusFailed,
+		Seconds:   8,
+		CreatedAt: 100,
+		Error:     &model.TaskError{Code: "content_filtered", Message: "unsafe"},
+	}
+	video := GetVideoObject(task)
+	assert.Equal(t, "video", video.Object)
+	assert.Equal(t, "8", video.Seconds)
+	assert.Nil(t, video.CompletedAt)
+	assert.Equal(t, "unsafe", video.Error.Message)
+
+	task.Status = model.TaskStatusCompleted
+	task.CompletedAt = 200
+	task.Error = nil
+	video = GetVideoObject(task)
+	assert.EqualValues(t, 200, *video.CompletedAt)
+	assert.Nil(t, video.Error)
+}
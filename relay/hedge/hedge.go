@@ -0,0 +1,221 @@
+// Package hedge supports hedged requests, which race a second channel against the first one
+// if the first one is slow to respond. The attempt that writes the first byte wins,
+// the response of the others are discarded.
+package hedge
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// StatusLost is the status code of the attempts that lost the race, as the client closed the request
+const StatusLost = 499
+
+// ErrLost is returned by the writer of the attempts that lost the race
+var ErrLost = errors.New("hedged request lost the race")
+
+var groupDelayLock sync.RWMutex
+
+// GroupDelay is the hedge delay of the groups in milliseconds, e.g. {"vip": 800}
+var GroupDelay = map[string]int{}
+
+func GroupDelay2JSONString() string {
+	groupDelayLock.RLock()
+	defer groupDelayLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupDelay)
+	if err != nil {
+		logger.SysError("error marshalling group hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupDelayByJSONString(jsonStr string) error {
+	delays := make(map[string]int)
+	if err := json.Unmarshal([]byte(jsonStr), &delays); err != nil {
+		return errors.Wrap(err, "unmarshal group hedge delay")
+	}
+	for group, delay := range delays {
+		if delay < 0 {
+			return errors.Errorf("hedge delay of group %q should not be negative", group)
+		}
+	}
+	groupDelayLock.Lock()
+	GroupDelay = delays
+	groupDelayLock.Unlock()
+	return nil
+}
+
+// GetDelay returns the hedge delay, the delay of the token takes precedence over the group,
+// 0 means the request should not be hedged.
+func GetDelay(tokenDelay int, group string) time.Duration {
+	if tokenDelay > 0 {
+		return time.Duration(tokenDelay) * time.Millisecond
+	}
+	groupDelayLock.RLock()
+	defer groupDelayLock.RUnlock()
+	return time.Duration(GroupDelay[group]) * time.Millisecond
+}
+
+// Race is a race between the attempts of a request
+type Race struct {
+	mu     sync.Mutex
+	dst    gin.ResponseWriter
+	winner *Writer
+	won    chan struct{}
+	// cancels are the functions to cancel the attempts
+	cancels map[*Writer]func()
+}
+
+// NewRace creates a race whose winner writes to dst
+func NewRace(dst gin.ResponseWriter) *Race {
+	return &Race{
+		dst:     dst,
+		won:     make(chan struct{}),
+		cancels: make(map[*Writer]func()),
+	}
+}
+
+// NewWriter creates the writer of an attempt, cancel is called once the attempt lost the race
+func (r *Race) NewWriter(cancel func()) *Writer {
+	w := &Writer{ResponseWriter: r.dst, race: r, header: make(http.Header)}
+	r.mu.Lock()
+	r.cancels[w] = cancel
+	r.mu.Unlock()
+	return w
+}
+
+// Won is closed once an attempt won the race
+func (r *Race) Won() <-chan struct{} {
+	return r.won
+}
+
+// Winner returns the writer that won the race, nil if there is no winner yet
+func (r *Race) Winner() *Writer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// claim makes w the winner if there is no winner yet, and returns true if w is the winner
+func (r *Race) claim(w *Writer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return r.winner == w
+	}
+
+	r.winner = w
+	for k, v := range w.header {
+		r.dst.Header()[k] = v
+	}
+	if w.status != 0 {
+		r.dst.WriteHeader(w.status)
+	}
+	for other, cancel := range r.cancels {
+		if other != w {
+			cancel()
+		}
+	}
+	close(r.won)
+	return true
+}
+
+// Writer buffers the status and the headers of an attempt until it writes the first byte,
+// then it either wins the race and writes to the client, or loses and discards the response.
+type Writer struct {
+	gin.ResponseWriter
+	race   *Race
+	header http.Header
+	status int
+}
+
+// Lost returns true if another attempt won the race, or this attempt finished without writing anything
+func (w *Writer) Lost() bool {
+	return w.race.Winner() != w
+}
+
+func (w *Writer) won() bool {
+	return w.race.Winner() == w
+}
+
+func (w *Writer) Header() http.Header {
+	if w.won() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *Writer) WriteHeader(code int) {
+	if w.won() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *Writer) WriteHeaderNow() {
+	if w.won() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *Writer) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if !w.race.claim(w) {
+		return 0, ErrLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *Writer) WriteString(s string) (int, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	if !w.race.claim(w) {
+		return 0, ErrLost
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *Writer) Status() int {
+	if w.won() {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *Writer) Size() int {
+	if w.won() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *Writer) Written() bool {
+	return w.won() && w.ResponseWriter.Written()
+}
+
+func (w *Writer) Flush() {
+	if w.won() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// IsLost returns true if the request of c is a hedged attempt that lost the race,
+// its response is discarded, so it must not be billed.
+func IsLost(c *gin.Context) bool {
+	w, ok := c.Writer.(*Writer)
+	return ok && w.Lost()
+}
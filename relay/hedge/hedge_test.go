@@ -0,0 +1,80 @@
+package hedge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	race := NewRace(c.Writer)
+	var cancelled []string
+	slow := race.NewWriter(func() { cancelled = append(cancelled, "slow") })
+	fast := race.NewWriter(func() { cancelled = append(cancelled, "fast") })
+
+	// nothing is sent to the client before the first byte
+	slow.Header().Set("Content-Type", "application/json")
+	slow.WriteHeader(http.StatusAccepted)
+	fast.Header().Set("Content-Type", "text/event-stream")
+	fast.WriteHeader(http.StatusOK)
+	assert.Empty(t, recorder.Header().Get("Content-Type"))
+	assert.Nil(t, race.Winner())
+	assert.False(t, fast.Written())
+
+	n, err := fast.WriteString("data: 1\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, 9, n)
+	select {
+	case <-race.Won():
+	case <-time.After(time.Second):
+		t.Fatal("the race should be won")
+	}
+	assert.Equal(t, []string{"slow"}, cancelled)
+	assert.False(t, fast.Lost())
+	assert.True(t, slow.Lost())
+
+	_, err = slow.Write([]byte(`{"id":"slow"}`))
+	assert.ErrorIs(t, err, ErrLost)
+	_, err = fast.Write([]byte("data: [DONE]\n\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "data: 1\n\ndata: [DONE]\n\n", recorder.Body.String())
+}
+
+func TestIsLost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.False(t, IsLost(c))
+
+	race := NewRace(c.Writer)
+	attempt := c.Copy()
+	attempt.Writer = race.NewWriter(func() {})
+	// an attempt finished without writing anything doesn't win
+	assert.True(t, IsLost(attempt))
+	_, err := attempt.Writer.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.False(t, IsLost(attempt))
+}
+
+func TestGetDelay(t *testing.T) {
+	defer func() { require.NoError(t, UpdateGroupDelayByJSONString("{}")) }()
+
+	require.NoError(t, UpdateGroupDelayByJSONString(`{"vip": 800}`))
+	assert.Equal(t, 800*time.Millisecond, GetDelay(0, "vip"))
+	assert.Equal(t, 200*time.Millisecond, GetDelay(200, "vip"))
+	assert.Zero(t, GetDelay(0, "default"))
+
+	assert.Error(t, UpdateGroupDelayByJSONString(`{"vip": -1}`))
+	assert.Equal(t, 800*time.Millisecond, GetDelay(0, "vip"))
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
@@ -125,3 +126,40 @@ func GetByContext(c *gin.Context) *Meta {
 func Set2Context(c *gin.Context, meta *Meta) {
 	c.Set(ctxkey.Meta, meta)
 }
+
+// GetByChannel builds the meta of the requests sent to the channel outside of a relay request,
+// such as fetching an asynchronous task with the key that created it.
+func GetByChannel(channel *model.Channel, keyId int, mode int, modelName string) (*Meta, error) {
+	key, err := channel.GetKeyById(keyId)
+	if err != nil {
+		return nil, errors.Wrap(err, "get channel key")
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "load channel config")
+	}
+	if err = cfg.DecryptSecrets(); err != nil {
+		return nil, errors.Wrap(err, "decrypt channel config")
+	}
+	if channel.Type == channeltype.Azure && cfg.APIVersion == "" && channel.Other != nil {
+		cfg.APIVersion = *channel.Other
+	}
+
+	meta := &Meta{
+		Mode:            mode,
+		ChannelType:     channel.Type,
+		ChannelId:       channel.Id,
+		ModelMapping:    channel.GetModelMapping(),
+		BaseURL:         channel.GetBaseURL(),
+		APIKey:          key,
+		APIType:         channeltype.ToAPIType(channel.Type),
+		Config:          cfg,
+		OriginModelName: modelName,
+		StartTime:       time.Now(),
+	}
+	if meta.BaseURL == "" {
+		meta.BaseURL = channeltype.ChannelBaseURLs[meta.ChannelType]
+	}
+	meta.ActualModelName = GetMappedModelName(modelName, meta.ModelMapping)
+	return meta, nil
+}
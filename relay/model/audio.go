@@ -0,0 +1,75 @@
+package model
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// AudioTranscriptionRequest is the OpenAI style transcription or translation request,
+// which is parsed by the adaptors whose upstream does not accept the multipart form.
+type AudioTranscriptionRequest struct {
+	Model          string
+	Language       string
+	Prompt         string
+	ResponseFormat string
+	Temperature    float64
+	FileName       string
+	File           []byte
+}
+
+// ParseAudioTranscriptionRequest parses the multipart form of the transcription or translation request
+func ParseAudioTranscriptionRequest(contentType string, body []byte) (*AudioTranscriptionRequest, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse content type")
+	}
+	if params["boundary"] == "" {
+		return nil, errors.New("the request should be a multipart form")
+	}
+
+	request := &AudioTranscriptionRequest{ResponseFormat: "json"}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read multipart form")
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read form field %s", part.FormName())
+		}
+		switch part.FormName() {
+		case "file":
+			request.FileName = part.FileName()
+			request.File = value
+		case "model":
+			request.Model = string(value)
+		case "language":
+			request.Language = string(value)
+		case "prompt":
+			request.Prompt = string(value)
+		case "response_format":
+			if len(value) != 0 {
+				request.ResponseFormat = string(value)
+			}
+		case "temperature":
+			if request.Temperature, err = strconv.ParseFloat(string(value), 64); err != nil {
+				return nil, errors.Wrap(err, "parse temperature")
+			}
+		}
+	}
+
+	if len(request.File) == 0 {
+		return nil, errors.New("file is required")
+	}
+	return request, nil
+}
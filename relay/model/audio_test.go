@@ -0,0 +1,34 @@
+package model
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAudioTranscriptionRequest(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("model", "whisper-1"))
+	require.NoError(t, writer.WriteField("language", "en"))
+	require.NoError(t, writer.WriteField("temperature", "0.2"))
+	fileWriter, err := writer.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = fileWriter.Write([]byte("fake audio"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	request, err := ParseAudioTranscriptionRequest(writer.FormDataContentType(), body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "whisper-1", request.Model)
+	require.Equal(t, "en", request.Language)
+	require.Equal(t, "json", request.ResponseFormat)
+	require.InDelta(t, 0.2, request.Temperature, 1e-9)
+	require.Equal(t, "speech.mp3", request.FileName)
+	require.Equal(t, []byte("fake audio"), request.File)
+
+	_, err = ParseAudioTranscriptionRequest("application/json", []byte(`{}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package model
+
+// RealtimeEvent is the envelope of the OpenAI Realtime API events,
+// only the fields needed by the relay are parsed.
+type RealtimeEvent struct {
+	Type     string            `json:"type"`
+	EventId  string            `json:"event_id,omitempty"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+	Error    *Error            `json:"error,omitempty"`
+}
+
+// RealtimeResponse is the response of the response.done event
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+// RealtimeUsage is the usage of a realtime response, the audio tokens are billed separately
+type RealtimeUsage struct {
+	TotalTokens        int                       `json:"total_tokens"`
+	InputTokens        int                       `json:"input_tokens"`
+	OutputTokens       int                       `json:"output_tokens"`
+	InputTokenDetails  RealtimeInputTokenDetails `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokenDetails      `json:"output_token_details"`
+}
+
+// RealtimeTokenDetails splits the tokens by the modality
+type RealtimeTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
+
+// RealtimeInputTokenDetails splits the input tokens by the modality, with the cached tokens
+type RealtimeInputTokenDetails struct {
+	RealtimeTokenDetails
+	CachedTokens int `json:"cached_tokens"`
+}
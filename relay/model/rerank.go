@@ -0,0 +1,79 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// RerankRequest is the canonical /v1/rerank request,
+// which is converted by the adaptors to the upstream format.
+type RerankRequest struct {
+	Model string `json:"model"`
+	Query string `json:"query"`
+	// Documents are the texts to rerank
+	Documents RerankDocuments `json:"documents"`
+	// TopN is the number of the most relevant documents to return, 0 means all
+	TopN int `json:"top_n,omitempty"`
+	// ReturnDocuments returns the document texts along with the scores
+	ReturnDocuments bool `json:"return_documents,omitempty"`
+}
+
+// RerankDocuments are the documents of the rerank request,
+// each document is either a string or an object with a text field.
+type RerankDocuments []string
+
+// UnmarshalJSON accepts both the string documents and the {"text": ...} documents
+func (d *RerankDocuments) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return errors.Wrap(err, "documents should be an array")
+	}
+
+	documents := make(RerankDocuments, 0, len(raws))
+	for i, raw := range raws {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			documents = append(documents, text)
+			continue
+		}
+
+		var document RerankDocument
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return errors.Errorf("document %d should be a string or an object with a text field", i)
+		}
+		documents = append(documents, document.Text)
+	}
+
+	*d = documents
+	return nil
+}
+
+// RerankDocument is a document returned along with its score
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+// RerankResult is the score of a document in the rerank request
+type RerankResult struct {
+	// Index is the position of the document in the request
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+// RerankUsage is the usage of a rerank request, the model is billed by
+// the search units if it's priced per search unit, otherwise by the tokens.
+type RerankUsage struct {
+	TotalTokens int `json:"total_tokens"`
+	SearchUnits int `json:"search_units,omitempty"`
+}
+
+// RerankResponse is the canonical /v1/rerank response,
+// the results are sorted by the relevance score in descending order.
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   RerankUsage    `json:"usage"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// the statuses of the upstream tasks, they're the same as the video object of OpenAI
+const (
+	TaskStatusQueued     = "queued"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusCompleted  = "completed"
+	TaskStatusFailed     = "failed"
+)
+
+// TaskResult is the status of an upstream task fetched by the adaptor
+type TaskResult struct {
+	// Status is one of the TaskStatus*
+	Status string
+	// Progress is the percentage of the task, 0 if the upstream doesn't report it
+	Progress int
+	// Error is set if the task is failed
+	Error *Error
+}
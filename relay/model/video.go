@@ -0,0 +1,92 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// VideoRequest is the canonical request to create a video (/v1/videos),
+// https://platform.openai.com/docs/api-reference/videos/create
+type VideoRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	// Seconds is the duration of the video, 0 means the default duration of the model
+	Seconds VideoSeconds `json:"seconds,omitempty"`
+	// Size is the resolution like 1280x720, which also decides the aspect ratio
+	Size string `json:"size,omitempty"`
+	// InputReference is the url or the base64 data url of the image to start the video from
+	InputReference string `json:"input_reference,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+}
+
+// DefaultVideoSeconds is the duration of the video if the request doesn't set it
+const DefaultVideoSeconds = 8
+
+// GetSeconds returns the duration of the video to generate and bill
+func (r *VideoRequest) GetSeconds() int {
+	if r.Seconds <= 0 {
+		return DefaultVideoSeconds
+	}
+	return int(r.Seconds)
+}
+
+// VideoSeconds is the duration of the video, OpenAI sends it as a string like "8"
+type VideoSeconds int
+
+func (s *VideoSeconds) UnmarshalJSON(data []byte) error {
+	var seconds int
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*s = VideoSeconds(seconds)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return errors.Errorf("seconds should be a number, got %s", string(data))
+	}
+	if text == "" {
+		*s = 0
+		return nil
+	}
+	seconds, err := strconv.Atoi(text)
+	if err != nil {
+		return errors.Errorf("seconds should be a number, got %q", text)
+	}
+	*s = VideoSeconds(seconds)
+	return nil
+}
+
+// AspectRatio returns the aspect ratio like 16:9 of the size, it returns "" if the size is not set
+func (r *VideoRequest) AspectRatio() string {
+	var width, height int
+	if _, err := fmt.Sscanf(r.Size, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return ""
+	}
+	if width >= height {
+		return "16:9"
+	}
+	return "9:16"
+}
+
+// Video is the video object returned to the client,
+// https://platform.openai.com/docs/api-reference/videos/object
+type Video struct {
+	Id          string      `json:"id"`
+	Object      string      `json:"object"`
+	Model       string      `json:"model"`
+	Status      string      `json:"status"`
+	Progress    int         `json:"progress"`
+	Seconds     string      `json:"seconds"`
+	Size        string      `json:"size,omitempty"`
+	CreatedAt   int64       `json:"created_at"`
+	CompletedAt *int64      `json:"completed_at"`
+	Error       *VideoError `json:"error"`
+}
+
+type VideoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
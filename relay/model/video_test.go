@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoRequestSeconds(t *testing.T) {
+	for body, want := range map[string]int{
+		`{"prompt":"a cat"}`:                DefaultVideoSeconds,
+		`{"prompt":"a cat","seconds":4}`:    4,
+		`{"prompt":"a cat","seconds":"12"}`: 12,
+		`{"prompt":"a cat","seconds":""}`:   DefaultVideoSeconds,
+	} {
+		request := new(VideoRequest)
+		require.NoError(t, json.Unmarshal([]byte(body), request), body)
+		assert.Equal(t, want, request.GetSeconds(), body)
+	}
+
+	request := new(VideoRequest)
+	assert.Error(t, json.Unmarshal([]byte(`{"seconds":"eight"}`), request))
+}
+
+func TestVideoRequestAspectRatio(t *testing.T) {
+	assert.Equal(t, "16:9", (&VideoRequest{Size: "1280x720"}).AspectRatio())
+	assert.Equal(t, "9:16", (&VideoRequest{Size: "720x1280"}).AspectRatio())
+	assert.Equal(t, "", (&VideoRequest{}).AspectRatio())
+	assert.Equal(t, "", (&VideoRequest{Size: "large"}).AspectRatio())
+}
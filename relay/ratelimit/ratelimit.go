@@ -0,0 +1,327 @@
+// Package ratelimit limits the requests per minute, the tokens per minute
+// and the concurrent requests of each token.
+//
+// The counters are kept in redis if enabled, so the limits are shared by all nodes,
+// otherwise or if redis fails, they are kept in memory of each node.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	redisKeyPrefix = "token_rate_limit:"
+	// window is the fixed window of the requests and tokens per minute
+	window = time.Minute
+	// concurrencyTTL is the lease of a concurrency slot, it's renewed while the request is running,
+	// so the slots leaked by the nodes crashed in the middle of requests are released once the lease expires
+	concurrencyTTL = time.Minute
+	// concurrencyRenewInterval is the interval to renew the leases of the running requests
+	concurrencyRenewInterval = concurrencyTTL / 3
+)
+
+// Result is the state of a limit after a request
+type Result struct {
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit resets
+	Reset time.Duration
+}
+
+// currentWindow returns the id of the current window and the time until it ends
+func currentWindow() (int64, time.Duration) {
+	now := time.Now()
+	start := now.Truncate(window)
+	return start.Unix() / int64(window.Seconds()), start.Add(window).Sub(now)
+}
+
+func requestsKey(tokenId int, windowId int64) string {
+	return fmt.Sprintf("%srpm:%d:%d", redisKeyPrefix, tokenId, windowId)
+}
+
+func tokensKey(tokenId int, windowId int64) string {
+	return fmt.Sprintf("%stpm:%d:%d", redisKeyPrefix, tokenId, windowId)
+}
+
+func concurrencyKey(tokenId int) string {
+	return fmt.Sprintf("%sconcurrency:%d", redisKeyPrefix, tokenId)
+}
+
+// AllowRequest counts a request of the token, and returns false
+// if the token has sent more than limit requests in the current minute.
+func AllowRequest(ctx context.Context, tokenId int, limit int) (Result, bool) {
+	windowId, reset := currentWindow()
+	count := incrBy(ctx, requestsKey(tokenId, windowId), 1, window)
+	return Result{
+		Limit:     limit,
+		Remaining: max(limit-int(count), 0),
+		Reset:     reset,
+	}, count <= int64(limit)
+}
+
+// AllowTokens returns false if the token has used up limit tokens in the current minute.
+// The tokens are counted by RecordTokens once the usage of a request is known.
+func AllowTokens(ctx context.Context, tokenId int, limit int) (Result, bool) {
+	windowId, reset := currentWindow()
+	used := get(ctx, tokensKey(tokenId, windowId))
+	return Result{
+		Limit:     limit,
+		Remaining: max(limit-int(used), 0),
+		Reset:     reset,
+	}, used < int64(limit)
+}
+
+// RecordTokens counts the prompt and completion tokens used by a request of the token
+func RecordTokens(ctx context.Context, tokenId int, tokens int) {
+	if tokenId <= 0 || tokens <= 0 {
+		return
+	}
+	windowId, _ := currentWindow()
+	incrBy(ctx, tokensKey(tokenId, windowId), int64(tokens), window)
+}
+
+// Acquire takes a concurrency slot of the token, it returns false if all the limit slots are taken.
+// Each slot is a lease that expires unless it's renewed, the lease is renewed until the release function is called,
+// which must be called once the request is done.
+func Acquire(ctx context.Context, tokenId int, limit int) (release func(), ok bool) {
+	l := &lease{
+		key:     concurrencyKey(tokenId),
+		id:      random.GetUUID(),
+		tokenId: tokenId,
+		stop:    make(chan struct{}),
+	}
+	if common.RedisEnabled {
+		acquired, err := l.acquireRedis(ctx, limit)
+		if err == nil {
+			if !acquired {
+				return nil, false
+			}
+			l.redis = true
+			go l.keepAlive()
+			return l.release, true
+		}
+		logger.SysErrorf("failed to acquire concurrency slot of token #%d, fallback to memory: %+v", tokenId, err)
+	}
+
+	if !memory.acquire(l.key, l.id, limit, time.Now().Add(concurrencyTTL)) {
+		return nil, false
+	}
+	go l.keepAlive()
+	return l.release, true
+}
+
+// lease is a concurrency slot held by a request
+type lease struct {
+	key     string
+	id      string
+	tokenId int
+	// redis is true if the lease is kept in redis, otherwise in memory
+	redis    bool
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// acquireRedis adds the lease to the sorted set of the token scored by the expiry, after the expired leases are pruned.
+// The lease is removed again if the set holds more than limit leases.
+func (l *lease) acquireRedis(ctx context.Context, limit int) (bool, error) {
+	// the slot is released after the request is done, even if the client has gone
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	pipe := common.RDB.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, l.key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.ZAdd(ctx, l.key, &redis.Z{Score: float64(now.Add(concurrencyTTL).UnixMilli()), Member: l.id})
+	count := pipe.ZCard(ctx, l.key)
+	pipe.Expire(ctx, l.key, concurrencyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, errors.Wrapf(err, "acquire %s", l.key)
+	}
+	if count.Val() > int64(limit) {
+		if err := common.RDB.ZRem(ctx, l.key, l.id).Err(); err != nil {
+			return false, errors.Wrapf(err, "remove lease from %s", l.key)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// keepAlive renews the lease periodically until it's released
+func (l *lease) keepAlive() {
+	ticker := time.NewTicker(concurrencyRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+func (l *lease) renew() {
+	expireAt := time.Now().Add(concurrencyTTL)
+	if !l.redis {
+		memory.renew(l.key, l.id, expireAt)
+		return
+	}
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	pipe.ZAddXX(ctx, l.key, &redis.Z{Score: float64(expireAt.UnixMilli()), Member: l.id})
+	pipe.Expire(ctx, l.key, concurrencyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.SysErrorf("failed to renew concurrency slot of token #%d: %+v", l.tokenId, err)
+	}
+}
+
+// release stops renewing the lease and removes it, it's safe to be called more than once
+func (l *lease) release() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		if !l.redis {
+			memory.release(l.key, l.id)
+			return
+		}
+		if err := common.RDB.ZRem(context.Background(), l.key, l.id).Err(); err != nil {
+			logger.SysErrorf("failed to release concurrency slot of token #%d: %+v", l.tokenId, err)
+		}
+	})
+}
+
+func incrBy(ctx context.Context, key string, n int64, ttl time.Duration) int64 {
+	if common.RedisEnabled {
+		count, err := redisIncrBy(ctx, key, n, ttl)
+		if err == nil {
+			return count
+		}
+		logger.SysErrorf("failed to increase rate limit counter %s, fallback to memory: %+v", key, err)
+	}
+	return memory.incrBy(key, n, ttl)
+}
+
+func get(ctx context.Context, key string) int64 {
+	if common.RedisEnabled {
+		count, err := common.RDB.Get(ctx, key).Int64()
+		switch {
+		case errors.Is(err, redis.Nil):
+			return 0
+		case err == nil:
+			return count
+		}
+		logger.SysErrorf("failed to get rate limit counter %s, fallback to memory: %+v", key, err)
+	}
+	return memory.get(key)
+}
+
+func redisIncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	// the counters are updated after the request is done, even if the client has gone
+	ctx = context.WithoutCancel(ctx)
+	pipe := common.RDB.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, n)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, errors.Wrapf(err, "increase %s", key)
+	}
+	return incr.Val(), nil
+}
+
+type memoryCounter struct {
+	value    int64
+	expireAt time.Time
+}
+
+// memoryStore is the fallback of redis
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	// leases are the expiries of the concurrency leases by the lease ids of each key
+	leases    map[string]map[string]time.Time
+	lastSweep time.Time
+}
+
+var memory = &memoryStore{
+	counters: make(map[string]*memoryCounter),
+	leases:   make(map[string]map[string]time.Time),
+}
+
+func (s *memoryStore) incrBy(key string, n int64, ttl time.Duration) int64 {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > window {
+		for k, counter := range s.counters {
+			if now.After(counter.expireAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expireAt) {
+		counter = new(memoryCounter)
+		s.counters[key] = counter
+	}
+	counter.value += n
+	counter.expireAt = now.Add(ttl)
+	return counter.value
+}
+
+func (s *memoryStore) get(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[key]
+	if !ok || time.Now().After(counter.expireAt) {
+		return 0
+	}
+	return counter.value
+}
+
+// acquire adds the lease to the key after the expired leases are pruned, it returns false if limit leases are held
+func (s *memoryStore) acquire(key string, leaseId string, limit int, expireAt time.Time) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases, ok := s.leases[key]
+	if !ok {
+		leases = make(map[string]time.Time)
+		s.leases[key] = leases
+	}
+	for id, leaseExpireAt := range leases {
+		if now.After(leaseExpireAt) {
+			delete(leases, id)
+		}
+	}
+	if len(leases) >= limit {
+		return false
+	}
+	leases[leaseId] = expireAt
+	return true
+}
+
+func (s *memoryStore) renew(key string, leaseId string, expireAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.leases[key][leaseId]; ok {
+		s.leases[key][leaseId] = expireAt
+	}
+}
+
+func (s *memoryStore) release(key string, leaseId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.leases[key], leaseId)
+	if len(s.leases[key]) == 0 {
+		delete(s.leases, key)
+	}
+}
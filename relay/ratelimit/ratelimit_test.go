@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func disableRedis(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	t.Cleanup(func() { common.RedisEnabled = redisEnabled })
+	common.RedisEnabled = false
+}
+
+func TestAllowRequest(t *testing.T) {
+	disableRedis(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, ok := AllowRequest(ctx, 1, 3)
+		require.True(t, ok)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, 2-i, result.Remaining)
+		assert.LessOrEqual(t, result.Reset, time.Minute)
+	}
+	result, ok := AllowRequest(ctx, 1, 3)
+	assert.False(t, ok)
+	assert.Zero(t, result.Remaining)
+
+	// the other tokens are not affected
+	_, ok = AllowRequest(ctx, 2, 3)
+	assert.True(t, ok)
+}
+
+func TestAllowTokens(t *testing.T) {
+	disableRedis(t)
+	ctx := context.Background()
+
+	result, ok := AllowTokens(ctx, 3, 100)
+	require.True(t, ok)
+	assert.Equal(t, 100, result.Remaining)
+
+	RecordTokens(ctx, 3, 60)
+	result, ok = AllowTokens(ctx, 3, 100)
+	require.True(t, ok)
+	assert.Equal(t, 40, result.Remaining)
+
+	RecordTokens(ctx, 3, 60)
+	result, ok = AllowTokens(ctx, 3, 100)
+	assert.False(t, ok)
+	assert.Zero(t, result.Remaining)
+}
+
+func TestAcquire(t *testing.T) {
+	disableRedis(t)
+	ctx := context.Background()
+
+	release1, ok := Acquire(ctx, 4, 2)
+	require.True(t, ok)
+	release2, ok := Acquire(ctx, 4, 2)
+	require.True(t, ok)
+	_, ok = Acquire(ctx, 4, 2)
+	assert.False(t, ok)
+
+	release1()
+	release3, ok := Acquire(ctx, 4, 2)
+	require.True(t, ok)
+	release2()
+	release3()
+	// the release is idempotent
+	release3()
+	assert.NotContains(t, memory.leases, concurrencyKey(4))
+}
+
+func TestAcquireExpiredLease(t *testing.T) {
+	disableRedis(t)
+	ctx := context.Background()
+
+	release, ok := Acquire(ctx, 5, 1)
+	require.True(t, ok)
+	defer release()
+	_, ok = Acquire(ctx, 5, 1)
+	require.False(t, ok)
+
+	// the leaked slot is released once its lease is not renewed in time
+	memory.mu.Lock()
+	for id := range memory.leases[concurrencyKey(5)] {
+		memory.leases[concurrencyKey(5)][id] = time.Now().Add(-time.Second)
+	}
+	memory.mu.Unlock()
+	release2, ok := Acquire(ctx, 5, 1)
+	require.True(t, ok)
+	release2()
+}
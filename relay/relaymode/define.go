@@ -17,4 +17,10 @@ const (
 	ImagesEdits
 	// ResponseAPI is for OpenAI Response API direct requests
 	ResponseAPI
+	// ClaudeMessages is for Anthropic Messages API native requests
+	ClaudeMessages
+	// Realtime is for OpenAI Realtime API WebSocket sessions
+	Realtime
+	// VideoGenerations creates the asynchronous video tasks
+	VideoGenerations
 )
@@ -8,6 +8,12 @@ func GetByPath(path string) int {
 		relayMode = Proxy
 	} else if strings.HasPrefix(path, "/v1/responses") {
 		relayMode = ResponseAPI
+	} else if strings.HasPrefix(path, "/v1/videos") {
+		relayMode = VideoGenerations
+	} else if strings.HasPrefix(path, "/v1/realtime") {
+		relayMode = Realtime
+	} else if strings.HasPrefix(path, "/v1/messages") {
+		relayMode = ClaudeMessages
 	} else if strings.HasPrefix(path, "/v1/chat/completions") {
 		relayMode = ChatCompletions
 	} else if strings.HasPrefix(path, "/v1/completions") {
@@ -4,6 +4,7 @@ import (
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/controller/auth"
 	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -30,7 +31,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
-		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/topup", middleware.PermissionAuth(model.PermissionUserManage), controller.AdminTopUp)
 
 		userRoute := apiRouter.Group("/user")
 		{
@@ -54,56 +55,77 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/totp/setup", controller.SetupTotp)
 				selfRoute.POST("/totp/confirm", controller.ConfirmTotp)
 				selfRoute.POST("/totp/disable", controller.DisableTotp)
+				selfRoute.GET("/notification", controller.GetNotifications)
+				selfRoute.GET("/notification/preference", controller.GetNotificationPreference)
+				selfRoute.PUT("/notification/preference", controller.UpdateNotificationPreference)
+				selfRoute.POST("/notification/test", controller.TestNotification)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
-				adminRoute.POST("/totp/disable/:id", controller.AdminDisableUserTotp)
+				userRead := middleware.PermissionAuth(model.PermissionUserRead)
+				userManage := middleware.PermissionAuth(model.PermissionUserManage)
+				adminRoute.GET("/", userRead, controller.GetAllUsers)
+				adminRoute.GET("/search", userRead, controller.SearchUsers)
+				adminRoute.GET("/:id", userRead, controller.GetUser)
+				adminRoute.POST("/", userManage, controller.CreateUser)
+				adminRoute.POST("/manage", userManage, controller.ManageUser)
+				adminRoute.PUT("/", userManage, controller.UpdateUser)
+				adminRoute.DELETE("/:id", userManage, controller.DeleteUser)
+				adminRoute.POST("/totp/disable/:id", userManage, controller.AdminDisableUserTotp)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/", middleware.PermissionAuth(model.PermissionOptionRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.PermissionAuth(model.PermissionOptionWrite), controller.UpdateOption)
+		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(model.PermissionRoleManage))
+		{
+			roleRoute.GET("/", controller.GetAllRoles)
+			roleRoute.GET("/permissions", controller.GetPermissions)
+			roleRoute.POST("/", controller.CreateRole)
+			roleRoute.PUT("/", controller.UpdateRole)
+			roleRoute.DELETE("/:id", controller.DeleteRole)
+			roleRoute.PUT("/user", controller.SetUserRole)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ListAllModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.GET("/pricing/:id", controller.GetChannelPricing)
-			channelRoute.GET("/default-pricing", controller.GetChannelDefaultPricing)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.PUT("/pricing/:id", controller.UpdateChannelPricing)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
+			channelRead := middleware.PermissionAuth(model.PermissionChannelRead)
+			channelWrite := middleware.PermissionAuth(model.PermissionChannelWrite)
+			channelRoute.GET("/", channelRead, controller.GetAllChannels)
+			channelRoute.GET("/search", channelRead, controller.SearchChannels)
+			channelRoute.GET("/models", channelRead, controller.ListAllModels)
+			channelRoute.GET("/:id", channelRead, controller.GetChannel)
+			channelRoute.GET("/:id/key", middleware.PermissionAuth(model.PermissionChannelKeyReveal), controller.GetChannelKey)
+			channelRoute.GET("/:id/keys", channelRead, controller.GetChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id", channelWrite, controller.UpdateChannelKeyStatus)
+			channelRoute.GET("/test", channelWrite, controller.TestChannels)
+			channelRoute.GET("/test/:id", channelWrite, controller.TestChannel)
+			channelRoute.GET("/update_balance", channelWrite, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelWrite, controller.UpdateChannelBalance)
+			channelRoute.GET("/pricing/:id", channelRead, controller.GetChannelPricing)
+			channelRoute.GET("/default-pricing", channelRead, controller.GetChannelDefaultPricing)
+			channelRoute.GET("/circuit_breaker/:id", channelRead, controller.GetChannelCircuitBreakers)
+			channelRoute.POST("/", channelWrite, controller.AddChannel)
+			channelRoute.PUT("/", channelWrite, controller.UpdateChannel)
+			channelRoute.PUT("/pricing/:id", channelWrite, controller.UpdateChannelPricing)
+			channelRoute.DELETE("/circuit_breaker/:id", channelWrite, controller.ResetChannelCircuitBreakers)
+			channelRoute.DELETE("/disabled", channelWrite, controller.DeleteDisabledChannel)
+			channelRoute.DELETE("/:id", channelWrite, controller.DeleteChannel)
 		}
 		debugRoute := apiRouter.Group("/debug")
-		debugRoute.Use(middleware.AdminAuth())
 		{
-			debugRoute.POST("/channel/:id/debug", controller.DebugChannelModelConfigs)
-			debugRoute.GET("/channels", controller.DebugAllChannelModelConfigs)
-			debugRoute.POST("/channel/:id/fix", controller.FixChannelModelConfigs)
-			debugRoute.GET("/channels/validate", controller.ValidateAllChannelModelConfigs)
-			debugRoute.POST("/channels/remigrate", controller.RemigratAllChannels)
-			debugRoute.GET("/channel/:id/migration-status", controller.GetChannelMigrationStatus)
-			debugRoute.POST("/channels/clean", controller.CleanAllMixedModelData)
+			channelRead := middleware.PermissionAuth(model.PermissionChannelRead)
+			channelWrite := middleware.PermissionAuth(model.PermissionChannelWrite)
+			debugRoute.POST("/channel/:id/debug", channelRead, controller.DebugChannelModelConfigs)
+			debugRoute.GET("/channels", channelRead, controller.DebugAllChannelModelConfigs)
+			debugRoute.POST("/channel/:id/fix", channelWrite, controller.FixChannelModelConfigs)
+			debugRoute.GET("/channels/validate", channelRead, controller.ValidateAllChannelModelConfigs)
+			debugRoute.POST("/channels/remigrate", channelWrite, controller.RemigratAllChannels)
+			debugRoute.GET("/channel/:id/migration-status", channelRead, controller.GetChannelMigrationStatus)
+			debugRoute.POST("/channels/clean", channelWrite, controller.CleanAllMixedModelData)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -116,30 +138,81 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 			apiRouter.POST("/token/consume", middleware.TokenAuth(), controller.ConsumeToken)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/", controller.GetUserOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.POST("/:id/topup", controller.TopUpOrganization)
+			organizationRoute.GET("/:id/member", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/member", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/member", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/member/:user_id", controller.RemoveOrganizationMember)
+			organizationRoute.GET("/:id/token", controller.GetOrganizationTokens)
+			organizationAdminRoute := organizationRoute.Group("/")
+			organizationAdminRoute.Use(middleware.PermissionAuth(model.PermissionOrganizationManage))
+			{
+				organizationAdminRoute.GET("/all", controller.GetAllOrganizations)
+				organizationAdminRoute.PUT("/:id/quota", controller.SetOrganizationQuota)
+			}
+		}
+		webhookRoute := apiRouter.Group("/webhook")
+		webhookRoute.Use(middleware.UserAuth())
+		{
+			webhookRoute.GET("/", controller.GetWebhooks)
+			webhookRoute.GET("/events", controller.GetWebhookEvents)
+			webhookRoute.POST("/", controller.AddWebhook)
+			webhookRoute.PUT("/", controller.UpdateWebhook)
+			webhookRoute.DELETE("/:id", controller.DeleteWebhook)
+			webhookRoute.GET("/:id/deliveries", controller.GetWebhookDeliveries)
+			webhookRoute.POST("/:id/test", controller.TestWebhook)
+			globalWebhookRoute := webhookRoute.Group("/global")
+			globalWebhookRoute.Use(middleware.PermissionAuth(model.PermissionWebhookManage))
+			{
+				globalWebhookRoute.GET("/", controller.GetGlobalWebhooks)
+				globalWebhookRoute.POST("/", controller.AddGlobalWebhook)
+				globalWebhookRoute.PUT("/", controller.UpdateGlobalWebhook)
+				globalWebhookRoute.DELETE("/:id", controller.DeleteGlobalWebhook)
+				globalWebhookRoute.GET("/:id/deliveries", controller.GetGlobalWebhookDeliveries)
+				globalWebhookRoute.POST("/:id/test", controller.TestGlobalWebhook)
+			}
+		}
 		costRoute := apiRouter.Group("/cost")
 		{
 			costRoute.GET("/request/:request_id", controller.GetRequestCost)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRead := middleware.PermissionAuth(model.PermissionRedemptionRead)
+			redemptionCreate := middleware.PermissionAuth(model.PermissionRedemptionCreate)
+			redemptionRoute.GET("/", redemptionRead, controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", redemptionRead, controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", redemptionRead, controller.GetRedemption)
+			redemptionRoute.POST("/", redemptionCreate, controller.AddRedemption)
+			redemptionRoute.PUT("/", redemptionCreate, controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", redemptionCreate, controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(model.PermissionLogRead), controller.GetAllLogs)
+		logRoute.GET("/export", middleware.PermissionAuth(model.PermissionLogRead), controller.ExportLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(model.PermissionLogDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(model.PermissionLogRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/analytics", middleware.PermissionAuth(model.PermissionLogRead), controller.GetLogAnalytics)
+		logRoute.GET("/self/analytics", middleware.UserAuth(), controller.GetSelfLogAnalytics)
+		logRoute.GET("/search", middleware.PermissionAuth(model.PermissionLogRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.PermissionAuth(model.PermissionAuditRead))
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(model.PermissionChannelRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
@@ -17,33 +17,68 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("", controller.ListModels)
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
+	// files are saved by one-api itself, so no channel is needed
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.GlobalRelayRateLimit())
+	{
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+	}
+	// batches are executed in background by one-api, the channels are selected for each request
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.GlobalRelayRateLimit())
+	{
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
+	// stored responses are routed to the channel that created them, instead of selecting by model
+	responsesRouter := router.Group("/v1/responses/:response_id")
+	responsesRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.GlobalRelayRateLimit())
+	{
+		responsesRouter.GET("", controller.RetrieveResponse)
+		responsesRouter.DELETE("", controller.DeleteResponse)
+		responsesRouter.POST("/cancel", controller.CancelResponse)
+	}
+	// video tasks are fetched from the channel that created them
+	videosRouter := router.Group("/v1/videos/:video_id")
+	videosRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.GlobalRelayRateLimit())
+	{
+		videosRouter.GET("", controller.RetrieveVideo)
+		videosRouter.GET("/content", controller.RetrieveVideoContent)
+	}
+	// tasks of any type are synced from the channel that created them
+	tasksRouter := router.Group("/v1/tasks/:task_id")
+	tasksRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.GlobalRelayRateLimit())
+	{
+		tasksRouter.GET("", controller.RetrieveTask)
+	}
 	relayV1Router := router.Group("/v1")
-	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+	relayV1Router.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.TokenRateLimit(), middleware.Distribute())
 	relayV1Router.Use(middleware.GlobalRelayRateLimit())
 	relayV1Router.Use(middleware.ChannelRateLimit())
 	{
 		relayV1Router.Any("/oneapi/proxy/:channelid/*target", controller.Relay)
 		relayV1Router.POST("/completions", controller.Relay)
 		relayV1Router.POST("/chat/completions", controller.Relay)
+		relayV1Router.POST("/messages", controller.Relay)
 		relayV1Router.POST("/responses", controller.Relay)
-		relayV1Router.GET("/responses/:response_id", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/responses/:response_id", controller.RelayNotImplemented)
-		relayV1Router.POST("/responses/:response_id/cancel", controller.RelayNotImplemented)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
 		relayV1Router.POST("/images/edits", controller.Relay)
 		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/rerank", controller.Relay)
+		relayV1Router.GET("/realtime", controller.Relay)
+		relayV1Router.POST("/videos", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)